@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/listbackup/api/internal/services"
+)
+
+const defaultManifests = "catalog/platforms"
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: catalog <command> [flags] [manifest files or directories]
+
+Commands:
+  validate  check manifests without touching the catalog
+  diff      show what applying the manifests would change
+  apply     upsert the platforms and publish their platform sources
+
+Manifests default to %s.
+
+Flags for apply:
+  -migrate  upgrade existing sources of every platform source that was published
+`, defaultManifests)
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	command := os.Args[1]
+	if command != "validate" && command != "diff" && command != "apply" {
+		usage()
+		os.Exit(2)
+	}
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.Usage = usage
+	migrate := flags.Bool("migrate", false, "upgrade existing sources after publishing")
+	flags.Parse(os.Args[2:])
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{defaultManifests}
+	}
+	manifests, err := services.LoadManifests(paths)
+	if err != nil {
+		log.Fatalf("Failed to load manifests: %v", err)
+	}
+	if len(manifests) == 0 {
+		log.Fatalf("No manifests found in %s", strings.Join(paths, ", "))
+	}
+
+	if problems := services.ValidateManifests(manifests); len(problems) > 0 {
+		for _, problem := range problems {
+			log.Println(problem)
+		}
+		log.Fatalf("%d problems found in %d manifests", len(problems), len(manifests))
+	}
+
+	ctx := context.Background()
+	switch command {
+	case "validate":
+		log.Printf("%d manifests are valid", len(manifests))
+
+	case "diff":
+		catalog := newCatalog(ctx)
+		for _, manifest := range manifests {
+			diff, err := catalog.DiffManifest(ctx, manifest)
+			if err != nil {
+				log.Fatalf("Failed to diff %s: %v", manifest.File, err)
+			}
+			if diff.Empty() {
+				log.Printf("%s: %s is up to date", manifest.File, manifest.Platform.PlatformID)
+			}
+			printJSON(diff)
+		}
+
+	case "apply":
+		catalog := newCatalog(ctx)
+		failed := false
+		for _, manifest := range manifests {
+			result, err := catalog.ApplyManifest(ctx, manifest)
+			if err != nil {
+				log.Printf("Failed to apply %s: %v", manifest.File, err)
+				failed = true
+				continue
+			}
+			printJSON(result)
+
+			if !*migrate {
+				continue
+			}
+			for _, source := range result.Sources {
+				if source.Status != "published" {
+					continue
+				}
+				report, err := catalog.MigrateSources(ctx, source.PlatformSourceID, false)
+				if err != nil {
+					log.Printf("Failed to migrate sources of %s: %v", source.PlatformSourceID, err)
+					failed = true
+					continue
+				}
+				printJSON(report)
+				if report.Failed > 0 {
+					failed = true
+				}
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	}
+}
+
+func newCatalog(ctx context.Context) *services.CatalogService {
+	catalog, err := services.NewCatalogService(ctx)
+	if err != nil {
+		log.Fatalf("Failed to create catalog service: %v", err)
+	}
+	return catalog
+}
+
+func printJSON(value interface{}) {
+	out, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to marshal output: %v", err)
+	}
+	fmt.Println(string(out))
+}
@@ -13,12 +13,14 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/listbackup/api/internal/services"
 	apitypes "github.com/listbackup/api/internal/types"
 	"github.com/listbackup/api/pkg/response"
 )
 
 type DeleteAccountHandler struct {
-	db *dynamodb.DynamoDB
+	db         *dynamodb.DynamoDB
+	legalHolds *services.LegalHoldService
 }
 
 func NewDeleteAccountHandler(ctx context.Context) (*DeleteAccountHandler, error) {
@@ -27,8 +29,14 @@ func NewDeleteAccountHandler(ctx context.Context) (*DeleteAccountHandler, error)
 		return nil, fmt.Errorf("failed to create AWS session: %v", err)
 	}
 
+	legalHolds, err := services.NewLegalHoldService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create legal hold service: %v", err)
+	}
+
 	return &DeleteAccountHandler{
-		db: dynamodb.New(sess),
+		db:         dynamodb.New(sess),
+		legalHolds: legalHolds,
 	}, nil
 }
 
@@ -71,6 +79,15 @@ func (h *DeleteAccountHandler) Handle(ctx context.Context, event events.APIGatew
 	}
 
 
+	// Legal holds always win over deletion requests
+	blocker, err := h.legalHolds.AccountDeletionBlocker(ctx, account)
+	if err != nil {
+		log.Printf("Failed to check legal holds: %v", err)
+		return response.InternalServerError("Failed to check legal holds"), nil
+	} else if blocker != "" {
+		return response.Conflict(fmt.Sprintf("Cannot delete account: %s", blocker)), nil
+	}
+
 	// Check for sub-accounts (prevent deletion if there are children)
 	hasSubAccounts, err := h.hasSubAccounts(ctx, accountId)
 	if err != nil {
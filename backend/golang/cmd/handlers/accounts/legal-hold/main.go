@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/listbackup/api/internal/services"
+	"github.com/listbackup/api/pkg/response"
+)
+
+type LegalHoldHandler struct {
+	accountService *services.AccountService
+	legalHolds     *services.LegalHoldService
+}
+
+type LegalHoldRequest struct {
+	Action     string `json:"action"`     // place|release
+	Scope      string `json:"scope"`      // account|source|snapshot
+	ResourceID string `json:"resourceId"` // Defaults to the account for account scope
+	Reason     string `json:"reason"`
+}
+
+func NewLegalHoldHandler(ctx context.Context) (*LegalHoldHandler, error) {
+	accountService, err := services.NewAccountService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create account service: %v", err)
+	}
+
+	legalHolds, err := services.NewLegalHoldService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create legal hold service: %v", err)
+	}
+
+	return &LegalHoldHandler{
+		accountService: accountService,
+		legalHolds:     legalHolds,
+	}, nil
+}
+
+func (h *LegalHoldHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	accountID := event.PathParameters["accountId"]
+	if accountID == "" {
+		return response.BadRequest("Account ID is required"), nil
+	}
+	if !strings.HasPrefix(accountID, "account:") {
+		accountID = "account:" + accountID
+	}
+
+	// Extract user ID from JWT claims
+	userID := ""
+	if authContext := event.RequestContext.Authorizer; authContext != nil {
+		if jwt, ok := authContext["jwt"].(map[string]interface{}); ok {
+			if claims, ok := jwt["claims"].(map[string]interface{}); ok {
+				if sub, exists := claims["sub"].(string); exists {
+					userID = "user:" + sub
+				}
+			}
+		}
+	}
+
+	if userID == "" {
+		return response.Unauthorized("User not authenticated"), nil
+	}
+
+	var req LegalHoldRequest
+	if err := json.Unmarshal([]byte(event.Body), &req); err != nil {
+		return response.BadRequest("Invalid request body"), nil
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		return response.BadRequest("A reason is required"), nil
+	}
+	if req.Scope == "" {
+		req.Scope = services.LegalHoldScopeAccount
+	}
+	if req.Scope == services.LegalHoldScopeAccount {
+		req.ResourceID = accountID
+	}
+
+	userAccount, err := h.accountService.ValidateAccountAccess(ctx, userID, accountID)
+	if err != nil {
+		log.Printf("User %s cannot access account %s: %v", userID, accountID, err)
+		return response.Forbidden("You do not have access to this account"), nil
+	}
+
+	switch req.Action {
+	case "place":
+		if !userAccount.Permissions.CanModifySettings {
+			return response.Forbidden("You do not have permission to place legal holds"), nil
+		}
+
+		hold, err := h.legalHolds.PlaceHold(ctx, accountID, req.Scope, req.ResourceID, userID, req.Reason)
+		if err != nil {
+			log.Printf("Failed to place legal hold: %v", err)
+			return response.BadRequest(err.Error()), nil
+		}
+		return response.Success(map[string]interface{}{
+			"scope":      req.Scope,
+			"resourceId": strings.TrimPrefix(req.ResourceID, req.Scope+":"),
+			"legalHold":  hold,
+		}), nil
+
+	case "release":
+		// Releasing a hold re-enables deletion, so it needs the stronger permission
+		if !userAccount.Permissions.CanDeleteAccount {
+			return response.Forbidden("You do not have permission to release legal holds"), nil
+		}
+
+		hold, err := h.legalHolds.ReleaseHold(ctx, accountID, req.Scope, req.ResourceID, userID, req.Reason)
+		if err != nil {
+			log.Printf("Failed to release legal hold: %v", err)
+			return response.BadRequest(err.Error()), nil
+		}
+		return response.Success(map[string]interface{}{
+			"scope":      req.Scope,
+			"resourceId": strings.TrimPrefix(req.ResourceID, req.Scope+":"),
+			"legalHold":  hold,
+		}), nil
+
+	default:
+		return response.BadRequest("Action must be place or release"), nil
+	}
+}
+
+func main() {
+	handler, err := NewLegalHoldHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create legal hold handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
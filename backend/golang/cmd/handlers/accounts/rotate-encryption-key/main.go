@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/listbackup/api/internal/database"
+	"github.com/listbackup/api/internal/services"
+	apitypes "github.com/listbackup/api/internal/types"
+	"github.com/listbackup/api/pkg/response"
+)
+
+type RotateEncryptionKeyHandler struct {
+	db             *database.DynamoDBClient
+	accountService *services.AccountService
+	snapshots      *services.SnapshotService
+}
+
+func NewRotateEncryptionKeyHandler(ctx context.Context) (*RotateEncryptionKeyHandler, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	accountService, err := services.NewAccountService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create account service: %v", err)
+	}
+
+	snapshots, err := services.NewSnapshotService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot service: %v", err)
+	}
+
+	return &RotateEncryptionKeyHandler{
+		db:             db,
+		accountService: accountService,
+		snapshots:      snapshots,
+	}, nil
+}
+
+func (h *RotateEncryptionKeyHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	accountID := event.PathParameters["accountId"]
+	if accountID == "" {
+		return response.BadRequest("Account ID is required"), nil
+	}
+	if !strings.HasPrefix(accountID, "account:") {
+		accountID = "account:" + accountID
+	}
+
+	// Extract user ID from JWT claims
+	userID := ""
+	if authContext := event.RequestContext.Authorizer; authContext != nil {
+		if jwt, ok := authContext["jwt"].(map[string]interface{}); ok {
+			if claims, ok := jwt["claims"].(map[string]interface{}); ok {
+				if sub, exists := claims["sub"].(string); exists {
+					userID = "user:" + sub
+				}
+			}
+		}
+	}
+
+	if userID == "" {
+		return response.Unauthorized("User not authenticated"), nil
+	}
+
+	userAccount, err := h.accountService.ValidateAccountAccess(ctx, userID, accountID)
+	if err != nil {
+		log.Printf("User %s cannot access account %s: %v", userID, accountID, err)
+		return response.Forbidden("You do not have access to this account"), nil
+	}
+	if !userAccount.Permissions.CanModifySettings {
+		return response.Forbidden("You do not have permission to manage encryption for this account"), nil
+	}
+
+	account, err := h.accountService.GetAccountByID(ctx, accountID)
+	if err != nil {
+		log.Printf("Failed to get account %s: %v", accountID, err)
+		return response.NotFound("Account not found"), nil
+	}
+
+	if !account.Settings.EncryptionEnabled {
+		return response.BadRequest("Encryption is not enabled for this account"), nil
+	}
+
+	previousKeyID := account.Settings.EncryptionKeyID
+	newKeyID, rewrapped, err := h.snapshots.RotateAccountKey(ctx, account)
+	if err != nil {
+		log.Printf("Key rotation for %s failed after %d snapshots: %v", accountID, rewrapped, err)
+		h.logActivity(ctx, accountID, userID, "error", fmt.Sprintf("Encryption key rotation failed after rewrapping %d snapshot keys", rewrapped))
+		return response.InternalServerError("Failed to rotate encryption key"), nil
+	}
+
+	h.logActivity(ctx, accountID, userID, "success", fmt.Sprintf("Rotated encryption key, rewrapped %d snapshot keys", rewrapped))
+
+	return response.Success(map[string]interface{}{
+		"accountId":          strings.TrimPrefix(accountID, "account:"),
+		"previousKeyId":      previousKeyID,
+		"keyId":              newKeyID,
+		"rewrappedSnapshots": rewrapped,
+	}), nil
+}
+
+func (h *RotateEncryptionKeyHandler) logActivity(ctx context.Context, accountID, userID, status, message string) {
+	activity := apitypes.Activity{
+		EventID:   fmt.Sprintf("activity:%d:%s", time.Now().UnixNano()/1000000, generateRandomString(9)),
+		AccountID: accountID,
+		UserID:    userID,
+		Type:      "security",
+		Action:    "rotate_encryption_key",
+		Status:    status,
+		Message:   message,
+		Timestamp: time.Now().UnixNano() / 1000000,
+		TTL:       time.Now().Add(90 * 24 * time.Hour).Unix(),
+	}
+
+	if err := h.db.PutItem(ctx, database.ActivityTable, activity); err != nil {
+		log.Printf("Failed to log activity: %v", err)
+	}
+}
+
+func generateRandomString(length int) string {
+	const charset = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = charset[time.Now().UnixNano()%int64(len(charset))]
+	}
+	return string(b)
+}
+
+func main() {
+	handler, err := NewRotateEncryptionKeyHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create rotate encryption key handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
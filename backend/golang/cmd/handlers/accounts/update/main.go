@@ -14,6 +14,8 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/listbackup/api/internal/compression"
+	"github.com/listbackup/api/internal/services"
 	apitypes "github.com/listbackup/api/internal/types"
 	internalutils "github.com/listbackup/api/internal/utils"
 	"github.com/listbackup/api/pkg/response"
@@ -106,6 +108,13 @@ func (h *UpdateAccountHandler) Handle(ctx context.Context, event events.APIGatew
 	}
 
 	if updateReq.Settings != nil {
+		if updateReq.Settings.Compression != "" && !compression.IsCodec(updateReq.Settings.Compression) {
+			return response.BadRequest("settings.compression must be gzip, zstd or none"), nil
+		}
+		if err := services.ValidateMaskingRules(nil, updateReq.Settings.Masking); err != nil {
+			return response.BadRequest(err.Error()), nil
+		}
+
 		// Convert settings to DynamoDB format
 		settingsItem, err := dynamodbattribute.MarshalMap(*updateReq.Settings)
 		if err != nil {
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/listbackup/api/internal/services"
+	"github.com/listbackup/api/pkg/response"
+)
+
+type CreateLinkHandler struct {
+	downloads *services.DownloadService
+}
+
+type CreateLinkRequest struct {
+	ExpiresIn  int      `json:"expiresIn,omitempty"` // Seconds
+	SingleUse  bool     `json:"singleUse,omitempty"`
+	AllowedIPs []string `json:"allowedIps,omitempty"`
+}
+
+func NewCreateLinkHandler(ctx context.Context) (*CreateLinkHandler, error) {
+	downloads, err := services.NewDownloadService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download service: %v", err)
+	}
+
+	return &CreateLinkHandler{downloads: downloads}, nil
+}
+
+func (h *CreateLinkHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var userID, accountID string
+	if authLambda, ok := event.RequestContext.Authorizer["lambda"].(map[string]interface{}); ok {
+		if uid, exists := authLambda["userId"].(string); exists {
+			userID = uid
+		}
+		if aid, exists := authLambda["accountId"].(string); exists {
+			accountID = aid
+		}
+	}
+
+	if userID == "" || accountID == "" {
+		return response.Unauthorized("User not authenticated"), nil
+	}
+
+	fileID := event.PathParameters["fileId"]
+	if fileID == "" {
+		return response.BadRequest("File ID is required"), nil
+	}
+
+	var req CreateLinkRequest
+	if event.Body != "" {
+		if err := json.Unmarshal([]byte(event.Body), &req); err != nil {
+			return response.BadRequest("Invalid request body"), nil
+		}
+	}
+
+	file, err := h.downloads.GetFile(ctx, accountID, fileID)
+	if err != nil {
+		log.Printf("Failed to get file: %v", err)
+		return response.NotFound("File not found"), nil
+	}
+
+	link, token, err := h.downloads.CreateLink(ctx, file, userID, services.LinkOptions{
+		ExpiresIn:  time.Duration(req.ExpiresIn) * time.Second,
+		SingleUse:  req.SingleUse,
+		AllowedIPs: req.AllowedIPs,
+	})
+	if err != nil {
+		var validationErr *services.ValidationError
+		if errors.As(err, &validationErr) {
+			return response.BadRequest(err.Error()), nil
+		}
+		log.Printf("Failed to create download link: %v", err)
+		return response.InternalServerError("Failed to create download link"), nil
+	}
+
+	log.Printf("Created download link for file %s in account %s", file.FileID, accountID)
+
+	return response.Created(map[string]interface{}{
+		"url":        fmt.Sprintf("https://%s/data/links/%s", event.RequestContext.DomainName, token),
+		"linkId":     link.LinkID,
+		"fileId":     strings.TrimPrefix(link.FileID, "file:"),
+		"fileName":   file.Path,
+		"expiresAt":  link.ExpiresAt,
+		"singleUse":  link.SingleUse,
+		"allowedIps": link.AllowedIPs,
+	}), nil
+}
+
+func main() {
+	handler, err := NewCreateLinkHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create create link handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
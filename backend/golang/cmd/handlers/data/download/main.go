@@ -2,27 +2,31 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/listbackup/api/internal/compression"
 	"github.com/listbackup/api/internal/database"
+	"github.com/listbackup/api/internal/services"
 	apitypes "github.com/listbackup/api/internal/types"
 	"github.com/listbackup/api/pkg/response"
 )
 
+const (
+	defaultExpiresIn = 3600
+	minExpiresIn     = 60
+	maxExpiresIn     = 12 * 3600
+)
+
 type DownloadDataHandler struct {
-	db       *database.DynamoDBClient
-	s3Client *s3.Client
-	s3Bucket string
+	db        *database.DynamoDBClient
+	downloads *services.DownloadService
 }
 
 func NewDownloadDataHandler(ctx context.Context) (*DownloadDataHandler, error) {
@@ -31,114 +35,118 @@ func NewDownloadDataHandler(ctx context.Context) (*DownloadDataHandler, error) {
 		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
 	}
 
-	cfg, err := config.LoadDefaultConfig(ctx)
+	downloads, err := services.NewDownloadService(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load AWS config: %v", err)
-	}
-
-	s3Client := s3.NewFromConfig(cfg)
-	s3Bucket := os.Getenv("S3_BUCKET")
-	if s3Bucket == "" {
-		s3Bucket = "listbackup-data-main" // fallback
+		return nil, fmt.Errorf("failed to create download service: %v", err)
 	}
 
 	return &DownloadDataHandler{
-		db:       db,
-		s3Client: s3Client,
-		s3Bucket: s3Bucket,
+		db:        db,
+		downloads: downloads,
 	}, nil
 }
 
 func (h *DownloadDataHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	accountID := "account:default"
-	userID := "user:default"
+	var userID, accountID string
+	if authLambda, ok := event.RequestContext.Authorizer["lambda"].(map[string]interface{}); ok {
+		if uid, exists := authLambda["userId"].(string); exists {
+			userID = uid
+		}
+		if aid, exists := authLambda["accountId"].(string); exists {
+			accountID = aid
+		}
+	}
+
+	if userID == "" || accountID == "" {
+		return response.Unauthorized("User not authenticated"), nil
+	}
+
 	log.Printf("Download data request for accountId: %s", accountID)
-	
+
 	// Get fileId from path parameters
 	fileID := event.PathParameters["fileId"]
 	if fileID == "" {
 		return response.BadRequest("File ID is required"), nil
 	}
-	
-	// Add file: prefix for DynamoDB lookup
-	fullFileID := "file:" + fileID
-	
-	// Get file metadata from DynamoDB
-	fileIDAttr, err := attributevalue.Marshal(fullFileID)
-	if err != nil {
-		log.Printf("Failed to marshal fileID: %v", err)
-		return response.InternalServerError("Failed to process request"), nil
+
+	expiresIn := defaultExpiresIn
+	if value := event.QueryStringParameters["expiresIn"]; value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < minExpiresIn || parsed > maxExpiresIn {
+			return response.BadRequest(fmt.Sprintf("expiresIn must be between %d and %d seconds", minExpiresIn, maxExpiresIn)), nil
+		}
+		expiresIn = parsed
 	}
-	
-	var file apitypes.File
-	err = h.db.GetItem(ctx, database.FilesTable, map[string]types.AttributeValue{
-		"fileId": fileIDAttr,
-	}, &file)
+
+	// Clients that cannot decode the stored codec get plain JSON; ?encoding=identity asks
+	// for it explicitly
+	acceptEncoding := header(event.Headers, "Accept-Encoding")
+	if value := event.QueryStringParameters["encoding"]; value != "" {
+		if value != "identity" && !compression.IsCodec(value) {
+			return response.BadRequest("encoding must be identity, gzip or zstd"), nil
+		}
+		acceptEncoding = value
+	}
+
+	file, err := h.downloads.GetFile(ctx, accountID, fileID)
 	if err != nil {
 		log.Printf("Failed to get file: %v", err)
 		return response.NotFound("File not found"), nil
 	}
-	
-	// Verify file belongs to the authenticated account
-	if file.AccountID != accountID {
-		return response.NotFound("File not found"), nil
+
+	url, contentEncoding, err := h.downloads.PresignFile(ctx, file, time.Duration(expiresIn)*time.Second, acceptEncoding)
+	if errors.Is(err, services.ErrObjectArchived) {
+		return h.rehydrate(ctx, file, userID)
 	}
-	
-	// Generate presigned URL for S3 download
-	presignClient := s3.NewPresignClient(h.s3Client)
-	request, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(h.s3Bucket),
-		Key:    aws.String(file.S3Key),
-	}, func(opts *s3.PresignOptions) {
-		opts.Expires = time.Duration(3600 * time.Second) // 1 hour
-	})
 	if err != nil {
-		log.Printf("Failed to generate presigned URL: %v", err)
+		log.Printf("Failed to prepare download for %s: %v", file.FileID, err)
 		return response.InternalServerError("Failed to generate download URL"), nil
 	}
-	
+
 	// Log download activity
-	err = h.logActivity(ctx, accountID, userID, "data", "download_success", fmt.Sprintf("Downloaded file: %s", file.Path))
+	err = services.LogActivity(ctx, h.db, accountID, userID, "data", "download_success", "success", fmt.Sprintf("Downloaded file: %s", file.Path))
 	if err != nil {
 		log.Printf("Failed to log activity: %v", err)
 	}
-	
+
 	return response.Success(map[string]interface{}{
-		"downloadUrl": request.URL,
-		"expiresIn":   3600,
-		"fileName":    file.Path,
-		"size":        file.Size,
-		"contentType": file.ContentType,
+		"downloadUrl":     url,
+		"expiresIn":       expiresIn,
+		"fileName":        file.Path,
+		"size":            file.Size,
+		"contentType":     file.ContentType,
+		"contentEncoding": contentEncoding,
 	}), nil
 }
 
-func (h *DownloadDataHandler) logActivity(ctx context.Context, accountID, userID, activityType, action, message string) error {
-	eventID := fmt.Sprintf("activity:%d:%s", time.Now().UnixNano()/1000000, generateRandomString(9))
-	timestamp := time.Now().UnixNano() / 1000000 // Unix timestamp in milliseconds
-	ttl := time.Now().Add(90 * 24 * time.Hour).Unix()
-
-	activity := apitypes.Activity{
-		EventID:   eventID,
-		AccountID: accountID,
-		UserID:    userID,
-		Type:      activityType,
-		Action:    action,
-		Status:    "success",
-		Message:   message,
-		Timestamp: timestamp,
-		TTL:       ttl,
+// rehydrate starts restoring an archived file and tells the client to wait for the
+// notification that it is ready
+func (h *DownloadDataHandler) rehydrate(ctx context.Context, file *apitypes.File, userID string) (events.APIGatewayProxyResponse, error) {
+	rehydration, err := h.downloads.RequestRehydration(ctx, file, userID)
+	if err != nil {
+		log.Printf("Failed to request rehydration of %s: %v", file.FileID, err)
+		return response.InternalServerError("Failed to restore archived file"), nil
 	}
 
-	return h.db.PutItem(ctx, database.ActivityTable, activity)
+	return response.Accepted(map[string]interface{}{
+		"status":      "rehydrating",
+		"message":     "This file is archived. It is being restored and you will be notified when it can be downloaded.",
+		"fileId":      file.FileID,
+		"fileName":    file.Path,
+		"storageTier": file.StorageTier,
+		"jobId":       rehydration.JobID,
+		"requestedAt": rehydration.RequestedAt,
+	}), nil
 }
 
-func generateRandomString(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyz0123456789"
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[time.Now().UnixNano()%int64(len(charset))]
+// header looks up a request header regardless of the case the gateway delivered it in
+func header(headers map[string]string, name string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
 	}
-	return string(b)
+	return ""
 }
 
 func main() {
@@ -148,4 +156,4 @@ func main() {
 	}
 
 	lambda.Start(handler.Handle)
-}
\ No newline at end of file
+}
@@ -2,74 +2,149 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/listbackup/api/internal/database"
+	"github.com/listbackup/api/internal/services"
 	apitypes "github.com/listbackup/api/internal/types"
+	"github.com/listbackup/api/internal/utils"
 	"github.com/listbackup/api/pkg/response"
 )
 
 type ListDataHandler struct {
-	db *database.DynamoDBClient
+	files *services.FileService
 }
 
 func NewListDataHandler(ctx context.Context) (*ListDataHandler, error) {
-	db, err := database.NewDynamoDBClient(ctx)
+	files, err := services.NewFileService(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+		return nil, fmt.Errorf("failed to create file service: %v", err)
 	}
 
-	return &ListDataHandler{db: db}, nil
+	return &ListDataHandler{files: files}, nil
 }
 
 func (h *ListDataHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	accountID := "account:default"
+	var userID, accountID string
+	if authLambda, ok := event.RequestContext.Authorizer["lambda"].(map[string]interface{}); ok {
+		if uid, exists := authLambda["userId"].(string); exists {
+			userID = uid
+		}
+		if aid, exists := authLambda["accountId"].(string); exists {
+			accountID = aid
+		}
+	}
+
+	if userID == "" || accountID == "" {
+		return response.Unauthorized("User not authenticated"), nil
+	}
+
 	log.Printf("List data request for accountId: %s", accountID)
-	
-	// Query files by accountId
-	accountIDAttr, err := attributevalue.Marshal(accountID)
+
+	filter, err := parseFilter(event.QueryStringParameters)
 	if err != nil {
-		log.Printf("Failed to marshal accountID: %v", err)
-		return response.InternalServerError("Failed to process request"), nil
-	}
-	
-	var fileList []apitypes.File
-	err = h.db.Query(ctx, database.FilesTable, "accountId = :accountId", map[string]types.AttributeValue{
-		":accountId": accountIDAttr,
-	}, &fileList)
-	
-	// If query fails, return empty list for now
+		return response.BadRequest(err.Error()), nil
+	}
+
+	fileList, nextToken, err := h.files.ListFiles(ctx, accountID, filter)
 	if err != nil {
-		log.Printf("Query failed, returning empty list: %v", err)
+		var validationErr *services.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			return response.BadRequest(err.Error()), nil
+		case errors.Is(err, database.ErrInvalidPageToken):
+			return response.BadRequest("Invalid nextToken"), nil
+		}
+		log.Printf("Failed to list files: %v", err)
+		return response.InternalServerError("Failed to list files"), nil
+	}
+	if fileList == nil {
 		fileList = []apitypes.File{}
 	}
-	
+
 	// Strip prefixes for API response
 	for i := range fileList {
-		if strings.HasPrefix(fileList[i].FileID, "file:") {
-			fileList[i].FileID = strings.TrimPrefix(fileList[i].FileID, "file:")
+		fileList[i].FileID = strings.TrimPrefix(fileList[i].FileID, "file:")
+		fileList[i].AccountID = strings.TrimPrefix(fileList[i].AccountID, "account:")
+		fileList[i].SourceID = strings.TrimPrefix(fileList[i].SourceID, "source:")
+		fileList[i].JobID = strings.TrimPrefix(fileList[i].JobID, "job:")
+		fileList[i].SnapshotID = strings.TrimPrefix(fileList[i].SnapshotID, "snapshot:")
+	}
+
+	result := map[string]interface{}{
+		"files": fileList,
+		"count": len(fileList),
+	}
+	if nextToken != "" {
+		result["nextToken"] = nextToken
+	}
+
+	return response.Success(result), nil
+}
+
+// parseFilter reads the listing filters from the query string. Dates are RFC 3339 or
+// YYYY-MM-DD; an inclusive "to" date covers the whole day.
+func parseFilter(params map[string]string) (services.FileFilter, error) {
+	filter := services.FileFilter{
+		SourceID:    params["sourceId"],
+		JobID:       params["jobId"],
+		SnapshotID:  params["snapshotId"],
+		ContentType: params["contentType"],
+		PathPrefix:  params["pathPrefix"],
+		NextToken:   params["nextToken"],
+		Limit:       50,
+		SortBy:      "createdAt",
+		Descending:  true,
+	}
+
+	if limitStr := params["limit"]; limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > 200 {
+			return filter, fmt.Errorf("limit must be between 1 and 200")
+		}
+		filter.Limit = int32(limit)
+	}
+
+	if sortBy := params["sortBy"]; sortBy != "" {
+		if sortBy != "createdAt" && sortBy != "path" {
+			return filter, fmt.Errorf("sortBy must be createdAt or path")
 		}
-		if strings.HasPrefix(fileList[i].AccountID, "account:") {
-			fileList[i].AccountID = strings.TrimPrefix(fileList[i].AccountID, "account:")
+		filter.SortBy = sortBy
+	}
+	if filter.SnapshotID != "" {
+		// Files within a snapshot are indexed by path
+		filter.SortBy = "path"
+		filter.Descending = false
+	}
+	if order := params["order"]; order != "" {
+		if order != "asc" && order != "desc" {
+			return filter, fmt.Errorf("order must be asc or desc")
 		}
-		if strings.HasPrefix(fileList[i].SourceID, "source:") {
-			fileList[i].SourceID = strings.TrimPrefix(fileList[i].SourceID, "source:")
+		filter.Descending = order == "desc"
+	}
+
+	if fromStr := params["from"]; fromStr != "" {
+		from, err := utils.ParseDate(fromStr, false)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from date: %s", fromStr)
 		}
-		if strings.HasPrefix(fileList[i].JobID, "job:") {
-			fileList[i].JobID = strings.TrimPrefix(fileList[i].JobID, "job:")
+		filter.From = &from
+	}
+	if toStr := params["to"]; toStr != "" {
+		to, err := utils.ParseDate(toStr, true)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to date: %s", toStr)
 		}
+		filter.To = &to
 	}
-	
-	return response.Success(map[string]interface{}{
-		"files": fileList,
-		"total": len(fileList),
-	}), nil
+
+	return filter, nil
 }
 
 func main() {
@@ -79,4 +154,4 @@ func main() {
 	}
 
 	lambda.Start(handler.Handle)
-}
\ No newline at end of file
+}
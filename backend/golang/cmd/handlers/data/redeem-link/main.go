@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/listbackup/api/internal/services"
+	"github.com/listbackup/api/pkg/response"
+)
+
+// RedeemLinkHandler serves shared download links. It is public: the link token is the
+// only credential, so restrictions are enforced by the download service.
+type RedeemLinkHandler struct {
+	downloads *services.DownloadService
+}
+
+func NewRedeemLinkHandler(ctx context.Context) (*RedeemLinkHandler, error) {
+	downloads, err := services.NewDownloadService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download service: %v", err)
+	}
+
+	return &RedeemLinkHandler{downloads: downloads}, nil
+}
+
+func (h *RedeemLinkHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	token := event.PathParameters["token"]
+	if token == "" {
+		return response.NotFound("Download link not found"), nil
+	}
+
+	identity := event.RequestContext.Identity
+	url, err := h.downloads.RedeemLink(ctx, token, identity.SourceIP, identity.UserAgent, header(event.Headers, "Accept-Encoding"))
+	switch {
+	case err == nil:
+		return response.Redirect(url), nil
+	case errors.Is(err, services.ErrLinkNotFound):
+		return response.NotFound("Download link not found"), nil
+	case errors.Is(err, services.ErrLinkExpired), errors.Is(err, services.ErrLinkUsed), errors.Is(err, services.ErrLinkFileGone):
+		return response.Gone(err.Error()), nil
+	case errors.Is(err, services.ErrLinkIPDenied):
+		return response.Forbidden(err.Error()), nil
+	case errors.Is(err, services.ErrLinkArchived):
+		return response.Accepted(map[string]interface{}{"message": err.Error()}), nil
+	}
+
+	log.Printf("Failed to redeem download link: %v", err)
+	return response.InternalServerError("Failed to prepare download"), nil
+}
+
+// header looks up a request header regardless of the case the gateway delivered it in
+func header(headers map[string]string, name string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+func main() {
+	handler, err := NewRedeemLinkHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create redeem link handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
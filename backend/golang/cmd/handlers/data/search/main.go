@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/listbackup/api/internal/services"
+	"github.com/listbackup/api/internal/utils"
+	"github.com/listbackup/api/pkg/response"
+)
+
+type SearchDataHandler struct {
+	search *services.SearchService
+}
+
+func NewSearchDataHandler(ctx context.Context) (*SearchDataHandler, error) {
+	search, err := services.NewSearchService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create search service: %v", err)
+	}
+
+	return &SearchDataHandler{search: search}, nil
+}
+
+func (h *SearchDataHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var userID, accountID string
+	if authLambda, ok := event.RequestContext.Authorizer["lambda"].(map[string]interface{}); ok {
+		if uid, exists := authLambda["userId"].(string); exists {
+			userID = uid
+		}
+		if aid, exists := authLambda["accountId"].(string); exists {
+			accountID = aid
+		}
+	}
+
+	if userID == "" || accountID == "" {
+		return response.Unauthorized("User not authenticated"), nil
+	}
+
+	query, err := parseQuery(event.QueryStringParameters)
+	if err != nil {
+		return response.BadRequest(err.Error()), nil
+	}
+
+	log.Printf("Search request for accountId: %s, field: %s", accountID, query.Field)
+
+	results, truncated, err := h.search.Search(ctx, accountID, query)
+	if err != nil {
+		log.Printf("Failed to search records: %v", err)
+		return response.InternalServerError("Failed to search records"), nil
+	}
+
+	// Strip prefixes for API response
+	for i := range results {
+		results[i].SourceID = strings.TrimPrefix(results[i].SourceID, "source:")
+		results[i].SnapshotID = strings.TrimPrefix(results[i].SnapshotID, "snapshot:")
+		results[i].FileID = strings.TrimPrefix(results[i].FileID, "file:")
+	}
+
+	return response.Success(map[string]interface{}{
+		"results":   results,
+		"count":     len(results),
+		"truncated": truncated,
+	}), nil
+}
+
+// parseQuery reads the search from the query string. Dates are RFC 3339 or YYYY-MM-DD;
+// an inclusive "to" date covers the whole day.
+func parseQuery(params map[string]string) (services.SearchQuery, error) {
+	query := services.SearchQuery{
+		Query:      strings.TrimSpace(params["q"]),
+		Field:      params["field"],
+		SourceID:   params["sourceId"],
+		SnapshotID: params["snapshotId"],
+		Limit:      20,
+	}
+
+	if query.Query == "" {
+		return query, fmt.Errorf("q is required")
+	}
+
+	switch query.Field {
+	case "", services.SearchFieldID, services.SearchFieldEmail, services.SearchFieldName:
+	default:
+		return query, fmt.Errorf("field must be id, email or name")
+	}
+
+	if limitStr := params["limit"]; limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > 100 {
+			return query, fmt.Errorf("limit must be between 1 and 100")
+		}
+		query.Limit = limit
+	}
+
+	if fromStr := params["from"]; fromStr != "" {
+		from, err := utils.ParseDate(fromStr, false)
+		if err != nil {
+			return query, fmt.Errorf("invalid from date: %s", fromStr)
+		}
+		query.From = &from
+	}
+	if toStr := params["to"]; toStr != "" {
+		to, err := utils.ParseDate(toStr, true)
+		if err != nil {
+			return query, fmt.Errorf("invalid to date: %s", toStr)
+		}
+		query.To = &to
+	}
+
+	return query, nil
+}
+
+func main() {
+	handler, err := NewSearchDataHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create search data handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/listbackup/api/internal/services"
+	apitypes "github.com/listbackup/api/internal/types"
+	"github.com/listbackup/api/pkg/response"
+)
+
+type CreateDestinationHandler struct {
+	destinations *services.DestinationService
+	billing      *services.BillingService
+}
+
+type CreateDestinationRequest struct {
+	Name        string                            `json:"name"`
+	Type        string                            `json:"type"` // s3|sftp|azure|gcs
+	Config      apitypes.StorageDestinationConfig `json:"config"`
+	Credentials apitypes.StorageCredentials       `json:"credentials"`
+}
+
+func NewCreateDestinationHandler(ctx context.Context) (*CreateDestinationHandler, error) {
+	destinations, err := services.NewDestinationService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create destination service: %v", err)
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %v", err)
+	}
+
+	return &CreateDestinationHandler{
+		destinations: destinations,
+		billing:      services.NewBillingService(dynamodb.NewFromConfig(cfg), os.Getenv("BILLING_TABLE")),
+	}, nil
+}
+
+func (h *CreateDestinationHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var userID, accountID string
+	if authLambda, ok := event.RequestContext.Authorizer["lambda"].(map[string]interface{}); ok {
+		if uid, exists := authLambda["userId"].(string); exists {
+			userID = uid
+		}
+		if aid, exists := authLambda["accountId"].(string); exists {
+			accountID = aid
+		}
+	}
+
+	if userID == "" || accountID == "" {
+		return response.Unauthorized("User not authenticated"), nil
+	}
+
+	var req CreateDestinationRequest
+	if err := json.Unmarshal([]byte(event.Body), &req); err != nil {
+		return response.BadRequest("Invalid request body"), nil
+	}
+
+	available, err := h.billing.IsFeatureAvailable(ctx, accountID, "externalStorage")
+	if err != nil {
+		log.Printf("Failed to check external storage feature for %s: %v", accountID, err)
+	}
+	if !available {
+		return response.Forbidden("External storage destinations are not included in your plan"), nil
+	}
+
+	destination, err := h.destinations.CreateDestination(ctx, accountID, userID, services.DestinationInput{
+		Name:        strings.TrimSpace(req.Name),
+		Type:        req.Type,
+		Config:      req.Config,
+		Credentials: req.Credentials,
+	})
+	if err != nil {
+		var validationErr *services.ValidationError
+		if errors.As(err, &validationErr) {
+			return response.BadRequest(err.Error()), nil
+		}
+		log.Printf("Failed to create destination: %v", err)
+		return response.InternalServerError("Failed to create destination"), nil
+	}
+
+	destination.DestinationID = strings.TrimPrefix(destination.DestinationID, "destination:")
+	return response.Created(destination), nil
+}
+
+func main() {
+	handler, err := NewCreateDestinationHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create destination handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
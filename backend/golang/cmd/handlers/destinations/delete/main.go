@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/listbackup/api/internal/services"
+	"github.com/listbackup/api/pkg/response"
+)
+
+type DeleteDestinationHandler struct {
+	destinations *services.DestinationService
+}
+
+func NewDeleteDestinationHandler(ctx context.Context) (*DeleteDestinationHandler, error) {
+	destinations, err := services.NewDestinationService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create destination service: %v", err)
+	}
+
+	return &DeleteDestinationHandler{destinations: destinations}, nil
+}
+
+func (h *DeleteDestinationHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var userID, accountID string
+	if authLambda, ok := event.RequestContext.Authorizer["lambda"].(map[string]interface{}); ok {
+		if uid, exists := authLambda["userId"].(string); exists {
+			userID = uid
+		}
+		if aid, exists := authLambda["accountId"].(string); exists {
+			accountID = aid
+		}
+	}
+
+	if userID == "" || accountID == "" {
+		return response.Unauthorized("User not authenticated"), nil
+	}
+
+	destinationID := event.PathParameters["destinationId"]
+	if destinationID == "" {
+		return response.BadRequest("Destination ID is required"), nil
+	}
+
+	destination, err := h.destinations.GetDestination(ctx, accountID, destinationID)
+	if err != nil {
+		log.Printf("Failed to get destination: %v", err)
+		return response.NotFound("Destination not found"), nil
+	}
+
+	if err := h.destinations.DeleteDestination(ctx, destination, userID); err != nil {
+		if errors.Is(err, services.ErrDestinationInUse) {
+			return response.Conflict("Destination is still used by sources; point them elsewhere first"), nil
+		}
+		log.Printf("Failed to delete destination %s: %v", destination.DestinationID, err)
+		return response.InternalServerError("Failed to delete destination"), nil
+	}
+
+	return response.Success(map[string]interface{}{
+		"message": "Destination deleted successfully",
+	}), nil
+}
+
+func main() {
+	handler, err := NewDeleteDestinationHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create delete destination handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/listbackup/api/internal/services"
+	"github.com/listbackup/api/pkg/response"
+)
+
+type ListDestinationsHandler struct {
+	destinations *services.DestinationService
+}
+
+func NewListDestinationsHandler(ctx context.Context) (*ListDestinationsHandler, error) {
+	destinations, err := services.NewDestinationService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create destination service: %v", err)
+	}
+
+	return &ListDestinationsHandler{destinations: destinations}, nil
+}
+
+func (h *ListDestinationsHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var userID, accountID string
+	if authLambda, ok := event.RequestContext.Authorizer["lambda"].(map[string]interface{}); ok {
+		if uid, exists := authLambda["userId"].(string); exists {
+			userID = uid
+		}
+		if aid, exists := authLambda["accountId"].(string); exists {
+			accountID = aid
+		}
+	}
+
+	if userID == "" || accountID == "" {
+		return response.Unauthorized("User not authenticated"), nil
+	}
+
+	destinations, err := h.destinations.ListDestinations(ctx, accountID)
+	if err != nil {
+		log.Printf("Failed to list destinations: %v", err)
+		return response.InternalServerError("Failed to list destinations"), nil
+	}
+
+	// Strip prefixes for API response
+	for i := range destinations {
+		destinations[i].DestinationID = strings.TrimPrefix(destinations[i].DestinationID, "destination:")
+	}
+
+	return response.Success(map[string]interface{}{
+		"destinations": destinations,
+		"total":        len(destinations),
+	}), nil
+}
+
+func main() {
+	handler, err := NewListDestinationsHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create list destinations handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
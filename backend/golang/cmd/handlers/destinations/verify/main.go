@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/listbackup/api/internal/services"
+	"github.com/listbackup/api/pkg/response"
+)
+
+type VerifyDestinationHandler struct {
+	destinations *services.DestinationService
+}
+
+func NewVerifyDestinationHandler(ctx context.Context) (*VerifyDestinationHandler, error) {
+	destinations, err := services.NewDestinationService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create destination service: %v", err)
+	}
+
+	return &VerifyDestinationHandler{destinations: destinations}, nil
+}
+
+// Handle re-runs the write, read back and delete check. The outcome is reported in the
+// destination's status and lastError rather than as an error response.
+func (h *VerifyDestinationHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var userID, accountID string
+	if authLambda, ok := event.RequestContext.Authorizer["lambda"].(map[string]interface{}); ok {
+		if uid, exists := authLambda["userId"].(string); exists {
+			userID = uid
+		}
+		if aid, exists := authLambda["accountId"].(string); exists {
+			accountID = aid
+		}
+	}
+
+	if userID == "" || accountID == "" {
+		return response.Unauthorized("User not authenticated"), nil
+	}
+
+	destinationID := event.PathParameters["destinationId"]
+	if destinationID == "" {
+		return response.BadRequest("Destination ID is required"), nil
+	}
+
+	destination, err := h.destinations.GetDestination(ctx, accountID, destinationID)
+	if err != nil {
+		log.Printf("Failed to get destination: %v", err)
+		return response.NotFound("Destination not found"), nil
+	}
+
+	if err := h.destinations.VerifyDestination(ctx, destination); err != nil {
+		log.Printf("Destination %s failed verification: %v", destination.DestinationID, err)
+	}
+
+	destination.DestinationID = strings.TrimPrefix(destination.DestinationID, "destination:")
+	return response.Success(destination), nil
+}
+
+func main() {
+	handler, err := NewVerifyDestinationHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create verify destination handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
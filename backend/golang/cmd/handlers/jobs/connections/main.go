@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/listbackup/api/internal/services"
+)
+
+// CheckRequest is the optional detail of the triggering event. Scheduled runs leave it
+// empty and check every connection.
+type CheckRequest struct {
+	AccountID string `json:"accountId,omitempty"`
+}
+
+type CheckConnectionsHandler struct {
+	health *services.ConnectionHealthService
+}
+
+func NewCheckConnectionsHandler(ctx context.Context) (*CheckConnectionsHandler, error) {
+	health, err := services.NewConnectionHealthService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection health service: %v", err)
+	}
+
+	return &CheckConnectionsHandler{health: health}, nil
+}
+
+func (h *CheckConnectionsHandler) Handle(ctx context.Context, event events.CloudWatchEvent) error {
+	var request CheckRequest
+	if len(event.Detail) > 0 {
+		if err := json.Unmarshal(event.Detail, &request); err != nil {
+			return fmt.Errorf("invalid check request: %v", err)
+		}
+	}
+
+	report, err := h.health.CheckConnections(ctx, request.AccountID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Checked %d connections: %d refreshed, %d active, %d expired, %d in error",
+		report.Checked, report.Refreshed, report.Active, report.Expired, report.Errored)
+
+	if report.Failed > 0 {
+		return fmt.Errorf("failed to check %d of %d connections", report.Failed, report.Checked+report.Failed)
+	}
+
+	return nil
+}
+
+func main() {
+	handler, err := NewCheckConnectionsHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create check connections handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/listbackup/api/internal/database"
+	"github.com/listbackup/api/internal/services"
+	"github.com/listbackup/api/pkg/response"
+)
+
+type ControlJobHandler struct {
+	db      *database.DynamoDBClient
+	control *services.JobControlService
+}
+
+func NewControlJobHandler(ctx context.Context) (*ControlJobHandler, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	control, err := services.NewJobControlService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job control service: %v", err)
+	}
+
+	return &ControlJobHandler{db: db, control: control}, nil
+}
+
+// Handle cancels, pauses, resumes or replays a job. Running jobs are sent the command and stop
+// within a few seconds, so their status in the response may not have changed yet.
+func (h *ControlJobHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var userID, accountID string
+	if authLambda, ok := event.RequestContext.Authorizer["lambda"].(map[string]interface{}); ok {
+		if uid, exists := authLambda["userId"].(string); exists {
+			userID = uid
+		}
+		if aid, exists := authLambda["accountId"].(string); exists {
+			accountID = aid
+		}
+	}
+
+	if userID == "" || accountID == "" {
+		return response.Unauthorized("User not authenticated"), nil
+	}
+
+	jobID := event.PathParameters["jobId"]
+	if jobID == "" {
+		return response.BadRequest("Job ID is required"), nil
+	}
+
+	command := event.PathParameters["command"]
+	switch command {
+	case services.JobCommandCancel, services.JobCommandPause, services.JobCommandResume, services.JobCommandReplay:
+	default:
+		return response.NotFound("Unknown job command"), nil
+	}
+
+	job, err := h.control.GetJob(ctx, accountID, jobID)
+	if err != nil {
+		log.Printf("Failed to get job: %v", err)
+		return response.NotFound("Job not found"), nil
+	}
+
+	updated, err := h.control.Command(ctx, job, command)
+	if err != nil {
+		if errors.Is(err, services.ErrJobCommandNotAllowed) {
+			return response.Conflict(err.Error()), nil
+		}
+		log.Printf("Failed to %s job %s: %v", command, job.JobID, err)
+		return response.InternalServerError(fmt.Sprintf("Failed to %s job", command)), nil
+	}
+
+	message := fmt.Sprintf("Sent %s to job: %s", command, job.Name)
+	if err := services.LogActivity(ctx, h.db, accountID, userID, "jobs", command+"_job", "success", message); err != nil {
+		log.Printf("Failed to log activity: %v", err)
+	}
+
+	return response.Success(map[string]interface{}{
+		"jobId":     strings.TrimPrefix(updated.JobID, "job:"),
+		"status":    updated.Status,
+		"control":   updated.Control,
+		"attempts":  updated.Attempts,
+		"progress":  updated.Progress,
+		"updatedAt": updated.UpdatedAt,
+	}), nil
+}
+
+func main() {
+	handler, err := NewControlJobHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create control job handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/google/uuid"
+	"github.com/listbackup/api/internal/export"
 	apitypes "github.com/listbackup/api/internal/types"
 )
 
@@ -24,11 +25,12 @@ type CreateJobHandler struct {
 }
 
 type CreateJobRequest struct {
-	Name     string `json:"name"`
-	Type     string `json:"type"`
-	SourceID string `json:"sourceId"`
-	Schedule string `json:"schedule,omitempty"`
-	Enabled  *bool  `json:"enabled,omitempty"`
+	Name     string              `json:"name"`
+	Type     string              `json:"type"`
+	SourceID string              `json:"sourceId"`
+	Schedule string              `json:"schedule,omitempty"`
+	Enabled  *bool               `json:"enabled,omitempty"`
+	Config   *apitypes.JobConfig `json:"config,omitempty"`
 }
 
 func NewCreateJobHandler() (*CreateJobHandler, error) {
@@ -154,6 +156,19 @@ func (h *CreateJobHandler) Handle(ctx context.Context, event events.APIGatewayPr
 		}, nil
 	}
 	
+	if createReq.Type == "export" && (createReq.Config == nil || createReq.Config.Export == nil || !export.IsFormat(createReq.Config.Export.Format)) {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers: map[string]string{
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Methods": "GET, POST, PUT, DELETE, OPTIONS",
+				"Access-Control-Allow-Headers": "Content-Type, Authorization",
+				"Content-Type":                 "application/json",
+			},
+			Body: `{"success": false, "error": "Export jobs require config.export.format of csv, xlsx, parquet, sqlite or postgres"}`,
+		}, nil
+	}
+	
 	// Generate new job ID
 	jobID := "job:" + uuid.New().String()
 	
@@ -184,6 +199,9 @@ func (h *CreateJobHandler) Handle(ctx context.Context, event events.APIGatewayPr
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
+	if createReq.Config != nil {
+		job.Config = *createReq.Config
+	}
 	
 	// Convert job to DynamoDB item
 	jobItem, err := dynamodbattribute.MarshalMap(job)
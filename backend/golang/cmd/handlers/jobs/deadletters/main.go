@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/listbackup/api/internal/database"
+	"github.com/listbackup/api/internal/services"
+	"github.com/listbackup/api/pkg/response"
+)
+
+type DeadLettersHandler struct {
+	retry *services.RetryService
+}
+
+func NewDeadLettersHandler(ctx context.Context) (*DeadLettersHandler, error) {
+	retry, err := services.NewRetryService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create retry service: %v", err)
+	}
+
+	return &DeadLettersHandler{retry: retry}, nil
+}
+
+// Handle lists the account's dead jobs with why they failed. A dead job is replayed with
+// POST /jobs/{jobId}/replay.
+func (h *DeadLettersHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var userID, accountID string
+	if authLambda, ok := event.RequestContext.Authorizer["lambda"].(map[string]interface{}); ok {
+		if uid, exists := authLambda["userId"].(string); exists {
+			userID = uid
+		}
+		if aid, exists := authLambda["accountId"].(string); exists {
+			accountID = aid
+		}
+	}
+
+	if userID == "" || accountID == "" {
+		return response.Unauthorized("User not authenticated"), nil
+	}
+
+	limit := int32(50)
+	if limitStr := event.QueryStringParameters["limit"]; limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l < 1 || l > 200 {
+			return response.BadRequest("limit must be between 1 and 200"), nil
+		}
+		limit = int32(l)
+	}
+
+	jobs, nextToken, err := h.retry.ListDeadJobs(ctx, accountID, limit, event.QueryStringParameters["nextToken"])
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidPageToken) {
+			return response.BadRequest("Invalid nextToken"), nil
+		}
+		log.Printf("Failed to list dead jobs: %v", err)
+		return response.InternalServerError("Failed to list dead jobs"), nil
+	}
+
+	deadJobs := make([]map[string]interface{}, 0, len(jobs))
+	for _, job := range jobs {
+		deadJobs = append(deadJobs, map[string]interface{}{
+			"jobId":    strings.TrimPrefix(job.JobID, "job:"),
+			"sourceId": strings.TrimPrefix(job.SourceID, "source:"),
+			"name":     job.Name,
+			"type":     job.Type,
+			"attempts": job.Attempts,
+			"failure":  job.Failure,
+			"deadAt":   job.DeadAt,
+		})
+	}
+
+	result := map[string]interface{}{
+		"jobs":  deadJobs,
+		"count": len(deadJobs),
+	}
+	if nextToken != "" {
+		result["nextToken"] = nextToken
+	}
+
+	return response.Success(result), nil
+}
+
+func main() {
+	handler, err := NewDeadLettersHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create dead letters handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
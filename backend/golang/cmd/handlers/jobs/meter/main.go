@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/listbackup/api/internal/database"
+	"github.com/listbackup/api/internal/services"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// MeterRequest is the optional detail of the triggering event. Scheduled runs leave it
+// empty and meter every active account.
+type MeterRequest struct {
+	AccountID string `json:"accountId,omitempty"`
+}
+
+type MeterStorageHandler struct {
+	db       *database.DynamoDBClient
+	metering *services.MeteringService
+}
+
+func NewMeterStorageHandler(ctx context.Context) (*MeterStorageHandler, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	metering, err := services.NewMeteringService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metering service: %v", err)
+	}
+
+	return &MeterStorageHandler{db: db, metering: metering}, nil
+}
+
+func (h *MeterStorageHandler) Handle(ctx context.Context, event events.CloudWatchEvent) error {
+	var request MeterRequest
+	if len(event.Detail) > 0 {
+		if err := json.Unmarshal(event.Detail, &request); err != nil {
+			return fmt.Errorf("invalid meter request: %v", err)
+		}
+	}
+
+	accounts, err := h.accountsToMeter(ctx, request.AccountID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Metering storage of %d accounts", len(accounts))
+
+	failed := 0
+	for i := range accounts {
+		account := &accounts[i]
+		if account.Status != "" && account.Status != "active" {
+			continue
+		}
+
+		report, err := h.metering.MeterAccount(ctx, account)
+		if err != nil {
+			failed++
+			log.Printf("Failed to meter account %s: %v", account.AccountID, err)
+			continue
+		}
+
+		log.Printf("Account %s: %d files, %d logical bytes, %d physical bytes, %.4f GB-hours",
+			account.AccountID, report.Files, report.LogicalBytes, report.PhysicalBytes, report.GBHours)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to meter %d of %d accounts", failed, len(accounts))
+	}
+
+	return nil
+}
+
+func (h *MeterStorageHandler) accountsToMeter(ctx context.Context, accountID string) ([]apitypes.Account, error) {
+	if accountID == "" {
+		var accounts []apitypes.Account
+		if err := h.db.ScanAllPages(ctx, database.AccountsTable, &accounts); err != nil {
+			return nil, fmt.Errorf("failed to list accounts: %v", err)
+		}
+		return accounts, nil
+	}
+
+	if !strings.HasPrefix(accountID, "account:") {
+		accountID = "account:" + accountID
+	}
+
+	accountIDAttr, err := attributevalue.Marshal(accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal accountID: %v", err)
+	}
+
+	var account apitypes.Account
+	err = h.db.GetItem(ctx, database.AccountsTable, map[string]types.AttributeValue{
+		"accountId": accountIDAttr,
+	}, &account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account %s: %v", accountID, err)
+	}
+
+	return []apitypes.Account{account}, nil
+}
+
+func main() {
+	handler, err := NewMeterStorageHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create meter storage handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
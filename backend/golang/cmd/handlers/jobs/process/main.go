@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/listbackup/api/internal/database"
+	"github.com/listbackup/api/internal/services"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+type ProcessJobHandler struct {
+	db        *database.DynamoDBClient
+	backup    *services.BackupService
+	exports   *services.ExportService
+	integrity *services.IntegrityService
+	archive   *services.ArchiveService
+	retry     *services.RetryService
+	dispatch  *services.DispatchService
+}
+
+func NewProcessJobHandler(ctx context.Context) (*ProcessJobHandler, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	backup, err := services.NewBackupService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup service: %v", err)
+	}
+
+	exports, err := services.NewExportService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export service: %v", err)
+	}
+
+	integrity, err := services.NewIntegrityService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create integrity service: %v", err)
+	}
+
+	archive, err := services.NewArchiveService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive service: %v", err)
+	}
+
+	retry, err := services.NewRetryService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create retry service: %v", err)
+	}
+
+	dispatch, err := services.NewDispatchService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dispatch service: %v", err)
+	}
+
+	return &ProcessJobHandler{db: db, backup: backup, exports: exports, integrity: integrity, archive: archive, retry: retry, dispatch: dispatch}, nil
+}
+
+// Handle consumes backup, sync, export and maintenance job messages. Messages that fail to process are
+// reported back to SQS individually so the rest of the batch is not redelivered.
+func (h *ProcessJobHandler) Handle(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	log.Printf("Processing %d job messages", len(event.Records))
+
+	var failures []events.SQSBatchItemFailure
+	for _, message := range event.Records {
+		if err := h.processMessage(ctx, message); err != nil {
+			log.Printf("Failed to process message %s: %v", message.MessageId, err)
+			failures = append(failures, events.SQSBatchItemFailure{ItemIdentifier: message.MessageId})
+		}
+	}
+
+	return events.SQSEventResponse{BatchItemFailures: failures}, nil
+}
+
+func (h *ProcessJobHandler) processMessage(ctx context.Context, message events.SQSMessage) error {
+	var queued apitypes.Job
+	if err := json.Unmarshal([]byte(message.Body), &queued); err != nil {
+		// A malformed message will never succeed, so drop it rather than retrying
+		log.Printf("Discarding malformed job message %s: %v", message.MessageId, err)
+		return nil
+	}
+
+	job, err := h.getJob(ctx, queued.JobID)
+	if err != nil {
+		return err
+	}
+
+	if job.Status == "running" || job.Status == "completed" || job.Status == "cancelled" || job.Status == "paused" || job.Status == "dead" {
+		log.Printf("Skipping job %s in status %s", job.JobID, job.Status)
+		return nil
+	}
+
+	if job.Type != "backup" && job.Type != "sync" && job.Type != "export" && job.Type != "maintenance" {
+		log.Printf("Job %s has type %s which this worker does not handle", job.JobID, job.Type)
+		return nil
+	}
+
+	startedAt := time.Now()
+	claimed, err := h.claimJob(ctx, job)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		log.Printf("Skipping job %s, its status changed from %s", job.JobID, job.Status)
+		return nil
+	}
+	job.Attempts++
+	h.dispatch.RecordDispatch(ctx, job, startedAt)
+
+	// Cancel and pause commands cancel runCtx; status updates keep using ctx
+	runCtx, stop := services.WatchJobControl(ctx, h.db, job.JobID)
+	defer stop()
+
+	if job.Type == "export" {
+		return h.runExport(ctx, runCtx, job, startedAt)
+	}
+	if job.Type == "maintenance" {
+		return h.runMaintenance(ctx, runCtx, job, startedAt)
+	}
+
+	snapshot, runErr := h.backup.RunJob(runCtx, job)
+	if runErr != nil {
+		return h.failJob(ctx, job, startedAt, services.JobRunError(runCtx, runErr))
+	}
+
+	log.Printf("Job %s completed snapshot %s in %s (%d records, %d bytes)", job.JobID, snapshot.SnapshotID,
+		time.Since(startedAt), snapshot.Manifest.TotalRecords, snapshot.Manifest.TotalBytes)
+	return h.updateJobStatus(ctx, job.JobID, "completed", "SET #status = :status, completedAt = :now, lastRunAt = :now, updatedAt = :now REMOVE failure, nextAttemptAt", nil)
+}
+
+func (h *ProcessJobHandler) runExport(ctx, runCtx context.Context, job *apitypes.Job, startedAt time.Time) error {
+	output, runErr := h.exports.RunExport(runCtx, job)
+	if runErr != nil {
+		return h.failJob(ctx, job, startedAt, services.JobRunError(runCtx, runErr))
+	}
+
+	outputAttr, err := attributevalue.Marshal(output)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job output: %v", err)
+	}
+
+	log.Printf("Job %s exported %s (%d bytes) in %s", job.JobID, output.S3Key, output.Size, time.Since(startedAt))
+	return h.updateJobStatus(ctx, job.JobID, "completed",
+		"SET #status = :status, completedAt = :now, lastRunAt = :now, updatedAt = :now, #output = :output REMOVE failure, nextAttemptAt",
+		map[string]types.AttributeValue{":output": outputAttr})
+}
+
+func (h *ProcessJobHandler) runMaintenance(ctx, runCtx context.Context, job *apitypes.Job, startedAt time.Time) error {
+	if job.Config.Maintenance != nil && job.Config.Maintenance.Task == services.MaintenanceRehydrate {
+		return h.runRehydration(ctx, runCtx, job, startedAt)
+	}
+
+	report, runErr := h.integrity.RunMaintenance(runCtx, job)
+	if runErr != nil {
+		return h.failJob(ctx, job, startedAt, services.JobRunError(runCtx, runErr))
+	}
+
+	log.Printf("Job %s verified %d snapshots (%d objects) in %s: %d corrupted, %d errors", job.JobID,
+		report.SnapshotsChecked, report.ObjectsChecked, time.Since(startedAt), len(report.Corrupted), len(report.Errors))
+
+	// Corrupted snapshots are a finding, not a job failure; only checks that could not run fail the job
+	if len(report.Errors) > 0 {
+		return h.failJob(ctx, job, startedAt, fmt.Errorf("failed to verify %d snapshots: %s", len(report.Errors), report.Errors[0]))
+	}
+	return h.updateJobStatus(ctx, job.JobID, "completed", "SET #status = :status, completedAt = :now, lastRunAt = :now, updatedAt = :now REMOVE failure, nextAttemptAt", nil)
+}
+
+// runRehydration starts restoring an archived file. The job stays running until S3 reports
+// the restore finished, unless the file turned out to be readable already.
+func (h *ProcessJobHandler) runRehydration(ctx, runCtx context.Context, job *apitypes.Job, startedAt time.Time) error {
+	ready, runErr := h.archive.StartRehydration(runCtx, job)
+	if runErr != nil {
+		return h.failJob(ctx, job, startedAt, services.JobRunError(runCtx, runErr))
+	}
+
+	if !ready {
+		log.Printf("Job %s requested restore of %s", job.JobID, job.Config.Maintenance.FileID)
+		return nil
+	}
+	return h.updateJobStatus(ctx, job.JobID, "completed", "SET #status = :status, completedAt = :now, lastRunAt = :now, updatedAt = :now REMOVE failure, nextAttemptAt", nil)
+}
+
+// failJob records why a job stopped. Jobs stopped by a cancel or pause command take that
+// status instead of failing; failed runs are retried or make the job dead.
+func (h *ProcessJobHandler) failJob(ctx context.Context, job *apitypes.Job, startedAt time.Time, runErr error) error {
+	switch {
+	case errors.Is(runErr, services.ErrJobPaused):
+		log.Printf("Job %s paused after %s", job.JobID, time.Since(startedAt))
+		return h.updateJobStatus(ctx, job.JobID, "paused", "SET #status = :status, updatedAt = :now REMOVE control", nil)
+	case errors.Is(runErr, services.ErrJobCancelled):
+		log.Printf("Job %s cancelled after %s", job.JobID, time.Since(startedAt))
+		return h.updateJobStatus(ctx, job.JobID, "cancelled", "SET #status = :status, completedAt = :now, updatedAt = :now REMOVE control", nil)
+	}
+
+	status, err := h.retry.RecordFailure(ctx, job, runErr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Job %s failed attempt %d after %s, now %s: %v", job.JobID, job.Attempts, time.Since(startedAt), status, runErr)
+	return nil
+}
+
+// claimJob marks the job running on condition that its status is still the one it was read
+// with, so a job cancelled or paused after it was queued is not started. Each claim counts
+// as an attempt.
+func (h *ProcessJobHandler) claimJob(ctx context.Context, job *apitypes.Job) (bool, error) {
+	values, err := attributevalue.MarshalMap(map[string]interface{}{
+		":from":   job.Status,
+		":status": "running",
+		":now":    time.Now(),
+		":one":    1,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal job update: %v", err)
+	}
+
+	err = h.db.TransactWrite(ctx, []types.TransactWriteItem{{Update: &types.Update{
+		TableName:                 aws.String(database.JobsTable),
+		Key:                       map[string]types.AttributeValue{"jobId": &types.AttributeValueMemberS{Value: job.JobID}},
+		UpdateExpression:          aws.String("SET #status = :status, startedAt = :now, updatedAt = :now REMOVE control ADD attempts :one"),
+		ConditionExpression:       aws.String("#status = :from"),
+		ExpressionAttributeNames:  map[string]string{"#status": "status"},
+		ExpressionAttributeValues: values,
+	}}})
+	if err != nil {
+		if database.ConditionFailed(err, 0) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to set job %s to running: %v", job.JobID, err)
+	}
+	return true, nil
+}
+
+func (h *ProcessJobHandler) getJob(ctx context.Context, jobID string) (*apitypes.Job, error) {
+	jobIDAttr, err := attributevalue.Marshal(jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal jobID: %v", err)
+	}
+
+	var job apitypes.Job
+	err = h.db.GetItem(ctx, database.JobsTable, map[string]types.AttributeValue{
+		"jobId": jobIDAttr,
+	}, &job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job %s: %v", jobID, err)
+	}
+
+	return &job, nil
+}
+
+func (h *ProcessJobHandler) updateJobStatus(ctx context.Context, jobID, status, updateExpression string, extraValues map[string]types.AttributeValue) error {
+	jobIDAttr, err := attributevalue.Marshal(jobID)
+	if err != nil {
+		return fmt.Errorf("failed to marshal jobID: %v", err)
+	}
+	statusAttr, err := attributevalue.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("failed to marshal status: %v", err)
+	}
+	nowAttr, err := attributevalue.Marshal(time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to marshal timestamp: %v", err)
+	}
+
+	values := map[string]types.AttributeValue{
+		":status": statusAttr,
+		":now":    nowAttr,
+	}
+	for k, v := range extraValues {
+		values[k] = v
+	}
+
+	err = h.db.UpdateItemWithNames(ctx, database.JobsTable, map[string]types.AttributeValue{
+		"jobId": jobIDAttr,
+	}, updateExpression, values, jobAttributeNames(updateExpression))
+	if err != nil {
+		return fmt.Errorf("failed to set job %s to %s: %v", jobID, status, err)
+	}
+
+	return nil
+}
+
+// jobAttributeNames returns the placeholders an update expression uses for reserved words
+func jobAttributeNames(updateExpression string) map[string]string {
+	names := map[string]string{"#status": "status"}
+	if strings.Contains(updateExpression, "#output") {
+		names["#output"] = "output"
+	}
+	return names
+}
+
+func main() {
+	handler, err := NewProcessJobHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create process job handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
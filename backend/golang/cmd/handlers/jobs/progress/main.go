@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/listbackup/api/internal/services"
+	"github.com/listbackup/api/pkg/response"
+)
+
+const (
+	defaultWait = 20 * time.Second
+	// maxWait stays under the 30 second API Gateway integration timeout
+	maxWait = 25 * time.Second
+)
+
+type JobProgressHandler struct {
+	control *services.JobControlService
+}
+
+func NewJobProgressHandler(ctx context.Context) (*JobProgressHandler, error) {
+	control, err := services.NewJobControlService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job control service: %v", err)
+	}
+
+	return &JobProgressHandler{control: control}, nil
+}
+
+// Handle long-polls a job's progress: it answers as soon as the job changes after the
+// cursor, or with the job as it is once the wait runs out. Clients sending
+// Accept: text/event-stream get the answer as a Server-Sent Event; EventSource then
+// reconnects with Last-Event-ID, which serves as the cursor, so the UI receives every
+// update as a stream.
+func (h *JobProgressHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var userID, accountID string
+	if authLambda, ok := event.RequestContext.Authorizer["lambda"].(map[string]interface{}); ok {
+		if uid, exists := authLambda["userId"].(string); exists {
+			userID = uid
+		}
+		if aid, exists := authLambda["accountId"].(string); exists {
+			accountID = aid
+		}
+	}
+
+	if userID == "" || accountID == "" {
+		return response.Unauthorized("User not authenticated"), nil
+	}
+
+	jobID := event.PathParameters["jobId"]
+	if jobID == "" {
+		return response.BadRequest("Job ID is required"), nil
+	}
+
+	stream := strings.Contains(header(event, "Accept"), "text/event-stream")
+	cursor := event.QueryStringParameters["after"]
+	if lastEventID := header(event, "Last-Event-ID"); stream && lastEventID != "" {
+		cursor = lastEventID
+	}
+
+	// Without a cursor the current progress is returned right away
+	after := time.Time{}
+	if cursor != "" {
+		nanos, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil {
+			return response.BadRequest("after must be a cursor returned by a previous request"), nil
+		}
+		after = time.Unix(0, nanos)
+	}
+
+	wait := defaultWait
+	if waitStr := event.QueryStringParameters["wait"]; waitStr != "" {
+		seconds, err := strconv.Atoi(waitStr)
+		if err != nil || seconds < 0 || time.Duration(seconds)*time.Second > maxWait {
+			return response.BadRequest(fmt.Sprintf("wait must be between 0 and %d seconds", int(maxWait.Seconds()))), nil
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+
+	job, changed, err := h.control.WaitForProgress(ctx, accountID, jobID, after, wait)
+	if err != nil {
+		log.Printf("Failed to get progress of job %s: %v", jobID, err)
+		return response.NotFound("Job not found"), nil
+	}
+
+	update := services.ProgressUpdate(job)
+	update.JobID = strings.TrimPrefix(update.JobID, "job:")
+	nextCursor := strconv.FormatInt(job.UpdatedAt.UnixNano(), 10)
+
+	if stream {
+		return eventStream(update, nextCursor, changed)
+	}
+	return response.Success(map[string]interface{}{
+		"progress": update,
+		"changed":  changed,
+		"cursor":   nextCursor,
+	}), nil
+}
+
+// eventStream frames the update as a Server-Sent Event. An unchanged job only gets a
+// comment, so the client keeps its cursor and reconnects.
+func eventStream(update services.JobProgressUpdate, cursor string, changed bool) (events.APIGatewayProxyResponse, error) {
+	var body strings.Builder
+	body.WriteString("retry: 1000\n\n")
+	if changed || update.Done {
+		data, err := json.Marshal(update)
+		if err != nil {
+			return response.InternalServerError("Failed to encode progress"), nil
+		}
+
+		name := "progress"
+		if update.Done {
+			name = "done"
+		}
+		fmt.Fprintf(&body, "id: %s\nevent: %s\ndata: %s\n\n", cursor, name, data)
+	} else {
+		body.WriteString(": no change\n\n")
+	}
+
+	headers := response.GetCORSHeaders()
+	headers["Content-Type"] = "text/event-stream"
+	headers["Cache-Control"] = "no-cache"
+	return events.APIGatewayProxyResponse{
+		StatusCode: response.StatusOK,
+		Headers:    headers,
+		Body:       body.String(),
+	}, nil
+}
+
+// header returns a request header regardless of how the gateway cased its name
+func header(event events.APIGatewayProxyRequest, name string) string {
+	for key, value := range event.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+func main() {
+	handler, err := NewJobProgressHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create job progress handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
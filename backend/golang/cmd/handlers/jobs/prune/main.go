@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/listbackup/api/internal/database"
+	"github.com/listbackup/api/internal/services"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// PruneRequest is the optional detail of the triggering event. Scheduled runs leave it
+// empty and prune every active account.
+type PruneRequest struct {
+	AccountID string `json:"accountId,omitempty"`
+	DryRun    bool   `json:"dryRun,omitempty"`
+}
+
+type PruneSnapshotsHandler struct {
+	db        *database.DynamoDBClient
+	retention *services.RetentionService
+	archive   *services.ArchiveService
+}
+
+func NewPruneSnapshotsHandler(ctx context.Context) (*PruneSnapshotsHandler, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	retention, err := services.NewRetentionService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create retention service: %v", err)
+	}
+
+	archive, err := services.NewArchiveService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive service: %v", err)
+	}
+
+	return &PruneSnapshotsHandler{db: db, retention: retention, archive: archive}, nil
+}
+
+func (h *PruneSnapshotsHandler) Handle(ctx context.Context, event events.CloudWatchEvent) error {
+	var request PruneRequest
+	if len(event.Detail) > 0 {
+		if err := json.Unmarshal(event.Detail, &request); err != nil {
+			return fmt.Errorf("invalid prune request: %v", err)
+		}
+	}
+
+	accounts, err := h.accountsToPrune(ctx, request.AccountID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Pruning and archiving %d accounts (dryRun=%t)", len(accounts), request.DryRun)
+
+	failed := 0
+	for i := range accounts {
+		account := &accounts[i]
+		if account.Status != "" && account.Status != "active" {
+			continue
+		}
+
+		report, err := h.retention.PruneAccount(ctx, account, request.DryRun)
+		if err != nil {
+			failed++
+			log.Printf("Failed to prune account %s: %v", account.AccountID, err)
+			continue
+		}
+
+		log.Printf("Account %s: pruned %d/%d snapshots, %d expired files, %d bytes freed, %d errors",
+			account.AccountID, report.SnapshotsPruned, report.SnapshotsChecked, report.FilesExpired, report.BytesFreed, len(report.Errors))
+
+		// Archive what survived pruning, so nothing is moved to Glacier only to be deleted
+		archived, err := h.archive.ArchiveAccount(ctx, account, request.DryRun)
+		if err != nil {
+			failed++
+			log.Printf("Failed to archive account %s: %v", account.AccountID, err)
+			continue
+		}
+
+		if archived.SnapshotsArchived > 0 {
+			log.Printf("Account %s: archived %d snapshots (%d objects, %d bytes), %d errors",
+				account.AccountID, archived.SnapshotsArchived, archived.ObjectsArchived, archived.BytesArchived, len(archived.Errors))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to prune or archive %d of %d accounts", failed, len(accounts))
+	}
+
+	return nil
+}
+
+func (h *PruneSnapshotsHandler) accountsToPrune(ctx context.Context, accountID string) ([]apitypes.Account, error) {
+	if accountID == "" {
+		var accounts []apitypes.Account
+		if err := h.db.ScanAllPages(ctx, database.AccountsTable, &accounts); err != nil {
+			return nil, fmt.Errorf("failed to list accounts: %v", err)
+		}
+		return accounts, nil
+	}
+
+	if !strings.HasPrefix(accountID, "account:") {
+		accountID = "account:" + accountID
+	}
+
+	accountIDAttr, err := attributevalue.Marshal(accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal accountID: %v", err)
+	}
+
+	var account apitypes.Account
+	err = h.db.GetItem(ctx, database.AccountsTable, map[string]types.AttributeValue{
+		"accountId": accountIDAttr,
+	}, &account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account %s: %v", accountID, err)
+	}
+
+	return []apitypes.Account{account}, nil
+}
+
+func main() {
+	handler, err := NewPruneSnapshotsHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create prune snapshots handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
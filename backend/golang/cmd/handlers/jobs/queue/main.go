@@ -6,18 +6,23 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/listbackup/api/internal/services"
 	apitypes "github.com/listbackup/api/internal/types"
 )
 
 type QueueJobHandler struct {
-	sqsClient *sqs.SQS
-	queueURLs map[string]string
+	sqsClient     *sqs.SQS
+	queueURLs     map[string]string
+	laneURLs      map[string]string
+	retryQueueURL string
 }
 
 func NewQueueJobHandler() (*QueueJobHandler, error) {
@@ -45,8 +50,10 @@ func NewQueueJobHandler() (*QueueJobHandler, error) {
 	}
 
 	return &QueueJobHandler{
-		sqsClient: sqs.New(sess),
-		queueURLs: queueURLs,
+		sqsClient:     sqs.New(sess),
+		queueURLs:     queueURLs,
+		laneURLs:      services.LaneQueueURLs(),
+		retryQueueURL: os.Getenv("RETRY_QUEUE_URL"),
 	}, nil
 }
 
@@ -175,6 +182,21 @@ func (h *QueueJobHandler) extractJobFromImage(image map[string]events.DynamoDBAt
 	if attr, ok := image["status"]; ok && attr.DataType() == events.DataTypeString {
 		job.Status = attr.String()
 	}
+	if attr, ok := image["resumedAt"]; ok && attr.DataType() == events.DataTypeString {
+		if resumedAt, err := time.Parse(time.RFC3339Nano, attr.String()); err == nil {
+			job.ResumedAt = &resumedAt
+		}
+	}
+	if attr, ok := image["attempts"]; ok && attr.DataType() == events.DataTypeNumber {
+		if attempts, err := strconv.Atoi(attr.Number()); err == nil {
+			job.Attempts = attempts
+		}
+	}
+	if attr, ok := image["nextAttemptAt"]; ok && attr.DataType() == events.DataTypeString {
+		if nextAttemptAt, err := time.Parse(time.RFC3339Nano, attr.String()); err == nil {
+			job.NextAttemptAt = &nextAttemptAt
+		}
+	}
 
 	if job.JobID == "" || job.Type == "" {
 		return nil, fmt.Errorf("missing required job fields: jobId=%s, type=%s", job.JobID, job.Type)
@@ -183,15 +205,12 @@ func (h *QueueJobHandler) extractJobFromImage(image map[string]events.DynamoDBAt
 	return job, nil
 }
 
+// routeJobToQueue queues a job. Jobs the worker runs go to the lane of their priority;
+// analytics and alert jobs keep their per-type queues.
 func (h *QueueJobHandler) routeJobToQueue(ctx context.Context, job *apitypes.Job) error {
-	// Get queue URL for job type
-	queueURL, exists := h.queueURLs[job.Type]
-	if !exists {
-		return fmt.Errorf("no queue configured for job type: %s", job.Type)
-	}
-
-	if queueURL == "" {
-		return fmt.Errorf("queue URL not configured for job type: %s", job.Type)
+	queueURL, messageGroupID, err := h.jobQueue(job)
+	if err != nil {
+		return err
 	}
 
 	// Create message body
@@ -200,16 +219,12 @@ func (h *QueueJobHandler) routeJobToQueue(ctx context.Context, job *apitypes.Job
 		return fmt.Errorf("failed to marshal job: %v", err)
 	}
 
-	// Create message group ID for FIFO ordering
-	// Use sourceId so all jobs for the same source are processed in order
-	messageGroupID := job.SourceID
-	if messageGroupID == "" {
-		messageGroupID = job.AccountID // Fallback to accountId
-	}
-
 	// Create deduplication ID to prevent duplicate messages
-	// Use jobId for unique identification
+	// Use jobId for unique identification, and tell each resume or replay of the job apart
 	deduplicationID := job.JobID
+	if job.ResumedAt != nil {
+		deduplicationID = fmt.Sprintf("%s:%d", job.JobID, job.ResumedAt.UnixMilli())
+	}
 
 	// Send message to appropriate queue
 	input := &sqs.SendMessageInput{
@@ -250,10 +265,37 @@ func (h *QueueJobHandler) routeJobToQueue(ctx context.Context, job *apitypes.Job
 		return fmt.Errorf("failed to send message to queue %s: %v", queueURL, err)
 	}
 
-	log.Printf("Sent job %s to %s queue (group: %s)", job.JobID, job.Type, messageGroupID)
+	log.Printf("Sent job %s to %s (group: %s)", job.JobID, queueURL, messageGroupID)
 	return nil
 }
 
+// jobQueue returns the queue URL and FIFO message group of a job
+func (h *QueueJobHandler) jobQueue(job *apitypes.Job) (string, string, error) {
+	switch job.Type {
+	case "backup", "sync", "export", "maintenance":
+		lane := services.JobLane(job)
+		if h.laneURLs[lane] == "" {
+			return "", "", fmt.Errorf("queue URL not configured for %s lane", lane)
+		}
+		return h.laneURLs[lane], services.DispatchGroupID(job), nil
+	}
+
+	queueURL, exists := h.queueURLs[job.Type]
+	if !exists {
+		return "", "", fmt.Errorf("no queue configured for job type: %s", job.Type)
+	}
+	if queueURL == "" {
+		return "", "", fmt.Errorf("queue URL not configured for job type: %s", job.Type)
+	}
+
+	// Use sourceId so all jobs for the same source are processed in order
+	messageGroupID := job.SourceID
+	if messageGroupID == "" {
+		messageGroupID = job.AccountID // Fallback to accountId
+	}
+	return queueURL, messageGroupID, nil
+}
+
 // handleJobStatusChange processes job status transitions (MODIFY events)
 func (h *QueueJobHandler) handleJobStatusChange(ctx context.Context, oldJob, newJob *apitypes.Job) error {
 	// Handle specific status transitions
@@ -267,14 +309,27 @@ func (h *QueueJobHandler) handleJobStatusChange(ctx context.Context, oldJob, new
 		// Could trigger follow-up jobs, send success notifications
 
 	case oldJob.Status == "running" && newJob.Status == "failed":
-		log.Printf("Job %s failed - considering retry", newJob.JobID)
-		// Could implement retry logic by re-queuing the job
+		log.Printf("Job %s failed attempt %d", newJob.JobID, newJob.Attempts)
 		return h.handleJobRetry(ctx, newJob)
 
+	case newJob.Status == "dead":
+		log.Printf("Job %s is dead after %d attempts", newJob.JobID, newJob.Attempts)
+
 	case newJob.Status == "cancelled":
 		log.Printf("Job %s was cancelled", newJob.JobID)
 		// Could cleanup resources, send cancellation notifications
 
+	case newJob.Status == "paused":
+		log.Printf("Job %s was paused", newJob.JobID)
+
+	case oldJob.Status == "paused" && newJob.Status == "pending":
+		log.Printf("Job %s was resumed", newJob.JobID)
+		return h.routeJobToQueue(ctx, newJob)
+
+	case oldJob.Status == "dead" && newJob.Status == "pending":
+		log.Printf("Job %s was replayed", newJob.JobID)
+		return h.routeJobToQueue(ctx, newJob)
+
 	default:
 		log.Printf("Job %s status change: %s → %s (no special handling)", 
 			newJob.JobID, oldJob.Status, newJob.Status)
@@ -283,21 +338,52 @@ func (h *QueueJobHandler) handleJobStatusChange(ctx context.Context, oldJob, new
 	return nil
 }
 
-// handleJobRetry implements retry logic for failed jobs
+// handleJobRetry schedules the next attempt of a failed job. The worker sets nextAttemptAt
+// only when the failure is worth retrying and retries are left. FIFO queues cannot delay a
+// single message, so retries go through the standard retry queue.
 func (h *QueueJobHandler) handleJobRetry(ctx context.Context, failedJob *apitypes.Job) error {
-	// Check if job should be retried (could be based on retry count, error type, etc.)
-	maxRetries := 3
-	currentRetries := 0 // This would come from job metadata
-	
-	if currentRetries < maxRetries {
-		log.Printf("Retrying failed job %s (attempt %d/%d)", failedJob.JobID, currentRetries+1, maxRetries)
-		
-		// Re-queue the job for retry
-		return h.routeJobToQueue(ctx, failedJob)
+	if failedJob.NextAttemptAt == nil {
+		log.Printf("Job %s will not be retried", failedJob.JobID)
+		return nil
 	}
-	
-	log.Printf("Job %s exceeded max retries (%d), moving to dead letter", failedJob.JobID, maxRetries)
-	// Could move to dead letter queue or mark as permanently failed
+	if h.retryQueueURL == "" {
+		return fmt.Errorf("retry queue URL not configured")
+	}
+
+	messageBody, err := json.Marshal(failedJob)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %v", err)
+	}
+
+	// SQS delays a message by at most 15 minutes
+	delay := int64(time.Until(*failedJob.NextAttemptAt).Seconds())
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > 900 {
+		delay = 900
+	}
+
+	_, err = h.sqsClient.SendMessage(&sqs.SendMessageInput{
+		QueueUrl:     aws.String(h.retryQueueURL),
+		MessageBody:  aws.String(string(messageBody)),
+		DelaySeconds: aws.Int64(delay),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"JobType": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(failedJob.Type),
+			},
+			"Attempts": {
+				DataType:    aws.String("Number"),
+				StringValue: aws.String(strconv.Itoa(failedJob.Attempts)),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send job %s to retry queue: %v", failedJob.JobID, err)
+	}
+
+	log.Printf("Scheduled retry of job %s after attempt %d in %ds", failedJob.JobID, failedJob.Attempts, delay)
 	return nil
 }
 
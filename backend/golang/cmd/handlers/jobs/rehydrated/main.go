@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/listbackup/api/internal/services"
+)
+
+// FileRehydratedHandler receives the bucket's restore-completed notifications and marks
+// the restored files ready for download
+type FileRehydratedHandler struct {
+	archive *services.ArchiveService
+}
+
+func NewFileRehydratedHandler(ctx context.Context) (*FileRehydratedHandler, error) {
+	archive, err := services.NewArchiveService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive service: %v", err)
+	}
+
+	return &FileRehydratedHandler{archive: archive}, nil
+}
+
+func (h *FileRehydratedHandler) Handle(ctx context.Context, event events.S3Event) error {
+	failed := 0
+	for _, record := range event.Records {
+		if !strings.HasPrefix(record.EventName, "ObjectRestore:Completed") {
+			continue
+		}
+
+		key := record.S3.Object.Key
+		if err := h.archive.CompleteRehydration(ctx, key); err != nil {
+			failed++
+			log.Printf("Failed to complete rehydration of %s: %v", key, err)
+			continue
+		}
+		log.Printf("Object %s restored from the archive tier", key)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to complete %d of %d rehydrations", failed, len(event.Records))
+	}
+
+	return nil
+}
+
+func main() {
+	handler, err := NewFileRehydratedHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create file rehydrated handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/listbackup/api/internal/database"
+	"github.com/listbackup/api/internal/services"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// defaultScrubSample is how many objects of each snapshot a scheduled scrub re-reads
+const defaultScrubSample = 2
+
+// ScrubRequest is the optional detail of the triggering event. Scheduled runs leave it
+// empty and check a sample of every snapshot of every active account.
+type ScrubRequest struct {
+	AccountID string `json:"accountId,omitempty"`
+	Full      bool   `json:"full,omitempty"` // Re-read every object instead of a sample
+}
+
+// ScrubSnapshotsHandler queues one maintenance job per source. The jobs stream routes
+// them to the maintenance queue, where jobs/process verifies the snapshots.
+type ScrubSnapshotsHandler struct {
+	db *database.DynamoDBClient
+}
+
+func NewScrubSnapshotsHandler(ctx context.Context) (*ScrubSnapshotsHandler, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	return &ScrubSnapshotsHandler{db: db}, nil
+}
+
+func (h *ScrubSnapshotsHandler) Handle(ctx context.Context, event events.CloudWatchEvent) error {
+	var request ScrubRequest
+	if len(event.Detail) > 0 {
+		if err := json.Unmarshal(event.Detail, &request); err != nil {
+			return fmt.Errorf("invalid scrub request: %v", err)
+		}
+	}
+
+	sample := defaultScrubSample
+	if request.Full {
+		sample = 0
+	}
+
+	accounts, err := h.accountsToScrub(ctx, request.AccountID)
+	if err != nil {
+		return err
+	}
+
+	queued, failed := 0, 0
+	for i := range accounts {
+		account := &accounts[i]
+		if account.Status != "" && account.Status != "active" {
+			continue
+		}
+
+		var sources []apitypes.Source
+		err := h.db.QueryGSIAll(ctx, database.SourcesTable, "AccountIndex", "accountId = :accountId", map[string]interface{}{
+			":accountId": account.AccountID,
+		}, &sources)
+		if err != nil {
+			failed++
+			log.Printf("Failed to list sources of account %s: %v", account.AccountID, err)
+			continue
+		}
+
+		for _, source := range sources {
+			if err := h.queueVerifyJob(ctx, &source, sample); err != nil {
+				failed++
+				log.Printf("Failed to queue integrity check for %s: %v", source.SourceID, err)
+				continue
+			}
+			queued++
+		}
+	}
+
+	log.Printf("Queued %d integrity checks across %d accounts (sample=%d)", queued, len(accounts), sample)
+
+	if failed > 0 {
+		return fmt.Errorf("failed to queue %d integrity checks", failed)
+	}
+
+	return nil
+}
+
+func (h *ScrubSnapshotsHandler) queueVerifyJob(ctx context.Context, source *apitypes.Source, sample int) error {
+	now := time.Now()
+	job := apitypes.Job{
+		JobID:     "job:" + uuid.New().String(),
+		AccountID: source.AccountID,
+		UserID:    "system",
+		SourceID:  source.SourceID,
+		Name:      "Integrity check: " + source.Name,
+		Type:      "maintenance",
+		SubType:   services.MaintenanceVerify,
+		Priority:  "low",
+		Trigger:   services.JobTriggerSchedule,
+		Status:    "pending",
+		Enabled:   true,
+		Config: apitypes.JobConfig{
+			Maintenance: &apitypes.MaintenanceConfig{
+				Task:   services.MaintenanceVerify,
+				Sample: sample,
+			},
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	return h.db.PutItem(ctx, database.JobsTable, job)
+}
+
+func (h *ScrubSnapshotsHandler) accountsToScrub(ctx context.Context, accountID string) ([]apitypes.Account, error) {
+	if accountID == "" {
+		var accounts []apitypes.Account
+		if err := h.db.ScanAllPages(ctx, database.AccountsTable, &accounts); err != nil {
+			return nil, fmt.Errorf("failed to list accounts: %v", err)
+		}
+		return accounts, nil
+	}
+
+	if !strings.HasPrefix(accountID, "account:") {
+		accountID = "account:" + accountID
+	}
+
+	accountIDAttr, err := attributevalue.Marshal(accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal accountID: %v", err)
+	}
+
+	var account apitypes.Account
+	err = h.db.GetItem(ctx, database.AccountsTable, map[string]types.AttributeValue{
+		"accountId": accountIDAttr,
+	}, &account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account %s: %v", accountID, err)
+	}
+
+	return []apitypes.Account{account}, nil
+}
+
+func main() {
+	handler, err := NewScrubSnapshotsHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create scrub snapshots handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
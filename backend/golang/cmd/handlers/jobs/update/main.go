@@ -230,10 +230,18 @@ func (h *UpdateJobHandler) Handle(ctx context.Context, event events.APIGatewayPr
 		expressionValues[":enabled"] = &dynamodb.AttributeValue{BOOL: aws.Bool(*updateReq.Enabled)}
 	}
 
+	// Setting the status directly would bypass a running worker, which only stops for commands
 	if updateReq.Status != nil {
-		updateExpressions = append(updateExpressions, "#status = :status")
-		expressionValues[":status"] = &dynamodb.AttributeValue{S: aws.String(*updateReq.Status)}
-		expressionNames["#status"] = aws.String("status")
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers: map[string]string{
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Methods": "GET, POST, PUT, DELETE, OPTIONS",
+				"Access-Control-Allow-Headers": "Content-Type, Authorization",
+				"Content-Type":                 "application/json",
+			},
+			Body: `{"success": false, "error": "Use POST /jobs/{jobId}/cancel, /pause or /resume to change a job's status"}`,
+		}, nil
 	}
 
 	if updateReq.Priority != nil {
@@ -34,6 +34,7 @@ type OAuthState struct {
 	AccountID    string    `json:"accountId" dynamodbav:"accountId"`
 	RedirectURI  string    `json:"redirectUri" dynamodbav:"redirectUri"`
 	ShopDomain   string    `json:"shopDomain,omitempty" dynamodbav:"shopDomain"`
+	ConnectionID string    `json:"connectionId,omitempty" dynamodbav:"connectionId,omitempty"`
 	CreatedAt    time.Time `json:"createdAt" dynamodbav:"createdAt"`
 	ExpiresAt    time.Time `json:"expiresAt" dynamodbav:"expiresAt"`
 }
@@ -161,8 +162,13 @@ func Handle(event events.APIGatewayV2HTTPRequest) (events.APIGatewayProxyRespons
 		return redirectWithError(provider, "token_exchange_failed", err.Error()), nil
 	}
 
-	// Create platform connection
-	connection, err := createPlatformConnection(provider, oauthState, tokens)
+	// Re-authorizing keeps the connection, so sources that use it work again
+	var connection *PlatformConnection
+	if oauthState.ConnectionID != "" {
+		connection, err = reauthorizeConnection(oauthState, tokens)
+	} else {
+		connection, err = createPlatformConnection(provider, oauthState, tokens)
+	}
 	if err != nil {
 		log.Printf("Failed to create platform connection: %v", err)
 		return redirectWithError(provider, "connection_failed", err.Error()), nil
@@ -306,6 +312,94 @@ func createPlatformConnection(provider string, state *OAuthState, tokens map[str
 	return &connection, nil
 }
 
+// reauthorizeConnection replaces the credentials of the connection the state was started
+// for and marks it active. A refresh token the provider does not send again is kept.
+func reauthorizeConnection(state *OAuthState, tokens map[string]interface{}) (*PlatformConnection, error) {
+	sess := session.Must(session.NewSession())
+	svc := dynamodb.New(sess)
+
+	key := map[string]*dynamodb.AttributeValue{
+		"connectionId": {
+			S: aws.String(state.ConnectionID),
+		},
+	}
+
+	result, err := svc.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(platformConnectionsTable),
+		Key:       key,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var existing PlatformConnection
+	if result.Item != nil {
+		if err := dynamodbattribute.UnmarshalMap(result.Item, &existing); err != nil {
+			return nil, err
+		}
+	}
+	if result.Item == nil || existing.AccountID != state.AccountID {
+		return nil, fmt.Errorf("connection not found")
+	}
+
+	if _, ok := tokens["refresh_token"]; !ok {
+		if refreshToken, ok := existing.Credentials["refresh_token"]; ok {
+			tokens["refresh_token"] = refreshToken
+		}
+	}
+
+	credentials, err := dynamodbattribute.Marshal(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := time.Now()
+	updatedAt, err := dynamodbattribute.Marshal(timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	updateExpression := "SET credentials = :credentials, #status = :status, updatedAt = :updatedAt, lastConnected = :updatedAt"
+	remove := " REMOVE statusReason"
+	values := map[string]*dynamodb.AttributeValue{
+		":credentials": credentials,
+		":status":      {S: aws.String("active")},
+		":updatedAt":   updatedAt,
+		":accountId":   {S: aws.String(state.AccountID)},
+	}
+	if expiresIn, ok := tokens["expires_in"].(float64); ok {
+		expiresAt, err := dynamodbattribute.Marshal(timestamp.Add(time.Duration(expiresIn) * time.Second))
+		if err != nil {
+			return nil, err
+		}
+		updateExpression += ", expiresAt = :expiresAt"
+		values[":expiresAt"] = expiresAt
+	} else {
+		remove += ", expiresAt"
+	}
+	updateExpression += remove
+
+	updated, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                 aws.String(platformConnectionsTable),
+		Key:                       key,
+		UpdateExpression:          aws.String(updateExpression),
+		ConditionExpression:       aws.String("accountId = :accountId"),
+		ExpressionAttributeNames:  map[string]*string{"#status": aws.String("status")},
+		ExpressionAttributeValues: values,
+		ReturnValues:              aws.String("ALL_NEW"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var connection PlatformConnection
+	if err := dynamodbattribute.UnmarshalMap(updated.Attributes, &connection); err != nil {
+		return nil, err
+	}
+
+	return &connection, nil
+}
+
 func getPlatformFromDB(platformID string) (*Platform, error) {
 	sess := session.Must(session.NewSession())
 	svc := dynamodb.New(sess)
@@ -27,9 +27,10 @@ type Response struct {
 }
 
 type OAuthStartRequest struct {
-	Provider    string `json:"provider"`
-	RedirectURI string `json:"redirectUri,omitempty"`
-	ShopDomain  string `json:"shopDomain,omitempty"` // For Shopify specifically
+	Provider     string `json:"provider"`
+	RedirectURI  string `json:"redirectUri,omitempty"`
+	ShopDomain   string `json:"shopDomain,omitempty"`   // For Shopify specifically
+	ConnectionID string `json:"connectionId,omitempty"` // Existing connection to re-authorize
 }
 
 type OAuthState struct {
@@ -39,6 +40,7 @@ type OAuthState struct {
 	AccountID    string    `json:"accountId" dynamodbav:"accountId"`
 	RedirectURI  string    `json:"redirectUri" dynamodbav:"redirectUri"`
 	ShopDomain   string    `json:"shopDomain,omitempty" dynamodbav:"shopDomain"`
+	ConnectionID string    `json:"connectionId,omitempty" dynamodbav:"connectionId,omitempty"`
 	CreatedAt    time.Time `json:"createdAt" dynamodbav:"createdAt"`
 	ExpiresAt    time.Time `json:"expiresAt" dynamodbav:"expiresAt"`
 }
@@ -58,9 +60,16 @@ type OAuthConfiguration struct {
 	ResponseType string   `json:"responseType" dynamodbav:"responseType"`
 }
 
+type PlatformConnection struct {
+	ConnectionID string `json:"connectionId" dynamodbav:"connectionId"`
+	AccountID    string `json:"accountId" dynamodbav:"accountId"`
+	PlatformID   string `json:"platformId" dynamodbav:"platformId"`
+}
+
 var (
-	oauthStatesTable = os.Getenv("OAUTH_STATES_TABLE")
-	platformsTable   = os.Getenv("PLATFORMS_TABLE")
+	oauthStatesTable         = os.Getenv("OAUTH_STATES_TABLE")
+	platformsTable           = os.Getenv("PLATFORMS_TABLE")
+	platformConnectionsTable = os.Getenv("PLATFORM_CONNECTIONS_TABLE")
 )
 
 func Handle(event events.APIGatewayV2HTTPRequest) (events.APIGatewayProxyResponse, error) {
@@ -115,6 +124,11 @@ func Handle(event events.APIGatewayV2HTTPRequest) (events.APIGatewayProxyRespons
 		req.Provider = provider
 	}
 
+	// Re-authorizing an existing connection, e.g. from a connection health notification
+	if req.ConnectionID == "" {
+		req.ConnectionID = event.QueryStringParameters["connectionId"]
+	}
+
 	// Build default redirect URI if not provided
 	if req.RedirectURI == "" {
 		baseURL := getBaseURL(event)
@@ -143,9 +157,25 @@ func Handle(event events.APIGatewayV2HTTPRequest) (events.APIGatewayProxyRespons
 	if platformsTable == "" {
 		platformsTable = os.Getenv("DYNAMODB_TABLE_PREFIX") + "-platforms"
 	}
+	if platformConnectionsTable == "" {
+		platformConnectionsTable = os.Getenv("DYNAMODB_TABLE_PREFIX") + "-platform-connections"
+	}
+
+	if req.ConnectionID != "" {
+		if !strings.HasPrefix(req.ConnectionID, "connection:") {
+			req.ConnectionID = "connection:" + req.ConnectionID
+		}
+		connection, err := getConnectionFromDB(req.ConnectionID)
+		if err != nil || connection.AccountID != accountID {
+			return createErrorResponse(404, "Connection not found"), nil
+		}
+		if connection.PlatformID != "platform:"+provider {
+			return createErrorResponse(400, "Connection does not belong to provider "+provider), nil
+		}
+	}
 
 	// Generate OAuth authorization URL
-	authURL, state, err := generateAuthURL(provider, userID, accountID, req.RedirectURI, req.ShopDomain)
+	authURL, state, err := generateAuthURL(provider, userID, accountID, req.RedirectURI, req.ShopDomain, req.ConnectionID)
 	if err != nil {
 		log.Printf("Failed to generate auth URL for provider %s: %v", provider, err)
 		return createErrorResponse(500, "Failed to initiate OAuth flow"), nil
@@ -169,7 +199,7 @@ func Handle(event events.APIGatewayV2HTTPRequest) (events.APIGatewayProxyRespons
 	}), nil
 }
 
-func generateAuthURL(provider, userID, accountID, redirectURI, shopDomain string) (string, string, error) {
+func generateAuthURL(provider, userID, accountID, redirectURI, shopDomain, connectionID string) (string, string, error) {
 	// Get platform OAuth configuration
 	platformID := "platform:" + provider
 	platform, err := getPlatformFromDB(platformID)
@@ -189,14 +219,15 @@ func generateAuthURL(provider, userID, accountID, redirectURI, shopDomain string
 
 	// Save state to DynamoDB
 	stateRecord := OAuthState{
-		StateID:     state,
-		Provider:    provider,
-		UserID:      userID,
-		AccountID:   accountID,
-		RedirectURI: redirectURI,
-		ShopDomain:  shopDomain,
-		CreatedAt:   time.Now(),
-		ExpiresAt:   time.Now().Add(15 * time.Minute), // State expires in 15 minutes
+		StateID:      state,
+		Provider:     provider,
+		UserID:       userID,
+		AccountID:    accountID,
+		RedirectURI:  redirectURI,
+		ShopDomain:   shopDomain,
+		ConnectionID: connectionID,
+		CreatedAt:    time.Now(),
+		ExpiresAt:    time.Now().Add(15 * time.Minute), // State expires in 15 minutes
 	}
 
 	if err := saveOAuthState(&stateRecord); err != nil {
@@ -288,6 +319,35 @@ func getPlatformFromDB(platformID string) (*Platform, error) {
 	return &platform, nil
 }
 
+func getConnectionFromDB(connectionID string) (*PlatformConnection, error) {
+	sess := session.Must(session.NewSession())
+	svc := dynamodb.New(sess)
+
+	result, err := svc.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(platformConnectionsTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"connectionId": {
+				S: aws.String(connectionID),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, fmt.Errorf("connection not found")
+	}
+
+	var connection PlatformConnection
+	err = dynamodbattribute.UnmarshalMap(result.Item, &connection)
+	if err != nil {
+		return nil, err
+	}
+
+	return &connection, nil
+}
+
 func isValidProvider(provider string) bool {
 	validProviders := []string{"google", "shopify", "facebook", "instagram", "twitter", "linkedin"}
 	for _, p := range validProviders {
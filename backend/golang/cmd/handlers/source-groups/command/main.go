@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/listbackup/api/internal/services"
+	"github.com/listbackup/api/pkg/response"
+)
+
+type SourceGroupCommandHandler struct {
+	sources *services.SourceService
+	control *services.JobControlService
+}
+
+func NewSourceGroupCommandHandler(ctx context.Context) (*SourceGroupCommandHandler, error) {
+	sources, err := services.NewSourceService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create source service: %v", err)
+	}
+
+	control, err := services.NewJobControlService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job control service: %v", err)
+	}
+
+	return &SourceGroupCommandHandler{sources: sources, control: control}, nil
+}
+
+// Handle pauses, resumes or syncs a source group, cascading the command to its sources
+func (h *SourceGroupCommandHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var userID, accountID string
+	if authLambda, ok := event.RequestContext.Authorizer["lambda"].(map[string]interface{}); ok {
+		if uid, exists := authLambda["userId"].(string); exists {
+			userID = uid
+		}
+		if aid, exists := authLambda["accountId"].(string); exists {
+			accountID = aid
+		}
+	}
+
+	if userID == "" || accountID == "" {
+		return response.Unauthorized("User not authenticated"), nil
+	}
+
+	groupID := event.PathParameters["groupId"]
+	if groupID == "" {
+		return response.BadRequest("Group ID is required"), nil
+	}
+
+	command := event.PathParameters["command"]
+	switch command {
+	case services.SourceGroupCommandPause, services.SourceGroupCommandResume, services.SourceGroupCommandSync:
+	default:
+		return response.NotFound("Unknown source group command"), nil
+	}
+
+	group, err := h.sources.GetGroup(ctx, accountID, groupID)
+	if err != nil {
+		if errors.Is(err, services.ErrSourceGroupNotFound) {
+			return response.NotFound("Source group not found"), nil
+		}
+		log.Printf("Failed to get source group %s: %v", groupID, err)
+		return response.InternalServerError("Failed to get source group"), nil
+	}
+
+	result := map[string]interface{}{
+		"groupId": strings.TrimPrefix(group.GroupID, "group:"),
+	}
+
+	if command == services.SourceGroupCommandSync {
+		if group.Status == "paused" {
+			return response.Conflict(services.ErrSourceGroupPaused.Error()), nil
+		}
+
+		sources, err := h.sources.ListGroupSources(ctx, group.GroupID)
+		if err != nil {
+			log.Printf("Failed to list sources of group %s: %v", group.GroupID, err)
+			return response.InternalServerError("Failed to sync source group"), nil
+		}
+
+		backups := h.control.StartGroupBackup(ctx, sources, userID)
+		started := 0
+		for i := range backups {
+			backups[i].SourceID = strings.TrimPrefix(backups[i].SourceID, "source:")
+			backups[i].JobID = strings.TrimPrefix(backups[i].JobID, "job:")
+			if backups[i].Status == "started" {
+				started++
+			}
+		}
+
+		result["status"] = group.Status
+		result["started"] = started
+		result["sources"] = backups
+		return response.Accepted(result), nil
+	}
+
+	changed, err := h.sources.SetGroupPaused(ctx, group, userID, command == services.SourceGroupCommandPause)
+	if err != nil {
+		log.Printf("Failed to %s source group %s: %v", command, group.GroupID, err)
+		return response.InternalServerError(fmt.Sprintf("Failed to %s every source of the group, try again", command)), nil
+	}
+
+	result["status"] = group.Status
+	result["sourcesChanged"] = changed
+	return response.Success(result), nil
+}
+
+func main() {
+	handler, err := NewSourceGroupCommandHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create source group command handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/listbackup/api/internal/services"
+	"github.com/listbackup/api/pkg/response"
+)
+
+type SourceGroupHealthHandler struct {
+	sources *services.SourceService
+}
+
+func NewSourceGroupHealthHandler(ctx context.Context) (*SourceGroupHealthHandler, error) {
+	sources, err := services.NewSourceService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create source service: %v", err)
+	}
+
+	return &SourceGroupHealthHandler{sources: sources}, nil
+}
+
+// Handle reports the last successful backup of each source of a group and how many are failing
+func (h *SourceGroupHealthHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var userID, accountID string
+	if authLambda, ok := event.RequestContext.Authorizer["lambda"].(map[string]interface{}); ok {
+		if uid, exists := authLambda["userId"].(string); exists {
+			userID = uid
+		}
+		if aid, exists := authLambda["accountId"].(string); exists {
+			accountID = aid
+		}
+	}
+
+	if userID == "" || accountID == "" {
+		return response.Unauthorized("User not authenticated"), nil
+	}
+
+	groupID := event.PathParameters["groupId"]
+	if groupID == "" {
+		return response.BadRequest("Group ID is required"), nil
+	}
+
+	group, err := h.sources.GetGroup(ctx, accountID, groupID)
+	if err != nil {
+		if errors.Is(err, services.ErrSourceGroupNotFound) {
+			return response.NotFound("Source group not found"), nil
+		}
+		log.Printf("Failed to get source group %s: %v", groupID, err)
+		return response.InternalServerError("Failed to get source group"), nil
+	}
+
+	health, err := h.sources.GroupHealth(ctx, group)
+	if err != nil {
+		log.Printf("Failed to get health of source group %s: %v", group.GroupID, err)
+		return response.InternalServerError("Failed to get source group health"), nil
+	}
+
+	health.GroupID = strings.TrimPrefix(health.GroupID, "group:")
+	for i := range health.Sources {
+		health.Sources[i].SourceID = strings.TrimPrefix(health.Sources[i].SourceID, "source:")
+		health.Sources[i].LastJobID = strings.TrimPrefix(health.Sources[i].LastJobID, "job:")
+	}
+
+	return response.Success(health), nil
+}
+
+func main() {
+	handler, err := NewSourceGroupHealthHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create source group health handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/listbackup/api/internal/services"
+	apitypes "github.com/listbackup/api/internal/types"
+	"github.com/listbackup/api/pkg/response"
+)
+
+type SourceGroupSettingsHandler struct {
+	sources *services.SourceService
+}
+
+type SourceGroupSettingsRequest struct {
+	apitypes.SourceGroupSettings
+	ResetOverrides bool `json:"resetOverrides"` // Apply to sources that set their own values too
+}
+
+func NewSourceGroupSettingsHandler(ctx context.Context) (*SourceGroupSettingsHandler, error) {
+	sources, err := services.NewSourceService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create source service: %v", err)
+	}
+
+	return &SourceGroupSettingsHandler{sources: sources}, nil
+}
+
+// Handle replaces the schedule and retention a group shares with its sources
+func (h *SourceGroupSettingsHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var userID, accountID string
+	if authLambda, ok := event.RequestContext.Authorizer["lambda"].(map[string]interface{}); ok {
+		if uid, exists := authLambda["userId"].(string); exists {
+			userID = uid
+		}
+		if aid, exists := authLambda["accountId"].(string); exists {
+			accountID = aid
+		}
+	}
+
+	if userID == "" || accountID == "" {
+		return response.Unauthorized("User not authenticated"), nil
+	}
+
+	groupID := event.PathParameters["groupId"]
+	if groupID == "" {
+		return response.BadRequest("Group ID is required"), nil
+	}
+
+	var req SourceGroupSettingsRequest
+	if err := json.Unmarshal([]byte(event.Body), &req); err != nil {
+		return response.BadRequest("Invalid request body"), nil
+	}
+
+	group, err := h.sources.GetGroup(ctx, accountID, groupID)
+	if err != nil {
+		if errors.Is(err, services.ErrSourceGroupNotFound) {
+			return response.NotFound("Source group not found"), nil
+		}
+		log.Printf("Failed to get source group %s: %v", groupID, err)
+		return response.InternalServerError("Failed to get source group"), nil
+	}
+
+	updated, err := h.sources.SetGroupSettings(ctx, group, userID, req.SourceGroupSettings, req.ResetOverrides)
+	if err != nil {
+		var validationErr *services.ValidationError
+		if errors.As(err, &validationErr) {
+			return response.BadRequest(err.Error()), nil
+		}
+		log.Printf("Failed to update settings of source group %s: %v", group.GroupID, err)
+		return response.InternalServerError("Failed to apply the settings to every source of the group, try again"), nil
+	}
+
+	return response.Success(map[string]interface{}{
+		"groupId":        strings.TrimPrefix(group.GroupID, "group:"),
+		"settings":       group.Settings,
+		"sourcesUpdated": updated,
+	}), nil
+}
+
+func main() {
+	handler, err := NewSourceGroupSettingsHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create source group settings handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
@@ -14,10 +14,12 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/listbackup/api/internal/services"
 )
 
 type UpdateSourceGroupHandler struct {
-	db *dynamodb.DynamoDB
+	db      *dynamodb.DynamoDB
+	sources *services.SourceService
 }
 
 type UpdateSourceGroupRequest struct {
@@ -52,8 +54,13 @@ func NewUpdateSourceGroupHandler() (*UpdateSourceGroupHandler, error) {
 		return nil, err
 	}
 
+	sources, err := services.NewSourceService(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
 	db := dynamodb.New(sess)
-	return &UpdateSourceGroupHandler{db: db}, nil
+	return &UpdateSourceGroupHandler{db: db, sources: sources}, nil
 }
 
 func (h *UpdateSourceGroupHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
@@ -135,6 +142,39 @@ func (h *UpdateSourceGroupHandler) Handle(ctx context.Context, event events.APIG
 		}, nil
 	}
 
+	// Pausing and resuming cascade to the group's sources
+	cascade := req.Status == "paused" || req.Status == "active"
+	if cascade {
+		group, err := h.sources.GetGroup(ctx, accountID, groupId)
+		if err != nil {
+			log.Printf("Failed to get source group: %v", err)
+			return events.APIGatewayProxyResponse{
+				StatusCode: 404,
+				Headers: map[string]string{
+					"Access-Control-Allow-Origin":  "*",
+					"Access-Control-Allow-Methods": "GET, POST, PUT, DELETE, OPTIONS",
+					"Access-Control-Allow-Headers": "Content-Type, Authorization",
+					"Content-Type":                 "application/json",
+				},
+				Body: `{"success": false, "error": "Source group not found"}`,
+			}, nil
+		}
+
+		if _, err := h.sources.SetGroupPaused(ctx, group, userID, req.Status == "paused"); err != nil {
+			log.Printf("Failed to change status of source group: %v", err)
+			return events.APIGatewayProxyResponse{
+				StatusCode: 500,
+				Headers: map[string]string{
+					"Access-Control-Allow-Origin":  "*",
+					"Access-Control-Allow-Methods": "GET, POST, PUT, DELETE, OPTIONS",
+					"Access-Control-Allow-Headers": "Content-Type, Authorization",
+					"Content-Type":                 "application/json",
+				},
+				Body: `{"success": false, "error": "Failed to change the status of every source in the group"}`,
+			}, nil
+		}
+	}
+
 	// Get table name
 	sourceGroupsTable := os.Getenv("SOURCE_GROUPS_TABLE")
 	if sourceGroupsTable == "" {
@@ -155,7 +195,7 @@ func (h *UpdateSourceGroupHandler) Handle(ctx context.Context, event events.APIG
 		updateExpr += ", description = :description"
 		exprValues[":description"] = &dynamodb.AttributeValue{S: aws.String(req.Description)}
 	}
-	if req.Status != "" {
+	if req.Status != "" && !cascade {
 		updateExpr += ", #status = :status"
 		exprValues[":status"] = &dynamodb.AttributeValue{S: aws.String(req.Status)}
 	}
@@ -164,7 +204,7 @@ func (h *UpdateSourceGroupHandler) Handle(ctx context.Context, event events.APIG
 	if req.Name != "" {
 		exprNames["#name"] = aws.String("name")
 	}
-	if req.Status != "" {
+	if req.Status != "" && !cascade {
 		exprNames["#status"] = aws.String("status")
 	}
 
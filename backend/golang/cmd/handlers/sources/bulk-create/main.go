@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/listbackup/api/internal/services"
+	"github.com/listbackup/api/pkg/response"
+)
+
+type BulkCreateSourcesHandler struct {
+	sources *services.SourceService
+}
+
+type BulkCreateSourcesRequest struct {
+	ConnectionID      string   `json:"connectionId"`
+	PlatformSourceIDs []string `json:"platformSourceIds"`
+	AllDefaults       bool     `json:"allDefaults"` // Use every platform source enabled by default
+	GroupName         string   `json:"groupName"`
+	Description       string   `json:"description"`
+}
+
+func NewBulkCreateSourcesHandler(ctx context.Context) (*BulkCreateSourcesHandler, error) {
+	sources, err := services.NewSourceService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create source service: %v", err)
+	}
+
+	return &BulkCreateSourcesHandler{sources: sources}, nil
+}
+
+// Handle creates a source group for a connection with a source for each selected platform
+// source. Either all of them are created or none are.
+func (h *BulkCreateSourcesHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var userID, accountID string
+	if authLambda, ok := event.RequestContext.Authorizer["lambda"].(map[string]interface{}); ok {
+		if uid, exists := authLambda["userId"].(string); exists {
+			userID = uid
+		}
+		if aid, exists := authLambda["accountId"].(string); exists {
+			accountID = aid
+		}
+	}
+
+	if userID == "" || accountID == "" {
+		return response.Unauthorized("User not authenticated"), nil
+	}
+
+	var req BulkCreateSourcesRequest
+	if err := json.Unmarshal([]byte(event.Body), &req); err != nil {
+		return response.BadRequest("Invalid request body"), nil
+	}
+
+	result, err := h.sources.BulkCreateSources(ctx, accountID, userID, services.BulkSourceInput{
+		ConnectionID:      req.ConnectionID,
+		PlatformSourceIDs: req.PlatformSourceIDs,
+		AllDefaults:       req.AllDefaults,
+		GroupName:         req.GroupName,
+		Description:       req.Description,
+	})
+	if err != nil {
+		var validationErr *services.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			return response.BadRequest(err.Error()), nil
+		case errors.Is(err, services.ErrSourceLimitReached):
+			return response.Forbidden(err.Error()), nil
+		case errors.Is(err, services.ErrConnectionNotFound):
+			return response.NotFound("Connection not found"), nil
+		case errors.Is(err, services.ErrConnectionInactive):
+			return response.BadRequest("Connection is not active"), nil
+		case errors.Is(err, services.ErrSourceExists):
+			return response.Conflict("A source or source group with the same ID already exists, try again"), nil
+		}
+		log.Printf("Failed to create sources: %v", err)
+		return response.InternalServerError("Failed to create sources"), nil
+	}
+
+	result.Group.GroupID = strings.TrimPrefix(result.Group.GroupID, "group:")
+	result.Group.ConnectionID = strings.TrimPrefix(result.Group.ConnectionID, "connection:")
+	for i := range result.Sources {
+		source := &result.Sources[i]
+		source.SourceID = strings.TrimPrefix(source.SourceID, "source:")
+		source.GroupID = result.Group.GroupID
+		source.ConnectionID = result.Group.ConnectionID
+		source.PlatformSourceID = strings.TrimPrefix(source.PlatformSourceID, "platform-source:")
+	}
+
+	return response.Created(result), nil
+}
+
+func main() {
+	handler, err := NewBulkCreateSourcesHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create bulk create sources handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
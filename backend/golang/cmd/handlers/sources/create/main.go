@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
 	"strings"
@@ -15,6 +16,8 @@ import (
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/google/uuid"
+	"github.com/listbackup/api/internal/services"
+	apitypes "github.com/listbackup/api/internal/types"
 )
 
 type CreateSourceHandler struct {
@@ -32,6 +35,7 @@ type Source struct {
 	Name             string        `json:"name" dynamodbav:"name"`
 	Status           string        `json:"status" dynamodbav:"status"`
 	Settings         SourceSettings `json:"settings" dynamodbav:"settings"`
+	TemplateVersion  int           `json:"templateVersion,omitempty" dynamodbav:"templateVersion,omitempty"`
 	CreatedAt        time.Time     `json:"createdAt" dynamodbav:"createdAt"`
 	UpdatedAt        time.Time     `json:"updatedAt" dynamodbav:"updatedAt"`
 	LastSyncAt       *time.Time    `json:"lastSyncAt,omitempty" dynamodbav:"lastSyncAt,omitempty"`
@@ -49,6 +53,8 @@ type SourceSettings struct {
 	IncrementalSync bool                     `json:"incrementalSync" dynamodbav:"incrementalSync"`
 	Notifications   BackupNotificationSettings `json:"notifications" dynamodbav:"notifications"`
 	CustomParams    map[string]string        `json:"customParams" dynamodbav:"customParams"`
+	Filters         []apitypes.RecordFilter  `json:"filters,omitempty" dynamodbav:"filters,omitempty"`
+	Masking         []apitypes.MaskingRule   `json:"masking,omitempty" dynamodbav:"masking,omitempty"`
 }
 
 type BackupNotificationSettings struct {
@@ -83,6 +89,8 @@ type PlatformSource struct {
 	Popularity       int                    `json:"popularity" dynamodbav:"popularity"`
 	Status           string                 `json:"status" dynamodbav:"status"`
 	DefaultSettings  PlatformSourceDefaults `json:"defaultSettings" dynamodbav:"defaultSettings"`
+	Endpoints        map[string]apitypes.PlatformEndpoint `json:"endpoints" dynamodbav:"endpoints"`
+	Version          int                    `json:"version,omitempty" dynamodbav:"version,omitempty"`
 	CreatedAt        time.Time              `json:"createdAt" dynamodbav:"createdAt"`
 	UpdatedAt        time.Time              `json:"updatedAt" dynamodbav:"updatedAt"`
 }
@@ -266,6 +274,11 @@ func (h *CreateSourceHandler) Handle(ctx context.Context, event events.APIGatewa
 		return errResp, nil
 	}
 
+	// Dependency cycles would stall every backup of the source, so reject them up front
+	if errResp := h.validateDependencies(platformSource); errResp.StatusCode != 0 {
+		return errResp, nil
+	}
+
 	// Verify group if specified
 	if req.GroupID != "" {
 		errResp := h.validateSourceGroup(ctx, req.GroupID, userID, accountID)
@@ -279,6 +292,15 @@ func (h *CreateSourceHandler) Handle(ctx context.Context, event events.APIGatewa
 
 	// Create source settings from platform source defaults and user overrides
 	sourceSettings := h.createSourceSettings(platformSource, req.Settings)
+	if err := services.ValidateSourceParams(platformSource.Endpoints, platformSource.DefaultSettings.CustomParams, sourceSettings.CustomParams); err != nil {
+		return settingsError(err), nil
+	}
+	if err := services.ValidateRecordFilters(platformSource.Endpoints, sourceSettings.Filters); err != nil {
+		return settingsError(err), nil
+	}
+	if err := services.ValidateMaskingRules(platformSource.Endpoints, sourceSettings.Masking); err != nil {
+		return settingsError(err), nil
+	}
 
 	// Create source object
 	now := time.Now()
@@ -292,6 +314,7 @@ func (h *CreateSourceHandler) Handle(ctx context.Context, event events.APIGatewa
 		Name:             req.Name,
 		Status:           "active",
 		Settings:         sourceSettings,
+		TemplateVersion:  platformSource.Version,
 		CreatedAt:        now,
 		UpdatedAt:        now,
 		LastSyncAt:       nil,
@@ -566,6 +589,52 @@ func (h *CreateSourceHandler) validatePlatformSource(ctx context.Context, platfo
 	return &platformSource, events.APIGatewayProxyResponse{}
 }
 
+// validateDependencies checks that the platform source's endpoint dependencies can be
+// ordered. Dependencies between platform sources are informational: backups of different
+// sources are not ordered, so they are not checked here.
+func (h *CreateSourceHandler) validateDependencies(platformSource *PlatformSource) events.APIGatewayProxyResponse {
+	if err := services.ValidateEndpointDependencies(platformSource.Endpoints); err != nil {
+		return configurationError(platformSource.PlatformSourceID, err)
+	}
+	return events.APIGatewayProxyResponse{}
+}
+
+// configurationError reports a platform source whose dependencies cannot be scheduled
+func configurationError(platformSourceID string, err error) events.APIGatewayProxyResponse {
+	body, _ := json.Marshal(map[string]interface{}{
+		"success": false,
+		"error":   fmt.Sprintf("Platform source %s is misconfigured: %v", strings.TrimPrefix(platformSourceID, "platform-source:"), err),
+	})
+	return events.APIGatewayProxyResponse{
+		StatusCode: 400,
+		Headers: map[string]string{
+			"Access-Control-Allow-Origin":  "*",
+			"Access-Control-Allow-Methods": "GET, POST, PUT, DELETE, OPTIONS",
+			"Access-Control-Allow-Headers": "Content-Type, Authorization",
+			"Content-Type":                 "application/json",
+		},
+		Body: string(body),
+	}
+}
+
+// settingsError reports source settings that do not fit the platform source
+func settingsError(err error) events.APIGatewayProxyResponse {
+	body, _ := json.Marshal(map[string]interface{}{
+		"success": false,
+		"error":   fmt.Sprintf("Invalid source settings: %v", err),
+	})
+	return events.APIGatewayProxyResponse{
+		StatusCode: 400,
+		Headers: map[string]string{
+			"Access-Control-Allow-Origin":  "*",
+			"Access-Control-Allow-Methods": "GET, POST, PUT, DELETE, OPTIONS",
+			"Access-Control-Allow-Headers": "Content-Type, Authorization",
+			"Content-Type":                 "application/json",
+		},
+		Body: string(body),
+	}
+}
+
 func (h *CreateSourceHandler) validateSourceGroup(ctx context.Context, groupID, userID, accountID string) events.APIGatewayProxyResponse {
 	sourceGroupsTable := os.Getenv("SOURCE_GROUPS_TABLE")
 	if sourceGroupsTable == "" {
@@ -666,6 +735,8 @@ func (h *CreateSourceHandler) createSourceSettings(platformSource *PlatformSourc
 		if userSettings.CustomParams != nil {
 			settings.CustomParams = userSettings.CustomParams
 		}
+		settings.Filters = userSettings.Filters
+		settings.Masking = userSettings.Masking
 		// Note: Using userSettings.Enabled as override since it's a bool and default is fine
 		settings.Enabled = userSettings.Enabled
 		settings.IncrementalSync = userSettings.IncrementalSync
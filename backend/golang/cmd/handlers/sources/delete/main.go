@@ -2,60 +2,107 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
-	"os"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/listbackup/api/internal/database"
+	"github.com/listbackup/api/internal/services"
+	apitypes "github.com/listbackup/api/internal/types"
+	"github.com/listbackup/api/pkg/response"
 )
 
 type DeleteSourceHandler struct {
-	db *dynamodb.DynamoDB
+	db         *database.DynamoDBClient
+	legalHolds *services.LegalHoldService
 }
 
-func NewDeleteSourceHandler() (*DeleteSourceHandler, error) {
-	region := os.Getenv("AWS_REGION")
-	if region == "" {
-		region = "us-west-2"
+func NewDeleteSourceHandler(ctx context.Context) (*DeleteSourceHandler, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
 	}
-	sess, err := session.NewSession(&aws.Config{Region: aws.String(region)})
+
+	legalHolds, err := services.NewLegalHoldService(ctx)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to create legal hold service: %v", err)
 	}
-	return &DeleteSourceHandler{db: dynamodb.New(sess)}, nil
+
+	return &DeleteSourceHandler{db: db, legalHolds: legalHolds}, nil
 }
 
 func (h *DeleteSourceHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	if event.HTTPMethod == "OPTIONS" {
-		return events.APIGatewayProxyResponse{
-			StatusCode: 200,
-			Headers: map[string]string{
-				"Access-Control-Allow-Origin":  "*",
-				"Access-Control-Allow-Methods": "GET, POST, PUT, DELETE, OPTIONS",
-				"Access-Control-Allow-Headers": "Content-Type, Authorization",
-			},
-		}, nil
-	}
-
-	return events.APIGatewayProxyResponse{
-		StatusCode: 200,
-		Headers: map[string]string{
-			"Access-Control-Allow-Origin":  "*",
-			"Access-Control-Allow-Methods": "GET, POST, PUT, DELETE, OPTIONS",
-			"Access-Control-Allow-Headers": "Content-Type, Authorization",
-			"Content-Type":                 "application/json",
-		},
-		Body: `{"success": true, "message": "Source delete endpoint ready"}`,
-	}, nil
+		return response.Options(), nil
+	}
+
+	sourceID := event.PathParameters["sourceId"]
+	if sourceID == "" {
+		return response.BadRequest("Source ID is required"), nil
+	}
+	if !strings.HasPrefix(sourceID, "source:") {
+		sourceID = "source:" + sourceID
+	}
+
+	var userID, accountID string
+	if authLambda, ok := event.RequestContext.Authorizer["lambda"].(map[string]interface{}); ok {
+		if uid, exists := authLambda["userId"].(string); exists {
+			userID = uid
+		}
+		if aid, exists := authLambda["accountId"].(string); exists {
+			accountID = aid
+		}
+	} else {
+		if uid, exists := event.RequestContext.Authorizer["userId"].(string); exists {
+			userID = uid
+		}
+		if aid, exists := event.RequestContext.Authorizer["accountId"].(string); exists {
+			accountID = aid
+		}
+	}
+
+	if userID == "" || accountID == "" {
+		log.Printf("Auth failed - userID: %s, accountID: %s", userID, accountID)
+		return response.Unauthorized("User not authenticated"), nil
+	}
+
+	sourceIDAttr, err := attributevalue.Marshal(sourceID)
+	if err != nil {
+		log.Printf("Failed to marshal sourceID: %v", err)
+		return response.InternalServerError("Failed to process request"), nil
+	}
+
+	var source apitypes.Source
+	err = h.db.GetItem(ctx, database.SourcesTable, map[string]types.AttributeValue{
+		"sourceId": sourceIDAttr,
+	}, &source)
+	if err != nil || source.AccountID != accountID {
+		return response.NotFound("Source not found"), nil
+	}
+
+	blocker, err := h.legalHolds.SourceDeletionBlocker(ctx, &source)
+	if err != nil {
+		log.Printf("Failed to check legal holds for %s: %v", sourceID, err)
+		return response.InternalServerError("Failed to check legal holds"), nil
+	}
+	if blocker != "" {
+		return response.Conflict(fmt.Sprintf("Source cannot be deleted: %s", blocker)), nil
+	}
+
+	return response.Success(map[string]interface{}{
+		"sourceId": strings.TrimPrefix(sourceID, "source:"),
+		"message":  "Source delete endpoint ready",
+	}), nil
 }
 
 func main() {
-	handler, err := NewDeleteSourceHandler()
+	handler, err := NewDeleteSourceHandler(context.Background())
 	if err != nil {
 		log.Fatalf("Failed to create delete source handler: %v", err)
 	}
 	lambda.Start(handler.Handle)
-}
\ No newline at end of file
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	apitypes "github.com/listbackup/api/internal/types"
 )
 
 type GetSourceHandler struct {
@@ -47,6 +48,8 @@ type SourceSettings struct {
 	IncrementalSync bool                     `json:"incrementalSync" dynamodbav:"incrementalSync"`
 	Notifications   BackupNotificationSettings `json:"notifications" dynamodbav:"notifications"`
 	CustomParams    map[string]string        `json:"customParams" dynamodbav:"customParams"`
+	Filters         []apitypes.RecordFilter  `json:"filters,omitempty" dynamodbav:"filters,omitempty"`
+	Masking         []apitypes.MaskingRule   `json:"masking,omitempty" dynamodbav:"masking,omitempty"`
 }
 
 type BackupNotificationSettings struct {
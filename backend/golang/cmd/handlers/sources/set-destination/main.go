@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/listbackup/api/internal/database"
+	"github.com/listbackup/api/internal/services"
+	apitypes "github.com/listbackup/api/internal/types"
+	"github.com/listbackup/api/pkg/response"
+)
+
+type SetDestinationHandler struct {
+	db           *database.DynamoDBClient
+	destinations *services.DestinationService
+}
+
+type SetDestinationRequest struct {
+	DestinationID string `json:"destinationId"` // Empty to stop mirroring
+}
+
+func NewSetDestinationHandler(ctx context.Context) (*SetDestinationHandler, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	destinations, err := services.NewDestinationService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create destination service: %v", err)
+	}
+
+	return &SetDestinationHandler{db: db, destinations: destinations}, nil
+}
+
+func (h *SetDestinationHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var userID, accountID string
+	if authLambda, ok := event.RequestContext.Authorizer["lambda"].(map[string]interface{}); ok {
+		if uid, exists := authLambda["userId"].(string); exists {
+			userID = uid
+		}
+		if aid, exists := authLambda["accountId"].(string); exists {
+			accountID = aid
+		}
+	}
+
+	if userID == "" || accountID == "" {
+		return response.Unauthorized("User not authenticated"), nil
+	}
+
+	sourceID := event.PathParameters["sourceId"]
+	if sourceID == "" {
+		return response.BadRequest("Source ID is required"), nil
+	}
+	if !strings.HasPrefix(sourceID, "source:") {
+		sourceID = "source:" + sourceID
+	}
+
+	var req SetDestinationRequest
+	if err := json.Unmarshal([]byte(event.Body), &req); err != nil {
+		return response.BadRequest("Invalid request body"), nil
+	}
+
+	sourceIDAttr, err := attributevalue.Marshal(sourceID)
+	if err != nil {
+		log.Printf("Failed to marshal sourceID: %v", err)
+		return response.InternalServerError("Failed to process request"), nil
+	}
+
+	var source apitypes.Source
+	err = h.db.GetItem(ctx, database.SourcesTable, map[string]types.AttributeValue{
+		"sourceId": sourceIDAttr,
+	}, &source)
+	if err != nil || source.AccountID != accountID {
+		return response.NotFound("Source not found"), nil
+	}
+
+	if err := h.destinations.SetSourceDestination(ctx, &source, req.DestinationID, userID); err != nil {
+		var validationErr *services.ValidationError
+		if errors.As(err, &validationErr) {
+			return response.BadRequest(err.Error()), nil
+		}
+		log.Printf("Failed to set destination of %s: %v", sourceID, err)
+		return response.InternalServerError("Failed to update source"), nil
+	}
+
+	return response.Success(map[string]interface{}{
+		"sourceId":      strings.TrimPrefix(source.SourceID, "source:"),
+		"destinationId": strings.TrimPrefix(source.DestinationID, "destination:"),
+	}), nil
+}
+
+func main() {
+	handler, err := NewSetDestinationHandler(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create set destination handler: %v", err)
+	}
+
+	lambda.Start(handler.Handle)
+}
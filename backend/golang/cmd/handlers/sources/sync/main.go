@@ -2,60 +2,95 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
-	"os"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/listbackup/api/internal/database"
+	"github.com/listbackup/api/internal/services"
+	apitypes "github.com/listbackup/api/internal/types"
+	"github.com/listbackup/api/pkg/response"
 )
 
 type SyncSourceHandler struct {
-	db *dynamodb.DynamoDB
+	db      *database.DynamoDBClient
+	control *services.JobControlService
 }
 
-func NewSyncSourceHandler() (*SyncSourceHandler, error) {
-	region := os.Getenv("AWS_REGION")
-	if region == "" {
-		region = "us-west-2"
+func NewSyncSourceHandler(ctx context.Context) (*SyncSourceHandler, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
 	}
-	sess, err := session.NewSession(&aws.Config{Region: aws.String(region)})
+
+	control, err := services.NewJobControlService(ctx)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to create job control service: %v", err)
 	}
-	return &SyncSourceHandler{db: dynamodb.New(sess)}, nil
+
+	return &SyncSourceHandler{db: db, control: control}, nil
 }
 
+// Handle starts an on-demand backup of a source. Its progress is followed with
+// GET /jobs/{jobId}/progress.
 func (h *SyncSourceHandler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	if event.HTTPMethod == "OPTIONS" {
-		return events.APIGatewayProxyResponse{
-			StatusCode: 200,
-			Headers: map[string]string{
-				"Access-Control-Allow-Origin":  "*",
-				"Access-Control-Allow-Methods": "GET, POST, PUT, DELETE, OPTIONS",
-				"Access-Control-Allow-Headers": "Content-Type, Authorization",
-			},
-		}, nil
-	}
-
-	return events.APIGatewayProxyResponse{
-		StatusCode: 200,
-		Headers: map[string]string{
-			"Access-Control-Allow-Origin":  "*",
-			"Access-Control-Allow-Methods": "GET, POST, PUT, DELETE, OPTIONS",
-			"Access-Control-Allow-Headers": "Content-Type, Authorization",
-			"Content-Type":                 "application/json",
-		},
-		Body: `{"success": true, "message": "Source sync endpoint ready"}`,
-	}, nil
+	var userID, accountID string
+	if authLambda, ok := event.RequestContext.Authorizer["lambda"].(map[string]interface{}); ok {
+		if uid, exists := authLambda["userId"].(string); exists {
+			userID = uid
+		}
+		if aid, exists := authLambda["accountId"].(string); exists {
+			accountID = aid
+		}
+	}
+
+	if userID == "" || accountID == "" {
+		return response.Unauthorized("User not authenticated"), nil
+	}
+
+	sourceID := event.PathParameters["sourceId"]
+	if sourceID == "" {
+		return response.BadRequest("Source ID is required"), nil
+	}
+	if !strings.HasPrefix(sourceID, "source:") {
+		sourceID = "source:" + sourceID
+	}
+
+	var source apitypes.Source
+	err := h.db.GetItem(ctx, database.SourcesTable, map[string]types.AttributeValue{
+		"sourceId": &types.AttributeValueMemberS{Value: sourceID},
+	}, &source)
+	if err != nil || source.AccountID != accountID {
+		return response.NotFound("Source not found"), nil
+	}
+
+	job, err := h.control.StartBackup(ctx, &source, userID)
+	if err != nil {
+		if errors.Is(err, services.ErrJobInFlight) {
+			return response.Conflict(fmt.Sprintf("A backup of this source is already %s (job %s)",
+				job.Status, strings.TrimPrefix(job.JobID, "job:"))), nil
+		}
+		log.Printf("Failed to start backup of %s: %v", sourceID, err)
+		return response.InternalServerError("Failed to start backup"), nil
+	}
+
+	return response.Accepted(map[string]interface{}{
+		"jobId":    strings.TrimPrefix(job.JobID, "job:"),
+		"sourceId": strings.TrimPrefix(job.SourceID, "source:"),
+		"status":   job.Status,
+		"trigger":  job.Trigger,
+	}), nil
 }
 
 func main() {
-	handler, err := NewSyncSourceHandler()
+	handler, err := NewSyncSourceHandler(context.Background())
 	if err != nil {
 		log.Fatalf("Failed to create sync source handler: %v", err)
 	}
+
 	lambda.Start(handler.Handle)
-}
\ No newline at end of file
+}
@@ -3,19 +3,24 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"log"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/listbackup/api/internal/services"
 )
 
 type HealthStatus struct {
-	Status    string    `json:"status"`
-	Timestamp time.Time `json:"timestamp"`
-	Version   string    `json:"version"`
-	Service   string    `json:"service"`
+	Status    string                  `json:"status"`
+	Timestamp time.Time               `json:"timestamp"`
+	Version   string                  `json:"version"`
+	Service   string                  `json:"service"`
+	Dispatch  *services.DispatchStats `json:"dispatch,omitempty"`
 }
 
+var dispatch *services.DispatchService
+
 func handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	health := HealthStatus{
 		Status:    "healthy",
@@ -24,6 +29,16 @@ func handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.A
 		Service:   "listbackup-api",
 	}
 
+	// The job queues are reported as degraded rather than failing the health check
+	if dispatch == nil {
+		health.Status = "degraded"
+	} else if stats, err := dispatch.Stats(ctx); err != nil {
+		log.Printf("Failed to get dispatch stats: %v", err)
+		health.Status = "degraded"
+	} else {
+		health.Dispatch = stats
+	}
+
 	body, _ := json.Marshal(map[string]interface{}{
 		"success": true,
 		"data":    health,
@@ -42,5 +57,11 @@ func handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.A
 }
 
 func main() {
+	var err error
+	dispatch, err = services.NewDispatchService(context.Background())
+	if err != nil {
+		log.Printf("Failed to create dispatch service: %v", err)
+	}
+
 	lambda.Start(handler)
 }
\ No newline at end of file
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/listbackup/api/internal/services"
+)
+
+func main() {
+	platformSourceID := flag.String("platform-source", "", "platform source to migrate sources of")
+	dryRun := flag.Bool("dry-run", false, "report what would change without writing")
+	diff := flag.String("diff", "", "print the diff between two recorded versions, e.g. 1,2")
+	versions := flag.Bool("versions", false, "list the recorded versions of the platform source")
+	flag.Parse()
+
+	if *platformSourceID == "" {
+		log.Fatalf("-platform-source is required")
+	}
+	id := *platformSourceID
+	if !strings.HasPrefix(id, "platform-source:") {
+		id = "platform-source:" + id
+	}
+
+	ctx := context.Background()
+	catalog, err := services.NewCatalogService(ctx)
+	if err != nil {
+		log.Fatalf("Failed to create catalog service: %v", err)
+	}
+
+	switch {
+	case *versions:
+		recorded, err := catalog.ListVersions(ctx, id)
+		if err != nil {
+			log.Fatalf("Failed to list versions: %v", err)
+		}
+		for _, version := range recorded {
+			fmt.Printf("v%d\tpublished %s\n", version.Version, version.PublishedAt.Format("2006-01-02 15:04:05"))
+		}
+
+	case *diff != "":
+		from, to, err := parseVersions(*diff)
+		if err != nil {
+			log.Fatalf("Invalid -diff: %v", err)
+		}
+		before, err := catalog.GetVersion(ctx, id, from)
+		if err != nil {
+			log.Fatalf("Failed to get version %d: %v", from, err)
+		}
+		after, err := catalog.GetVersion(ctx, id, to)
+		if err != nil {
+			log.Fatalf("Failed to get version %d: %v", to, err)
+		}
+		printJSON(services.DiffPlatformSources(before, after))
+
+	default:
+		report, err := catalog.MigrateSources(ctx, id, *dryRun)
+		if err != nil {
+			log.Fatalf("Failed to migrate sources: %v", err)
+		}
+		printJSON(report)
+		log.Printf("%d upgraded, %d up to date, %d failed (dry run: %t)", report.Upgraded, report.UpToDate, report.Failed, report.DryRun)
+		if report.Failed > 0 {
+			os.Exit(1)
+		}
+	}
+}
+
+func parseVersions(value string) (int, int, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("expected two versions separated by a comma")
+	}
+	from, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid version %q", parts[0])
+	}
+	to, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid version %q", parts[1])
+	}
+	return from, to, nil
+}
+
+func printJSON(value interface{}) {
+	out, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to marshal output: %v", err)
+	}
+	fmt.Println(string(out))
+}
@@ -2,12 +2,11 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/listbackup/api/internal/database"
+	"github.com/listbackup/api/internal/services"
 	"github.com/listbackup/api/internal/types"
 )
 
@@ -27,14 +26,21 @@ func main() {
 	}
 	log.Printf("Created Keap platform: %s", platform.PlatformID)
 
-	// Create Keap platform sources
+	catalog, err := services.NewCatalogService(ctx)
+	if err != nil {
+		log.Fatalf("Failed to create catalog service: %v", err)
+	}
+
+	// Publish Keap platform sources, versioning any template that changed
 	platformSources := createKeapPlatformSources(platform.PlatformID)
 	for _, source := range platformSources {
-		err = db.PutItem(ctx, database.PlatformSourcesTable, source)
+		published, changed, err := catalog.PublishPlatformSource(ctx, source)
 		if err != nil {
-			log.Printf("Failed to create platform source %s: %v", source.Name, err)
+			log.Printf("Failed to publish platform source %s: %v", source.Name, err)
+		} else if changed {
+			log.Printf("Published platform source: %s (version %d)", source.Name, published.Version)
 		} else {
-			log.Printf("Created platform source: %s", source.Name)
+			log.Printf("Platform source unchanged: %s (version %d)", source.Name, published.Version)
 		}
 	}
 
@@ -82,7 +88,7 @@ func createKeapPlatform() types.Platform {
 func createKeapPlatformSources(platformID string) []types.PlatformSource {
 	sources := []types.PlatformSource{
 		{
-			PlatformSourceID: fmt.Sprintf("platform-source:%s", uuid.New().String()),
+			PlatformSourceID: "platform-source:keap-contacts",
 			PlatformID:       platformID,
 			Name:             "Keap Contacts",
 			Description:      "Backup all contact records including custom fields, tags, and contact history",
@@ -147,7 +153,7 @@ func createKeapPlatformSources(platformID string) []types.PlatformSource {
 			UpdatedAt:    time.Now(),
 		},
 		{
-			PlatformSourceID: fmt.Sprintf("platform-source:%s", uuid.New().String()),
+			PlatformSourceID: "platform-source:keap-orders",
 			PlatformID:       platformID,
 			Name:             "Keap Orders",
 			Description:      "Backup all order and transaction data including line items and payment information",
@@ -184,7 +190,7 @@ func createKeapPlatformSources(platformID string) []types.PlatformSource {
 					DefaultPriority:     "high",
 					DefaultFrequency:    "daily",
 					SupportsIncremental: true,
-					Dependencies:        []string{"contacts"},
+					Dependencies:        []string{},
 					Parameters: []types.APIParameter{
 						{Name: "limit", Type: "integer", Required: false, Default: "1000", Description: "Number of records per page"},
 						{Name: "offset", Type: "integer", Required: false, Default: "0", Description: "Record offset for pagination"},
@@ -210,7 +216,7 @@ func createKeapPlatformSources(platformID string) []types.PlatformSource {
 			UpdatedAt:    time.Now(),
 		},
 		{
-			PlatformSourceID: fmt.Sprintf("platform-source:%s", uuid.New().String()),
+			PlatformSourceID: "platform-source:keap-campaigns",
 			PlatformID:       platformID,
 			Name:             "Keap Campaigns",
 			Description:      "Backup email marketing campaigns, sequences, and automation workflows",
@@ -270,7 +276,7 @@ func createKeapPlatformSources(platformID string) []types.PlatformSource {
 			UpdatedAt:    time.Now(),
 		},
 		{
-			PlatformSourceID: fmt.Sprintf("platform-source:%s", uuid.New().String()),
+			PlatformSourceID: "platform-source:keap-tags",
 			PlatformID:       platformID,
 			Name:             "Keap Tags",
 			Description:      "Backup contact tags and categories for organizing and segmenting contacts",
@@ -21,4 +21,8 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/sqs v1.38.8
 	github.com/disintegration/imaging v1.6.2
 	github.com/google/uuid v1.3.0
+	github.com/klauspost/compress v1.17.11
+	github.com/pkg/sftp v1.13.7
+	golang.org/x/crypto v0.31.0
+	gopkg.in/yaml.v3 v3.0.1
 )
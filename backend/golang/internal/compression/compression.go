@@ -0,0 +1,156 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codecs. The names double as HTTP Content-Encoding values.
+const (
+	CodecNone = "none"
+	CodecGzip = "gzip"
+	CodecZstd = "zstd"
+)
+
+// DefaultCodec is used for accounts that have not chosen one. gzip is understood by every
+// HTTP client, so compressed objects can usually be served as they are.
+const DefaultCodec = CodecGzip
+
+// IsCodec reports whether c is a supported codec
+func IsCodec(c string) bool {
+	switch c {
+	case CodecNone, CodecGzip, CodecZstd:
+		return true
+	}
+	return false
+}
+
+// Resolve returns the codec to write with for an account setting, where empty means the
+// default. An unknown setting falls back to the default rather than failing the backup.
+func Resolve(setting string) string {
+	if setting == "" || !IsCodec(setting) {
+		return DefaultCodec
+	}
+	return setting
+}
+
+// ContentEncoding returns the HTTP Content-Encoding for data stored with codec, or "" when
+// the data is stored as is. Files written before compression have an empty codec.
+func ContentEncoding(codec string) string {
+	if codec == CodecGzip || codec == CodecZstd {
+		return codec
+	}
+	return ""
+}
+
+// Compress encodes data with codec
+func Compress(codec string, data []byte) ([]byte, error) {
+	switch ContentEncoding(codec) {
+	case "":
+		return data, nil
+	case CodecGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to gzip data: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("failed to gzip data: %v", err)
+		}
+		return buf.Bytes(), nil
+	default:
+		w, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd encoder: %v", err)
+		}
+		defer w.Close()
+		return w.EncodeAll(data, make([]byte, 0, len(data)/4)), nil
+	}
+}
+
+// Decompress decodes data that was stored with codec
+func Decompress(codec string, data []byte) ([]byte, error) {
+	switch ContentEncoding(codec) {
+	case "":
+		return data, nil
+	case CodecGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip data: %v", err)
+		}
+		defer r.Close()
+		plain, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip data: %v", err)
+		}
+		return plain, nil
+	default:
+		r, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd decoder: %v", err)
+		}
+		defer r.Close()
+		plain, err := r.DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zstd data: %v", err)
+		}
+		return plain, nil
+	}
+}
+
+// NewReader returns a reader that decodes data read from r that was stored with codec,
+// without holding the decoded data in memory
+func NewReader(codec string, r io.Reader) (io.ReadCloser, error) {
+	switch ContentEncoding(codec) {
+	case "":
+		return io.NopCloser(r), nil
+	case CodecGzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip data: %v", err)
+		}
+		return gr, nil
+	default:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd decoder: %v", err)
+		}
+		return zr.IOReadCloser(), nil
+	}
+}
+
+// Accepts reports whether an Accept-Encoding header allows the given content encoding.
+// An explicit entry wins over "*", and q=0 refuses an encoding.
+func Accepts(acceptEncoding, encoding string) bool {
+	if encoding == "" {
+		return true
+	}
+
+	wildcard := false
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		accepted := true
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				accepted = err == nil && q > 0
+			}
+		}
+
+		switch name {
+		case encoding:
+			return accepted
+		case "*":
+			wildcard = accepted
+		}
+	}
+	return wildcard
+}
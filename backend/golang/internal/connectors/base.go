@@ -30,11 +30,22 @@ type Endpoint struct {
 
 // EndpointOptions represents configuration options for an endpoint
 type EndpointOptions struct {
-	EntityKey    string `json:"entityKey"`
-	LimitParam   string `json:"limitParam"`
-	OffsetParam  string `json:"offsetParam"`
-	Limit        int    `json:"limit"`
-	ExtraParams  string `json:"extraParams"`
+	EntityKey   string            `json:"entityKey"`
+	LimitParam  string            `json:"limitParam"`
+	OffsetParam string            `json:"offsetParam"`
+	Limit       int               `json:"limit"`
+	ExtraParams string            `json:"extraParams"`
+	Params      map[string]string `json:"params,omitempty"` // Query parameters sent with every page
+}
+
+// APIError is returned when a platform API answers with a status other than 200
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Body)
 }
 
 // AuthConfig represents authentication configuration
@@ -120,7 +131,7 @@ func (bc *BaseConnector) MakeRequest(ctx context.Context, method, url string, bo
 
 	resp, err := bc.HTTPClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %v", err)
+		return nil, fmt.Errorf("request failed: %w", err)
 	}
 
 	return resp, nil
@@ -129,17 +140,41 @@ func (bc *BaseConnector) MakeRequest(ctx context.Context, method, url string, bo
 // FetchPaginatedData fetches data with pagination support
 func (bc *BaseConnector) FetchPaginatedData(ctx context.Context, endpoint Endpoint) ([]byte, error) {
 	var allData []json.RawMessage
-	offset := 0
+	err := bc.FetchPages(ctx, endpoint, 0, func(page []json.RawMessage, nextOffset int) error {
+		allData = append(allData, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert all data to JSON
+	result, err := json.Marshal(allData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal result: %v", err)
+	}
+
+	return result, nil
+}
+
+// FetchPages fetches an endpoint page by page starting at offset, passing each page and
+// the offset of the page after it to onPage. It stops with ctx's error between pages once
+// ctx is done, so callers can checkpoint nextOffset and resume from it later.
+func (bc *BaseConnector) FetchPages(ctx context.Context, endpoint Endpoint, offset int, onPage func(page []json.RawMessage, nextOffset int) error) error {
 	limit := endpoint.Options.Limit
 	if limit == 0 {
 		limit = 100 // Default limit
 	}
 
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		// Build URL with pagination parameters
 		u, err := url.Parse(endpoint.URL)
 		if err != nil {
-			return nil, fmt.Errorf("invalid endpoint URL: %v", err)
+			return fmt.Errorf("invalid endpoint URL: %v", err)
 		}
 
 		q := u.Query()
@@ -161,30 +196,33 @@ func (bc *BaseConnector) FetchPaginatedData(ctx context.Context, endpoint Endpoi
 			}
 		}
 
+		for key, value := range endpoint.Options.Params {
+			q.Set(key, value)
+		}
+
 		u.RawQuery = q.Encode()
 
 		// Make request
 		resp, err := bc.MakeRequest(ctx, "GET", u.String(), nil)
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch data: %v", err)
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			body, _ := io.ReadAll(resp.Body)
-			return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+			return fmt.Errorf("failed to fetch data: %w", err)
 		}
 
 		// Read response body
 		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
 		if err != nil {
-			return nil, fmt.Errorf("failed to read response body: %v", err)
+			return fmt.Errorf("failed to read response body: %v", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return &APIError{StatusCode: resp.StatusCode, Body: string(body)}
 		}
 
 		// Parse response
 		var response map[string]interface{}
 		if err := json.Unmarshal(body, &response); err != nil {
-			return nil, fmt.Errorf("failed to parse response: %v", err)
+			return fmt.Errorf("failed to parse response: %v", err)
 		}
 
 		// Extract data based on entity key
@@ -208,26 +246,23 @@ func (bc *BaseConnector) FetchPaginatedData(ctx context.Context, endpoint Endpoi
 			}
 		}
 
-		allData = append(allData, pageData...)
+		offset += limit
+		if err := onPage(pageData, offset); err != nil {
+			return err
+		}
 
 		// Check if we should continue pagination
 		if len(pageData) < limit {
-			break // No more data
+			return nil // No more data
 		}
 
-		offset += limit
-
 		// Respect rate limiting
-		time.Sleep(bc.Config.RateLimitDelay)
-	}
-
-	// Convert all data to JSON
-	result, err := json.Marshal(allData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal result: %v", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(bc.Config.RateLimitDelay):
+		}
 	}
-
-	return result, nil
 }
 
 // GetName returns the connector name
@@ -0,0 +1,136 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/listbackup/api/internal/types"
+)
+
+// ErrNoCredentials is returned when a connection has no credentials the platform accepts
+var ErrNoCredentials = errors.New("no usable credentials")
+
+// CatalogConnector is a generic connector driven by Platform and PlatformEndpoint catalog records
+type CatalogConnector struct {
+	*BaseConnector
+	platform types.Platform
+}
+
+// NewCatalogConnector creates a connector for a platform using a connection's stored credentials
+func NewCatalogConnector(platform types.Platform, credentials map[string]interface{}) (*CatalogConnector, error) {
+	token := credentialValue(credentials, "access_token", "accessToken", "api_key", "apiKey", "auth_token", "apiToken", "token")
+	if token == "" {
+		return nil, fmt.Errorf("%w for platform %s", ErrNoCredentials, platform.PlatformID)
+	}
+
+	auth := AuthConfig{Type: "oauth", Token: token}
+	if platform.APIConfig.AuthType == "apikey" {
+		auth = AuthConfig{Type: "api_key", AuthorizationType: "Bearer", APIKey: token}
+	}
+
+	// Space requests so that a full set of concurrent fetches on one connection stays
+	// within the platform's advertised rate limits
+	rateLimitDelay := RequestSpacing(platform.APIConfig.RateLimits)
+
+	connectorConfig := ConnectorConfig{
+		Name:           platform.Name,
+		Type:           platform.Type,
+		BaseURL:        strings.TrimRight(platform.APIConfig.BaseURL, "/"),
+		Auth:           auth,
+		RateLimitDelay: rateLimitDelay,
+		Timeout:        30 * time.Second,
+		CustomHeaders:  platform.APIConfig.RequiredHeaders,
+	}
+
+	return &CatalogConnector{
+		BaseConnector: NewBaseConnector(connectorConfig),
+		platform:      platform,
+	}, nil
+}
+
+// Test calls the platform's configured test endpoint. A rejected request is returned as
+// an *APIError, so callers can tell bad credentials from an unavailable platform.
+func (cc *CatalogConnector) Test(ctx context.Context) error {
+	if cc.platform.APIConfig.TestEndpoint == "" {
+		return nil
+	}
+
+	resp, err := cc.MakeRequest(ctx, "GET", cc.Config.BaseURL+cc.platform.APIConfig.TestEndpoint, nil)
+	if err != nil {
+		return fmt.Errorf("%s API test failed: %w", cc.platform.Type, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s API test failed: %w", cc.platform.Type, &APIError{StatusCode: resp.StatusCode, Body: string(body)})
+	}
+
+	return nil
+}
+
+// GetAvailableEndpoints is not catalog-aware; endpoints come from PlatformSource records
+func (cc *CatalogConnector) GetAvailableEndpoints() []Endpoint {
+	return []Endpoint{}
+}
+
+// FetchData fetches all pages of an endpoint
+func (cc *CatalogConnector) FetchData(ctx context.Context, endpoint Endpoint) ([]byte, error) {
+	return cc.FetchPaginatedData(ctx, endpoint)
+}
+
+// EndpointFromCatalog converts a PlatformEndpoint template into a fetchable Endpoint. The
+// endpoint's parameter defaults are sent with each request, overridden by params, the
+// source's own values. Pagination parameters are left to the connector.
+func (cc *CatalogConnector) EndpointFromCatalog(name string, endpoint types.PlatformEndpoint, params map[string]string) Endpoint {
+	options := EndpointOptions{
+		EntityKey:   strings.TrimPrefix(endpoint.ResponseMapping.DataPath, "$."),
+		OffsetParam: endpoint.ResponseMapping.PaginationKey,
+		Params:      map[string]string{},
+	}
+
+	for _, param := range endpoint.Parameters {
+		switch {
+		case param.Name == "limit":
+			options.LimitParam = "limit"
+			if limit, err := strconv.Atoi(param.Default); err == nil {
+				options.Limit = limit
+			}
+		case param.Name != options.OffsetParam && param.Default != "":
+			options.Params[param.Name] = param.Default
+		}
+	}
+
+	for key, value := range params {
+		switch key {
+		case options.OffsetParam:
+		case options.LimitParam:
+			if limit, err := strconv.Atoi(value); err == nil && limit > 0 {
+				options.Limit = limit
+			}
+		default:
+			options.Params[key] = value
+		}
+	}
+
+	return Endpoint{
+		Name:        name,
+		URL:         cc.Config.BaseURL + endpoint.Path,
+		Description: endpoint.Description,
+		Options:     options,
+	}
+}
+
+func credentialValue(credentials map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := credentials[key].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,51 @@
+package connectors
+
+import (
+	"time"
+
+	"github.com/listbackup/api/internal/types"
+)
+
+const (
+	// defaultConcurrency applies to platforms that advertise no rate limits
+	defaultConcurrency = 2
+	// maxConcurrency caps requests in flight per connection however generous the platform
+	maxConcurrency = 8
+)
+
+// ConcurrencyLimit returns how many requests may be in flight at once against one
+// connection to the platform, across every job using that connection. It is the burst
+// limit, held to the requests allowed per second.
+func ConcurrencyLimit(limits types.RateLimitConfig) int {
+	limit := limits.BurstLimit
+	if rps := limits.RequestsPerSecond; rps > 0 && (limit <= 0 || rps < limit) {
+		limit = rps
+	}
+	if limit <= 0 {
+		limit = defaultConcurrency
+	}
+	if limit > maxConcurrency {
+		limit = maxConcurrency
+	}
+	return limit
+}
+
+// RequestSpacing returns the delay each concurrent caller leaves between its requests so
+// that ConcurrencyLimit callers together stay within the platform's strictest sustained
+// rate, whether that is set per second, minute or hour
+func RequestSpacing(limits types.RateLimitConfig) time.Duration {
+	rate := 0.0
+	for _, allowed := range []float64{
+		float64(limits.RequestsPerSecond),
+		float64(limits.RequestsPerMinute) / 60,
+		float64(limits.RequestsPerHour) / 3600,
+	} {
+		if allowed > 0 && (rate == 0 || allowed < rate) {
+			rate = allowed
+		}
+	}
+	if rate == 0 {
+		return time.Second
+	}
+	return time.Duration(float64(ConcurrencyLimit(limits)) / rate * float64(time.Second))
+}
@@ -2,8 +2,12 @@ package database
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -12,31 +16,65 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
+// ErrItemNotFound is returned by GetItem when the table has no item with the key
+var ErrItemNotFound = errors.New("item not found")
+
+// ErrInvalidPageToken is returned for a page token EncodePageToken did not produce
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// ConditionFailed reports whether err is a failed condition check of a single write, or a
+// transaction cancelled because the condition of its item at index failed. A negative
+// index matches any item of the transaction.
+func ConditionFailed(err error, index int) bool {
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return true
+	}
+
+	var canceled *types.TransactionCanceledException
+	if !errors.As(err, &canceled) {
+		return false
+	}
+	for i, reason := range canceled.CancellationReasons {
+		if aws.ToString(reason.Code) == "ConditionalCheckFailed" && (index < 0 || i == index) {
+			return true
+		}
+	}
+	return false
+}
+
 type DynamoDBClient struct {
 	client *dynamodb.Client
 }
 
 var (
-	UsersTable               = os.Getenv("USERS_TABLE")
-	AccountsTable            = os.Getenv("ACCOUNTS_TABLE")
-	UserAccountsTable        = os.Getenv("USER_ACCOUNTS_TABLE")
-	PlatformsTable           = os.Getenv("PLATFORMS_TABLE")
-	PlatformSourcesTable     = os.Getenv("PLATFORM_SOURCES_TABLE")
-	PlatformConnectionsTable = os.Getenv("PLATFORM_CONNECTIONS_TABLE")
-	SourceGroupsTable        = os.Getenv("SOURCE_GROUPS_TABLE")
-	SourcesTable             = os.Getenv("SOURCES_TABLE")
-	ActivityTable            = os.Getenv("ACTIVITY_TABLE")
-	JobsTable                = os.Getenv("JOBS_TABLE")
-	FilesTable               = os.Getenv("FILES_TABLE")
-	TeamsTable               = os.Getenv("TEAMS_TABLE")
-	TeamMembersTable         = os.Getenv("TEAM_MEMBERS_TABLE")
-	TeamAccountsTable        = os.Getenv("TEAM_ACCOUNTS_TABLE")
-	TeamInvitationsTable     = os.Getenv("TEAM_INVITATIONS_TABLE")
-	ClientsTable             = os.Getenv("CLIENTS_TABLE")
-	ClientAccountsTable      = os.Getenv("CLIENT_ACCOUNTS_TABLE")
-	ClientTeamsTable         = os.Getenv("CLIENT_TEAMS_TABLE")
-	ClientInvitationsTable   = os.Getenv("CLIENT_INVITATIONS_TABLE")
-	ClientPermissionsTable   = os.Getenv("CLIENT_PERMISSIONS_TABLE")
+	UsersTable                  = os.Getenv("USERS_TABLE")
+	AccountsTable               = os.Getenv("ACCOUNTS_TABLE")
+	UserAccountsTable           = os.Getenv("USER_ACCOUNTS_TABLE")
+	PlatformsTable              = os.Getenv("PLATFORMS_TABLE")
+	PlatformSourcesTable        = os.Getenv("PLATFORM_SOURCES_TABLE")
+	PlatformSourceVersionsTable = os.Getenv("PLATFORM_SOURCE_VERSIONS_TABLE")
+	PlatformConnectionsTable    = os.Getenv("PLATFORM_CONNECTIONS_TABLE")
+	SourceGroupsTable           = os.Getenv("SOURCE_GROUPS_TABLE")
+	SourcesTable                = os.Getenv("SOURCES_TABLE")
+	ActivityTable               = os.Getenv("ACTIVITY_TABLE")
+	JobsTable                   = os.Getenv("JOBS_TABLE")
+	FilesTable                  = os.Getenv("FILES_TABLE")
+	SnapshotsTable              = os.Getenv("SNAPSHOTS_TABLE")
+	SearchIndexTable            = os.Getenv("SEARCH_INDEX_TABLE")
+	DownloadLinksTable          = os.Getenv("DOWNLOAD_LINKS_TABLE")
+	StorageDestinationsTable    = os.Getenv("STORAGE_DESTINATIONS_TABLE")
+	ConnectionLeasesTable       = os.Getenv("CONNECTION_LEASES_TABLE")
+	JobMetricsTable             = os.Getenv("JOB_METRICS_TABLE")
+	TeamsTable                  = os.Getenv("TEAMS_TABLE")
+	TeamMembersTable            = os.Getenv("TEAM_MEMBERS_TABLE")
+	TeamAccountsTable           = os.Getenv("TEAM_ACCOUNTS_TABLE")
+	TeamInvitationsTable        = os.Getenv("TEAM_INVITATIONS_TABLE")
+	ClientsTable                = os.Getenv("CLIENTS_TABLE")
+	ClientAccountsTable         = os.Getenv("CLIENT_ACCOUNTS_TABLE")
+	ClientTeamsTable            = os.Getenv("CLIENT_TEAMS_TABLE")
+	ClientInvitationsTable      = os.Getenv("CLIENT_INVITATIONS_TABLE")
+	ClientPermissionsTable      = os.Getenv("CLIENT_PERMISSIONS_TABLE")
 )
 
 func NewDynamoDBClient(ctx context.Context) (*DynamoDBClient, error) {
@@ -86,7 +124,7 @@ func (db *DynamoDBClient) GetItem(ctx context.Context, tableName string, key map
 	}
 
 	if resp.Item == nil {
-		return fmt.Errorf("item not found")
+		return ErrItemNotFound
 	}
 
 	err = attributevalue.UnmarshalMap(resp.Item, result)
@@ -116,6 +154,28 @@ func (db *DynamoDBClient) PutItem(ctx context.Context, tableName string, item in
 	return nil
 }
 
+// PutItemWithCondition writes an item only while condition holds for the item it replaces
+func (db *DynamoDBClient) PutItemWithCondition(ctx context.Context, tableName string, item interface{}, condition string, expressionAttributeValues map[string]types.AttributeValue) error {
+	av, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return fmt.Errorf("failed to marshal item: %v", err)
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName:                 aws.String(tableName),
+		Item:                      av,
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeValues: expressionAttributeValues,
+	}
+
+	_, err = db.client.PutItem(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to put item to %s: %w", tableName, err)
+	}
+
+	return nil
+}
+
 func (db *DynamoDBClient) UpdateItem(ctx context.Context, tableName string, key map[string]types.AttributeValue, updateExpression string, expressionAttributeValues map[string]types.AttributeValue) error {
 	input := &dynamodb.UpdateItemInput{
 		TableName:                 aws.String(tableName),
@@ -203,6 +263,161 @@ func (db *DynamoDBClient) QueryGSI(ctx context.Context, tableName string, indexN
 	return nil
 }
 
+// QueryGSIAll queries a GSI and follows LastEvaluatedKey until every page has been read
+func (db *DynamoDBClient) QueryGSIAll(ctx context.Context, tableName string, indexName string, keyCondition string, expressionAttributeValues map[string]interface{}, results interface{}) error {
+	avMap := make(map[string]types.AttributeValue)
+	for k, v := range expressionAttributeValues {
+		av, err := attributevalue.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal expression attribute value %s: %v", k, err)
+		}
+		avMap[k] = av
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(tableName),
+		IndexName:                 aws.String(indexName),
+		KeyConditionExpression:    aws.String(keyCondition),
+		ExpressionAttributeValues: avMap,
+	}
+
+	var items []map[string]types.AttributeValue
+	for {
+		resp, err := db.client.Query(ctx, input)
+		if err != nil {
+			return fmt.Errorf("failed to query GSI %s on %s: %v", indexName, tableName, err)
+		}
+
+		items = append(items, resp.Items...)
+		if len(resp.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = resp.LastEvaluatedKey
+	}
+
+	err := attributevalue.UnmarshalListOfMaps(items, results)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal GSI query results: %v", err)
+	}
+
+	return nil
+}
+
+// PageQuery describes one page of a query against a table or GSI
+type PageQuery struct {
+	IndexName        string
+	KeyCondition     string
+	FilterExpression string
+	Names            map[string]string
+	Values           map[string]interface{}
+	Limit            int32
+	Descending       bool
+	NextToken        string // Opaque token returned by a previous page
+}
+
+// maxPageReads bounds how many reads a filtered page may take to fill up
+const maxPageReads = 10
+
+// QueryPage returns up to query.Limit matching items and an opaque token for the next page,
+// which is empty once the query is exhausted. Filtered pages are topped up with further
+// reads so callers rarely see short pages.
+func (db *DynamoDBClient) QueryPage(ctx context.Context, tableName string, query PageQuery, results interface{}) (string, error) {
+	avMap := make(map[string]types.AttributeValue)
+	for k, v := range query.Values {
+		av, err := attributevalue.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal expression attribute value %s: %v", k, err)
+		}
+		avMap[k] = av
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(tableName),
+		KeyConditionExpression:    aws.String(query.KeyCondition),
+		ExpressionAttributeValues: avMap,
+		ScanIndexForward:          aws.Bool(!query.Descending),
+	}
+	if query.IndexName != "" {
+		input.IndexName = aws.String(query.IndexName)
+	}
+	if query.FilterExpression != "" {
+		input.FilterExpression = aws.String(query.FilterExpression)
+	}
+	if len(query.Names) > 0 {
+		input.ExpressionAttributeNames = query.Names
+	}
+
+	if query.NextToken != "" {
+		startKey, err := DecodePageToken(query.NextToken)
+		if err != nil {
+			return "", err
+		}
+		input.ExclusiveStartKey = startKey
+	}
+
+	var items []map[string]types.AttributeValue
+	for reads := 0; reads < maxPageReads; reads++ {
+		if query.Limit > 0 {
+			input.Limit = aws.Int32(query.Limit - int32(len(items)))
+		}
+
+		resp, err := db.client.Query(ctx, input)
+		if err != nil {
+			return "", fmt.Errorf("failed to query %s: %v", tableName, err)
+		}
+
+		items = append(items, resp.Items...)
+		input.ExclusiveStartKey = resp.LastEvaluatedKey
+		if len(resp.LastEvaluatedKey) == 0 || (query.Limit > 0 && int32(len(items)) >= query.Limit) {
+			break
+		}
+	}
+
+	if err := attributevalue.UnmarshalListOfMaps(items, results); err != nil {
+		return "", fmt.Errorf("failed to unmarshal query results: %v", err)
+	}
+
+	if len(input.ExclusiveStartKey) == 0 {
+		return "", nil
+	}
+	return EncodePageToken(input.ExclusiveStartKey)
+}
+
+// EncodePageToken turns a LastEvaluatedKey into an opaque, URL-safe token
+func EncodePageToken(key map[string]types.AttributeValue) (string, error) {
+	var plain map[string]interface{}
+	if err := attributevalue.UnmarshalMap(key, &plain); err != nil {
+		return "", fmt.Errorf("failed to encode page token: %v", err)
+	}
+
+	tokenBytes, err := json.Marshal(plain)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode page token: %v", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(tokenBytes), nil
+}
+
+// DecodePageToken reverses EncodePageToken
+func DecodePageToken(token string) (map[string]types.AttributeValue, error) {
+	tokenBytes, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	var plain map[string]interface{}
+	if err := json.Unmarshal(tokenBytes, &plain); err != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	key, err := attributevalue.MarshalMap(plain)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	return key, nil
+}
+
 func (db *DynamoDBClient) TransactWrite(ctx context.Context, transactItems []types.TransactWriteItem) error {
 	input := &dynamodb.TransactWriteItemsInput{
 		TransactItems: transactItems,
@@ -210,7 +425,60 @@ func (db *DynamoDBClient) TransactWrite(ctx context.Context, transactItems []typ
 
 	_, err := db.client.TransactWriteItems(ctx, input)
 	if err != nil {
-		return fmt.Errorf("failed to execute transaction: %v", err)
+		return fmt.Errorf("failed to execute transaction: %w", err)
+	}
+
+	return nil
+}
+
+// batchWriteSize is the most requests DynamoDB accepts in one BatchWriteItem call
+const batchWriteSize = 25
+
+// BatchPutItems writes items in batches, retrying any the service leaves unprocessed
+func (db *DynamoDBClient) BatchPutItems(ctx context.Context, tableName string, items []interface{}) error {
+	requests := make([]types.WriteRequest, 0, len(items))
+	for _, item := range items {
+		av, err := attributevalue.MarshalMap(item)
+		if err != nil {
+			return fmt.Errorf("failed to marshal item: %v", err)
+		}
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: av}})
+	}
+
+	return db.batchWrite(ctx, tableName, requests)
+}
+
+// BatchDeleteItems deletes items by key in batches
+func (db *DynamoDBClient) BatchDeleteItems(ctx context.Context, tableName string, keys []map[string]types.AttributeValue) error {
+	requests := make([]types.WriteRequest, 0, len(keys))
+	for _, key := range keys {
+		requests = append(requests, types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: key}})
+	}
+
+	return db.batchWrite(ctx, tableName, requests)
+}
+
+func (db *DynamoDBClient) batchWrite(ctx context.Context, tableName string, requests []types.WriteRequest) error {
+	for start := 0; start < len(requests); start += batchWriteSize {
+		end := start + batchWriteSize
+		if end > len(requests) {
+			end = len(requests)
+		}
+
+		pending := map[string][]types.WriteRequest{tableName: requests[start:end]}
+		for attempt := 0; len(pending[tableName]) > 0; attempt++ {
+			if attempt == 5 {
+				return fmt.Errorf("failed to write %d items to %s: retries exhausted", len(pending[tableName]), tableName)
+			}
+			// Unprocessed items usually mean throttling, so back off before retrying
+			time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+
+			resp, err := db.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: pending})
+			if err != nil {
+				return fmt.Errorf("failed to batch write to %s: %v", tableName, err)
+			}
+			pending = resp.UnprocessedItems
+		}
 	}
 
 	return nil
@@ -257,6 +525,34 @@ func (db *DynamoDBClient) ScanAll(ctx context.Context, tableName string, results
 	return db.ScanTable(ctx, tableName, results)
 }
 
+// ScanAllPages scans every page of a table. ScanAll only returns the first 1 MB page.
+func (db *DynamoDBClient) ScanAllPages(ctx context.Context, tableName string, results interface{}) error {
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(tableName),
+	}
+
+	var items []map[string]types.AttributeValue
+	for {
+		resp, err := db.client.Scan(ctx, input)
+		if err != nil {
+			return fmt.Errorf("failed to scan %s: %v", tableName, err)
+		}
+
+		items = append(items, resp.Items...)
+		if len(resp.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = resp.LastEvaluatedKey
+	}
+
+	err := attributevalue.UnmarshalListOfMaps(items, results)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal scan results: %v", err)
+	}
+
+	return nil
+}
+
 // Utility functions for marshalling/unmarshalling
 func MarshalDynamoDBItem(item interface{}) (map[string]types.AttributeValue, error) {
 	return attributevalue.MarshalMap(item)
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestConditionFailed(t *testing.T) {
+	canceled := fmt.Errorf("failed to execute transaction: %w", &types.TransactionCanceledException{
+		CancellationReasons: []types.CancellationReason{
+			{Code: aws.String("None")},
+			{Code: aws.String("ConditionalCheckFailed")},
+		},
+	})
+
+	tests := []struct {
+		name  string
+		err   error
+		index int
+		want  bool
+	}{
+		{name: "single write", err: fmt.Errorf("failed to update: %w", &types.ConditionalCheckFailedException{}), index: -1, want: true},
+		{name: "failed item", err: canceled, index: 1, want: true},
+		{name: "any item", err: canceled, index: -1, want: true},
+		{name: "other item", err: canceled, index: 0},
+		{name: "other cancellation", err: &types.TransactionCanceledException{CancellationReasons: []types.CancellationReason{{Code: aws.String("TransactionConflict")}}}, index: -1},
+		{name: "other error", err: errors.New("ConditionalCheckFailed"), index: -1},
+		{name: "nil", index: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ConditionFailed(tt.err, tt.index); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -10,30 +10,6 @@ import (
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 )
 
-// Table constants for DynamoDB v1 client
-var (
-	UsersTable               = os.Getenv("USERS_TABLE")
-	AccountsTable            = os.Getenv("ACCOUNTS_TABLE")
-	UserAccountsTable        = os.Getenv("USER_ACCOUNTS_TABLE")
-	PlatformsTable           = os.Getenv("PLATFORMS_TABLE")
-	PlatformSourcesTable     = os.Getenv("PLATFORM_SOURCES_TABLE")
-	PlatformConnectionsTable = os.Getenv("PLATFORM_CONNECTIONS_TABLE")
-	SourceGroupsTable        = os.Getenv("SOURCE_GROUPS_TABLE")
-	SourcesTable             = os.Getenv("SOURCES_TABLE")
-	ActivityTable            = os.Getenv("ACTIVITY_TABLE")
-	JobsTable                = os.Getenv("JOBS_TABLE")
-	FilesTable               = os.Getenv("FILES_TABLE")
-	TeamsTable               = os.Getenv("TEAMS_TABLE")
-	TeamMembersTable         = os.Getenv("TEAM_MEMBERS_TABLE")
-	TeamAccountsTable        = os.Getenv("TEAM_ACCOUNTS_TABLE")
-	TeamInvitationsTable     = os.Getenv("TEAM_INVITATIONS_TABLE")
-	ClientsTable             = os.Getenv("CLIENTS_TABLE")
-	ClientAccountsTable      = os.Getenv("CLIENT_ACCOUNTS_TABLE")
-	ClientTeamsTable         = os.Getenv("CLIENT_TEAMS_TABLE")
-	ClientInvitationsTable   = os.Getenv("CLIENT_INVITATIONS_TABLE")
-	ClientPermissionsTable   = os.Getenv("CLIENT_PERMISSIONS_TABLE")
-)
-
 // DynamoDBClientV1 uses AWS SDK v1 for Go 1.16 compatibility
 type DynamoDBClientV1 struct {
 	client *dynamodb.DynamoDB
@@ -72,7 +48,7 @@ func (db *DynamoDBClientV1) GetItem(tableName string, key map[string]*dynamodb.A
 	}
 
 	if resp.Item == nil {
-		return fmt.Errorf("item not found")
+		return ErrItemNotFound
 	}
 
 	err = dynamodbattribute.UnmarshalMap(resp.Item, result)
@@ -48,7 +48,7 @@ func (db *PlatformsDynamoDBClient) GetItem(tableName string, key map[string]*dyn
 	}
 
 	if resp.Item == nil {
-		return fmt.Errorf("item not found")
+		return ErrItemNotFound
 	}
 
 	err = dynamodbattribute.UnmarshalMap(resp.Item, result)
@@ -0,0 +1,295 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Parquet physical types, encodings and other enum values used by the writer
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetOptional  = 1
+	parquetUTF8      = 0
+	parquetDataPage  = 0
+	parquetPlain     = 0
+	parquetRLE       = 3
+	parquetNoCodec   = 0
+	parquetVersion   = 1
+	parquetCreatedBy = "listbackup export"
+)
+
+var parquetMagic = []byte("PAR1")
+
+// WriteParquet writes a table as an uncompressed Parquet file with one row group. Every
+// column is optional and stored as a single PLAIN encoded data page.
+func WriteParquet(w io.Writer, table *Table) error {
+	if len(table.Columns) == 0 {
+		return fmt.Errorf("table %s has no columns", table.Name)
+	}
+
+	var file bytes.Buffer
+	file.Write(parquetMagic)
+
+	chunks := make([]parquetChunk, len(table.Columns))
+	var totalBytes int64
+	for i, column := range table.Columns {
+		page := parquetPage(table, i)
+
+		header := &thriftWriter{}
+		header.i32Field(1, parquetDataPage)
+		header.i32Field(2, int32(len(page)))
+		header.i32Field(3, int32(len(page)))
+		header.structField(5)
+		header.i32Field(1, int32(len(table.Rows)))
+		header.i32Field(2, parquetPlain)
+		header.i32Field(3, parquetRLE)
+		header.i32Field(4, parquetRLE)
+		header.endStruct()
+		header.endStruct()
+
+		chunks[i] = parquetChunk{
+			column: column,
+			offset: int64(file.Len()),
+			size:   int64(header.buf.Len() + len(page)),
+		}
+		totalBytes += chunks[i].size
+
+		file.Write(header.buf.Bytes())
+		file.Write(page)
+	}
+
+	footer := parquetFooter(table, chunks, totalBytes)
+	file.Write(footer)
+	binary.Write(&file, binary.LittleEndian, uint32(len(footer)))
+	file.Write(parquetMagic)
+
+	if _, err := w.Write(file.Bytes()); err != nil {
+		return fmt.Errorf("failed to write parquet file: %v", err)
+	}
+	return nil
+}
+
+type parquetChunk struct {
+	column Column
+	offset int64
+	size   int64
+}
+
+// parquetPage encodes a column's definition levels followed by its non-null values
+func parquetPage(table *Table, index int) []byte {
+	defined := make([]bool, len(table.Rows))
+	var values bytes.Buffer
+	var bools []bool
+	for r, row := range table.Rows {
+		value := row[index]
+		if value == nil {
+			continue
+		}
+		defined[r] = true
+
+		switch v := value.(type) {
+		case bool:
+			bools = append(bools, v)
+		case int64:
+			binary.Write(&values, binary.LittleEndian, v)
+		case float64:
+			binary.Write(&values, binary.LittleEndian, math.Float64bits(v))
+		default:
+			s := formatValue(v)
+			binary.Write(&values, binary.LittleEndian, uint32(len(s)))
+			values.WriteString(s)
+		}
+	}
+	if table.Columns[index].Type == TypeBool {
+		values.Write(packBits(bools))
+	}
+
+	levels := bitPackedRun(defined)
+
+	var page bytes.Buffer
+	binary.Write(&page, binary.LittleEndian, uint32(len(levels)))
+	page.Write(levels)
+	page.Write(values.Bytes())
+	return page.Bytes()
+}
+
+// bitPackedRun encodes one-bit definition levels as a single bit-packed run of the
+// RLE/bit-packing hybrid encoding
+func bitPackedRun(bits []bool) []byte {
+	groups := (len(bits) + 7) / 8
+
+	var run bytes.Buffer
+	writeUvarint(&run, uint64(groups)<<1|1)
+	run.Write(packBits(bits))
+	return run.Bytes()
+}
+
+func packBits(bits []bool) []byte {
+	packed := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			packed[i/8] |= 1 << (uint(i) % 8)
+		}
+	}
+	return packed
+}
+
+func parquetFooter(table *Table, chunks []parquetChunk, totalBytes int64) []byte {
+	meta := &thriftWriter{}
+	meta.i32Field(1, parquetVersion)
+
+	// Schema: a root group followed by one optional leaf per column
+	meta.listField(2, thriftStruct, len(table.Columns)+1)
+	meta.beginStruct()
+	meta.stringField(4, "schema")
+	meta.i32Field(5, int32(len(table.Columns)))
+	meta.endStruct()
+	for _, column := range table.Columns {
+		meta.beginStruct()
+		meta.i32Field(1, parquetPhysicalType(column.Type))
+		meta.i32Field(3, parquetOptional)
+		meta.stringField(4, column.Name)
+		if column.Type == TypeString {
+			meta.i32Field(6, parquetUTF8)
+		}
+		meta.endStruct()
+	}
+
+	meta.i64Field(3, int64(len(table.Rows)))
+
+	meta.listField(4, thriftStruct, 1)
+	meta.beginStruct()
+	meta.listField(1, thriftStruct, len(chunks))
+	for _, chunk := range chunks {
+		meta.beginStruct()
+		meta.i64Field(2, chunk.offset)
+		meta.structField(3)
+		meta.i32Field(1, parquetPhysicalType(chunk.column.Type))
+		meta.listField(2, thriftI32, 2)
+		meta.writeVarint(parquetPlain)
+		meta.writeVarint(parquetRLE)
+		meta.listField(3, thriftBinary, 1)
+		meta.writeString(chunk.column.Name)
+		meta.i32Field(4, parquetNoCodec)
+		meta.i64Field(5, int64(len(table.Rows)))
+		meta.i64Field(6, chunk.size)
+		meta.i64Field(7, chunk.size)
+		meta.i64Field(9, chunk.offset)
+		meta.endStruct()
+		meta.endStruct()
+	}
+	meta.i64Field(2, totalBytes)
+	meta.i64Field(3, int64(len(table.Rows)))
+	meta.endStruct()
+
+	meta.stringField(6, parquetCreatedBy)
+	meta.endStruct()
+
+	return meta.buf.Bytes()
+}
+
+func parquetPhysicalType(columnType ColumnType) int32 {
+	switch columnType {
+	case TypeBool:
+		return parquetBoolean
+	case TypeInt:
+		return parquetInt64
+	case TypeFloat:
+		return parquetDouble
+	}
+	return parquetByteArray
+}
+
+// Thrift compact protocol type codes
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes the subset of the Thrift compact protocol Parquet metadata needs
+type thriftWriter struct {
+	buf     bytes.Buffer
+	lastIDs []int16 // Last field ID written, per open struct
+	lastID  int16
+}
+
+func (t *thriftWriter) fieldHeader(id int16, fieldType byte) {
+	if delta := id - t.lastID; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		t.buf.WriteByte(fieldType)
+		t.writeVarint(int64(id))
+	}
+	t.lastID = id
+}
+
+func (t *thriftWriter) i32Field(id int16, value int32) {
+	t.fieldHeader(id, thriftI32)
+	t.writeVarint(int64(value))
+}
+
+func (t *thriftWriter) i64Field(id int16, value int64) {
+	t.fieldHeader(id, thriftI64)
+	t.writeVarint(value)
+}
+
+func (t *thriftWriter) stringField(id int16, value string) {
+	t.fieldHeader(id, thriftBinary)
+	t.writeString(value)
+}
+
+func (t *thriftWriter) listField(id int16, elemType byte, size int) {
+	t.fieldHeader(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		t.buf.WriteByte(0xF0 | elemType)
+		writeUvarint(&t.buf, uint64(size))
+	}
+}
+
+// structField opens a struct valued field; close it with endStruct
+func (t *thriftWriter) structField(id int16) {
+	t.fieldHeader(id, thriftStruct)
+	t.beginStruct()
+}
+
+// beginStruct opens a struct, either a list element or the field opened by structField
+func (t *thriftWriter) beginStruct() {
+	t.lastIDs = append(t.lastIDs, t.lastID)
+	t.lastID = 0
+}
+
+func (t *thriftWriter) endStruct() {
+	t.buf.WriteByte(0)
+	if n := len(t.lastIDs); n > 0 {
+		t.lastID = t.lastIDs[n-1]
+		t.lastIDs = t.lastIDs[:n-1]
+	}
+}
+
+func (t *thriftWriter) writeString(value string) {
+	writeUvarint(&t.buf, uint64(len(value)))
+	t.buf.WriteString(value)
+}
+
+// writeVarint writes a zigzag encoded integer
+func (t *thriftWriter) writeVarint(value int64) {
+	writeUvarint(&t.buf, uint64((value<<1)^(value>>63)))
+}
+
+func writeUvarint(buf *bytes.Buffer, value uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], value)
+	buf.Write(tmp[:n])
+}
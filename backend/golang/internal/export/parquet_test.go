@@ -0,0 +1,252 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// thriftReader decodes the Thrift compact protocol structs written by thriftWriter into
+// maps of field ID to value: int64 for integers, string for binary, []interface{} for
+// lists and map[int16]interface{} for structs
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	value, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		panic(fmt.Sprintf("bad varint at %d", r.pos))
+	}
+	r.pos += n
+	return value
+}
+
+func (r *thriftReader) varint() int64 {
+	u := r.uvarint()
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (r *thriftReader) value(fieldType byte) interface{} {
+	switch fieldType {
+	case thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		n := int(r.uvarint())
+		s := string(r.data[r.pos : r.pos+n])
+		r.pos += n
+		return s
+	case thriftList:
+		header := r.data[r.pos]
+		r.pos++
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = r.value(header & 0x0F)
+		}
+		return list
+	case thriftStruct:
+		return r.readStruct()
+	}
+	panic(fmt.Sprintf("unsupported thrift type %d at %d", fieldType, r.pos))
+}
+
+func (r *thriftReader) readStruct() map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	var lastID int16
+	for {
+		header := r.data[r.pos]
+		r.pos++
+		if header == 0 {
+			return fields
+		}
+
+		id := lastID + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.varint())
+		}
+		fields[id] = r.value(header & 0x0F)
+		lastID = id
+	}
+}
+
+// parquetFile is the layout of a file written by WriteParquet
+type parquetFile struct {
+	data   []byte
+	footer map[int16]interface{}
+}
+
+func readParquet(t *testing.T, data []byte) parquetFile {
+	t.Helper()
+	if len(data) < 12 || !bytes.Equal(data[:4], parquetMagic) || !bytes.Equal(data[len(data)-4:], parquetMagic) {
+		t.Fatal("file does not start and end with PAR1")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footerStart := len(data) - 8 - footerLen
+	reader := &thriftReader{data: data[:len(data)-8], pos: footerStart}
+	footer := reader.readStruct()
+	if reader.pos != len(data)-8 {
+		t.Fatalf("footer ends at %d, want %d", reader.pos, len(data)-8)
+	}
+	return parquetFile{data: data, footer: footer}
+}
+
+// page returns the data page header and body of a column chunk
+func (f parquetFile) page(t *testing.T, column int) (map[int16]interface{}, []byte) {
+	t.Helper()
+	rowGroup := f.footer[4].([]interface{})[0].(map[int16]interface{})
+	chunk := rowGroup[1].([]interface{})[column].(map[int16]interface{})
+	meta := chunk[3].(map[int16]interface{})
+
+	reader := &thriftReader{data: f.data, pos: int(meta[9].(int64))}
+	header := reader.readStruct()
+	size := int(header[3].(int64))
+	if int64(reader.pos-int(meta[9].(int64))+size) != meta[6].(int64) {
+		t.Fatalf("chunk size %d does not match its page", meta[6])
+	}
+	return header, f.data[reader.pos : reader.pos+size]
+}
+
+// decodePage splits a page into its definition levels and PLAIN values
+func decodePage(t *testing.T, body []byte, column Column, rows int) ([]bool, []interface{}) {
+	t.Helper()
+	levelsLen := int(binary.LittleEndian.Uint32(body))
+	levels := body[4 : 4+levelsLen]
+	values := body[4+levelsLen:]
+
+	header, n := binary.Uvarint(levels)
+	if header&1 != 1 || int(header>>1) != (rows+7)/8 {
+		t.Fatalf("definition levels are not one bit-packed run of %d rows", rows)
+	}
+	defined := make([]bool, rows)
+	count := 0
+	for i := range defined {
+		defined[i] = levels[n+i/8]&(1<<(uint(i)%8)) != 0
+		if defined[i] {
+			count++
+		}
+	}
+
+	var decoded []interface{}
+	for i := 0; i < count; i++ {
+		switch column.Type {
+		case TypeBool:
+			decoded = append(decoded, values[i/8]&(1<<(uint(i)%8)) != 0)
+		case TypeInt:
+			decoded = append(decoded, int64(binary.LittleEndian.Uint64(values)))
+			values = values[8:]
+		case TypeFloat:
+			decoded = append(decoded, math.Float64frombits(binary.LittleEndian.Uint64(values)))
+			values = values[8:]
+		default:
+			n := int(binary.LittleEndian.Uint32(values))
+			decoded = append(decoded, string(values[4:4+n]))
+			values = values[4+n:]
+		}
+	}
+	return defined, decoded
+}
+
+func TestWriteParquet(t *testing.T) {
+	table, err := NewTable("contacts", []byte(`[
+		{"id":1,"name":"Ada","score":1.5,"active":true},
+		{"id":2,"name":null,"score":2,"active":false},
+		{"id":3,"name":"Grace","active":true}
+	]`), "")
+	if err != nil {
+		t.Fatalf("NewTable: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteParquet(&buf, table); err != nil {
+		t.Fatalf("WriteParquet: %v", err)
+	}
+	file := readParquet(t, buf.Bytes())
+
+	if rows := file.footer[3].(int64); rows != 3 {
+		t.Fatalf("file has %d rows, want 3", rows)
+	}
+
+	schema := file.footer[2].([]interface{})
+	if len(schema) != len(table.Columns)+1 {
+		t.Fatalf("schema has %d elements, want %d", len(schema), len(table.Columns)+1)
+	}
+	if children := schema[0].(map[int16]interface{})[5].(int64); children != int64(len(table.Columns)) {
+		t.Fatalf("root has %d children, want %d", children, len(table.Columns))
+	}
+
+	want := map[string]struct {
+		physical int64
+		defined  []bool
+		values   []interface{}
+	}{
+		"active": {parquetBoolean, []bool{true, true, true}, []interface{}{true, false, true}},
+		"id":     {parquetInt64, []bool{true, true, true}, []interface{}{int64(1), int64(2), int64(3)}},
+		"name":   {parquetByteArray, []bool{true, false, true}, []interface{}{"Ada", "Grace"}},
+		"score":  {parquetDouble, []bool{true, true, false}, []interface{}{1.5, 2.0}},
+	}
+	for i, column := range table.Columns {
+		t.Run(column.Name, func(t *testing.T) {
+			w := want[column.Name]
+			element := schema[i+1].(map[int16]interface{})
+			if element[4] != column.Name || element[1] != w.physical || element[3] != int64(parquetOptional) {
+				t.Fatalf("schema element %v does not describe optional %s of type %d", element, column.Name, w.physical)
+			}
+
+			header, body := file.page(t, i)
+			if header[1] != int64(parquetDataPage) || header[5].(map[int16]interface{})[1] != int64(3) {
+				t.Fatalf("page header %v is not a data page of 3 values", header)
+			}
+			defined, values := decodePage(t, body, column, 3)
+			if !reflect.DeepEqual(defined, w.defined) {
+				t.Fatalf("got definition levels %v, want %v", defined, w.defined)
+			}
+			if !reflect.DeepEqual(values, w.values) {
+				t.Fatalf("got values %v, want %v", values, w.values)
+			}
+		})
+	}
+}
+
+func TestWriteParquetManyColumns(t *testing.T) {
+	// More than 14 columns needs the long form of the Thrift list header
+	record := "{"
+	for i := 0; i < 20; i++ {
+		if i > 0 {
+			record += ","
+		}
+		record += fmt.Sprintf(`"c%02d":%d`, i, i)
+	}
+	record += "}"
+
+	table, err := NewTable("wide", []byte("["+record+"]"), "")
+	if err != nil {
+		t.Fatalf("NewTable: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := WriteParquet(&buf, table); err != nil {
+		t.Fatalf("WriteParquet: %v", err)
+	}
+
+	file := readParquet(t, buf.Bytes())
+	if n := len(file.footer[2].([]interface{})); n != 21 {
+		t.Fatalf("schema has %d elements, want 21", n)
+	}
+	_, body := file.page(t, 19)
+	if _, values := decodePage(t, body, table.Columns[19], 1); !reflect.DeepEqual(values, []interface{}{int64(19)}) {
+		t.Fatalf("got values %v of the last column", values)
+	}
+}
+
+func TestWriteParquetRejectsEmptyTable(t *testing.T) {
+	if err := WriteParquet(&bytes.Buffer{}, &Table{Name: "empty"}); err == nil {
+		t.Fatal("expected an error for a table without columns")
+	}
+}
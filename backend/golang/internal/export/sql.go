@@ -0,0 +1,113 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// sqlInsertBatch is the number of rows written per INSERT statement
+const sqlInsertBatch = 100
+
+// WriteSQL writes the tables as a SQL dump for the sqlite or postgres dialect, with one
+// table per endpoint, all inside a single transaction
+func WriteSQL(w io.Writer, tables []*Table, dialect string) error {
+	if dialect != FormatSQLite && dialect != FormatPostgres {
+		return fmt.Errorf("unsupported SQL dialect: %s", dialect)
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "-- ListBackup export (%s)\nBEGIN;\n\n", dialect)
+
+	for _, table := range tables {
+		if len(table.Columns) == 0 {
+			continue
+		}
+
+		name := quoteIdentifier(table.Name)
+		columns := make([]string, len(table.Columns))
+		definitions := make([]string, len(table.Columns))
+		for i, column := range table.Columns {
+			columns[i] = quoteIdentifier(column.Name)
+			definitions[i] = "  " + columns[i] + " " + sqlType(column.Type, dialect)
+		}
+
+		fmt.Fprintf(out, "DROP TABLE IF EXISTS %s;\n", name)
+		fmt.Fprintf(out, "CREATE TABLE %s (\n%s\n);\n", name, strings.Join(definitions, ",\n"))
+
+		for start := 0; start < len(table.Rows); start += sqlInsertBatch {
+			end := start + sqlInsertBatch
+			if end > len(table.Rows) {
+				end = len(table.Rows)
+			}
+
+			fmt.Fprintf(out, "INSERT INTO %s (%s) VALUES\n", name, strings.Join(columns, ", "))
+			for r, row := range table.Rows[start:end] {
+				values := make([]string, len(row))
+				for i, value := range row {
+					values[i] = sqlLiteral(value, dialect)
+				}
+
+				terminator := ",\n"
+				if start+r == end-1 {
+					terminator = ";\n"
+				}
+				fmt.Fprintf(out, "  (%s)%s", strings.Join(values, ", "), terminator)
+			}
+		}
+		out.WriteString("\n")
+	}
+
+	out.WriteString("COMMIT;\n")
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("failed to write SQL dump: %v", err)
+	}
+	return nil
+}
+
+func sqlType(columnType ColumnType, dialect string) string {
+	switch columnType {
+	case TypeInt:
+		if dialect == FormatPostgres {
+			return "BIGINT"
+		}
+		return "INTEGER"
+	case TypeFloat:
+		if dialect == FormatPostgres {
+			return "DOUBLE PRECISION"
+		}
+		return "REAL"
+	case TypeBool:
+		if dialect == FormatPostgres {
+			return "BOOLEAN"
+		}
+		return "INTEGER"
+	}
+	return "TEXT"
+}
+
+func sqlLiteral(value interface{}, dialect string) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if dialect == FormatPostgres {
+			return strings.ToUpper(formatValue(v))
+		}
+		if v {
+			return "1"
+		}
+		return "0"
+	case int64, float64:
+		return formatValue(v)
+	}
+
+	// PostgreSQL text cannot hold NUL bytes
+	s := strings.ReplaceAll(formatValue(value), "\x00", "")
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
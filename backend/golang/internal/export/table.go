@@ -0,0 +1,213 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Export formats
+const (
+	FormatCSV      = "csv"
+	FormatXLSX     = "xlsx"
+	FormatParquet  = "parquet"
+	FormatSQLite   = "sqlite"
+	FormatPostgres = "postgres"
+)
+
+// DefaultSeparator joins the keys of nested objects when records are flattened
+const DefaultSeparator = "."
+
+// ColumnType is the type inferred for a column from every value in it
+type ColumnType int
+
+const (
+	TypeString ColumnType = iota
+	TypeInt
+	TypeFloat
+	TypeBool
+)
+
+// Column is one flattened field of an endpoint's records
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// Table holds an endpoint's records flattened into rows. Row values are nil, string,
+// int64, float64 or bool, matching the column type.
+type Table struct {
+	Name    string
+	Columns []Column
+	Rows    [][]interface{}
+}
+
+// IsFormat reports whether format is a supported export format
+func IsFormat(format string) bool {
+	switch format {
+	case FormatCSV, FormatXLSX, FormatParquet, FormatSQLite, FormatPostgres:
+		return true
+	}
+	return false
+}
+
+// NewTable flattens a JSON array of records into a table. Nested objects become columns
+// named by joining their keys with separator; arrays are kept as JSON text.
+func NewTable(name string, data []byte, separator string) (*Table, error) {
+	if separator == "" {
+		separator = DefaultSeparator
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var records []interface{}
+	if err := decoder.Decode(&records); err != nil {
+		return nil, fmt.Errorf("failed to parse %s records: %v", name, err)
+	}
+
+	flattened := make([]map[string]interface{}, 0, len(records))
+	seen := map[string]bool{}
+	var names []string
+	for _, record := range records {
+		row := map[string]interface{}{}
+		if object, ok := record.(map[string]interface{}); ok {
+			flatten("", object, separator, row)
+		} else {
+			row["value"] = scalar(record)
+		}
+
+		for key := range row {
+			if !seen[key] {
+				seen[key] = true
+				names = append(names, key)
+			}
+		}
+		flattened = append(flattened, row)
+	}
+	sort.Strings(names)
+
+	table := &Table{Name: name, Columns: make([]Column, len(names))}
+	for i, column := range names {
+		table.Columns[i] = Column{Name: column, Type: inferType(column, flattened)}
+	}
+
+	for _, row := range flattened {
+		values := make([]interface{}, len(table.Columns))
+		for i, column := range table.Columns {
+			values[i] = convert(row[column.Name], column.Type)
+		}
+		table.Rows = append(table.Rows, values)
+	}
+
+	return table, nil
+}
+
+func flatten(prefix string, object map[string]interface{}, separator string, row map[string]interface{}) {
+	for key, value := range object {
+		if prefix != "" {
+			key = prefix + separator + key
+		}
+
+		if nested, ok := value.(map[string]interface{}); ok {
+			flatten(key, nested, separator, row)
+			continue
+		}
+		row[key] = scalar(value)
+	}
+}
+
+// scalar keeps JSON scalars as they are and encodes arrays and objects as JSON text
+func scalar(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}, map[string]interface{}:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	}
+	return value
+}
+
+// inferType picks the narrowest type that holds every non-null value of a column
+func inferType(column string, rows []map[string]interface{}) ColumnType {
+	allBool, allInt, allNumber, found := true, true, true, false
+	for _, row := range rows {
+		value, ok := row[column]
+		if !ok || value == nil {
+			continue
+		}
+		found = true
+
+		switch v := value.(type) {
+		case bool:
+			allInt, allNumber = false, false
+		case json.Number:
+			allBool = false
+			if _, err := v.Int64(); err != nil {
+				allInt = false
+			}
+		default:
+			return TypeString
+		}
+	}
+
+	switch {
+	case !found:
+		return TypeString
+	case allBool:
+		return TypeBool
+	case allInt:
+		return TypeInt
+	case allNumber:
+		return TypeFloat
+	}
+	return TypeString
+}
+
+func convert(value interface{}, columnType ColumnType) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	switch columnType {
+	case TypeBool:
+		return value.(bool)
+	case TypeInt:
+		n, _ := value.(json.Number).Int64()
+		return n
+	case TypeFloat:
+		f, _ := value.(json.Number).Float64()
+		return f
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(value)
+}
+
+// formatValue renders a row value as text for the text based formats
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(value)
+}
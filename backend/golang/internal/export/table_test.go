@@ -0,0 +1,108 @@
+package export
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewTable(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		separator string
+		columns   []Column
+		rows      [][]interface{}
+	}{
+		{
+			name:    "scalar types",
+			data:    `[{"id":1,"price":2.5,"active":true,"email":"a@example.com"}]`,
+			columns: []Column{{"active", TypeBool}, {"email", TypeString}, {"id", TypeInt}, {"price", TypeFloat}},
+			rows:    [][]interface{}{{true, "a@example.com", int64(1), 2.5}},
+		},
+		{
+			name:    "nested objects are flattened",
+			data:    `[{"id":1,"address":{"city":"Austin","geo":{"lat":30.2}}}]`,
+			columns: []Column{{"address.city", TypeString}, {"address.geo.lat", TypeFloat}, {"id", TypeInt}},
+			rows:    [][]interface{}{{"Austin", 30.2, int64(1)}},
+		},
+		{
+			name:      "custom separator",
+			data:      `[{"address":{"city":"Austin"}}]`,
+			separator: "_",
+			columns:   []Column{{"address_city", TypeString}},
+			rows:      [][]interface{}{{"Austin"}},
+		},
+		{
+			name:    "arrays are kept as JSON",
+			data:    `[{"tags":["a","b"],"items":[{"sku":1}]}]`,
+			columns: []Column{{"items", TypeString}, {"tags", TypeString}},
+			rows:    [][]interface{}{{`[{"sku":1}]`, `["a","b"]`}},
+		},
+		{
+			name:    "missing and null values",
+			data:    `[{"id":1,"name":"a"},{"id":2,"name":null},{"id":3}]`,
+			columns: []Column{{"id", TypeInt}, {"name", TypeString}},
+			rows:    [][]interface{}{{int64(1), "a"}, {int64(2), nil}, {int64(3), nil}},
+		},
+		{
+			name:    "integers widen to floats",
+			data:    `[{"n":1},{"n":2.5}]`,
+			columns: []Column{{"n", TypeFloat}},
+			rows:    [][]interface{}{{1.0}, {2.5}},
+		},
+		{
+			name:    "mixed types fall back to strings",
+			data:    `[{"v":1},{"v":"x"},{"v":true}]`,
+			columns: []Column{{"v", TypeString}},
+			rows:    [][]interface{}{{"1"}, {"x"}, {"true"}},
+		},
+		{
+			name:    "large integers keep their precision",
+			data:    `[{"id":9007199254740993}]`,
+			columns: []Column{{"id", TypeInt}},
+			rows:    [][]interface{}{{int64(9007199254740993)}},
+		},
+		{
+			name:    "only nulls",
+			data:    `[{"v":null}]`,
+			columns: []Column{{"v", TypeString}},
+			rows:    [][]interface{}{{nil}},
+		},
+		{
+			name:    "non-object records",
+			data:    `["a","b"]`,
+			columns: []Column{{"value", TypeString}},
+			rows:    [][]interface{}{{"a"}, {"b"}},
+		},
+		{
+			name:    "no records",
+			data:    `[]`,
+			columns: []Column{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := NewTable("contacts", []byte(tt.data), tt.separator)
+			if err != nil {
+				t.Fatalf("NewTable: %v", err)
+			}
+			if table.Name != "contacts" {
+				t.Fatalf("got name %q", table.Name)
+			}
+			if !reflect.DeepEqual(table.Columns, tt.columns) {
+				t.Fatalf("got columns %v, want %v", table.Columns, tt.columns)
+			}
+			if !reflect.DeepEqual(table.Rows, tt.rows) {
+				t.Fatalf("got rows %v, want %v", table.Rows, tt.rows)
+			}
+		})
+	}
+}
+
+func TestNewTableRejectsInvalidJSON(t *testing.T) {
+	for _, data := range []string{`{"id":1}`, `[{"id":1}`, ``} {
+		if _, err := NewTable("contacts", []byte(data), ""); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
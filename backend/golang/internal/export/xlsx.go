@@ -0,0 +1,163 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxSheetName is the longest sheet name Excel accepts
+const maxSheetName = 31
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+%s</Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+// WriteXLSX writes the tables as a workbook with one sheet per table. Cells are written
+// inline so the workbook needs no shared string table.
+func WriteXLSX(w io.Writer, tables []*Table) error {
+	archive := zip.NewWriter(w)
+
+	var overrides, sheets, rels strings.Builder
+	names := map[string]bool{}
+	for i, table := range tables {
+		n := i + 1
+		fmt.Fprintf(&overrides, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`+"\n", n)
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escapeXML(sheetName(table.Name, n, names)), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`+"\n", n, n)
+	}
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", fmt.Sprintf(xlsxContentTypes, overrides.String())},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>` + sheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+` + rels.String() + `</Relationships>`},
+	}
+	for _, part := range parts {
+		if err := writeZipEntry(archive, part.name, []byte(part.content)); err != nil {
+			return err
+		}
+	}
+
+	for i, table := range tables {
+		if err := writeZipEntry(archive, fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), worksheet(table)); err != nil {
+			return err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to finish workbook: %v", err)
+	}
+	return nil
+}
+
+func worksheet(table *Table) []byte {
+	var sheet bytes.Buffer
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	header := make([]interface{}, len(table.Columns))
+	for i, column := range table.Columns {
+		header[i] = column.Name
+	}
+	writeSheetRow(&sheet, 1, header)
+	for i, row := range table.Rows {
+		writeSheetRow(&sheet, i+2, row)
+	}
+
+	sheet.WriteString(`</sheetData></worksheet>`)
+	return sheet.Bytes()
+}
+
+func writeSheetRow(sheet *bytes.Buffer, rowNumber int, values []interface{}) {
+	fmt.Fprintf(sheet, `<row r="%d">`, rowNumber)
+	for i, value := range values {
+		ref := columnLetters(i) + strconv.Itoa(rowNumber)
+		switch v := value.(type) {
+		case nil:
+			continue
+		case int64, float64:
+			fmt.Fprintf(sheet, `<c r="%s"><v>%s</v></c>`, ref, formatValue(v))
+		case bool:
+			b := 0
+			if v {
+				b = 1
+			}
+			fmt.Fprintf(sheet, `<c r="%s" t="b"><v>%d</v></c>`, ref, b)
+		default:
+			fmt.Fprintf(sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, escapeXML(formatValue(v)))
+		}
+	}
+	sheet.WriteString(`</row>`)
+}
+
+// columnLetters converts a zero-based column index to its spreadsheet name: A, B, ... AA
+func columnLetters(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+// sheetName makes an endpoint name valid and unique as a sheet name
+func sheetName(name string, n int, used map[string]bool) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		name = "Sheet"
+	}
+	if len([]rune(name)) > maxSheetName {
+		name = string([]rune(name)[:maxSheetName])
+	}
+
+	if used[strings.ToLower(name)] {
+		suffix := fmt.Sprintf(" (%d)", n)
+		runes := []rune(name)
+		if len(runes)+len(suffix) > maxSheetName {
+			runes = runes[:maxSheetName-len(suffix)]
+		}
+		name = string(runes) + suffix
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
+
+func escapeXML(s string) string {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(s))
+	return escaped.String()
+}
+
+func writeZipEntry(archive *zip.Writer, name string, content []byte) error {
+	entry, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %v", name, err)
+	}
+	if _, err := entry.Write(content); err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	return nil
+}
@@ -87,7 +87,7 @@ func (u *UsageTracker) TrackBackupOperation(ctx context.Context, accountID strin
 	}
 }
 
-// TrackStorageUsage tracks storage usage in GB
+// TrackStorageUsage tracks storage usage in GB. The hourly jobs/meter run records it automatically.
 func (u *UsageTracker) TrackStorageUsage(ctx context.Context, accountID string, storageGB int64) {
 	if !u.enabled {
 		return
@@ -200,17 +200,15 @@ func extractAuthContext(event events.APIGatewayProxyRequest) (string, string) {
 	var userID, accountID string
 
 	// Try lambda authorizer context first
-	if event.RequestContext.Authorizer.Lambda != nil {
-		if lambdaContext, ok := event.RequestContext.Authorizer.Lambda.(map[string]interface{}); ok {
-			if uid, exists := lambdaContext["userId"]; exists {
-				if uidStr, ok := uid.(string); ok {
-					userID = uidStr
-				}
+	if lambdaContext, ok := event.RequestContext.Authorizer["lambda"].(map[string]interface{}); ok {
+		if uid, exists := lambdaContext["userId"]; exists {
+			if uidStr, ok := uid.(string); ok {
+				userID = uidStr
 			}
-			if aid, exists := lambdaContext["accountId"]; exists {
-				if aidStr, ok := aid.(string); ok {
-					accountID = aidStr
-				}
+		}
+		if aid, exists := lambdaContext["accountId"]; exists {
+			if aidStr, ok := aid.(string); ok {
+				accountID = aidStr
 			}
 		}
 	}
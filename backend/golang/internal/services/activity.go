@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/listbackup/api/internal/database"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// LogActivity records an event in an account's activity feed for background services
+// that have no request handler of their own
+func LogActivity(ctx context.Context, db *database.DynamoDBClient, accountID, userID, activityType, action, status, message string) error {
+	eventID := fmt.Sprintf("activity:%d:%s", time.Now().UnixNano()/1000000, generateRandomString(9))
+	timestamp := time.Now().UnixNano() / 1000000 // Unix timestamp in milliseconds
+	ttl := time.Now().Add(90 * 24 * time.Hour).Unix()
+
+	activity := apitypes.Activity{
+		EventID:   eventID,
+		AccountID: accountID,
+		UserID:    userID,
+		Type:      activityType,
+		Action:    action,
+		Status:    status,
+		Message:   message,
+		Timestamp: timestamp,
+		TTL:       ttl,
+	}
+
+	return db.PutItem(ctx, database.ActivityTable, activity)
+}
+
+func generateRandomString(length int) string {
+	const charset = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = charset[time.Now().UnixNano()%int64(len(charset))]
+	}
+	return string(b)
+}
@@ -0,0 +1,547 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/uuid"
+	"github.com/listbackup/api/internal/database"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// Storage tiers recorded on files
+const (
+	StorageTierStandard = "standard"
+	StorageTierArchive  = "archive"
+)
+
+const (
+	// archiveTagKey tags objects for the bucket lifecycle rule that moves them to Glacier
+	archiveTagKey = "storage-tier"
+	// archiveMinSize matches the lifecycle default of not transitioning smaller objects,
+	// which would cost more in Glacier overhead than they save
+	archiveMinSize = 128 << 10
+	// rehydrationDays is how long a restored copy stays readable
+	rehydrationDays = 7
+	// rehydrationTimeout is after how long an unfinished restore may be requested again.
+	// Standard Glacier retrievals finish within hours.
+	rehydrationTimeout = 48 * time.Hour
+)
+
+// ArchiveService moves old snapshots to the archive tier and restores archived files on
+// request
+type ArchiveService struct {
+	db            *database.DynamoDBClient
+	snapshots     *SnapshotService
+	billing       *BillingService
+	notifications *NotificationService
+}
+
+// ArchiveReport summarises one archival run over an account
+type ArchiveReport struct {
+	AccountID         string   `json:"accountId"`
+	DryRun            bool     `json:"dryRun"`
+	ArchiveAfterDays  int      `json:"archiveAfterDays"`
+	SnapshotsArchived int      `json:"snapshotsArchived"`
+	ObjectsArchived   int      `json:"objectsArchived"`
+	BytesArchived     int64    `json:"bytesArchived"`
+	Errors            []string `json:"errors,omitempty"`
+}
+
+// NewArchiveService creates a new archive service. Snapshots are only archived when
+// BILLING_TABLE is configured, since the archive age comes from the plan.
+func NewArchiveService(ctx context.Context) (*ArchiveService, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	snapshots, err := NewSnapshotService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	notifications, err := NewNotificationService()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notification service: %v", err)
+	}
+
+	service := &ArchiveService{db: db, snapshots: snapshots, notifications: notifications}
+
+	if billingTable := os.Getenv("BILLING_TABLE"); billingTable != "" {
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS config: %v", err)
+		}
+		service.billing = NewBillingService(dynamodb.NewFromConfig(cfg), billingTable)
+	}
+
+	return service, nil
+}
+
+// ArchiveAccount tags the objects of snapshots older than the plan's archive age, which
+// the bucket lifecycle then moves to Glacier, and records the tier on their files. The
+// newest completed snapshot of each source always stays in the standard tier.
+func (s *ArchiveService) ArchiveAccount(ctx context.Context, account *apitypes.Account, dryRun bool) (*ArchiveReport, error) {
+	report := &ArchiveReport{AccountID: account.AccountID, DryRun: dryRun}
+	if s.billing == nil {
+		return report, nil
+	}
+
+	limits, err := s.billing.CheckPlanLimits(ctx, account.AccountID)
+	if err != nil {
+		log.Printf("No plan limits for %s, not archiving: %v", account.AccountID, err)
+		return report, nil
+	}
+	report.ArchiveAfterDays = limits.ArchiveAfterDays
+	if report.ArchiveAfterDays <= 0 {
+		return report, nil
+	}
+
+	var sources []apitypes.Source
+	err = s.db.QueryGSIAll(ctx, database.SourcesTable, "AccountIndex", "accountId = :accountId", map[string]interface{}{
+		":accountId": account.AccountID,
+	}, &sources)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sources: %v", err)
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -report.ArchiveAfterDays)
+	for _, source := range sources {
+		snapshots, err := s.snapshots.ListSourceSnapshots(ctx, source.SourceID)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", source.SourceID, err))
+			continue
+		}
+
+		for _, snapshot := range SelectArchivableSnapshots(snapshots, cutoff) {
+			objects, bytes := archivableObjects(snapshot.Manifest.Objects)
+			if !dryRun {
+				if err := s.archiveSnapshot(ctx, &snapshot, objects); err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", snapshot.SnapshotID, err))
+					continue
+				}
+			}
+			report.SnapshotsArchived++
+			report.ObjectsArchived += len(objects)
+			report.BytesArchived += bytes
+		}
+	}
+
+	if report.SnapshotsArchived > 0 || len(report.Errors) > 0 {
+		s.recordReport(ctx, report)
+	}
+	return report, nil
+}
+
+// SelectArchivableSnapshots returns the completed snapshots that finished before cutoff
+// and are not archived yet, leaving out the newest completed snapshot
+func SelectArchivableSnapshots(snapshots []apitypes.Snapshot, cutoff time.Time) []apitypes.Snapshot {
+	var completed []apitypes.Snapshot
+	for _, snapshot := range snapshots {
+		if snapshot.Status == "completed" {
+			completed = append(completed, snapshot)
+		}
+	}
+	sort.Slice(completed, func(i, j int) bool {
+		return completed[i].CreatedAt.After(completed[j].CreatedAt)
+	})
+
+	var archivable []apitypes.Snapshot
+	for i, snapshot := range completed {
+		if i == 0 || snapshot.ArchivedAt != nil {
+			continue
+		}
+		finished := snapshot.CreatedAt
+		if snapshot.CompletedAt != nil {
+			finished = *snapshot.CompletedAt
+		}
+		if finished.Before(cutoff) {
+			archivable = append(archivable, snapshot)
+		}
+	}
+	return archivable
+}
+
+// archivableObjects returns the objects large enough for lifecycle to transition and their
+// total stored size
+func archivableObjects(objects []apitypes.SnapshotObject) ([]apitypes.SnapshotObject, int64) {
+	var archivable []apitypes.SnapshotObject
+	var bytes int64
+	for _, object := range objects {
+		size := storedOrLogical(object.StoredSize, object.Size)
+		if size < archiveMinSize {
+			continue
+		}
+		archivable = append(archivable, object)
+		bytes += size
+	}
+	return archivable, bytes
+}
+
+// archiveSnapshot tags the objects for transition and marks their files and the snapshot
+// as archived. Tagging does not create a new object version, so locked objects keep their
+// legal hold.
+func (s *ArchiveService) archiveSnapshot(ctx context.Context, snapshot *apitypes.Snapshot, objects []apitypes.SnapshotObject) error {
+	now := time.Now()
+	for _, object := range objects {
+		_, err := s.snapshots.s3Client.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+			Bucket: aws.String(s.snapshots.bucket),
+			Key:    aws.String(object.S3Key),
+			Tagging: &s3types.Tagging{
+				TagSet: []s3types.Tag{{Key: aws.String(archiveTagKey), Value: aws.String(StorageTierArchive)}},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to tag %s for archival: %v", object.S3Key, err)
+		}
+
+		if object.FileID == "" {
+			continue
+		}
+		if err := s.updateFile(ctx, object.FileID, "SET storageTier = :tier, archivedAt = :now", map[string]interface{}{
+			":tier": StorageTierArchive,
+			":now":  now,
+		}); err != nil {
+			return err
+		}
+	}
+
+	snapshotIDAttr, err := attributevalue.Marshal(snapshot.SnapshotID)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshotID: %v", err)
+	}
+	nowAttr, err := attributevalue.Marshal(now)
+	if err != nil {
+		return fmt.Errorf("failed to marshal timestamp: %v", err)
+	}
+
+	err = s.db.UpdateItem(ctx, database.SnapshotsTable, map[string]types.AttributeValue{
+		"snapshotId": snapshotIDAttr,
+	}, "SET archivedAt = :now", map[string]types.AttributeValue{
+		":now": nowAttr,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark snapshot archived: %v", err)
+	}
+	return nil
+}
+
+func (s *ArchiveService) recordReport(ctx context.Context, report *ArchiveReport) {
+	status := "success"
+	if len(report.Errors) > 0 {
+		status = "error"
+	}
+
+	prefix := "Archived"
+	if report.DryRun {
+		prefix = "Dry run: would archive"
+	}
+	message := fmt.Sprintf("%s %d snapshots older than %d days (%d objects, %d bytes)",
+		prefix, report.SnapshotsArchived, report.ArchiveAfterDays, report.ObjectsArchived, report.BytesArchived)
+	if len(report.Errors) > 0 {
+		message += fmt.Sprintf(" (%d errors: %s)", len(report.Errors), strings.Join(report.Errors, "; "))
+	}
+
+	if err := LogActivity(ctx, s.db, report.AccountID, "system", "retention", "archive_snapshots", status, message); err != nil {
+		log.Printf("Failed to record archive report for %s: %v", report.AccountID, err)
+	}
+}
+
+// RequestRehydration queues a job restoring an archived file and returns the restore it
+// belongs to. A restore that is already under way is returned as is, so repeated download
+// attempts do not queue more jobs.
+func (s *ArchiveService) RequestRehydration(ctx context.Context, file *apitypes.File, userID string) (*apitypes.FileRehydration, error) {
+	now := time.Now()
+	if current := file.Rehydration; current != nil && current.Status != "ready" && now.Sub(current.RequestedAt) < rehydrationTimeout {
+		return current, nil
+	}
+
+	job := apitypes.Job{
+		JobID:     "job:" + uuid.New().String(),
+		AccountID: file.AccountID,
+		UserID:    userID,
+		SourceID:  file.SourceID,
+		Name:      "Restore from archive: " + file.Path,
+		Type:      "maintenance",
+		SubType:   MaintenanceRehydrate,
+		Priority:  "high",
+		Status:    "pending",
+		Enabled:   true,
+		Config: apitypes.JobConfig{
+			Maintenance: &apitypes.MaintenanceConfig{
+				Task:       MaintenanceRehydrate,
+				SnapshotID: file.SnapshotID,
+				FileID:     file.FileID,
+			},
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	rehydration := &apitypes.FileRehydration{
+		JobID:       job.JobID,
+		RequestedBy: userID,
+		Status:      "requested",
+		RequestedAt: now,
+	}
+
+	jobItem, err := attributevalue.MarshalMap(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal job: %v", err)
+	}
+	values, err := attributevalue.MarshalMap(map[string]interface{}{
+		":rehydration": rehydration,
+		":ready":       "ready",
+		":stale":       now.Add(-rehydrationTimeout),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rehydration: %v", err)
+	}
+
+	// The condition claims the file, so concurrent downloads queue a single job
+	err = s.db.TransactWrite(ctx, []types.TransactWriteItem{
+		{Put: &types.Put{
+			TableName: aws.String(database.JobsTable),
+			Item:      jobItem,
+		}},
+		{Update: &types.Update{
+			TableName:                 aws.String(database.FilesTable),
+			Key:                       map[string]types.AttributeValue{"fileId": &types.AttributeValueMemberS{Value: file.FileID}},
+			UpdateExpression:          aws.String("SET rehydration = :rehydration"),
+			ConditionExpression:       aws.String("attribute_not_exists(rehydration) OR rehydration.#status = :ready OR rehydration.requestedAt < :stale"),
+			ExpressionAttributeNames:  map[string]string{"#status": "status"},
+			ExpressionAttributeValues: values,
+		}},
+	})
+	if err != nil {
+		if database.ConditionFailed(err, 1) {
+			current, getErr := s.getFile(ctx, file.FileID)
+			if getErr == nil && current.Rehydration != nil {
+				return current.Rehydration, nil
+			}
+		}
+		return nil, fmt.Errorf("failed to queue rehydration of %s: %v", file.FileID, err)
+	}
+
+	file.Rehydration = rehydration
+	message := fmt.Sprintf("Requested restore of archived file %s", file.Path)
+	if err := LogActivity(ctx, s.db, file.AccountID, userID, "data", "file_rehydration", "pending", message); err != nil {
+		log.Printf("Failed to log activity: %v", err)
+	}
+	return rehydration, nil
+}
+
+// StartRehydration asks S3 to restore the file of a rehydrate job. It reports true when
+// the file could already be read and is marked ready; otherwise the job stays running
+// until CompleteRehydration is called for the restored object.
+func (s *ArchiveService) StartRehydration(ctx context.Context, job *apitypes.Job) (bool, error) {
+	config := job.Config.Maintenance
+	if config == nil || config.FileID == "" {
+		return false, fmt.Errorf("job %s has no file to restore", job.JobID)
+	}
+
+	file, err := s.getFile(ctx, config.FileID)
+	if err != nil {
+		return false, err
+	}
+
+	// Lifecycle runs asynchronously, so a recently archived object may not have moved yet
+	readable, err := s.snapshots.objectReadable(ctx, file.S3Key)
+	if err != nil {
+		return false, err
+	}
+	if readable {
+		return true, s.markReady(ctx, file, time.Now().AddDate(0, 0, rehydrationDays))
+	}
+
+	_, err = s.snapshots.s3Client.RestoreObject(ctx, &s3.RestoreObjectInput{
+		Bucket: aws.String(s.snapshots.bucket),
+		Key:    aws.String(file.S3Key),
+		RestoreRequest: &s3types.RestoreRequest{
+			Days:                 aws.Int32(rehydrationDays),
+			GlacierJobParameters: &s3types.GlacierJobParameters{Tier: s3types.TierStandard},
+		},
+	})
+	if err != nil && !strings.Contains(err.Error(), "RestoreAlreadyInProgress") {
+		return false, fmt.Errorf("failed to restore %s: %v", file.S3Key, err)
+	}
+
+	if err := s.updateFile(ctx, file.FileID, "SET rehydration.#status = :status", map[string]interface{}{
+		":status": "restoring",
+	}); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// CompleteRehydration handles S3 reporting that the restore of an object finished. The
+// file is marked ready, its job completed and the user who asked for it notified.
+func (s *ArchiveService) CompleteRehydration(ctx context.Context, s3Key string) error {
+	file, err := s.fileForKey(ctx, s3Key)
+	if err != nil {
+		return err
+	}
+	if file.Rehydration == nil {
+		log.Printf("Object %s was restored without a rehydration request", s3Key)
+		return nil
+	}
+
+	if err := s.markReady(ctx, file, time.Now().AddDate(0, 0, rehydrationDays)); err != nil {
+		return err
+	}
+	return s.completeJob(ctx, file.Rehydration.JobID)
+}
+
+// markReady records that the file can be downloaded until readyUntil and notifies the
+// user who requested it
+func (s *ArchiveService) markReady(ctx context.Context, file *apitypes.File, readyUntil time.Time) error {
+	now := time.Now()
+	err := s.updateFile(ctx, file.FileID, "SET rehydration.#status = :status, rehydration.readyAt = :now, rehydration.readyUntil = :until", map[string]interface{}{
+		":status": "ready",
+		":now":    now,
+		":until":  readyUntil,
+	})
+	if err != nil {
+		return err
+	}
+
+	rehydration := file.Rehydration
+	if rehydration == nil {
+		return nil
+	}
+
+	message := fmt.Sprintf("Archived file %s has been restored and can be downloaded until %s",
+		file.Path, readyUntil.UTC().Format(time.RFC3339))
+	if err := LogActivity(ctx, s.db, file.AccountID, rehydration.RequestedBy, "data", "file_rehydration", "success", message); err != nil {
+		log.Printf("Failed to log activity: %v", err)
+	}
+
+	_, err = s.notifications.CreateNotification(CreateNotificationOptions{
+		UserID:      rehydration.RequestedBy,
+		AccountID:   file.AccountID,
+		Type:        "success",
+		Category:    "backup",
+		Title:       "Archived file ready to download",
+		Message:     message,
+		Priority:    "normal",
+		Channels:    []string{"app", "email"},
+		EntityID:    file.FileID,
+		EntityType:  "file",
+		ActionURL:   fmt.Sprintf("/dashboard/sources/%s", strings.TrimPrefix(file.SourceID, "source:")),
+		ActionLabel: "View Source",
+		Data: map[string]interface{}{
+			"jobId":      rehydration.JobID,
+			"readyUntil": readyUntil,
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to notify %s that %s is restored: %v", rehydration.RequestedBy, file.FileID, err)
+	}
+	return nil
+}
+
+// fileForKey finds the file stored under an object key, which has the form
+// account/source/snapshot/path
+func (s *ArchiveService) fileForKey(ctx context.Context, s3Key string) (*apitypes.File, error) {
+	// Keys in S3 event notifications are URL encoded
+	if decoded, err := url.QueryUnescape(s3Key); err == nil {
+		s3Key = decoded
+	}
+	parts := strings.SplitN(s3Key, "/", 4)
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("%s is not a snapshot object key", s3Key)
+	}
+
+	var files []apitypes.File
+	_, err := s.db.QueryPage(ctx, database.FilesTable, database.PageQuery{
+		IndexName:    FilesSnapshotPathIndex,
+		KeyCondition: "snapshotId = :snapshotId AND #path = :path",
+		Names:        map[string]string{"#path": "path"},
+		Values: map[string]interface{}{
+			":snapshotId": "snapshot:" + parts[2],
+			":path":       parts[3],
+		},
+	}, &files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find file for %s: %v", s3Key, err)
+	}
+	for i := range files {
+		if files[i].S3Key == s3Key {
+			return &files[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no file is stored under %s", s3Key)
+}
+
+func (s *ArchiveService) getFile(ctx context.Context, fileID string) (*apitypes.File, error) {
+	fileIDAttr, err := attributevalue.Marshal(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal fileID: %v", err)
+	}
+
+	var file apitypes.File
+	err = s.db.GetItem(ctx, database.FilesTable, map[string]types.AttributeValue{
+		"fileId": fileIDAttr,
+	}, &file)
+	if err != nil || file.FileID == "" {
+		return nil, fmt.Errorf("file %s not found", fileID)
+	}
+	return &file, nil
+}
+
+func (s *ArchiveService) updateFile(ctx context.Context, fileID, updateExpression string, values map[string]interface{}) error {
+	fileIDAttr, err := attributevalue.Marshal(fileID)
+	if err != nil {
+		return fmt.Errorf("failed to marshal fileID: %v", err)
+	}
+	valuesAttr, err := attributevalue.MarshalMap(values)
+	if err != nil {
+		return fmt.Errorf("failed to marshal file update: %v", err)
+	}
+
+	key := map[string]types.AttributeValue{"fileId": fileIDAttr}
+	if strings.Contains(updateExpression, "#status") {
+		err = s.db.UpdateItemWithNames(ctx, database.FilesTable, key, updateExpression, valuesAttr, map[string]string{"#status": "status"})
+	} else {
+		err = s.db.UpdateItem(ctx, database.FilesTable, key, updateExpression, valuesAttr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update file %s: %v", fileID, err)
+	}
+	return nil
+}
+
+func (s *ArchiveService) completeJob(ctx context.Context, jobID string) error {
+	jobIDAttr, err := attributevalue.Marshal(jobID)
+	if err != nil {
+		return fmt.Errorf("failed to marshal jobID: %v", err)
+	}
+	values, err := attributevalue.MarshalMap(map[string]interface{}{
+		":status": "completed",
+		":now":    time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal job update: %v", err)
+	}
+
+	err = s.db.UpdateItemWithNames(ctx, database.JobsTable, map[string]types.AttributeValue{
+		"jobId": jobIDAttr,
+	}, "SET #status = :status, completedAt = :now, lastRunAt = :now, updatedAt = :now", values, map[string]string{"#status": "status"})
+	if err != nil {
+		return fmt.Errorf("failed to complete job %s: %v", jobID, err)
+	}
+	return nil
+}
@@ -0,0 +1,515 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/listbackup/api/internal/connectors"
+	"github.com/listbackup/api/internal/database"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// BackupService executes backup and sync jobs
+type BackupService struct {
+	db           *database.DynamoDBClient
+	snapshots    *SnapshotService
+	search       *SearchService
+	destinations *DestinationService
+	masking      *MaskingService
+}
+
+// BackupPlan is everything a job needs loaded before it can run
+type BackupPlan struct {
+	Job            *apitypes.Job
+	Account        *apitypes.Account
+	Source         *apitypes.Source
+	Connection     *apitypes.PlatformConnection
+	Platform       *apitypes.Platform
+	PlatformSource *apitypes.PlatformSource
+}
+
+// NewBackupService creates a new backup service
+func NewBackupService(ctx context.Context) (*BackupService, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	snapshots, err := NewSnapshotService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := NewSecretsService()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create secrets service: %v", err)
+	}
+
+	masking := &MaskingService{secrets: secrets, keys: map[string][]byte{}}
+	return &BackupService{
+		db:           db,
+		snapshots:    snapshots,
+		search:       &SearchService{db: db, snapshots: snapshots, masking: masking},
+		destinations: &DestinationService{db: db, snapshots: snapshots, secrets: secrets},
+		masking:      masking,
+	}, nil
+}
+
+// checkpointPages is how many pages of an endpoint are fetched between checkpoints
+const checkpointPages = 50
+
+// RunJob fetches every endpoint of the job's source and stores the results as a snapshot.
+// Progress is checkpointed per endpoint, so when the job was paused or failed before, it
+// continues its earlier snapshot from where that run stopped.
+func (s *BackupService) RunJob(ctx context.Context, job *apitypes.Job) (*apitypes.Snapshot, error) {
+	plan, err := s.LoadPlan(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+
+	connector, err := connectors.NewCatalogConnector(*plan.Platform, plan.Connection.Credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	endpointNames := selectEndpoints(plan)
+	if len(endpointNames) == 0 {
+		return nil, fmt.Errorf("source %s has no endpoints to back up", plan.Source.SourceID)
+	}
+
+	writer, progress, err := s.openSnapshot(ctx, plan, len(endpointNames))
+	if err != nil {
+		return nil, err
+	}
+	if isHeld(plan.Account.LegalHold) || isHeld(plan.Source.LegalHold) {
+		writer.HoldObjects()
+	}
+
+	// Checkpoints are still written once a pause or cancel has cancelled ctx
+	saveCtx := context.WithoutCancel(ctx)
+
+	// A resumed snapshot keeps masking with the rules it began with, so all of its
+	// records are masked alike
+	masker, err := s.masking.NewMasker(ctx, plan.Account.AccountID, writer.Snapshot().Manifest.Masking)
+	if err != nil {
+		return nil, s.stopJob(saveCtx, nil, job, writer, progress, err)
+	}
+
+	// Endpoints run concurrently, but never before the endpoints they depend on, so
+	// records that reference others are fetched after what they reference. Each fetch
+	// holds a slot on the connection, shared with every other job using it, so sources
+	// on one platform account together stay within its rate limits.
+	parallelism := connectors.ConcurrencyLimit(plan.Platform.APIConfig.RateLimits)
+	slots := NewConnectionSemaphore(s.db, plan.Connection.ConnectionID, parallelism)
+	var mu sync.Mutex
+	inFlight := map[string]bool{}
+	setRunning := func(name string, running bool) {
+		if running {
+			inFlight[name] = true
+		} else {
+			delete(inFlight, name)
+		}
+		names := make([]string, 0, len(inFlight))
+		for n := range inFlight {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		progress.CurrentStep = strings.Join(names, ", ")
+	}
+	saveCheckpoint := func(name string, checkpoint apitypes.EndpointCheckpoint) {
+		mu.Lock()
+		defer mu.Unlock()
+		progress.Endpoints[name] = checkpoint
+		s.saveProgress(saveCtx, job.JobID, progress)
+	}
+
+	err = runEndpointGraph(ctx, endpointNames, plan.PlatformSource.Endpoints, parallelism, func(ctx context.Context, name string) error {
+		mu.Lock()
+		checkpoint := progress.Endpoints[name]
+		if checkpoint.Status == "completed" {
+			mu.Unlock()
+			return nil
+		}
+		setRunning(name, true)
+		s.saveProgress(ctx, job.JobID, progress)
+		mu.Unlock()
+
+		catalogEndpoint := plan.PlatformSource.Endpoints[name]
+		params := EndpointParams(plan.PlatformSource.Endpoints, name, plan.Source.Settings.CustomParams)
+		endpoint := connector.EndpointFromCatalog(name, catalogEndpoint, params)
+		// Pages are filtered and masked before they are staged, so masked fields are never
+		// written, not even to a checkpoint
+		filters := EndpointFilters(plan.Source.Settings.Filters, name)
+		var dropped int64
+		prepare := func(page []json.RawMessage) ([]json.RawMessage, error) {
+			kept, err := FilterRecords(page, filters)
+			if err != nil {
+				return nil, err
+			}
+			dropped += int64(len(page) - len(kept))
+			return masker.MaskRecords(name, kept)
+		}
+
+		release, err := slots.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		data, parts, err := s.fetchEndpoint(ctx, writer, connector, endpoint, checkpoint, prepare, func(checkpoint apitypes.EndpointCheckpoint) {
+			saveCheckpoint(name, checkpoint)
+		})
+		release()
+		if err != nil {
+			mu.Lock()
+			setRunning(name, false)
+			// Endpoints stopped by a pause, a cancel or another endpoint's failure did not fail
+			if ctx.Err() == nil {
+				progress.FailedSteps++
+				progress.ErrorMessage = fmt.Sprintf("%s: %v", name, err)
+			}
+			s.saveProgress(saveCtx, job.JobID, progress)
+			mu.Unlock()
+			return fmt.Errorf("failed to fetch %s: %w", name, err)
+		}
+
+		// The endpoint is fully fetched, so it is stored even if the job is being paused
+		records := countRecords(data)
+		file, err := writer.WriteObject(saveCtx, name, data, records)
+		if err != nil {
+			return err
+		}
+
+		// A missing index entry only affects search, so it does not fail the backup
+		if _, err := s.search.IndexRecords(saveCtx, file, catalogEndpoint.ResponseMapping, data); err != nil {
+			log.Printf("Failed to index %s for search: %v", name, err)
+		}
+
+		if err := writer.Save(saveCtx); err != nil {
+			log.Printf("Failed to checkpoint snapshot %s: %v", writer.Snapshot().SnapshotID, err)
+		}
+		s.snapshots.DeleteParts(saveCtx, parts)
+
+		mu.Lock()
+		setRunning(name, false)
+		progress.Endpoints[name] = apitypes.EndpointCheckpoint{
+			Status:    "completed",
+			Records:   records,
+			FileID:    file.FileID,
+			UpdatedAt: time.Now(),
+		}
+		progress.CompletedSteps++
+		progress.RecordsProcessed += records
+		progress.RecordsFiltered += dropped
+		progress.DataSizeBytes += int64(len(data))
+		progress.PercentComplete = float64(progress.CompletedSteps) / float64(progress.TotalSteps) * 100
+		s.saveProgress(saveCtx, job.JobID, progress)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		progress.CurrentStep = ""
+		return nil, s.stopJob(saveCtx, context.Cause(ctx), job, writer, progress, err)
+	}
+
+	progress.CurrentStep = ""
+	progress.SnapshotID = ""
+	s.saveProgress(ctx, job.JobID, progress)
+
+	snapshot, err := writer.Complete(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.markSourceBackedUp(ctx, plan.Source.SourceID); err != nil {
+		log.Printf("Failed to update source %s backup time: %v", plan.Source.SourceID, err)
+	}
+
+	// The snapshot is safe in our bucket either way, so a failed mirror is recorded on the
+	// snapshot rather than failing the job
+	if plan.Source.DestinationID != "" {
+		if _, err := s.destinations.MirrorSnapshot(ctx, snapshot, plan.Source.DestinationID); err != nil {
+			log.Printf("Failed to mirror snapshot %s: %v", snapshot.SnapshotID, err)
+		}
+	}
+
+	return snapshot, nil
+}
+
+// openSnapshot resumes the snapshot checkpointed by an earlier run of the job, or begins a
+// new one. A checkpoint whose snapshot has since finished is discarded.
+func (s *BackupService) openSnapshot(ctx context.Context, plan *BackupPlan, totalSteps int) (*SnapshotWriter, apitypes.JobProgress, error) {
+	job := plan.Job
+	if snapshotID := job.Progress.SnapshotID; snapshotID != "" {
+		writer, err := s.snapshots.ResumeSnapshot(ctx, plan.Account, job, snapshotID)
+		if err == nil {
+			progress := job.Progress
+			progress.TotalSteps = totalSteps
+			progress.FailedSteps = 0
+			progress.ErrorMessage = ""
+			if progress.Endpoints == nil {
+				progress.Endpoints = map[string]apitypes.EndpointCheckpoint{}
+			}
+			// An endpoint stored just before the run stopped may not have been checkpointed
+			for _, object := range writer.Snapshot().Manifest.Objects {
+				if checkpoint := progress.Endpoints[object.Endpoint]; checkpoint.Status != "completed" {
+					s.snapshots.DeleteParts(ctx, checkpoint.Parts)
+					progress.Endpoints[object.Endpoint] = apitypes.EndpointCheckpoint{
+						Status:    "completed",
+						Records:   object.Records,
+						FileID:    object.FileID,
+						UpdatedAt: time.Now(),
+					}
+					progress.CompletedSteps++
+				}
+			}
+			log.Printf("Resuming job %s in snapshot %s at %d of %d endpoints", job.JobID, snapshotID, progress.CompletedSteps, totalSteps)
+			return writer, progress, nil
+		}
+		if !errors.Is(err, ErrSnapshotNotResumable) {
+			return nil, apitypes.JobProgress{}, err
+		}
+		log.Printf("Starting job %s over: %v", job.JobID, err)
+	}
+
+	writer, err := s.snapshots.BeginSnapshot(ctx, plan.Account, job, ActiveMaskingRules(plan.Account, plan.Source))
+	if err != nil {
+		return nil, apitypes.JobProgress{}, err
+	}
+	return writer, apitypes.JobProgress{
+		TotalSteps: totalSteps,
+		SnapshotID: writer.Snapshot().SnapshotID,
+		Endpoints:  map[string]apitypes.EndpointCheckpoint{},
+	}, nil
+}
+
+// fetchEndpoint fetches an endpoint from where its checkpoint left off and returns all of
+// its records, each page passed through prepare, along with the staged parts they
+// include. Pages are staged in the snapshot
+// every checkpointPages pages and when the fetch stops early, and checkpointed with the
+// offset to continue from. Endpoints without an offset parameter cannot be continued and
+// are always fetched from the start.
+func (s *BackupService) fetchEndpoint(ctx context.Context, writer *SnapshotWriter, connector *connectors.CatalogConnector, endpoint connectors.Endpoint, checkpoint apitypes.EndpointCheckpoint, prepare func([]json.RawMessage) ([]json.RawMessage, error), save func(apitypes.EndpointCheckpoint)) ([]byte, []string, error) {
+	saveCtx := context.WithoutCancel(ctx)
+	resumable := endpoint.Options.OffsetParam != ""
+	if !resumable {
+		s.snapshots.DeleteParts(saveCtx, checkpoint.Parts)
+		checkpoint = apitypes.EndpointCheckpoint{}
+	}
+	checkpoint.Status = "running"
+
+	var pending []json.RawMessage
+	offset, pages := checkpoint.Offset, 0
+	stage := func() error {
+		if !resumable || len(pending) == 0 {
+			return nil
+		}
+		key, err := writer.StagePart(saveCtx, endpoint.Name, len(checkpoint.Parts), pending)
+		if err != nil {
+			return err
+		}
+		checkpoint.Parts = append(checkpoint.Parts, key)
+		checkpoint.Records += int64(len(pending))
+		checkpoint.Offset = offset
+		checkpoint.UpdatedAt = time.Now()
+		pending, pages = nil, 0
+		save(checkpoint)
+		return nil
+	}
+
+	err := connector.FetchPages(ctx, endpoint, checkpoint.Offset, func(page []json.RawMessage, nextOffset int) error {
+		page, err := prepare(page)
+		if err != nil {
+			return fmt.Errorf("failed to prepare %s: %v", endpoint.Name, err)
+		}
+		pending = append(pending, page...)
+		offset = nextOffset
+		if pages++; pages >= checkpointPages {
+			return stage()
+		}
+		return nil
+	})
+	if err != nil {
+		// Keep what was fetched so the next run does not fetch it again
+		if stageErr := stage(); stageErr != nil {
+			log.Printf("Failed to checkpoint %s: %v", endpoint.Name, stageErr)
+		}
+		return nil, nil, err
+	}
+
+	records, err := writer.ReadParts(saveCtx, checkpoint.Parts)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := json.Marshal(append(records, pending...))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal %s: %v", endpoint.Name, err)
+	}
+	return data, checkpoint.Parts, nil
+}
+
+// stopJob finishes the snapshot of a run that did not complete. A paused snapshot keeps
+// its checkpoint for when the job is resumed, a failed one for when it is retried, and a
+// cancelled one is closed for good along with its staged parts.
+func (s *BackupService) stopJob(ctx context.Context, cause error, job *apitypes.Job, writer *SnapshotWriter, progress apitypes.JobProgress, runErr error) error {
+	switch {
+	case errors.Is(cause, ErrJobPaused):
+		if err := writer.Pause(ctx); err != nil {
+			log.Printf("Failed to pause snapshot %s: %v", writer.Snapshot().SnapshotID, err)
+		}
+		s.saveProgress(ctx, job.JobID, progress)
+		return cause
+
+	case errors.Is(cause, ErrJobCancelled):
+		if _, err := writer.Cancel(ctx); err != nil {
+			log.Printf("Failed to cancel snapshot %s: %v", writer.Snapshot().SnapshotID, err)
+		}
+		s.snapshots.DeleteParts(ctx, stagedParts(progress))
+		progress.SnapshotID = ""
+		progress.Endpoints = nil
+		s.saveProgress(ctx, job.JobID, progress)
+		return cause
+	}
+
+	if _, err := writer.Fail(ctx); err != nil {
+		log.Printf("Failed to mark snapshot as failed: %v", err)
+	}
+	s.saveProgress(ctx, job.JobID, progress)
+	return runErr
+}
+
+// stagedParts returns the staged parts of every unfinished endpoint
+func stagedParts(progress apitypes.JobProgress) []string {
+	var parts []string
+	for _, checkpoint := range progress.Endpoints {
+		parts = append(parts, checkpoint.Parts...)
+	}
+	return parts
+}
+
+// LoadPlan loads the account, source, connection and catalog records for a job
+func (s *BackupService) LoadPlan(ctx context.Context, job *apitypes.Job) (*BackupPlan, error) {
+	plan := &BackupPlan{
+		Job:            job,
+		Account:        &apitypes.Account{},
+		Source:         &apitypes.Source{},
+		Connection:     &apitypes.PlatformConnection{},
+		Platform:       &apitypes.Platform{},
+		PlatformSource: &apitypes.PlatformSource{},
+	}
+
+	if err := s.getByID(ctx, database.AccountsTable, "accountId", job.AccountID, plan.Account); err != nil {
+		return nil, fmt.Errorf("failed to load account: %v", err)
+	}
+	if err := s.getByID(ctx, database.SourcesTable, "sourceId", job.SourceID, plan.Source); err != nil {
+		return nil, fmt.Errorf("failed to load source: %v", err)
+	}
+	if plan.Source.AccountID != job.AccountID {
+		return nil, fmt.Errorf("source %s does not belong to account %s", job.SourceID, job.AccountID)
+	}
+	if err := s.getByID(ctx, database.PlatformConnectionsTable, "connectionId", plan.Source.ConnectionID, plan.Connection); err != nil {
+		return nil, fmt.Errorf("failed to load connection: %v", err)
+	}
+	if err := s.getByID(ctx, database.PlatformSourcesTable, "platformSourceId", plan.Source.PlatformSourceID, plan.PlatformSource); err != nil {
+		return nil, fmt.Errorf("failed to load platform source: %v", err)
+	}
+	if err := s.getByID(ctx, database.PlatformsTable, "platformId", plan.PlatformSource.PlatformID, plan.Platform); err != nil {
+		return nil, fmt.Errorf("failed to load platform: %v", err)
+	}
+
+	return plan, nil
+}
+
+func (s *BackupService) getByID(ctx context.Context, tableName, keyName, id string, result interface{}) error {
+	idAttr, err := attributevalue.Marshal(id)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %v", keyName, err)
+	}
+
+	return s.db.GetItem(ctx, tableName, map[string]types.AttributeValue{
+		keyName: idAttr,
+	}, result)
+}
+
+func (s *BackupService) saveProgress(ctx context.Context, jobID string, progress apitypes.JobProgress) {
+	jobIDAttr, err := attributevalue.Marshal(jobID)
+	if err != nil {
+		log.Printf("Failed to marshal jobID: %v", err)
+		return
+	}
+	progressAttr, err := attributevalue.Marshal(progress)
+	if err != nil {
+		log.Printf("Failed to marshal job progress: %v", err)
+		return
+	}
+	updatedAtAttr, err := attributevalue.Marshal(time.Now())
+	if err != nil {
+		log.Printf("Failed to marshal timestamp: %v", err)
+		return
+	}
+
+	err = s.db.UpdateItem(ctx, database.JobsTable, map[string]types.AttributeValue{
+		"jobId": jobIDAttr,
+	}, "SET progress = :progress, updatedAt = :updatedAt", map[string]types.AttributeValue{
+		":progress":  progressAttr,
+		":updatedAt": updatedAtAttr,
+	})
+	if err != nil {
+		log.Printf("Failed to save progress for job %s: %v", jobID, err)
+	}
+}
+
+func (s *BackupService) markSourceBackedUp(ctx context.Context, sourceID string) error {
+	sourceIDAttr, err := attributevalue.Marshal(sourceID)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sourceID: %v", err)
+	}
+	nowAttr, err := attributevalue.Marshal(time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to marshal timestamp: %v", err)
+	}
+
+	return s.db.UpdateItem(ctx, database.SourcesTable, map[string]types.AttributeValue{
+		"sourceId": sourceIDAttr,
+	}, "SET lastBackupAt = :now, lastSyncAt = :now, updatedAt = :now", map[string]types.AttributeValue{
+		":now": nowAttr,
+	})
+}
+
+// selectEndpoints returns the endpoints to back up: the job's explicit list, or every
+// default-enabled endpoint of the platform source
+func selectEndpoints(plan *BackupPlan) []string {
+	var names []string
+	if len(plan.Job.Config.Endpoints) > 0 {
+		for _, name := range plan.Job.Config.Endpoints {
+			if _, ok := plan.PlatformSource.Endpoints[name]; ok {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+
+	for name, endpoint := range plan.PlatformSource.Endpoints {
+		if endpoint.DefaultEnabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// countRecords returns the number of records in a JSON array or NDJSON payload
+func countRecords(data []byte) int64 {
+	records, err := parseRecords(data)
+	if err != nil {
+		return 0
+	}
+	return records
+}
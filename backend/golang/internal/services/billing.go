@@ -2,7 +2,6 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"time"
@@ -12,7 +11,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/google/uuid"
-	"github.com/listbackup/api/internal/types"
+	apitypes "github.com/listbackup/api/internal/types"
 )
 
 type BillingService struct {
@@ -30,8 +29,8 @@ func NewBillingService(dynamoClient *dynamodb.Client, tableName string) *Billing
 // ============ SUBSCRIPTION MANAGEMENT ============
 
 // CreateSubscription creates a new subscription
-func (s *BillingService) CreateSubscription(ctx context.Context, accountID, planID, stripeCustomerID, stripeSubID string) (*types.Subscription, error) {
-	subscription := &types.Subscription{
+func (s *BillingService) CreateSubscription(ctx context.Context, accountID, planID, stripeCustomerID, stripeSubID string) (*apitypes.Subscription, error) {
+	subscription := &apitypes.Subscription{
 		SubscriptionID:     fmt.Sprintf("sub_%s", uuid.New().String()),
 		AccountID:          accountID,
 		StripeCustomerID:   stripeCustomerID,
@@ -64,7 +63,7 @@ func (s *BillingService) CreateSubscription(ctx context.Context, accountID, plan
 }
 
 // GetSubscription retrieves a subscription by ID
-func (s *BillingService) GetSubscription(ctx context.Context, subscriptionID string) (*types.Subscription, error) {
+func (s *BillingService) GetSubscription(ctx context.Context, subscriptionID string) (*apitypes.Subscription, error) {
 	result, err := s.dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(s.tableName),
 		Key: map[string]types.AttributeValue{
@@ -79,7 +78,7 @@ func (s *BillingService) GetSubscription(ctx context.Context, subscriptionID str
 		return nil, fmt.Errorf("subscription not found")
 	}
 
-	var subscription types.Subscription
+	var subscription apitypes.Subscription
 	err = attributevalue.UnmarshalMap(result.Item, &subscription)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal subscription: %w", err)
@@ -89,7 +88,7 @@ func (s *BillingService) GetSubscription(ctx context.Context, subscriptionID str
 }
 
 // GetSubscriptionByAccount retrieves a subscription by account ID
-func (s *BillingService) GetSubscriptionByAccount(ctx context.Context, accountID string) (*types.Subscription, error) {
+func (s *BillingService) GetSubscriptionByAccount(ctx context.Context, accountID string) (*apitypes.Subscription, error) {
 	result, err := s.dynamoClient.Query(ctx, &dynamodb.QueryInput{
 		TableName:              aws.String(s.tableName),
 		IndexName:              aws.String("AccountIndex"),
@@ -107,7 +106,7 @@ func (s *BillingService) GetSubscriptionByAccount(ctx context.Context, accountID
 		return nil, fmt.Errorf("subscription not found for account")
 	}
 
-	var subscription types.Subscription
+	var subscription apitypes.Subscription
 	err = attributevalue.UnmarshalMap(result.Items[0], &subscription)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal subscription: %w", err)
@@ -161,7 +160,7 @@ func (s *BillingService) CancelSubscription(ctx context.Context, subscriptionID
 // ============ BILLING PLAN MANAGEMENT ============
 
 // CreateBillingPlan creates a new billing plan
-func (s *BillingService) CreateBillingPlan(ctx context.Context, plan *types.BillingPlan) error {
+func (s *BillingService) CreateBillingPlan(ctx context.Context, plan *apitypes.BillingPlan) error {
 	if plan.PlanID == "" {
 		plan.PlanID = fmt.Sprintf("plan_%s", uuid.New().String())
 	}
@@ -185,7 +184,7 @@ func (s *BillingService) CreateBillingPlan(ctx context.Context, plan *types.Bill
 }
 
 // GetBillingPlan retrieves a billing plan by ID
-func (s *BillingService) GetBillingPlan(ctx context.Context, planID string) (*types.BillingPlan, error) {
+func (s *BillingService) GetBillingPlan(ctx context.Context, planID string) (*apitypes.BillingPlan, error) {
 	result, err := s.dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(s.tableName),
 		Key: map[string]types.AttributeValue{
@@ -200,7 +199,7 @@ func (s *BillingService) GetBillingPlan(ctx context.Context, planID string) (*ty
 		return nil, fmt.Errorf("billing plan not found")
 	}
 
-	var plan types.BillingPlan
+	var plan apitypes.BillingPlan
 	err = attributevalue.UnmarshalMap(result.Item, &plan)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal billing plan: %w", err)
@@ -210,7 +209,7 @@ func (s *BillingService) GetBillingPlan(ctx context.Context, planID string) (*ty
 }
 
 // ListBillingPlans retrieves all active billing plans
-func (s *BillingService) ListBillingPlans(ctx context.Context) ([]types.BillingPlan, error) {
+func (s *BillingService) ListBillingPlans(ctx context.Context) ([]apitypes.BillingPlan, error) {
 	result, err := s.dynamoClient.Query(ctx, &dynamodb.QueryInput{
 		TableName:              aws.String(s.tableName),
 		IndexName:              aws.String("StatusIndex"),
@@ -226,9 +225,9 @@ func (s *BillingService) ListBillingPlans(ctx context.Context) ([]types.BillingP
 		return nil, fmt.Errorf("failed to list billing plans: %w", err)
 	}
 
-	var plans []types.BillingPlan
+	var plans []apitypes.BillingPlan
 	for _, item := range result.Items {
-		var plan types.BillingPlan
+		var plan apitypes.BillingPlan
 		err = attributevalue.UnmarshalMap(item, &plan)
 		if err != nil {
 			log.Printf("Failed to unmarshal billing plan: %v", err)
@@ -244,13 +243,20 @@ func (s *BillingService) ListBillingPlans(ctx context.Context) ([]types.BillingP
 
 // RecordUsage records usage for billing
 func (s *BillingService) RecordUsage(ctx context.Context, accountID, subscriptionID, metricType string, quantity int64) error {
+	return s.RecordMeteredUsage(ctx, accountID, subscriptionID, metricType, quantity, 0)
+}
+
+// RecordMeteredUsage records usage that also has a fractional amount, such as storage
+// measured in GB-hours
+func (s *BillingService) RecordMeteredUsage(ctx context.Context, accountID, subscriptionID, metricType string, quantity int64, amount float64) error {
 	now := time.Now()
-	usageRecord := &types.UsageRecord{
+	usageRecord := &apitypes.UsageRecord{
 		RecordID:       fmt.Sprintf("usage_%s", uuid.New().String()),
 		AccountID:      accountID,
 		SubscriptionID: subscriptionID,
 		MetricType:     metricType,
 		Quantity:       quantity,
+		Amount:         amount,
 		Timestamp:      now,
 		BillingPeriod:  now.Format("2006-01"),
 		CreatedAt:      now,
@@ -273,7 +279,7 @@ func (s *BillingService) RecordUsage(ctx context.Context, accountID, subscriptio
 }
 
 // GetUsageForPeriod retrieves usage records for a billing period
-func (s *BillingService) GetUsageForPeriod(ctx context.Context, accountID, billingPeriod string) ([]types.UsageRecord, error) {
+func (s *BillingService) GetUsageForPeriod(ctx context.Context, accountID, billingPeriod string) ([]apitypes.UsageRecord, error) {
 	result, err := s.dynamoClient.Query(ctx, &dynamodb.QueryInput{
 		TableName:              aws.String(s.tableName),
 		IndexName:              aws.String("AccountBillingPeriodIndex"),
@@ -287,9 +293,9 @@ func (s *BillingService) GetUsageForPeriod(ctx context.Context, accountID, billi
 		return nil, fmt.Errorf("failed to get usage for period: %w", err)
 	}
 
-	var usageRecords []types.UsageRecord
+	var usageRecords []apitypes.UsageRecord
 	for _, item := range result.Items {
-		var record types.UsageRecord
+		var record apitypes.UsageRecord
 		err = attributevalue.UnmarshalMap(item, &record)
 		if err != nil {
 			log.Printf("Failed to unmarshal usage record: %v", err)
@@ -304,7 +310,7 @@ func (s *BillingService) GetUsageForPeriod(ctx context.Context, accountID, billi
 // ============ INVOICE MANAGEMENT ============
 
 // CreateInvoice creates a new invoice
-func (s *BillingService) CreateInvoice(ctx context.Context, invoice *types.Invoice) error {
+func (s *BillingService) CreateInvoice(ctx context.Context, invoice *apitypes.Invoice) error {
 	if invoice.InvoiceID == "" {
 		invoice.InvoiceID = fmt.Sprintf("inv_%s", uuid.New().String())
 	}
@@ -328,7 +334,7 @@ func (s *BillingService) CreateInvoice(ctx context.Context, invoice *types.Invoi
 }
 
 // GetInvoice retrieves an invoice by ID
-func (s *BillingService) GetInvoice(ctx context.Context, invoiceID string) (*types.Invoice, error) {
+func (s *BillingService) GetInvoice(ctx context.Context, invoiceID string) (*apitypes.Invoice, error) {
 	result, err := s.dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(s.tableName),
 		Key: map[string]types.AttributeValue{
@@ -343,7 +349,7 @@ func (s *BillingService) GetInvoice(ctx context.Context, invoiceID string) (*typ
 		return nil, fmt.Errorf("invoice not found")
 	}
 
-	var invoice types.Invoice
+	var invoice apitypes.Invoice
 	err = attributevalue.UnmarshalMap(result.Item, &invoice)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal invoice: %w", err)
@@ -353,7 +359,7 @@ func (s *BillingService) GetInvoice(ctx context.Context, invoiceID string) (*typ
 }
 
 // ListInvoices retrieves invoices for an account
-func (s *BillingService) ListInvoices(ctx context.Context, accountID string) ([]types.Invoice, error) {
+func (s *BillingService) ListInvoices(ctx context.Context, accountID string) ([]apitypes.Invoice, error) {
 	result, err := s.dynamoClient.Query(ctx, &dynamodb.QueryInput{
 		TableName:              aws.String(s.tableName),
 		IndexName:              aws.String("AccountIndex"),
@@ -367,9 +373,9 @@ func (s *BillingService) ListInvoices(ctx context.Context, accountID string) ([]
 		return nil, fmt.Errorf("failed to list invoices: %w", err)
 	}
 
-	var invoices []types.Invoice
+	var invoices []apitypes.Invoice
 	for _, item := range result.Items {
-		var invoice types.Invoice
+		var invoice apitypes.Invoice
 		err = attributevalue.UnmarshalMap(item, &invoice)
 		if err != nil {
 			log.Printf("Failed to unmarshal invoice: %v", err)
@@ -384,7 +390,7 @@ func (s *BillingService) ListInvoices(ctx context.Context, accountID string) ([]
 // ============ PAYMENT METHOD MANAGEMENT ============
 
 // CreatePaymentMethod creates a new payment method
-func (s *BillingService) CreatePaymentMethod(ctx context.Context, paymentMethod *types.PaymentMethod) error {
+func (s *BillingService) CreatePaymentMethod(ctx context.Context, paymentMethod *apitypes.PaymentMethod) error {
 	if paymentMethod.PaymentMethodID == "" {
 		paymentMethod.PaymentMethodID = fmt.Sprintf("pm_%s", uuid.New().String())
 	}
@@ -408,7 +414,7 @@ func (s *BillingService) CreatePaymentMethod(ctx context.Context, paymentMethod
 }
 
 // GetPaymentMethod retrieves a payment method by ID
-func (s *BillingService) GetPaymentMethod(ctx context.Context, paymentMethodID string) (*types.PaymentMethod, error) {
+func (s *BillingService) GetPaymentMethod(ctx context.Context, paymentMethodID string) (*apitypes.PaymentMethod, error) {
 	result, err := s.dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(s.tableName),
 		Key: map[string]types.AttributeValue{
@@ -423,7 +429,7 @@ func (s *BillingService) GetPaymentMethod(ctx context.Context, paymentMethodID s
 		return nil, fmt.Errorf("payment method not found")
 	}
 
-	var paymentMethod types.PaymentMethod
+	var paymentMethod apitypes.PaymentMethod
 	err = attributevalue.UnmarshalMap(result.Item, &paymentMethod)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal payment method: %w", err)
@@ -433,7 +439,7 @@ func (s *BillingService) GetPaymentMethod(ctx context.Context, paymentMethodID s
 }
 
 // ListPaymentMethods retrieves payment methods for an account
-func (s *BillingService) ListPaymentMethods(ctx context.Context, accountID string) ([]types.PaymentMethod, error) {
+func (s *BillingService) ListPaymentMethods(ctx context.Context, accountID string) ([]apitypes.PaymentMethod, error) {
 	result, err := s.dynamoClient.Query(ctx, &dynamodb.QueryInput{
 		TableName:              aws.String(s.tableName),
 		IndexName:              aws.String("AccountIndex"),
@@ -446,9 +452,9 @@ func (s *BillingService) ListPaymentMethods(ctx context.Context, accountID strin
 		return nil, fmt.Errorf("failed to list payment methods: %w", err)
 	}
 
-	var paymentMethods []types.PaymentMethod
+	var paymentMethods []apitypes.PaymentMethod
 	for _, item := range result.Items {
-		var pm types.PaymentMethod
+		var pm apitypes.PaymentMethod
 		err = attributevalue.UnmarshalMap(item, &pm)
 		if err != nil {
 			log.Printf("Failed to unmarshal payment method: %v", err)
@@ -463,7 +469,7 @@ func (s *BillingService) ListPaymentMethods(ctx context.Context, accountID strin
 // ============ BILLING EVENTS ============
 
 // RecordBillingEvent records a billing event
-func (s *BillingService) RecordBillingEvent(ctx context.Context, event *types.BillingEvent) error {
+func (s *BillingService) RecordBillingEvent(ctx context.Context, event *apitypes.BillingEvent) error {
 	if event.EventID == "" {
 		event.EventID = fmt.Sprintf("evt_%s", uuid.New().String())
 	}
@@ -488,7 +494,7 @@ func (s *BillingService) RecordBillingEvent(ctx context.Context, event *types.Bi
 // ============ CUSTOMER MANAGEMENT ============
 
 // CreateBillingCustomer creates a new billing customer
-func (s *BillingService) CreateBillingCustomer(ctx context.Context, customer *types.BillingCustomer) error {
+func (s *BillingService) CreateBillingCustomer(ctx context.Context, customer *apitypes.BillingCustomer) error {
 	if customer.CustomerID == "" {
 		customer.CustomerID = fmt.Sprintf("cus_%s", uuid.New().String())
 	}
@@ -512,7 +518,7 @@ func (s *BillingService) CreateBillingCustomer(ctx context.Context, customer *ty
 }
 
 // GetBillingCustomer retrieves a billing customer by account ID
-func (s *BillingService) GetBillingCustomer(ctx context.Context, accountID string) (*types.BillingCustomer, error) {
+func (s *BillingService) GetBillingCustomer(ctx context.Context, accountID string) (*apitypes.BillingCustomer, error) {
 	result, err := s.dynamoClient.Query(ctx, &dynamodb.QueryInput{
 		TableName:              aws.String(s.tableName),
 		IndexName:              aws.String("AccountIndex"),
@@ -530,7 +536,7 @@ func (s *BillingService) GetBillingCustomer(ctx context.Context, accountID strin
 		return nil, fmt.Errorf("billing customer not found for account")
 	}
 
-	var customer types.BillingCustomer
+	var customer apitypes.BillingCustomer
 	err = attributevalue.UnmarshalMap(result.Items[0], &customer)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal billing customer: %w", err)
@@ -542,7 +548,7 @@ func (s *BillingService) GetBillingCustomer(ctx context.Context, accountID strin
 // ============ UTILITY FUNCTIONS ============
 
 // CheckPlanLimits checks if an account has exceeded plan limits
-func (s *BillingService) CheckPlanLimits(ctx context.Context, accountID string) (*types.PlanLimits, error) {
+func (s *BillingService) CheckPlanLimits(ctx context.Context, accountID string) (*apitypes.PlanLimits, error) {
 	subscription, err := s.GetSubscriptionByAccount(ctx, accountID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get subscription: %w", err)
@@ -0,0 +1,400 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/listbackup/api/internal/database"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// ErrPlatformSourceNotFound is returned when a platform source does not exist
+var ErrPlatformSourceNotFound = errors.New("platform source not found")
+
+// CatalogService publishes versions of platform source templates and upgrades the sources
+// created from them
+type CatalogService struct {
+	db *database.DynamoDBClient
+}
+
+// SourceUpgrade is the outcome of upgrading one source to a newer template version
+type SourceUpgrade struct {
+	SourceID    string   `json:"sourceId"`
+	AccountID   string   `json:"accountId"`
+	Name        string   `json:"name"`
+	FromVersion int      `json:"fromVersion"`
+	ToVersion   int      `json:"toVersion"`
+	Status      string   `json:"status"`              // upgraded|would_upgrade|up_to_date|failed
+	Updated     []string `json:"updated,omitempty"`   // Settings that took the new template's defaults
+	Preserved   []string `json:"preserved,omitempty"` // Customized settings that were kept
+	Warnings    []string `json:"warnings,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// MigrationReport is the result of upgrading the sources of a platform source
+type MigrationReport struct {
+	PlatformSourceID string          `json:"platformSourceId"`
+	ToVersion        int             `json:"toVersion"`
+	DryRun           bool            `json:"dryRun"`
+	Upgraded         int             `json:"upgraded"`
+	UpToDate         int             `json:"upToDate"`
+	Failed           int             `json:"failed"`
+	Sources          []SourceUpgrade `json:"sources"`
+}
+
+// NewCatalogService creates a new catalog service
+func NewCatalogService(ctx context.Context) (*CatalogService, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	return &CatalogService{db: db}, nil
+}
+
+// PublishPlatformSource saves a platform source template. When it differs from the
+// current template it becomes a new version and is recorded in the version history;
+// otherwise nothing is written. A template saved before versioning is recorded as
+// version 0 first, so the sources created from it can be upgraded too. It reports
+// whether a new version was published.
+func (s *CatalogService) PublishPlatformSource(ctx context.Context, template apitypes.PlatformSource) (*apitypes.PlatformSource, bool, error) {
+	current, err := s.GetPlatformSource(ctx, template.PlatformSourceID)
+	if err != nil && !errors.Is(err, ErrPlatformSourceNotFound) {
+		return nil, false, err
+	}
+
+	now := time.Now()
+	template.Version = 1
+	template.CreatedAt = now
+	template.UpdatedAt = now
+
+	var items []types.TransactWriteItem
+	condition := "attribute_not_exists(platformSourceId)"
+	values := map[string]interface{}{}
+	if current != nil {
+		if current.Version > 0 && DiffPlatformSources(current, &template).Empty() {
+			return current, false, nil
+		}
+
+		template.Version = current.Version + 1
+		template.CreatedAt = current.CreatedAt
+		if current.Version == 0 {
+			item, err := versionItem(current, current.UpdatedAt)
+			if err != nil {
+				return nil, false, err
+			}
+			items = append(items, item)
+			condition = "attribute_not_exists(#version)"
+		} else {
+			condition = "#version = :previous"
+			values[":previous"] = current.Version
+		}
+	}
+
+	item, err := versionItem(&template, now)
+	if err != nil {
+		return nil, false, err
+	}
+	items = append(items, item)
+
+	templateItem, err := attributevalue.MarshalMap(template)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal platform source: %v", err)
+	}
+	put := &types.Put{
+		TableName:           aws.String(database.PlatformSourcesTable),
+		Item:                templateItem,
+		ConditionExpression: aws.String(condition),
+	}
+	if current != nil {
+		put.ExpressionAttributeNames = map[string]string{"#version": "version"}
+	}
+	if len(values) > 0 {
+		put.ExpressionAttributeValues, err = attributevalue.MarshalMap(values)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to marshal platform source version: %v", err)
+		}
+	}
+	items = append(items, types.TransactWriteItem{Put: put})
+
+	if err := s.db.TransactWrite(ctx, items); err != nil {
+		if database.ConditionFailed(err, -1) {
+			return nil, false, fmt.Errorf("platform source %s was changed while publishing, try again", template.PlatformSourceID)
+		}
+		return nil, false, fmt.Errorf("failed to publish platform source %s: %v", template.PlatformSourceID, err)
+	}
+	return &template, true, nil
+}
+
+// GetPlatformSource retrieves the current template of a platform source
+func (s *CatalogService) GetPlatformSource(ctx context.Context, platformSourceID string) (*apitypes.PlatformSource, error) {
+	var platformSource apitypes.PlatformSource
+	err := s.db.GetItem(ctx, database.PlatformSourcesTable, map[string]types.AttributeValue{
+		"platformSourceId": &types.AttributeValueMemberS{Value: platformSourceID},
+	}, &platformSource)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return nil, ErrPlatformSourceNotFound
+		}
+		return nil, fmt.Errorf("failed to get platform source %s: %v", platformSourceID, err)
+	}
+	return &platformSource, nil
+}
+
+// GetVersion retrieves a published version of a platform source template
+func (s *CatalogService) GetVersion(ctx context.Context, platformSourceID string, version int) (*apitypes.PlatformSource, error) {
+	versionAttr, err := attributevalue.Marshal(version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal version: %v", err)
+	}
+
+	var record apitypes.PlatformSourceVersion
+	err = s.db.GetItem(ctx, database.PlatformSourceVersionsTable, map[string]types.AttributeValue{
+		"platformSourceId": &types.AttributeValueMemberS{Value: platformSourceID},
+		"version":          versionAttr,
+	}, &record)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return nil, fmt.Errorf("version %d of platform source %s is not recorded", version, platformSourceID)
+		}
+		return nil, fmt.Errorf("failed to get version %d of platform source %s: %v", version, platformSourceID, err)
+	}
+	return &record.Template, nil
+}
+
+// ListVersions returns the recorded versions of a platform source, oldest first
+func (s *CatalogService) ListVersions(ctx context.Context, platformSourceID string) ([]apitypes.PlatformSourceVersion, error) {
+	query := database.PageQuery{
+		KeyCondition: "platformSourceId = :platformSourceId",
+		Values:       map[string]interface{}{":platformSourceId": platformSourceID},
+	}
+
+	var versions []apitypes.PlatformSourceVersion
+	for {
+		var page []apitypes.PlatformSourceVersion
+		next, err := s.db.QueryPage(ctx, database.PlatformSourceVersionsTable, query, &page)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list versions of platform source %s: %v", platformSourceID, err)
+		}
+		versions = append(versions, page...)
+		if next == "" {
+			return versions, nil
+		}
+		query.NextToken = next
+	}
+}
+
+// MigrateSources upgrades every source created from a platform source to its current
+// template. Settings a source left at the defaults of the version it came from take the
+// new defaults; settings that were customized are kept. With dryRun set nothing is
+// written and the report shows what would change.
+func (s *CatalogService) MigrateSources(ctx context.Context, platformSourceID string, dryRun bool) (*MigrationReport, error) {
+	latest, err := s.GetPlatformSource(ctx, platformSourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []apitypes.Source
+	err = s.db.QueryGSIAll(ctx, database.SourcesTable, "PlatformSourceIndex", "platformSourceId = :platformSourceId",
+		map[string]interface{}{":platformSourceId": platformSourceID}, &sources)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sources of platform source %s: %v", platformSourceID, err)
+	}
+
+	report := &MigrationReport{
+		PlatformSourceID: platformSourceID,
+		ToVersion:        latest.Version,
+		DryRun:           dryRun,
+		Sources:          []SourceUpgrade{},
+	}
+	templates := map[int]*apitypes.PlatformSource{latest.Version: latest}
+	for i := range sources {
+		upgrade := s.upgradeSource(ctx, &sources[i], latest, templates, dryRun)
+		switch upgrade.Status {
+		case "upgraded", "would_upgrade":
+			report.Upgraded++
+		case "up_to_date":
+			report.UpToDate++
+		case "failed":
+			report.Failed++
+		}
+		report.Sources = append(report.Sources, upgrade)
+	}
+	return report, nil
+}
+
+func (s *CatalogService) upgradeSource(ctx context.Context, source *apitypes.Source, latest *apitypes.PlatformSource, templates map[int]*apitypes.PlatformSource, dryRun bool) SourceUpgrade {
+	upgrade := SourceUpgrade{
+		SourceID:    source.SourceID,
+		AccountID:   source.AccountID,
+		Name:        source.Name,
+		FromVersion: source.TemplateVersion,
+		ToVersion:   latest.Version,
+	}
+	if source.TemplateVersion >= latest.Version {
+		upgrade.Status = "up_to_date"
+		return upgrade
+	}
+
+	base, ok := templates[source.TemplateVersion]
+	if !ok {
+		var err error
+		base, err = s.GetVersion(ctx, latest.PlatformSourceID, source.TemplateVersion)
+		if err != nil {
+			log.Printf("No base template for source %s: %v", source.SourceID, err)
+		}
+		templates[source.TemplateVersion] = base
+	}
+
+	var settings apitypes.SourceSettings
+	if base == nil {
+		// Without the old defaults there is no telling which settings were customized
+		settings = source.Settings
+		settings.CustomParams = copyParams(source.Settings.CustomParams)
+		for key, value := range latest.DefaultSettings.CustomParams {
+			if _, ok := settings.CustomParams[key]; !ok {
+				settings.CustomParams[key] = value
+				upgrade.Updated = append(upgrade.Updated, "customParams."+key)
+			}
+		}
+		upgrade.Warnings = append(upgrade.Warnings, fmt.Sprintf("version %d of the template is not recorded, so every existing setting was kept", source.TemplateVersion))
+	} else {
+		settings, upgrade.Updated, upgrade.Preserved = UpgradeSourceSettings(source.Settings, base.DefaultSettings, latest.DefaultSettings)
+		diff := DiffPlatformSources(base, latest)
+		for _, name := range diff.EndpointsRemoved {
+			upgrade.Warnings = append(upgrade.Warnings, fmt.Sprintf("endpoint %s is no longer backed up", name))
+		}
+		for _, name := range diff.EndpointsAdded {
+			if latest.Endpoints[name].DefaultEnabled {
+				upgrade.Warnings = append(upgrade.Warnings, fmt.Sprintf("endpoint %s is now backed up", name))
+			}
+		}
+	}
+
+	if dryRun {
+		upgrade.Status = "would_upgrade"
+		return upgrade
+	}
+
+	if err := s.saveUpgrade(ctx, source, settings, latest.Version); err != nil {
+		log.Printf("Failed to upgrade source %s: %v", source.SourceID, err)
+		upgrade.Status = "failed"
+		upgrade.Error = err.Error()
+		return upgrade
+	}
+	upgrade.Status = "upgraded"
+
+	message := fmt.Sprintf("Upgraded source %s to version %d of its template", source.Name, latest.Version)
+	if err := LogActivity(ctx, s.db, source.AccountID, "system", "sources", "template_upgrade", "success", message); err != nil {
+		log.Printf("Failed to log activity: %v", err)
+	}
+	return upgrade
+}
+
+// saveUpgrade writes the upgraded settings unless the source was upgraded in the meantime
+func (s *CatalogService) saveUpgrade(ctx context.Context, source *apitypes.Source, settings apitypes.SourceSettings, version int) error {
+	fields := map[string]interface{}{
+		":settings":  settings,
+		":version":   version,
+		":updatedAt": time.Now(),
+	}
+	condition := "attribute_not_exists(templateVersion)"
+	if source.TemplateVersion > 0 {
+		condition = "templateVersion = :from"
+		fields[":from"] = source.TemplateVersion
+	}
+	values, err := attributevalue.MarshalMap(fields)
+	if err != nil {
+		return fmt.Errorf("failed to marshal source upgrade: %v", err)
+	}
+
+	err = s.db.TransactWrite(ctx, []types.TransactWriteItem{{Update: &types.Update{
+		TableName:                 aws.String(database.SourcesTable),
+		Key:                       map[string]types.AttributeValue{"sourceId": &types.AttributeValueMemberS{Value: source.SourceID}},
+		UpdateExpression:          aws.String("SET settings = :settings, templateVersion = :version, updatedAt = :updatedAt"),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeValues: values,
+	}}})
+	if err != nil {
+		if database.ConditionFailed(err, 0) {
+			return fmt.Errorf("source was upgraded by another migration")
+		}
+		return fmt.Errorf("failed to save source upgrade: %v", err)
+	}
+	return nil
+}
+
+// UpgradeSourceSettings moves source settings from one version's defaults to another's. A
+// setting still at the old default takes the new default; a customized setting is kept.
+// It returns the new settings with the settings that changed and the customized settings
+// that were kept although the default changed.
+func UpgradeSourceSettings(current apitypes.SourceSettings, from, to apitypes.PlatformSourceDefaults) (apitypes.SourceSettings, []string, []string) {
+	settings := current
+	settings.CustomParams = copyParams(current.CustomParams)
+	var updated, preserved []string
+
+	apply := func(field string, customized, defaultChanged bool, take func()) {
+		if !defaultChanged {
+			return
+		}
+		if customized {
+			preserved = append(preserved, field)
+			return
+		}
+		take()
+		updated = append(updated, field)
+	}
+
+	apply("enabled", current.Enabled != from.Enabled, from.Enabled != to.Enabled, func() { settings.Enabled = to.Enabled })
+	apply("priority", current.Priority != from.Priority, from.Priority != to.Priority, func() { settings.Priority = to.Priority })
+	apply("frequency", current.Frequency != from.Frequency, from.Frequency != to.Frequency, func() { settings.Frequency = to.Frequency })
+	apply("retentionDays", current.RetentionDays != from.RetentionDays, from.RetentionDays != to.RetentionDays, func() { settings.RetentionDays = to.RetentionDays })
+	apply("incrementalSync", current.IncrementalSync != from.IncrementalSync, from.IncrementalSync != to.IncrementalSync, func() { settings.IncrementalSync = to.IncrementalSync })
+	apply("notifications", current.Notifications != from.Notifications, from.Notifications != to.Notifications, func() { settings.Notifications = to.Notifications })
+
+	for _, key := range unionKeys(from.CustomParams, to.CustomParams) {
+		value, has := current.CustomParams[key]
+		before, hadBefore := from.CustomParams[key]
+		after, hasAfter := to.CustomParams[key]
+		apply("customParams."+key, has != hadBefore || value != before, hadBefore != hasAfter || before != after, func() {
+			if hasAfter {
+				settings.CustomParams[key] = after
+			} else {
+				delete(settings.CustomParams, key)
+			}
+		})
+	}
+	return settings, updated, preserved
+}
+
+// versionItem builds the write that records a version of a template
+func versionItem(template *apitypes.PlatformSource, publishedAt time.Time) (types.TransactWriteItem, error) {
+	item, err := attributevalue.MarshalMap(apitypes.PlatformSourceVersion{
+		PlatformSourceID: template.PlatformSourceID,
+		Version:          template.Version,
+		Template:         *template,
+		PublishedAt:      publishedAt,
+	})
+	if err != nil {
+		return types.TransactWriteItem{}, fmt.Errorf("failed to marshal platform source version: %v", err)
+	}
+	return types.TransactWriteItem{Put: &types.Put{
+		TableName:           aws.String(database.PlatformSourceVersionsTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(platformSourceId)"),
+	}}, nil
+}
+
+func copyParams(params map[string]string) map[string]string {
+	copied := make(map[string]string, len(params))
+	for key, value := range params {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// FieldChange is one field that differs between two versions of a template
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old,omitempty"`
+	New   interface{} `json:"new,omitempty"`
+}
+
+// EndpointChange lists what changed in an endpoint both versions have
+type EndpointChange struct {
+	Endpoint string        `json:"endpoint"`
+	Changes  []FieldChange `json:"changes"`
+}
+
+// PlatformSourceDiff describes what changed between two versions of a platform source
+type PlatformSourceDiff struct {
+	PlatformSourceID    string           `json:"platformSourceId"`
+	FromVersion         int              `json:"fromVersion"`
+	ToVersion           int              `json:"toVersion"`
+	Fields              []FieldChange    `json:"fields,omitempty"`   // Name, status and other descriptive fields
+	Defaults            []FieldChange    `json:"defaults,omitempty"` // Default settings new sources get
+	EndpointsAdded      []string         `json:"endpointsAdded,omitempty"`
+	EndpointsRemoved    []string         `json:"endpointsRemoved,omitempty"`
+	EndpointsChanged    []EndpointChange `json:"endpointsChanged,omitempty"`
+	DependenciesAdded   []string         `json:"dependenciesAdded,omitempty"`
+	DependenciesRemoved []string         `json:"dependenciesRemoved,omitempty"`
+}
+
+// Empty reports whether the two versions are the same template
+func (d *PlatformSourceDiff) Empty() bool {
+	return len(d.Fields) == 0 && len(d.Defaults) == 0 &&
+		len(d.EndpointsAdded) == 0 && len(d.EndpointsRemoved) == 0 && len(d.EndpointsChanged) == 0 &&
+		len(d.DependenciesAdded) == 0 && len(d.DependenciesRemoved) == 0
+}
+
+// DiffPlatformSources compares two versions of a platform source template. Timestamps and
+// the version number itself are not compared.
+func DiffPlatformSources(from, to *apitypes.PlatformSource) *PlatformSourceDiff {
+	diff := &PlatformSourceDiff{
+		PlatformSourceID: to.PlatformSourceID,
+		FromVersion:      from.Version,
+		ToVersion:        to.Version,
+	}
+
+	diff.Fields = compareFields(nil, []fieldPair{
+		{"platformId", from.PlatformID, to.PlatformID},
+		{"name", from.Name, to.Name},
+		{"description", from.Description, to.Description},
+		{"dataType", from.DataType, to.DataType},
+		{"icon", from.Icon, to.Icon},
+		{"category", from.Category, to.Category},
+		{"popularity", from.Popularity, to.Popularity},
+		{"status", from.Status, to.Status},
+	})
+	diff.Defaults = diffDefaults(from.DefaultSettings, to.DefaultSettings)
+
+	for _, name := range sortedKeys(from.Endpoints) {
+		if _, ok := to.Endpoints[name]; !ok {
+			diff.EndpointsRemoved = append(diff.EndpointsRemoved, name)
+		}
+	}
+	for _, name := range sortedKeys(to.Endpoints) {
+		before, ok := from.Endpoints[name]
+		if !ok {
+			diff.EndpointsAdded = append(diff.EndpointsAdded, name)
+			continue
+		}
+		if changes := diffEndpoint(before, to.Endpoints[name]); len(changes) > 0 {
+			diff.EndpointsChanged = append(diff.EndpointsChanged, EndpointChange{Endpoint: name, Changes: changes})
+		}
+	}
+
+	diff.DependenciesAdded, diff.DependenciesRemoved = diffSets(from.Dependencies, to.Dependencies)
+	return diff
+}
+
+type fieldPair struct {
+	field    string
+	old, new interface{}
+}
+
+// compareFields appends a change for every pair whose values differ
+func compareFields(changes []FieldChange, pairs []fieldPair) []FieldChange {
+	for _, pair := range pairs {
+		if !sameValue(pair.old, pair.new) {
+			changes = append(changes, FieldChange{Field: pair.field, Old: pair.old, New: pair.new})
+		}
+	}
+	return changes
+}
+
+// sameValue compares two values, treating nil and empty maps or slices as equal since
+// DynamoDB does not keep the difference
+func sameValue(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Kind() == vb.Kind() && (va.Kind() == reflect.Map || va.Kind() == reflect.Slice) && va.Len() == 0 && vb.Len() == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func diffDefaults(from, to apitypes.PlatformSourceDefaults) []FieldChange {
+	changes := compareFields(nil, []fieldPair{
+		{"enabled", from.Enabled, to.Enabled},
+		{"priority", from.Priority, to.Priority},
+		{"frequency", from.Frequency, to.Frequency},
+		{"retentionDays", from.RetentionDays, to.RetentionDays},
+		{"incrementalSync", from.IncrementalSync, to.IncrementalSync},
+		{"notifications", from.Notifications, to.Notifications},
+	})
+	for _, key := range unionKeys(from.CustomParams, to.CustomParams) {
+		before, hadBefore := from.CustomParams[key]
+		after, hasAfter := to.CustomParams[key]
+		if hadBefore != hasAfter || before != after {
+			change := FieldChange{Field: "customParams." + key}
+			if hadBefore {
+				change.Old = before
+			}
+			if hasAfter {
+				change.New = after
+			}
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+func diffEndpoint(from, to apitypes.PlatformEndpoint) []FieldChange {
+	changes := compareFields(nil, []fieldPair{
+		{"path", from.Path, to.Path},
+		{"method", from.Method, to.Method},
+		{"dataType", from.DataType, to.DataType},
+		{"defaultEnabled", from.DefaultEnabled, to.DefaultEnabled},
+		{"defaultPriority", from.DefaultPriority, to.DefaultPriority},
+		{"defaultFrequency", from.DefaultFrequency, to.DefaultFrequency},
+		{"supportsIncremental", from.SupportsIncremental, to.SupportsIncremental},
+		{"responseMapping.dataPath", from.ResponseMapping.DataPath, to.ResponseMapping.DataPath},
+		{"responseMapping.idField", from.ResponseMapping.IDField, to.ResponseMapping.IDField},
+		{"responseMapping.timestampField", from.ResponseMapping.TimestampField, to.ResponseMapping.TimestampField},
+		{"responseMapping.paginationKey", from.ResponseMapping.PaginationKey, to.ResponseMapping.PaginationKey},
+		{"responseMapping.fieldMappings", from.ResponseMapping.FieldMappings, to.ResponseMapping.FieldMappings},
+	})
+
+	added, removed := diffSets(from.Dependencies, to.Dependencies)
+	if len(added) > 0 || len(removed) > 0 {
+		changes = append(changes, FieldChange{Field: "dependencies", Old: from.Dependencies, New: to.Dependencies})
+	}
+
+	params := make(map[string]apitypes.APIParameter, len(from.Parameters))
+	for _, param := range from.Parameters {
+		params[param.Name] = param
+	}
+	seen := make(map[string]bool, len(to.Parameters))
+	for _, param := range to.Parameters {
+		seen[param.Name] = true
+		before, ok := params[param.Name]
+		switch {
+		case !ok:
+			changes = append(changes, FieldChange{Field: "parameters." + param.Name, New: param})
+		case before != param:
+			changes = append(changes, FieldChange{Field: "parameters." + param.Name, Old: before, New: param})
+		}
+	}
+	for _, param := range from.Parameters {
+		if !seen[param.Name] {
+			changes = append(changes, FieldChange{Field: "parameters." + param.Name, Old: param})
+		}
+	}
+	return changes
+}
+
+// diffSets returns the values only in to and the values only in from
+func diffSets(from, to []string) ([]string, []string) {
+	before := make(map[string]bool, len(from))
+	for _, value := range from {
+		before[value] = true
+	}
+	after := make(map[string]bool, len(to))
+	for _, value := range to {
+		after[value] = true
+	}
+
+	var added, removed []string
+	for _, value := range to {
+		if !before[value] {
+			added = append(added, value)
+		}
+	}
+	for _, value := range from {
+		if !after[value] {
+			removed = append(removed, value)
+		}
+	}
+	return added, removed
+}
+
+func sortedKeys(endpoints map[string]apitypes.PlatformEndpoint) []string {
+	keys := make([]string, 0, len(endpoints))
+	for key := range endpoints {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func unionKeys(a, b map[string]string) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// String summarizes the diff in one line
+func (d *PlatformSourceDiff) String() string {
+	if d.Empty() {
+		return fmt.Sprintf("%s: v%d and v%d are the same", d.PlatformSourceID, d.FromVersion, d.ToVersion)
+	}
+	return fmt.Sprintf("%s v%d -> v%d: %d fields, %d defaults, %d endpoints added, %d removed, %d changed, %d dependencies added, %d removed",
+		d.PlatformSourceID, d.FromVersion, d.ToVersion, len(d.Fields), len(d.Defaults),
+		len(d.EndpointsAdded), len(d.EndpointsRemoved), len(d.EndpointsChanged),
+		len(d.DependenciesAdded), len(d.DependenciesRemoved))
+}
+
+// DiffPlatforms compares two definitions of a platform, including its OAuth and API
+// configuration. Timestamps are not compared.
+func DiffPlatforms(from, to *apitypes.Platform) []FieldChange {
+	changes := compareFields(nil, []fieldPair{
+		{"name", from.Name, to.Name},
+		{"type", from.Type, to.Type},
+		{"category", from.Category, to.Category},
+		{"description", from.Description, to.Description},
+		{"status", from.Status, to.Status},
+		{"version", from.Version, to.Version},
+		{"logoUrl", from.LogoURL, to.LogoURL},
+		{"documentationUrl", from.DocumentationURL, to.DocumentationURL},
+		{"apiConfig.baseUrl", from.APIConfig.BaseURL, to.APIConfig.BaseURL},
+		{"apiConfig.authType", from.APIConfig.AuthType, to.APIConfig.AuthType},
+		{"apiConfig.testEndpoint", from.APIConfig.TestEndpoint, to.APIConfig.TestEndpoint},
+		{"apiConfig.rateLimits", from.APIConfig.RateLimits, to.APIConfig.RateLimits},
+		{"apiConfig.requiredHeaders", from.APIConfig.RequiredHeaders, to.APIConfig.RequiredHeaders},
+		{"apiConfig.version", from.APIConfig.Version, to.APIConfig.Version},
+	})
+
+	switch {
+	case from.OAuth == nil && to.OAuth == nil:
+	case from.OAuth == nil || to.OAuth == nil:
+		changes = append(changes, FieldChange{Field: "oauth", Old: from.OAuth, New: to.OAuth})
+	default:
+		changes = compareFields(changes, []fieldPair{
+			{"oauth.authUrl", from.OAuth.AuthURL, to.OAuth.AuthURL},
+			{"oauth.tokenUrl", from.OAuth.TokenURL, to.OAuth.TokenURL},
+			{"oauth.userInfoUrl", from.OAuth.UserInfoURL, to.OAuth.UserInfoURL},
+			{"oauth.scopes", from.OAuth.Scopes, to.OAuth.Scopes},
+			{"oauth.responseType", from.OAuth.ResponseType, to.OAuth.ResponseType},
+		})
+	}
+	return changes
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/listbackup/api/internal/connectors"
+	"github.com/listbackup/api/internal/database"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+const (
+	// refreshAhead is how long before it expires a connection's access token is refreshed.
+	// Health checks run every 30 minutes, so tokens are renewed before they lapse.
+	refreshAhead = 45 * time.Minute
+	// connectionTestTimeout bounds the test request made for one connection
+	connectionTestTimeout = 20 * time.Second
+)
+
+// ConnectionHealthService keeps platform connections usable: it refreshes OAuth tokens
+// ahead of expiry and tests each connection against its platform
+type ConnectionHealthService struct {
+	db            *database.DynamoDBClient
+	oauth         *OAuthService
+	notifications *NotificationService
+}
+
+// ConnectionCheck is the outcome of checking one connection
+type ConnectionCheck struct {
+	ConnectionID   string `json:"connectionId"`
+	PreviousStatus string `json:"previousStatus"`
+	Status         string `json:"status"` // active|expired|error
+	Reason         string `json:"reason,omitempty"`
+	Refreshed      bool   `json:"refreshed"`
+}
+
+// ConnectionHealthReport summarizes a run of the connection health check
+type ConnectionHealthReport struct {
+	Checked   int `json:"checked"`
+	Refreshed int `json:"refreshed"`
+	Active    int `json:"active"`
+	Expired   int `json:"expired"`
+	Errored   int `json:"errored"`
+	Failed    int `json:"failed"` // Connections whose check could not be completed
+}
+
+// NewConnectionHealthService creates a new connection health service
+func NewConnectionHealthService(ctx context.Context) (*ConnectionHealthService, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	oauth, err := NewOAuthService()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OAuth service: %v", err)
+	}
+
+	notifications, err := NewNotificationService()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notification service: %v", err)
+	}
+
+	return &ConnectionHealthService{db: db, oauth: oauth, notifications: notifications}, nil
+}
+
+// CheckConnections checks every connection, or only those of accountID when it is set
+func (s *ConnectionHealthService) CheckConnections(ctx context.Context, accountID string) (*ConnectionHealthReport, error) {
+	var connections []apitypes.PlatformConnection
+	if accountID == "" {
+		if err := s.db.ScanAllPages(ctx, database.PlatformConnectionsTable, &connections); err != nil {
+			return nil, fmt.Errorf("failed to list connections: %v", err)
+		}
+	} else {
+		if !strings.HasPrefix(accountID, "account:") {
+			accountID = "account:" + accountID
+		}
+		err := s.db.QueryGSIAll(ctx, database.PlatformConnectionsTable, "AccountIndex", "accountId = :accountId",
+			map[string]interface{}{":accountId": accountID}, &connections)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list connections of %s: %v", accountID, err)
+		}
+	}
+
+	report := &ConnectionHealthReport{}
+	platforms := map[string]*apitypes.Platform{}
+	for i := range connections {
+		connection := &connections[i]
+
+		platform, ok := platforms[connection.PlatformID]
+		if !ok {
+			platform = &apitypes.Platform{}
+			err := s.db.GetItem(ctx, database.PlatformsTable, map[string]types.AttributeValue{
+				"platformId": &types.AttributeValueMemberS{Value: connection.PlatformID},
+			}, platform)
+			if err != nil {
+				log.Printf("Failed to load platform %s: %v", connection.PlatformID, err)
+				platform = nil
+			}
+			platforms[connection.PlatformID] = platform
+		}
+		if platform == nil {
+			report.Failed++
+			continue
+		}
+
+		check, err := s.CheckConnection(ctx, connection, platform)
+		if err != nil {
+			log.Printf("Failed to check connection %s: %v", connection.ConnectionID, err)
+			report.Failed++
+			continue
+		}
+
+		report.Checked++
+		if check.Refreshed {
+			report.Refreshed++
+		}
+		switch check.Status {
+		case "active":
+			report.Active++
+		case "expired":
+			report.Expired++
+		default:
+			report.Errored++
+		}
+	}
+
+	return report, nil
+}
+
+// CheckConnection refreshes the connection's access token when it is about to expire and
+// tests the connection against its platform. The connection's status and reason are
+// saved, and its owner is notified when it stops working. A test that fails in a way that
+// may pass on retry returns an error and leaves the status as it was.
+func (s *ConnectionHealthService) CheckConnection(ctx context.Context, connection *apitypes.PlatformConnection, platform *apitypes.Platform) (*ConnectionCheck, error) {
+	check := &ConnectionCheck{ConnectionID: connection.ConnectionID, PreviousStatus: connection.Status}
+	now := time.Now()
+
+	if connection.AuthType == "oauth" && connection.ExpiresAt != nil && connection.ExpiresAt.Before(now.Add(refreshAhead)) {
+		err := s.oauth.RefreshToken(ctx, connection, platform)
+		lapsed := !connection.ExpiresAt.After(now)
+		switch {
+		case err == nil:
+			check.Refreshed = true
+		case errors.Is(err, ErrRefreshRejected), errors.Is(err, ErrNoRefreshToken) && lapsed:
+			return s.markUnhealthy(ctx, connection, check, "expired", fmt.Sprintf("Access could not be renewed: %v", err))
+		case errors.Is(err, ErrNoRefreshToken):
+			// Nothing can renew the token, but it works until it lapses
+		case lapsed:
+			return s.markUnhealthy(ctx, connection, check, "error", fmt.Sprintf("Access token expired and could not be refreshed: %v", err))
+		default:
+			// The current token is still valid, so the next run tries again
+			log.Printf("Failed to refresh token of %s: %v", connection.ConnectionID, err)
+		}
+	}
+
+	connector, err := connectors.NewCatalogConnector(*platform, connection.Credentials)
+	if err == nil {
+		testCtx, cancel := context.WithTimeout(ctx, connectionTestTimeout)
+		err = connector.Test(testCtx)
+		cancel()
+	}
+	if err != nil {
+		failure := ClassifyJobError(err)
+		if failure.Retryable {
+			// Rate limits, timeouts and platform outages say nothing about the connection,
+			// so it keeps its status until a later check succeeds or fails for good
+			return nil, fmt.Errorf("connection test failed with a retryable %s error: %v", failure.Class, err)
+		}
+		if failure.Class == FailureAuth {
+			return s.markUnhealthy(ctx, connection, check, "expired", fmt.Sprintf("The platform rejected the connection's credentials: %v", err))
+		}
+		return s.markUnhealthy(ctx, connection, check, "error", fmt.Sprintf("Connection test failed: %v", err))
+	}
+
+	connection.Status, connection.StatusReason = "active", ""
+	check.Status = "active"
+	if err := s.saveHealth(ctx, connection); err != nil {
+		return nil, err
+	}
+	if check.PreviousStatus != "" && check.PreviousStatus != "active" {
+		message := fmt.Sprintf("Connection %s is working again", connection.Name)
+		if err := LogActivity(ctx, s.db, connection.AccountID, "system", "connections", "connection_restored", "success", message); err != nil {
+			log.Printf("Failed to log activity: %v", err)
+		}
+	}
+	return check, nil
+}
+
+// markUnhealthy saves a failed check and, when the connection was working before or failed
+// differently, reports it to the connection's owner
+func (s *ConnectionHealthService) markUnhealthy(ctx context.Context, connection *apitypes.PlatformConnection, check *ConnectionCheck, status, reason string) (*ConnectionCheck, error) {
+	connection.Status, connection.StatusReason = status, reason
+	check.Status, check.Reason = status, reason
+	if err := s.saveHealth(ctx, connection); err != nil {
+		return nil, err
+	}
+	if check.PreviousStatus != status {
+		s.reportUnhealthy(ctx, connection)
+	}
+	return check, nil
+}
+
+// saveHealth stores the connection's status, reason and check time
+func (s *ConnectionHealthService) saveHealth(ctx context.Context, connection *apitypes.PlatformConnection) error {
+	now := time.Now()
+	nowAttr, err := attributevalue.Marshal(now)
+	if err != nil {
+		return fmt.Errorf("failed to marshal timestamp: %v", err)
+	}
+
+	updateExpression := "SET #status = :status, lastCheckedAt = :now, updatedAt = :now"
+	values := map[string]types.AttributeValue{
+		":status": &types.AttributeValueMemberS{Value: connection.Status},
+		":now":    nowAttr,
+	}
+	if connection.Status == "active" {
+		updateExpression += ", lastConnected = :now"
+		connection.LastConnected = &now
+	}
+	if connection.StatusReason != "" {
+		updateExpression += ", statusReason = :reason"
+		values[":reason"] = &types.AttributeValueMemberS{Value: connection.StatusReason}
+	} else {
+		updateExpression += " REMOVE statusReason"
+	}
+
+	err = s.db.UpdateItemWithNames(ctx, database.PlatformConnectionsTable, map[string]types.AttributeValue{
+		"connectionId": &types.AttributeValueMemberS{Value: connection.ConnectionID},
+	}, updateExpression, values, map[string]string{"#status": "status"})
+	if err != nil {
+		return fmt.Errorf("failed to save health of connection %s: %v", connection.ConnectionID, err)
+	}
+
+	connection.LastCheckedAt = &now
+	connection.UpdatedAt = now
+	return nil
+}
+
+// reportUnhealthy records a connection that stopped working in the activity feed and
+// sends its owner a link that re-authorizes it
+func (s *ConnectionHealthService) reportUnhealthy(ctx context.Context, connection *apitypes.PlatformConnection) {
+	message := fmt.Sprintf("Connection %s stopped working and backups that use it will fail until it is re-authorized. %s",
+		connection.Name, connection.StatusReason)
+	if err := LogActivity(ctx, s.db, connection.AccountID, "system", "connections", "connection_"+connection.Status, "error", message); err != nil {
+		log.Printf("Failed to log activity: %v", err)
+	}
+
+	if connection.UserID == "" {
+		return
+	}
+	_, err := s.notifications.CreateNotification(CreateNotificationOptions{
+		UserID:      connection.UserID,
+		AccountID:   connection.AccountID,
+		Type:        "error",
+		Category:    "integration",
+		Title:       fmt.Sprintf("Reconnect %s", connection.Name),
+		Message:     message,
+		Priority:    "high",
+		Channels:    []string{"app", "email"},
+		EntityID:    connection.ConnectionID,
+		EntityType:  "connection",
+		ActionURL:   ReauthorizeURL(connection),
+		ActionLabel: "Re-authorize",
+		Data: map[string]interface{}{
+			"status": connection.Status,
+			"reason": connection.StatusReason,
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to notify %s of connection %s: %v", connection.UserID, connection.ConnectionID, err)
+	}
+}
+
+// ReauthorizeURL returns the app link that restarts the OAuth flow for an existing
+// connection, so its sources keep using it once the owner signs in again
+func ReauthorizeURL(connection *apitypes.PlatformConnection) string {
+	return fmt.Sprintf("/dashboard/integrations?reauthorize=%s&provider=%s",
+		displayID(connection.ConnectionID), strings.TrimPrefix(connection.PlatformID, "platform:"))
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// ErrDependencyCycle is returned when dependencies refer back to themselves
+var ErrDependencyCycle = errors.New("dependency cycle")
+
+// ValidateEndpointDependencies checks that every endpoint dependency names another
+// endpoint of the same platform source and that the dependencies form no cycle
+func ValidateEndpointDependencies(endpoints map[string]apitypes.PlatformEndpoint) error {
+	names := make([]string, 0, len(endpoints))
+	for name := range endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	graph := make(map[string][]string, len(endpoints))
+	for _, name := range names {
+		for _, dep := range endpoints[name].Dependencies {
+			if _, ok := endpoints[dep]; !ok {
+				return fmt.Errorf("endpoint %s depends on unknown endpoint %s", name, dep)
+			}
+		}
+		graph[name] = endpoints[name].Dependencies
+	}
+
+	if cycle := FindDependencyCycle(graph); cycle != nil {
+		return fmt.Errorf("%w between endpoints: %s", ErrDependencyCycle, strings.Join(cycle, " -> "))
+	}
+	return nil
+}
+
+// FindDependencyCycle returns the nodes of a cycle in graph, which maps each node to the
+// nodes it depends on, starting and ending with the same node. It returns nil when the
+// graph is acyclic. Dependencies missing from graph are treated as having none.
+func FindDependencyCycle(graph map[string][]string) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(graph))
+	var path []string
+
+	var visit func(node string) []string
+	visit = func(node string) []string {
+		state[node] = visiting
+		path = append(path, node)
+		for _, dep := range graph[node] {
+			switch state[dep] {
+			case visiting:
+				for i, n := range path {
+					if n == dep {
+						return append(append([]string{}, path[i:]...), dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[node] = visited
+		return nil
+	}
+
+	nodes := make([]string, 0, len(graph))
+	for node := range graph {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		if state[node] == unvisited {
+			if cycle := visit(node); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// runEndpointGraph calls fetch for each of names, starting an endpoint only once every
+// dependency it has among names has succeeded, with at most parallelism fetches running.
+// Dependencies on endpoints that were not selected are ignored. After the first failure
+// no further endpoints are started, in-flight fetches are cancelled, and that error is
+// returned.
+func runEndpointGraph(ctx context.Context, names []string, endpoints map[string]apitypes.PlatformEndpoint, parallelism int, fetch func(ctx context.Context, name string) error) error {
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		selected[name] = true
+	}
+
+	graph := make(map[string][]string, len(names))
+	waiting := make(map[string]int, len(names))
+	children := make(map[string][]string, len(names))
+	for _, name := range names {
+		for _, dep := range endpoints[name].Dependencies {
+			if !selected[dep] {
+				continue
+			}
+			graph[name] = append(graph[name], dep)
+			waiting[name]++
+			children[dep] = append(children[dep], name)
+		}
+	}
+	if cycle := FindDependencyCycle(graph); cycle != nil {
+		return fmt.Errorf("%w between endpoints: %s", ErrDependencyCycle, strings.Join(cycle, " -> "))
+	}
+
+	var ready []string
+	for _, name := range names {
+		if waiting[name] == 0 {
+			ready = append(ready, name)
+		}
+	}
+
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		name string
+		err  error
+	}
+	results := make(chan result)
+	running := 0
+	var firstErr error
+	for {
+		for firstErr == nil && running < parallelism && len(ready) > 0 {
+			name := ready[0]
+			ready = ready[1:]
+			running++
+			go func() {
+				results <- result{name: name, err: fetch(ctx, name)}
+			}()
+		}
+		if running == 0 {
+			break
+		}
+
+		r := <-results
+		running--
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = r.err
+				cancel()
+			}
+			continue
+		}
+		for _, child := range children[r.name] {
+			waiting[child]--
+			if waiting[child] == 0 {
+				ready = append(ready, child)
+			}
+		}
+	}
+
+	return firstErr
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+func TestFindDependencyCycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		graph map[string][]string
+		want  []string
+	}{
+		{name: "empty", graph: map[string][]string{}},
+		{name: "acyclic", graph: map[string][]string{"a": {"b", "c"}, "b": {"c"}, "c": nil}},
+		{name: "missing dependency", graph: map[string][]string{"a": {"x"}}},
+		{name: "self", graph: map[string][]string{"a": {"a"}}, want: []string{"a", "a"}},
+		{name: "two nodes", graph: map[string][]string{"a": {"b"}, "b": {"a"}}, want: []string{"a", "b", "a"}},
+		{name: "behind a chain", graph: map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"d"}, "d": {"b"}}, want: []string{"b", "c", "d", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FindDependencyCycle(tt.graph); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testEndpoints(deps map[string][]string) map[string]apitypes.PlatformEndpoint {
+	endpoints := make(map[string]apitypes.PlatformEndpoint, len(deps))
+	for name, d := range deps {
+		endpoints[name] = apitypes.PlatformEndpoint{Name: name, Dependencies: d}
+	}
+	return endpoints
+}
+
+func TestValidateEndpointDependencies(t *testing.T) {
+	tests := []struct {
+		name      string
+		deps      map[string][]string
+		wantErr   bool
+		wantCycle bool
+	}{
+		{name: "valid", deps: map[string][]string{"contacts": nil, "orders": {"contacts"}}},
+		{name: "unknown endpoint", deps: map[string][]string{"orders": {"contacts"}}, wantErr: true},
+		{name: "cycle", deps: map[string][]string{"contacts": {"orders"}, "orders": {"contacts"}}, wantErr: true, wantCycle: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateEndpointDependencies(testEndpoints(tt.deps))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrDependencyCycle) != tt.wantCycle {
+				t.Fatalf("got error %v, want cycle %v", err, tt.wantCycle)
+			}
+		})
+	}
+}
+
+// endpointRecorder records when fetches of runEndpointGraph start and finish
+type endpointRecorder struct {
+	mu       sync.Mutex
+	finished map[string]bool
+	started  []string
+	running  int
+	peak     int
+	// startedEarly lists endpoints started before one of their dependencies finished
+	startedEarly []string
+}
+
+func (r *endpointRecorder) fetch(endpoints map[string]apitypes.PlatformEndpoint, fail map[string]bool) func(ctx context.Context, name string) error {
+	return func(ctx context.Context, name string) error {
+		r.mu.Lock()
+		r.started = append(r.started, name)
+		for _, dep := range endpoints[name].Dependencies {
+			if _, ok := endpoints[dep]; ok && !r.finished[dep] {
+				r.startedEarly = append(r.startedEarly, name)
+			}
+		}
+		r.running++
+		if r.running > r.peak {
+			r.peak = r.running
+		}
+		r.mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.running--
+		if fail[name] {
+			return errors.New(name + " failed")
+		}
+		r.finished[name] = true
+		return nil
+	}
+}
+
+func TestRunEndpointGraph(t *testing.T) {
+	tests := []struct {
+		name        string
+		deps        map[string][]string
+		names       []string
+		parallelism int
+		fail        map[string]bool
+		wantStarted []string
+		wantErr     bool
+		wantCycle   bool
+		maxPeak     int
+	}{
+		{
+			name:        "dependencies run first",
+			deps:        map[string][]string{"contacts": nil, "orders": {"contacts"}, "invoices": {"orders", "contacts"}},
+			names:       []string{"invoices", "orders", "contacts"},
+			parallelism: 3,
+			wantStarted: []string{"contacts", "invoices", "orders"},
+			maxPeak:     1,
+		},
+		{
+			name:        "parallelism bounds running fetches",
+			deps:        map[string][]string{"a": nil, "b": nil, "c": nil, "d": nil, "e": nil},
+			names:       []string{"a", "b", "c", "d", "e"},
+			parallelism: 2,
+			wantStarted: []string{"a", "b", "c", "d", "e"},
+			maxPeak:     2,
+		},
+		{
+			name:        "zero parallelism runs one at a time",
+			deps:        map[string][]string{"a": nil, "b": nil},
+			names:       []string{"a", "b"},
+			wantStarted: []string{"a", "b"},
+			maxPeak:     1,
+		},
+		{
+			name:        "unselected dependencies are ignored",
+			deps:        map[string][]string{"contacts": nil, "orders": {"contacts"}},
+			names:       []string{"orders"},
+			parallelism: 2,
+			wantStarted: []string{"orders"},
+			maxPeak:     1,
+		},
+		{
+			name:        "failure stops dependents",
+			deps:        map[string][]string{"contacts": nil, "orders": {"contacts"}, "invoices": {"orders"}},
+			names:       []string{"contacts", "orders", "invoices"},
+			parallelism: 1,
+			fail:        map[string]bool{"contacts": true},
+			wantStarted: []string{"contacts"},
+			wantErr:     true,
+			maxPeak:     1,
+		},
+		{
+			name:        "cycle fetches nothing",
+			deps:        map[string][]string{"a": {"b"}, "b": {"a"}},
+			names:       []string{"a", "b"},
+			parallelism: 2,
+			wantErr:     true,
+			wantCycle:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoints := testEndpoints(tt.deps)
+			recorder := &endpointRecorder{finished: map[string]bool{}}
+			err := runEndpointGraph(context.Background(), tt.names, endpoints, tt.parallelism, recorder.fetch(selectedEndpoints(endpoints, tt.names), tt.fail))
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrDependencyCycle) != tt.wantCycle {
+				t.Fatalf("got error %v, want cycle %v", err, tt.wantCycle)
+			}
+
+			started := append([]string(nil), recorder.started...)
+			sort.Strings(started)
+			if !reflect.DeepEqual(started, tt.wantStarted) {
+				t.Fatalf("started %v, want %v", started, tt.wantStarted)
+			}
+			if len(recorder.startedEarly) > 0 {
+				t.Fatalf("%v started before their dependencies finished", recorder.startedEarly)
+			}
+			if recorder.peak > tt.maxPeak {
+				t.Fatalf("%d fetches ran at once, want at most %d", recorder.peak, tt.maxPeak)
+			}
+		})
+	}
+}
+
+func TestRunEndpointGraphCancelsInFlight(t *testing.T) {
+	endpoints := testEndpoints(map[string][]string{"fails": nil, "slow": nil})
+	cancelled := make(chan bool, 1)
+	err := runEndpointGraph(context.Background(), []string{"fails", "slow"}, endpoints, 2, func(ctx context.Context, name string) error {
+		if name == "fails" {
+			return errors.New("fails failed")
+		}
+		select {
+		case <-ctx.Done():
+			cancelled <- true
+		case <-time.After(time.Second):
+			cancelled <- false
+		}
+		return ctx.Err()
+	})
+	if err == nil || err.Error() != "fails failed" {
+		t.Fatalf("got error %v, want the first failure", err)
+	}
+	if !<-cancelled {
+		t.Fatal("in-flight fetch was not cancelled")
+	}
+}
+
+// selectedEndpoints limits endpoints to names, as runEndpointGraph only orders those
+func selectedEndpoints(endpoints map[string]apitypes.PlatformEndpoint, names []string) map[string]apitypes.PlatformEndpoint {
+	selected := make(map[string]apitypes.PlatformEndpoint, len(names))
+	for _, name := range names {
+		selected[name] = endpoints[name]
+	}
+	return selected
+}
@@ -0,0 +1,425 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/listbackup/api/internal/database"
+	"github.com/listbackup/api/internal/storage"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+var (
+	// ErrDestinationInUse is returned when deleting a destination that sources still target
+	ErrDestinationInUse = errors.New("destination is used by one or more sources")
+	// ErrDestinationNotFound is returned when a destination does not exist or belongs to
+	// another account
+	ErrDestinationNotFound = errors.New("destination not found")
+)
+
+// DestinationService manages customer-owned storage destinations and mirrors snapshots
+// to them
+type DestinationService struct {
+	db        *database.DynamoDBClient
+	snapshots *SnapshotService
+	secrets   *SecretsService
+}
+
+// DestinationInput is the data needed to create a storage destination
+type DestinationInput struct {
+	Name        string
+	Type        string
+	Config      apitypes.StorageDestinationConfig
+	Credentials apitypes.StorageCredentials
+}
+
+// mirrorManifest is written next to the mirrored objects so the copy can be checked and
+// used without access to ListBackup
+type mirrorManifest struct {
+	SnapshotID   string                 `json:"snapshotId"`
+	SourceID     string                 `json:"sourceId"`
+	CreatedAt    time.Time              `json:"createdAt"`
+	TotalRecords int64                  `json:"totalRecords"`
+	Objects      []mirrorManifestObject `json:"objects"`
+}
+
+type mirrorManifestObject struct {
+	Endpoint string `json:"endpoint"`
+	Key      string `json:"key"`
+	Records  int64  `json:"records"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+}
+
+// NewDestinationService creates a new destination service
+func NewDestinationService(ctx context.Context) (*DestinationService, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	snapshots, err := NewSnapshotService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := NewSecretsService()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create secrets service: %v", err)
+	}
+
+	return &DestinationService{db: db, snapshots: snapshots, secrets: secrets}, nil
+}
+
+// CreateDestination stores the credentials in Secrets Manager, records the destination and
+// verifies it. A destination that fails verification is still created, with status failed.
+func (s *DestinationService) CreateDestination(ctx context.Context, accountID, userID string, input DestinationInput) (*apitypes.StorageDestination, error) {
+	if input.Name == "" {
+		return nil, validationErrorf("name is required")
+	}
+	if err := storage.Validate(input.Type, input.Config, input.Credentials); err != nil {
+		return nil, &ValidationError{Message: err.Error()}
+	}
+
+	now := time.Now()
+	destinationID := "destination:" + uuid.New().String()
+	destination := &apitypes.StorageDestination{
+		DestinationID: destinationID,
+		AccountID:     accountID,
+		CreatedBy:     userID,
+		Name:          input.Name,
+		Type:          input.Type,
+		Config:        input.Config,
+		SecretName:    fmt.Sprintf("listbackup/destinations/%s/%s", displayID(accountID), displayID(destinationID)),
+		Status:        "pending",
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	if err := s.secrets.StoreJSONSecret(ctx, destination.SecretName, input.Credentials); err != nil {
+		return nil, fmt.Errorf("failed to store destination credentials: %v", err)
+	}
+	if err := s.db.PutItem(ctx, database.StorageDestinationsTable, destination); err != nil {
+		return nil, fmt.Errorf("failed to create destination: %v", err)
+	}
+
+	message := fmt.Sprintf("Added %s storage destination %s", destination.Type, destination.Name)
+	if err := LogActivity(ctx, s.db, accountID, userID, "storage", "destination_created", "success", message); err != nil {
+		log.Printf("Failed to log activity: %v", err)
+	}
+
+	if err := s.VerifyDestination(ctx, destination); err != nil {
+		log.Printf("Destination %s failed verification: %v", destinationID, err)
+	}
+
+	return destination, nil
+}
+
+// GetDestination returns a destination if it belongs to the account
+func (s *DestinationService) GetDestination(ctx context.Context, accountID, destinationID string) (*apitypes.StorageDestination, error) {
+	idAttr, err := attributevalue.Marshal(withPrefix(destinationID, "destination:"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal destinationID: %v", err)
+	}
+
+	var destination apitypes.StorageDestination
+	err = s.db.GetItem(ctx, database.StorageDestinationsTable, map[string]types.AttributeValue{
+		"destinationId": idAttr,
+	}, &destination)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return nil, ErrDestinationNotFound
+		}
+		return nil, fmt.Errorf("failed to get destination %s: %v", destinationID, err)
+	}
+	if destination.AccountID != accountID {
+		return nil, ErrDestinationNotFound
+	}
+
+	return &destination, nil
+}
+
+// ListDestinations returns every destination of an account
+func (s *DestinationService) ListDestinations(ctx context.Context, accountID string) ([]apitypes.StorageDestination, error) {
+	var destinations []apitypes.StorageDestination
+	err := s.db.QueryGSIAll(ctx, database.StorageDestinationsTable, "AccountIndex", "accountId = :accountId",
+		map[string]interface{}{":accountId": accountID}, &destinations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list destinations: %v", err)
+	}
+	return destinations, nil
+}
+
+// DeleteDestination removes a destination and schedules its credentials for deletion.
+// Objects already mirrored to it are left in place.
+func (s *DestinationService) DeleteDestination(ctx context.Context, destination *apitypes.StorageDestination, userID string) error {
+	var sources []apitypes.Source
+	err := s.db.QueryGSIAll(ctx, database.SourcesTable, "AccountIndex", "accountId = :accountId",
+		map[string]interface{}{":accountId": destination.AccountID}, &sources)
+	if err != nil {
+		return fmt.Errorf("failed to list sources: %v", err)
+	}
+	for _, source := range sources {
+		if source.DestinationID == destination.DestinationID {
+			return ErrDestinationInUse
+		}
+	}
+
+	idAttr, err := attributevalue.Marshal(destination.DestinationID)
+	if err != nil {
+		return fmt.Errorf("failed to marshal destinationID: %v", err)
+	}
+	if err := s.db.DeleteItem(ctx, database.StorageDestinationsTable, map[string]types.AttributeValue{
+		"destinationId": idAttr,
+	}); err != nil {
+		return fmt.Errorf("failed to delete destination: %v", err)
+	}
+
+	if err := s.secrets.DeleteSecret(ctx, destination.SecretName); err != nil {
+		log.Printf("Failed to delete credentials of destination %s: %v", destination.DestinationID, err)
+	}
+
+	message := fmt.Sprintf("Removed %s storage destination %s", destination.Type, destination.Name)
+	if err := LogActivity(ctx, s.db, destination.AccountID, userID, "storage", "destination_deleted", "success", message); err != nil {
+		log.Printf("Failed to log activity: %v", err)
+	}
+
+	return nil
+}
+
+// VerifyDestination writes, reads back and deletes a probe object, and records the result
+// on the destination. The first successful SFTP verification pins the server's host key.
+// The returned error is the verification failure, if any.
+func (s *DestinationService) VerifyDestination(ctx context.Context, destination *apitypes.StorageDestination) error {
+	checkErr := s.probe(ctx, destination)
+
+	now := time.Now()
+	destination.UpdatedAt = now
+	if checkErr != nil {
+		destination.Status = "failed"
+		destination.LastError = checkErr.Error()
+	} else {
+		destination.Status = "verified"
+		destination.LastError = ""
+		destination.LastVerifiedAt = &now
+	}
+
+	if err := s.db.PutItem(ctx, database.StorageDestinationsTable, destination); err != nil {
+		return fmt.Errorf("failed to save destination: %v", err)
+	}
+	return checkErr
+}
+
+func (s *DestinationService) probe(ctx context.Context, destination *apitypes.StorageDestination) error {
+	writer, err := s.openWriter(ctx, destination)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	key := fmt.Sprintf(".listbackup/verify-%d.txt", time.Now().UnixNano())
+	probe := []byte("ListBackup destination check " + time.Now().UTC().Format(time.RFC3339))
+
+	if err := writer.Put(ctx, key, probe, "text/plain"); err != nil {
+		return err
+	}
+	readBack, err := writer.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(readBack, probe) {
+		return fmt.Errorf("probe object read back with different content")
+	}
+	if err := writer.Delete(ctx, key); err != nil {
+		return err
+	}
+
+	if reporter, ok := writer.(storage.HostKeyReporter); ok && destination.Config.HostKey == "" {
+		destination.Config.HostKey = reporter.HostKey()
+	}
+	return nil
+}
+
+func (s *DestinationService) openWriter(ctx context.Context, destination *apitypes.StorageDestination) (storage.Writer, error) {
+	var creds apitypes.StorageCredentials
+	if err := s.secrets.GetJSONSecret(ctx, destination.SecretName, &creds); err != nil {
+		return nil, fmt.Errorf("failed to load destination credentials: %v", err)
+	}
+	return storage.NewWriter(ctx, destination, creds)
+}
+
+// SetSourceDestination points a source at a verified destination, or clears its
+// destination when destinationID is empty
+func (s *DestinationService) SetSourceDestination(ctx context.Context, source *apitypes.Source, destinationID, userID string) error {
+	message := fmt.Sprintf("Source %s no longer mirrors snapshots", source.Name)
+	if destinationID != "" {
+		destination, err := s.GetDestination(ctx, source.AccountID, destinationID)
+		if err != nil {
+			if errors.Is(err, ErrDestinationNotFound) {
+				return validationErrorf("destination %s not found", destinationID)
+			}
+			return err
+		}
+		if destination.Status != "verified" {
+			return validationErrorf("destination %s has not been verified", destination.Name)
+		}
+		destinationID = destination.DestinationID
+		message = fmt.Sprintf("Source %s now mirrors snapshots to %s", source.Name, destination.Name)
+	}
+
+	sourceIDAttr, err := attributevalue.Marshal(source.SourceID)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sourceID: %v", err)
+	}
+	values, err := attributevalue.MarshalMap(map[string]interface{}{
+		":destinationId": destinationID,
+		":now":           time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal source update: %v", err)
+	}
+
+	err = s.db.UpdateItem(ctx, database.SourcesTable, map[string]types.AttributeValue{
+		"sourceId": sourceIDAttr,
+	}, "SET destinationId = :destinationId, updatedAt = :now", values)
+	if err != nil {
+		return fmt.Errorf("failed to update source: %v", err)
+	}
+	source.DestinationID = destinationID
+
+	if err := LogActivity(ctx, s.db, source.AccountID, userID, "storage", "source_destination_set", "success", message); err != nil {
+		log.Printf("Failed to log activity: %v", err)
+	}
+	return nil
+}
+
+// MirrorSnapshot copies a completed snapshot to a destination as plain JSON with a
+// manifest, then reads every object back and compares checksums. The result is recorded
+// on the snapshot. Mirrored copies belong to the customer and are never pruned.
+func (s *DestinationService) MirrorSnapshot(ctx context.Context, snapshot *apitypes.Snapshot, destinationID string) (*apitypes.SnapshotMirror, error) {
+	mirror := &apitypes.SnapshotMirror{
+		DestinationID: destinationID,
+		Prefix:        fmt.Sprintf("%s/%s", displayID(snapshot.SourceID), displayID(snapshot.SnapshotID)),
+		MirroredAt:    time.Now(),
+	}
+
+	mirrorErr := s.mirror(ctx, snapshot, mirror)
+	if mirrorErr != nil {
+		mirror.Status = "failed"
+		mirror.Error = mirrorErr.Error()
+
+		message := fmt.Sprintf("Failed to mirror snapshot %s: %v", displayID(snapshot.SnapshotID), mirrorErr)
+		if err := LogActivity(ctx, s.db, snapshot.AccountID, "", "storage", "snapshot_mirrored", "failed", message); err != nil {
+			log.Printf("Failed to log activity: %v", err)
+		}
+	} else {
+		verifiedAt := time.Now()
+		mirror.Status = "verified"
+		mirror.VerifiedAt = &verifiedAt
+	}
+
+	if err := s.saveMirror(ctx, snapshot.SnapshotID, mirror); err != nil {
+		return nil, err
+	}
+	snapshot.Mirror = mirror
+
+	return mirror, mirrorErr
+}
+
+func (s *DestinationService) mirror(ctx context.Context, snapshot *apitypes.Snapshot, mirror *apitypes.SnapshotMirror) error {
+	destination, err := s.GetDestination(ctx, snapshot.AccountID, mirror.DestinationID)
+	if err != nil {
+		return err
+	}
+	if destination.Type == storage.TypeSFTP && destination.Config.HostKey == "" {
+		return fmt.Errorf("destination %s has no pinned host key; verify it first", destination.Name)
+	}
+
+	writer, err := s.openWriter(ctx, destination)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	manifest := mirrorManifest{
+		SnapshotID:   displayID(snapshot.SnapshotID),
+		SourceID:     displayID(snapshot.SourceID),
+		CreatedAt:    snapshot.CreatedAt,
+		TotalRecords: snapshot.Manifest.TotalRecords,
+	}
+	for _, object := range snapshot.Manifest.Objects {
+		data, err := s.snapshots.ReadObject(ctx, snapshot, object)
+		if err != nil {
+			return err
+		}
+
+		key := mirror.Prefix + "/" + object.Endpoint + ".json"
+		if err := writer.Put(ctx, key, data, "application/json"); err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(data)
+		manifest.Objects = append(manifest.Objects, mirrorManifestObject{
+			Endpoint: object.Endpoint,
+			Key:      key,
+			Records:  object.Records,
+			Size:     int64(len(data)),
+			SHA256:   hex.EncodeToString(sum[:]),
+		})
+		mirror.Objects++
+		mirror.Bytes += int64(len(data))
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal mirror manifest: %v", err)
+	}
+	if err := writer.Put(ctx, mirror.Prefix+"/manifest.json", manifestData, "application/json"); err != nil {
+		return err
+	}
+
+	// Verification: every object must read back with the checksum it was written with
+	for _, object := range manifest.Objects {
+		data, err := writer.Get(ctx, object.Key)
+		if err != nil {
+			return fmt.Errorf("verification failed: %v", err)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != object.SHA256 {
+			return fmt.Errorf("verification failed: %s does not match its checksum", object.Key)
+		}
+	}
+
+	return nil
+}
+
+func (s *DestinationService) saveMirror(ctx context.Context, snapshotID string, mirror *apitypes.SnapshotMirror) error {
+	snapshotIDAttr, err := attributevalue.Marshal(snapshotID)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshotID: %v", err)
+	}
+	mirrorAttr, err := attributevalue.Marshal(mirror)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot mirror: %v", err)
+	}
+
+	err = s.db.UpdateItem(ctx, database.SnapshotsTable, map[string]types.AttributeValue{
+		"snapshotId": snapshotIDAttr,
+	}, "SET mirror = :mirror", map[string]types.AttributeValue{
+		":mirror": mirrorAttr,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save snapshot mirror: %v", err)
+	}
+	return nil
+}
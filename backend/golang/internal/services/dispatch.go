@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/listbackup/api/internal/database"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// Priority lanes. Worker jobs are queued by priority rather than type, so a long
+// low-priority backup never holds up a job a user is waiting on.
+const (
+	LaneHigh   = "high"
+	LaneMedium = "medium"
+	LaneLow    = "low"
+)
+
+// JobLanes lists the lanes from highest to lowest priority
+var JobLanes = []string{LaneHigh, LaneMedium, LaneLow}
+
+// accountLaneShards is how many jobs of one account may run at once in each lane. Every
+// account gets that many FIFO message groups per lane, so an account with thousands of
+// sources queues behind itself instead of crowding out other accounts.
+var accountLaneShards = map[string]uint32{
+	LaneHigh:   2,
+	LaneMedium: 2,
+	LaneLow:    1,
+}
+
+// dispatchMetricsTTL is how long hourly dispatch counters are kept
+const dispatchMetricsTTL = 7 * 24 * time.Hour
+
+// JobLane returns the lane a job is queued in. Jobs without a known priority go to the
+// medium lane.
+func JobLane(job *apitypes.Job) string {
+	switch job.Priority {
+	case LaneHigh, LaneLow:
+		return job.Priority
+	default:
+		return LaneMedium
+	}
+}
+
+// DispatchGroupID returns the FIFO message group of a job: one of its account's shards in
+// the job's lane. A source always maps to the same shard, so its jobs in a lane still run
+// in order.
+func DispatchGroupID(job *apitypes.Job) string {
+	lane := JobLane(job)
+	key := job.SourceID
+	if key == "" {
+		key = job.JobID
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return fmt.Sprintf("%s#%s#%d", job.AccountID, lane, h.Sum32()%accountLaneShards[lane])
+}
+
+// LaneQueueURLs reads the lane queue URLs from the environment
+func LaneQueueURLs() map[string]string {
+	return map[string]string{
+		LaneHigh:   os.Getenv("JOBS_HIGH_QUEUE_URL"),
+		LaneMedium: os.Getenv("JOBS_MEDIUM_QUEUE_URL"),
+		LaneLow:    os.Getenv("JOBS_LOW_QUEUE_URL"),
+	}
+}
+
+// LaneStats is the state of one priority lane
+type LaneStats struct {
+	Lane     string `json:"lane"`
+	Queued   int    `json:"queued"`   // Messages waiting to be picked up
+	InFlight int    `json:"inFlight"` // Messages being worked on
+	Delayed  int    `json:"delayed"`
+	// Dispatched counts the jobs workers started this hour, and AvgWaitSeconds how long
+	// they waited from being queued
+	Dispatched     int64   `json:"dispatched"`
+	AvgWaitSeconds float64 `json:"avgWaitSeconds"`
+}
+
+// DispatchStats summarizes job dispatch across the lanes
+type DispatchStats struct {
+	Lanes        []LaneStats `json:"lanes"`
+	RetryQueued  int         `json:"retryQueued"`  // Retries due to run
+	RetryDelayed int         `json:"retryDelayed"` // Retries waiting out their backoff
+	Hour         string      `json:"hour"`
+}
+
+type dispatchCounter struct {
+	MetricID   string `dynamodbav:"metricId"`
+	Dispatched int64  `dynamodbav:"dispatched"`
+	WaitMillis int64  `dynamodbav:"waitMillis"`
+}
+
+// DispatchService reports how jobs move through the priority lanes
+type DispatchService struct {
+	db            *database.DynamoDBClient
+	sqs           *sqs.Client
+	laneURLs      map[string]string
+	retryQueueURL string
+}
+
+// NewDispatchService creates a new dispatch service
+func NewDispatchService(ctx context.Context) (*DispatchService, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %v", err)
+	}
+
+	return &DispatchService{
+		db:            db,
+		sqs:           sqs.NewFromConfig(cfg),
+		laneURLs:      LaneQueueURLs(),
+		retryQueueURL: os.Getenv("RETRY_QUEUE_URL"),
+	}, nil
+}
+
+// RecordDispatch counts a job a worker started and how long it waited to be picked up.
+// Metrics never hold up a job, so failures are only logged.
+func (s *DispatchService) RecordDispatch(ctx context.Context, job *apitypes.Job, startedAt time.Time) {
+	wait := startedAt.Sub(jobQueuedAt(job))
+	if wait < 0 {
+		wait = 0
+	}
+
+	values, err := attributevalue.MarshalMap(map[string]interface{}{
+		":one":  1,
+		":wait": wait.Milliseconds(),
+		":ttl":  startedAt.Add(dispatchMetricsTTL).Unix(),
+	})
+	if err != nil {
+		log.Printf("Failed to marshal dispatch of job %s: %v", job.JobID, err)
+		return
+	}
+
+	err = s.db.UpdateItemWithNames(ctx, database.JobMetricsTable, map[string]types.AttributeValue{
+		"metricId": &types.AttributeValueMemberS{Value: dispatchMetricID(JobLane(job), startedAt)},
+	}, "ADD dispatched :one, waitMillis :wait SET #ttl = :ttl", values, map[string]string{"#ttl": "ttl"})
+	if err != nil {
+		log.Printf("Failed to record dispatch of job %s: %v", job.JobID, err)
+	}
+}
+
+// Stats returns the depth of each lane and the retry queue along with this hour's
+// dispatch counters
+func (s *DispatchService) Stats(ctx context.Context) (*DispatchStats, error) {
+	now := time.Now().UTC()
+	stats := &DispatchStats{Hour: now.Format("2006-01-02T15")}
+
+	for _, lane := range JobLanes {
+		laneStats := LaneStats{Lane: lane}
+
+		depth, err := s.queueDepth(ctx, s.laneURLs[lane])
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s lane depth: %v", lane, err)
+		}
+		laneStats.Queued = depth[sqstypes.QueueAttributeNameApproximateNumberOfMessages]
+		laneStats.InFlight = depth[sqstypes.QueueAttributeNameApproximateNumberOfMessagesNotVisible]
+		laneStats.Delayed = depth[sqstypes.QueueAttributeNameApproximateNumberOfMessagesDelayed]
+
+		var counter dispatchCounter
+		err = s.db.GetItem(ctx, database.JobMetricsTable, map[string]types.AttributeValue{
+			"metricId": &types.AttributeValueMemberS{Value: dispatchMetricID(lane, now)},
+		}, &counter)
+		if err != nil && !errors.Is(err, database.ErrItemNotFound) {
+			return nil, fmt.Errorf("failed to get %s lane dispatch metrics: %v", lane, err)
+		}
+		laneStats.Dispatched = counter.Dispatched
+		if counter.Dispatched > 0 {
+			laneStats.AvgWaitSeconds = float64(counter.WaitMillis) / float64(counter.Dispatched) / 1000
+		}
+
+		stats.Lanes = append(stats.Lanes, laneStats)
+	}
+
+	depth, err := s.queueDepth(ctx, s.retryQueueURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get retry queue depth: %v", err)
+	}
+	stats.RetryQueued = depth[sqstypes.QueueAttributeNameApproximateNumberOfMessages]
+	stats.RetryDelayed = depth[sqstypes.QueueAttributeNameApproximateNumberOfMessagesDelayed]
+
+	return stats, nil
+}
+
+// queueDepth returns the approximate message counts of a queue
+func (s *DispatchService) queueDepth(ctx context.Context, queueURL string) (map[sqstypes.QueueAttributeName]int, error) {
+	if queueURL == "" {
+		return nil, fmt.Errorf("queue URL not configured")
+	}
+
+	names := []sqstypes.QueueAttributeName{
+		sqstypes.QueueAttributeNameApproximateNumberOfMessages,
+		sqstypes.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+		sqstypes.QueueAttributeNameApproximateNumberOfMessagesDelayed,
+	}
+	output, err := s.sqs.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: names,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	depth := make(map[sqstypes.QueueAttributeName]int, len(names))
+	for _, name := range names {
+		depth[name], _ = strconv.Atoi(output.Attributes[string(name)])
+	}
+	return depth, nil
+}
+
+// jobQueuedAt returns when a job was last put on a queue
+func jobQueuedAt(job *apitypes.Job) time.Time {
+	queuedAt := job.CreatedAt
+	if job.ResumedAt != nil && job.ResumedAt.After(queuedAt) {
+		queuedAt = *job.ResumedAt
+	}
+	if job.NextAttemptAt != nil && job.NextAttemptAt.After(queuedAt) {
+		queuedAt = *job.NextAttemptAt
+	}
+	return queuedAt
+}
+
+func dispatchMetricID(lane string, at time.Time) string {
+	return fmt.Sprintf("dispatch#%s#%s", lane, at.UTC().Format("2006-01-02T15"))
+}
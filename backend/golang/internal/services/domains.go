@@ -523,7 +523,7 @@ func (s *DomainService) checkDNSVerification(ctx context.Context, domain *types.
 		HostedZoneId:    aws.String(s.hostedZoneID),
 		StartRecordName: aws.String(recordName),
 		StartRecordType: aws.String("TXT"),
-		MaxItems:        aws.Int64(1),
+		MaxItems:        aws.String("1"),
 	})
 
 	if err != nil {
@@ -0,0 +1,509 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/listbackup/api/internal/compression"
+	"github.com/listbackup/api/internal/database"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// Download link lifetimes
+const (
+	DefaultLinkExpiry = 24 * time.Hour
+	MinLinkExpiry     = time.Minute
+	MaxLinkExpiry     = 7 * 24 * time.Hour
+
+	// linkRedirectTTL is how long the S3 URL a redeemed link redirects to stays valid
+	linkRedirectTTL = 5 * time.Minute
+	// linkRecordRetention keeps expired link records around for auditing before TTL removes them
+	linkRecordRetention = 30 * 24 * time.Hour
+
+	// stagingLifetime is how long the ExpireDownloadStaging lifecycle rule keeps staged copies
+	stagingLifetime = 24 * time.Hour
+	// stagingPartSize is the part size of staging uploads. S3 parts other than the last
+	// must be at least 5 MB.
+	stagingPartSize = 8 << 20
+)
+
+// Reasons a download link cannot be redeemed
+var (
+	ErrLinkNotFound  = errors.New("download link not found")
+	ErrLinkExpired   = errors.New("download link has expired")
+	ErrLinkUsed      = errors.New("download link has already been used")
+	ErrLinkIPDenied  = errors.New("download link cannot be used from this address")
+	ErrLinkFileGone  = errors.New("the linked file is no longer available")
+	ErrLinkArchived  = errors.New("the linked file is being restored from the archive, try again later")
+	errLinkCondition = errors.New("link condition failed")
+)
+
+// DownloadService hands out presigned URLs for backed up files, directly or through
+// shareable download links
+type DownloadService struct {
+	db        *database.DynamoDBClient
+	snapshots *SnapshotService
+	archive   *ArchiveService
+}
+
+// LinkOptions restricts how a download link may be used
+type LinkOptions struct {
+	ExpiresIn  time.Duration
+	SingleUse  bool
+	AllowedIPs []string // IP addresses or CIDR ranges
+}
+
+// NewDownloadService creates a new download service
+func NewDownloadService(ctx context.Context) (*DownloadService, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	snapshots, err := NewSnapshotService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := NewArchiveService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DownloadService{db: db, snapshots: snapshots, archive: archive}, nil
+}
+
+// GetFile returns a file if it belongs to the account
+func (s *DownloadService) GetFile(ctx context.Context, accountID, fileID string) (*apitypes.File, error) {
+	fileIDAttr, err := attributevalue.Marshal(withPrefix(fileID, "file:"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal fileID: %v", err)
+	}
+
+	var file apitypes.File
+	err = s.db.GetItem(ctx, database.FilesTable, map[string]types.AttributeValue{
+		"fileId": fileIDAttr,
+	}, &file)
+	if err != nil || file.AccountID != accountID {
+		return nil, fmt.Errorf("file %s not found", fileID)
+	}
+
+	return &file, nil
+}
+
+// PresignFile returns a URL the file can be downloaded from for ttl, and the
+// Content-Encoding it is served with. Compressed files are served as stored when
+// acceptEncoding allows their codec and decompressed otherwise. Encrypted files, and files
+// that need decompressing, are written to a short-lived staging object first. Archived
+// files without a restored copy return ErrObjectArchived.
+func (s *DownloadService) PresignFile(ctx context.Context, file *apitypes.File, ttl time.Duration, acceptEncoding string) (string, string, error) {
+	if err := s.checkReadable(ctx, file); err != nil {
+		return "", "", err
+	}
+
+	stored := compression.ContentEncoding(file.Codec)
+	encoding := stored
+	if !compression.Accepts(acceptEncoding, stored) {
+		encoding = ""
+	}
+
+	downloadKey := file.S3Key
+	if file.Encrypted || encoding != stored {
+		stagingKey, err := s.stageFile(ctx, file, encoding, ttl)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to stage file %s: %v", file.FileID, err)
+		}
+		downloadKey = stagingKey
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket:                     aws.String(s.snapshots.bucket),
+		Key:                        aws.String(downloadKey),
+		ResponseContentDisposition: aws.String(fmt.Sprintf("attachment; filename=%q", path.Base(file.Path))),
+	}
+	if encoding != "" {
+		input.ResponseContentEncoding = aws.String(encoding)
+	}
+
+	request, err := s3.NewPresignClient(s.snapshots.s3Client).PresignGetObject(ctx, input, func(opts *s3.PresignOptions) {
+		opts.Expires = ttl
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate presigned URL: %v", err)
+	}
+
+	return request.URL, encoding, nil
+}
+
+// checkReadable returns ErrObjectArchived when the file is in the archive tier and has
+// not been restored
+func (s *DownloadService) checkReadable(ctx context.Context, file *apitypes.File) error {
+	if file.StorageTier != StorageTierArchive {
+		return nil
+	}
+	readable, err := s.snapshots.objectReadable(ctx, file.S3Key)
+	if err != nil {
+		return err
+	}
+	if !readable {
+		return ErrObjectArchived
+	}
+	return nil
+}
+
+// RequestRehydration starts restoring a file PresignFile refused with ErrObjectArchived
+func (s *DownloadService) RequestRehydration(ctx context.Context, file *apitypes.File, userID string) (*apitypes.FileRehydration, error) {
+	return s.archive.RequestRehydration(ctx, file, userID)
+}
+
+// stageFile writes the decrypted contents of a file under the downloads/ prefix, whose
+// ExpireDownloadStaging lifecycle rule removes them, and any versions they replace, after
+// a day. Staged copies are encrypted at rest with SSE-KMS; deleting the file removes them
+// straight away. The data stays compressed when encoding is the file's codec and is decompressed
+// as it is uploaded when encoding is empty. A copy staged earlier is reused when it will
+// outlive a URL valid for ttl.
+func (s *DownloadService) stageFile(ctx context.Context, file *apitypes.File, encoding string, ttl time.Duration) (string, error) {
+	variant := encoding
+	if variant == "" {
+		variant = "identity"
+	}
+	stagingKey := downloadsPrefix(file.FileID) + variant + "/" + file.Path
+	if s.stagedCopyUsable(ctx, stagingKey, ttl) {
+		return stagingKey, nil
+	}
+
+	stored, err := s.snapshots.openStoredFile(ctx, file)
+	if err != nil {
+		return "", err
+	}
+	defer stored.Close()
+
+	var body io.Reader = stored
+	if encoding == "" {
+		decoded, err := compression.NewReader(file.Codec, stored)
+		if err != nil {
+			return "", err
+		}
+		defer decoded.Close()
+		body = decoded
+	}
+
+	if err := s.uploadStaging(ctx, stagingKey, body, file.ContentType, encoding); err != nil {
+		return "", err
+	}
+	return stagingKey, nil
+}
+
+// stagedCopyUsable reports whether a staged copy exists and lifecycle will not remove it
+// before a URL valid for ttl expires
+func (s *DownloadService) stagedCopyUsable(ctx context.Context, stagingKey string, ttl time.Duration) bool {
+	head, err := s.snapshots.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.snapshots.bucket),
+		Key:    aws.String(stagingKey),
+	})
+	if err != nil || head.LastModified == nil {
+		return false
+	}
+	return time.Since(*head.LastModified)+ttl <= stagingLifetime
+}
+
+// uploadStaging uploads body in parts of stagingPartSize, so only one part is held in
+// memory. Bodies that fit in one part are uploaded with a single request.
+func (s *DownloadService) uploadStaging(ctx context.Context, stagingKey string, body io.Reader, contentType, encoding string) error {
+	buf := make([]byte, stagingPartSize)
+	n, err := io.ReadFull(body, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("failed to read file: %v", err)
+	}
+	if err != nil {
+		input := &s3.PutObjectInput{
+			Bucket:               aws.String(s.snapshots.bucket),
+			Key:                  aws.String(stagingKey),
+			Body:                 bytes.NewReader(buf[:n]),
+			ContentType:          aws.String(contentType),
+			ServerSideEncryption: s3types.ServerSideEncryptionAwsKms,
+		}
+		if encoding != "" {
+			input.ContentEncoding = aws.String(encoding)
+		}
+		if _, err := s.snapshots.s3Client.PutObject(ctx, input); err != nil {
+			return fmt.Errorf("failed to upload staging object: %v", err)
+		}
+		return nil
+	}
+
+	create := &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(s.snapshots.bucket),
+		Key:                  aws.String(stagingKey),
+		ContentType:          aws.String(contentType),
+		ServerSideEncryption: s3types.ServerSideEncryptionAwsKms,
+	}
+	if encoding != "" {
+		create.ContentEncoding = aws.String(encoding)
+	}
+	upload, err := s.snapshots.s3Client.CreateMultipartUpload(ctx, create)
+	if err != nil {
+		return fmt.Errorf("failed to start staging upload: %v", err)
+	}
+
+	abort := func(cause error) error {
+		_, err := s.snapshots.s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(s.snapshots.bucket),
+			Key:      aws.String(stagingKey),
+			UploadId: upload.UploadId,
+		})
+		if err != nil {
+			log.Printf("Failed to abort staging upload %s: %v", stagingKey, err)
+		}
+		return cause
+	}
+
+	var parts []s3types.CompletedPart
+	for partNumber := int32(1); n > 0; partNumber++ {
+		part, err := s.snapshots.s3Client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(s.snapshots.bucket),
+			Key:        aws.String(stagingKey),
+			UploadId:   upload.UploadId,
+			PartNumber: aws.Int32(partNumber),
+			Body:       bytes.NewReader(buf[:n]),
+		})
+		if err != nil {
+			return abort(fmt.Errorf("failed to upload staging part %d: %v", partNumber, err))
+		}
+		parts = append(parts, s3types.CompletedPart{ETag: part.ETag, PartNumber: aws.Int32(partNumber)})
+
+		n, err = io.ReadFull(body, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return abort(fmt.Errorf("failed to read file: %v", err))
+		}
+	}
+
+	_, err = s.snapshots.s3Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.snapshots.bucket),
+		Key:             aws.String(stagingKey),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return abort(fmt.Errorf("failed to complete staging upload: %v", err))
+	}
+	return nil
+}
+
+// CreateLink creates a shareable download link for a file and returns it with the token
+// the recipient presents. The token is only ever returned here.
+func (s *DownloadService) CreateLink(ctx context.Context, file *apitypes.File, userID string, options LinkOptions) (*apitypes.DownloadLink, string, error) {
+	expiresIn := options.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = DefaultLinkExpiry
+	}
+	if expiresIn < MinLinkExpiry || expiresIn > MaxLinkExpiry {
+		return nil, "", validationErrorf("link expiry must be between %s and %s", MinLinkExpiry, MaxLinkExpiry)
+	}
+	for _, allowed := range options.AllowedIPs {
+		if _, _, err := net.ParseCIDR(allowed); err != nil && net.ParseIP(allowed) == nil {
+			return nil, "", validationErrorf("invalid IP address or range: %s", allowed)
+		}
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, "", fmt.Errorf("failed to generate link token: %v", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+
+	now := time.Now()
+	link := &apitypes.DownloadLink{
+		LinkID:     linkID(token),
+		AccountID:  file.AccountID,
+		FileID:     file.FileID,
+		CreatedBy:  userID,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(expiresIn),
+		SingleUse:  options.SingleUse,
+		AllowedIPs: options.AllowedIPs,
+		TTL:        now.Add(expiresIn + linkRecordRetention).Unix(),
+	}
+	if err := s.db.PutItem(ctx, database.DownloadLinksTable, link); err != nil {
+		return nil, "", fmt.Errorf("failed to save download link: %v", err)
+	}
+
+	message := fmt.Sprintf("Created download link %s for %s, expires %s", shortLinkID(link.LinkID), file.Path, link.ExpiresAt.UTC().Format(time.RFC3339))
+	if link.SingleUse {
+		message += ", single use"
+	}
+	if len(link.AllowedIPs) > 0 {
+		message += ", restricted to " + strings.Join(link.AllowedIPs, ", ")
+	}
+	if err := LogActivity(ctx, s.db, file.AccountID, userID, "data", "download_link_created", "success", message); err != nil {
+		log.Printf("Failed to log activity: %v", err)
+	}
+
+	return link, token, nil
+}
+
+// RedeemLink checks a link token against its restrictions, records the use and returns a
+// short-lived URL for the file, negotiating its encoding like PresignFile. Refused attempts
+// are recorded as well.
+func (s *DownloadService) RedeemLink(ctx context.Context, token, sourceIP, userAgent, acceptEncoding string) (string, error) {
+	link, err := s.getLink(ctx, linkID(token))
+	if err != nil {
+		return "", err
+	}
+
+	refuse := func(reason error) (string, error) {
+		message := fmt.Sprintf("Refused download link %s from %s: %v", shortLinkID(link.LinkID), sourceIP, reason)
+		if err := LogActivity(ctx, s.db, link.AccountID, link.CreatedBy, "data", "download_link_used", "failed", message); err != nil {
+			log.Printf("Failed to log activity: %v", err)
+		}
+		return "", reason
+	}
+
+	if time.Now().After(link.ExpiresAt) {
+		return refuse(ErrLinkExpired)
+	}
+	if !ipAllowed(sourceIP, link.AllowedIPs) {
+		return refuse(ErrLinkIPDenied)
+	}
+
+	file, err := s.GetFile(ctx, link.AccountID, link.FileID)
+	if err != nil {
+		return refuse(ErrLinkFileGone)
+	}
+
+	// Checked before the use is recorded, so a single-use link survives the restore
+	if err := s.checkReadable(ctx, file); err != nil {
+		if !errors.Is(err, ErrObjectArchived) {
+			return "", err
+		}
+		if _, err := s.archive.RequestRehydration(ctx, file, link.CreatedBy); err != nil {
+			return "", err
+		}
+		return refuse(ErrLinkArchived)
+	}
+
+	if err := s.recordUse(ctx, link, sourceIP); err != nil {
+		if errors.Is(err, errLinkCondition) {
+			return refuse(ErrLinkUsed)
+		}
+		return "", err
+	}
+
+	url, _, err := s.PresignFile(ctx, file, linkRedirectTTL, acceptEncoding)
+	if err != nil {
+		return "", err
+	}
+
+	message := fmt.Sprintf("Download link %s for %s used from %s (%s)", shortLinkID(link.LinkID), file.Path, sourceIP, userAgent)
+	if err := LogActivity(ctx, s.db, link.AccountID, link.CreatedBy, "data", "download_link_used", "success", message); err != nil {
+		log.Printf("Failed to log activity: %v", err)
+	}
+
+	return url, nil
+}
+
+func (s *DownloadService) getLink(ctx context.Context, id string) (*apitypes.DownloadLink, error) {
+	idAttr, err := attributevalue.Marshal(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal linkId: %v", err)
+	}
+
+	var link apitypes.DownloadLink
+	err = s.db.GetItem(ctx, database.DownloadLinksTable, map[string]types.AttributeValue{
+		"linkId": idAttr,
+	}, &link)
+	if err != nil || link.LinkID == "" {
+		return nil, ErrLinkNotFound
+	}
+
+	return &link, nil
+}
+
+// recordUse counts a use of the link. Single-use links are claimed with a condition so
+// two concurrent requests cannot both succeed.
+func (s *DownloadService) recordUse(ctx context.Context, link *apitypes.DownloadLink, sourceIP string) error {
+	values, err := attributevalue.MarshalMap(map[string]interface{}{
+		":one":  1,
+		":zero": 0,
+		":now":  time.Now(),
+		":ip":   sourceIP,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal link update: %v", err)
+	}
+
+	update := &types.Update{
+		TableName:                 aws.String(database.DownloadLinksTable),
+		Key:                       map[string]types.AttributeValue{"linkId": &types.AttributeValueMemberS{Value: link.LinkID}},
+		UpdateExpression:          aws.String("SET useCount = useCount + :one, lastUsedAt = :now, lastUsedIp = :ip"),
+		ExpressionAttributeValues: values,
+	}
+	if link.SingleUse {
+		update.ConditionExpression = aws.String("useCount = :zero")
+	} else {
+		delete(values, ":zero")
+	}
+
+	err = s.db.TransactWrite(ctx, []types.TransactWriteItem{{Update: update}})
+	if err != nil {
+		if database.ConditionFailed(err, 0) {
+			return errLinkCondition
+		}
+		return fmt.Errorf("failed to record link use: %v", err)
+	}
+
+	return nil
+}
+
+// ipAllowed reports whether ip matches one of the allowed addresses or ranges. An empty
+// list allows every address.
+func ipAllowed(ip string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range allowed {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if allowedAddr := net.ParseIP(entry); allowedAddr != nil && allowedAddr.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func linkID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// shortLinkID is enough of a link ID to tell links apart in the activity feed
+func shortLinkID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,341 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/google/uuid"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+const (
+	// EncryptionAlgorithm is the cipher used for backup objects and wrapped data keys
+	EncryptionAlgorithm = "AES-256-GCM"
+
+	dataKeySize = 32
+)
+
+// envelopeMagic prefixes every encrypted object so readers can detect the format
+var envelopeMagic = []byte("LBE1")
+
+// KeyProvider wraps and unwraps per-snapshot data keys with a per-account key-encryption key (KEK)
+type KeyProvider interface {
+	// Name identifies the provider in snapshot manifests (local|kms)
+	Name() string
+	// CreateKey provisions a new KEK for an account and returns its ID
+	CreateKey(ctx context.Context, accountID string) (string, error)
+	// WrapKey encrypts a data key under the given KEK
+	WrapKey(ctx context.Context, keyID string, dataKey []byte, encryptionContext map[string]string) ([]byte, error)
+	// UnwrapKey decrypts a data key previously wrapped under the given KEK
+	UnwrapKey(ctx context.Context, keyID string, wrappedKey []byte, encryptionContext map[string]string) ([]byte, error)
+}
+
+// LocalKeyProvider derives KEKs from a master secret. Intended for local development and tests.
+type LocalKeyProvider struct {
+	masterKey []byte
+}
+
+// NewLocalKeyProvider creates a local KEK provider from a master secret
+func NewLocalKeyProvider(masterKey []byte) (*LocalKeyProvider, error) {
+	if len(masterKey) < dataKeySize {
+		return nil, fmt.Errorf("local master key must be at least %d bytes", dataKeySize)
+	}
+	return &LocalKeyProvider{masterKey: masterKey}, nil
+}
+
+// Name returns the provider name
+func (p *LocalKeyProvider) Name() string {
+	return "local"
+}
+
+// CreateKey returns a new local key ID; the key material is derived on demand
+func (p *LocalKeyProvider) CreateKey(ctx context.Context, accountID string) (string, error) {
+	return fmt.Sprintf("local:%s:%s", accountID, uuid.New().String()), nil
+}
+
+// WrapKey seals the data key with a KEK derived from the master secret and key ID
+func (p *LocalKeyProvider) WrapKey(ctx context.Context, keyID string, dataKey []byte, encryptionContext map[string]string) ([]byte, error) {
+	return seal(p.deriveKey(keyID), dataKey, encodeEncryptionContext(encryptionContext))
+}
+
+// UnwrapKey opens a data key sealed by WrapKey
+func (p *LocalKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrappedKey []byte, encryptionContext map[string]string) ([]byte, error) {
+	return open(p.deriveKey(keyID), wrappedKey, encodeEncryptionContext(encryptionContext))
+}
+
+func (p *LocalKeyProvider) deriveKey(keyID string) []byte {
+	mac := hmac.New(sha256.New, p.masterKey)
+	mac.Write([]byte(keyID))
+	return mac.Sum(nil)
+}
+
+// KMSKeyProvider wraps data keys with per-account AWS KMS keys
+type KMSKeyProvider struct {
+	client *kms.KMS
+}
+
+// NewKMSKeyProvider creates a KMS-backed KEK provider
+func NewKMSKeyProvider() (*KMSKeyProvider, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = "us-west-2"
+	}
+
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(region),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session: %v", err)
+	}
+
+	return &KMSKeyProvider{client: kms.New(sess)}, nil
+}
+
+// Name returns the provider name
+func (p *KMSKeyProvider) Name() string {
+	return "kms"
+}
+
+// CreateKey creates a symmetric KMS key tagged with the owning account
+func (p *KMSKeyProvider) CreateKey(ctx context.Context, accountID string) (string, error) {
+	result, err := p.client.CreateKeyWithContext(ctx, &kms.CreateKeyInput{
+		Description: aws.String(fmt.Sprintf("ListBackup backup encryption key for %s", accountID)),
+		KeyUsage:    aws.String(kms.KeyUsageTypeEncryptDecrypt),
+		Tags: []*kms.Tag{
+			{TagKey: aws.String("AccountId"), TagValue: aws.String(accountID)},
+			{TagKey: aws.String("Service"), TagValue: aws.String("listbackup")},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create KMS key: %v", err)
+	}
+
+	return aws.StringValue(result.KeyMetadata.Arn), nil
+}
+
+// WrapKey encrypts the data key with KMS
+func (p *KMSKeyProvider) WrapKey(ctx context.Context, keyID string, dataKey []byte, encryptionContext map[string]string) ([]byte, error) {
+	result, err := p.client.EncryptWithContext(ctx, &kms.EncryptInput{
+		KeyId:             aws.String(keyID),
+		Plaintext:         dataKey,
+		EncryptionContext: aws.StringMap(encryptionContext),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key with KMS: %v", err)
+	}
+
+	return result.CiphertextBlob, nil
+}
+
+// UnwrapKey decrypts the data key with KMS
+func (p *KMSKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrappedKey []byte, encryptionContext map[string]string) ([]byte, error) {
+	result, err := p.client.DecryptWithContext(ctx, &kms.DecryptInput{
+		KeyId:             aws.String(keyID),
+		CiphertextBlob:    wrappedKey,
+		EncryptionContext: aws.StringMap(encryptionContext),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key with KMS: %v", err)
+	}
+
+	return result.Plaintext, nil
+}
+
+// EncryptionService implements envelope encryption of backup objects
+type EncryptionService struct {
+	provider KeyProvider
+}
+
+// NewEncryptionService creates an encryption service with the given KEK provider
+func NewEncryptionService(provider KeyProvider) *EncryptionService {
+	return &EncryptionService{provider: provider}
+}
+
+// NewEncryptionServiceFromEnv selects the KEK provider from ENCRYPTION_KEY_PROVIDER (kms by default)
+func NewEncryptionServiceFromEnv() (*EncryptionService, error) {
+	switch os.Getenv("ENCRYPTION_KEY_PROVIDER") {
+	case "local":
+		masterKey, err := base64.StdEncoding.DecodeString(os.Getenv("LOCAL_KEK_MASTER_KEY"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid LOCAL_KEK_MASTER_KEY: %v", err)
+		}
+		provider, err := NewLocalKeyProvider(masterKey)
+		if err != nil {
+			return nil, err
+		}
+		return NewEncryptionService(provider), nil
+	default:
+		provider, err := NewKMSKeyProvider()
+		if err != nil {
+			return nil, err
+		}
+		return NewEncryptionService(provider), nil
+	}
+}
+
+// ProviderName returns the name of the configured KEK provider
+func (s *EncryptionService) ProviderName() string {
+	return s.provider.Name()
+}
+
+// CreateAccountKey provisions a new KEK for an account
+func (s *EncryptionService) CreateAccountKey(ctx context.Context, accountID string) (string, error) {
+	return s.provider.CreateKey(ctx, accountID)
+}
+
+// NewSnapshotKey generates a data key for a snapshot and wraps it with the account KEK
+func (s *EncryptionService) NewSnapshotKey(ctx context.Context, keyID, accountID, snapshotID string) ([]byte, *apitypes.SnapshotEncryption, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate data key: %v", err)
+	}
+
+	wrapped, err := s.provider.WrapKey(ctx, keyID, dataKey, snapshotEncryptionContext(accountID, snapshotID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return dataKey, &apitypes.SnapshotEncryption{
+		Algorithm:      EncryptionAlgorithm,
+		KeyProvider:    s.provider.Name(),
+		KeyID:          keyID,
+		WrappedDataKey: base64.StdEncoding.EncodeToString(wrapped),
+	}, nil
+}
+
+// OpenSnapshotKey unwraps the data key recorded in a snapshot manifest
+func (s *EncryptionService) OpenSnapshotKey(ctx context.Context, accountID, snapshotID string, enc *apitypes.SnapshotEncryption) ([]byte, error) {
+	if enc.KeyProvider != s.provider.Name() {
+		return nil, fmt.Errorf("snapshot key was wrapped by %s provider, configured provider is %s", enc.KeyProvider, s.provider.Name())
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(enc.WrappedDataKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapped data key: %v", err)
+	}
+
+	return s.provider.UnwrapKey(ctx, enc.KeyID, wrapped, snapshotEncryptionContext(accountID, snapshotID))
+}
+
+// RewrapSnapshotKey re-wraps a snapshot's data key under a new KEK without touching the encrypted objects
+func (s *EncryptionService) RewrapSnapshotKey(ctx context.Context, accountID, snapshotID string, enc *apitypes.SnapshotEncryption, newKeyID string) (*apitypes.SnapshotEncryption, error) {
+	dataKey, err := s.OpenSnapshotKey(ctx, accountID, snapshotID, enc)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := s.provider.WrapKey(ctx, newKeyID, dataKey, snapshotEncryptionContext(accountID, snapshotID))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &apitypes.SnapshotEncryption{
+		Algorithm:      enc.Algorithm,
+		KeyProvider:    s.provider.Name(),
+		KeyID:          newKeyID,
+		WrappedDataKey: base64.StdEncoding.EncodeToString(wrapped),
+		RotatedAt:      &now,
+	}, nil
+}
+
+// EncryptObject seals an object with a snapshot data key. The object key is bound as associated data.
+func (s *EncryptionService) EncryptObject(dataKey []byte, objectKey string, plaintext []byte) ([]byte, error) {
+	sealed, err := seal(dataKey, plaintext, []byte(objectKey))
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, envelopeMagic...), sealed...), nil
+}
+
+// DecryptObject opens an object sealed by EncryptObject
+func (s *EncryptionService) DecryptObject(dataKey []byte, objectKey string, ciphertext []byte) ([]byte, error) {
+	if !IsEncryptedObject(ciphertext) {
+		return nil, fmt.Errorf("object is not in encrypted envelope format")
+	}
+	return open(dataKey, ciphertext[len(envelopeMagic):], []byte(objectKey))
+}
+
+// IsEncryptedObject reports whether data carries the encrypted envelope header
+func IsEncryptedObject(data []byte) bool {
+	return len(data) >= len(envelopeMagic) && string(data[:len(envelopeMagic)]) == string(envelopeMagic)
+}
+
+func snapshotEncryptionContext(accountID, snapshotID string) map[string]string {
+	return map[string]string{
+		"accountId":  accountID,
+		"snapshotId": snapshotID,
+	}
+}
+
+// encodeEncryptionContext produces a stable byte encoding of an encryption context for use as AAD
+func encodeEncryptionContext(encryptionContext map[string]string) []byte {
+	keys := make([]string, 0, len(encryptionContext))
+	for k := range encryptionContext {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+encryptionContext[k])
+	}
+	return []byte(strings.Join(parts, "&"))
+}
+
+// seal encrypts with AES-256-GCM and returns nonce || ciphertext
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts nonce || ciphertext produced by seal
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %v", err)
+	}
+
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+const (
+	testMasterKey  = "0123456789abcdef0123456789abcdef"
+	otherMasterKey = "fedcba9876543210fedcba9876543210"
+)
+
+func newTestEncryption(t *testing.T, master string) *EncryptionService {
+	t.Helper()
+	provider, err := NewLocalKeyProvider([]byte(master))
+	if err != nil {
+		t.Fatalf("NewLocalKeyProvider: %v", err)
+	}
+	return NewEncryptionService(provider)
+}
+
+func TestNewLocalKeyProviderRejectsShortKey(t *testing.T) {
+	if _, err := NewLocalKeyProvider([]byte("short")); err == nil {
+		t.Fatal("expected an error for a master key shorter than a data key")
+	}
+}
+
+func TestEncryptObject(t *testing.T) {
+	enc := newTestEncryption(t, testMasterKey)
+	dataKey, _, err := enc.NewSnapshotKey(context.Background(), "local:account:1:key", "account:1", "snapshot:1")
+	if err != nil {
+		t.Fatalf("NewSnapshotKey: %v", err)
+	}
+	otherKey, _, err := enc.NewSnapshotKey(context.Background(), "local:account:1:key", "account:1", "snapshot:2")
+	if err != nil {
+		t.Fatalf("NewSnapshotKey: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		plaintext  []byte
+		decryptKey []byte
+		objectKey  string
+		wantErr    bool
+	}{
+		{name: "round trip", plaintext: []byte(`[{"id":1}]`), decryptKey: dataKey, objectKey: "a/b.json"},
+		{name: "empty object", plaintext: []byte{}, decryptKey: dataKey, objectKey: "a/b.json"},
+		{name: "object key mismatch", plaintext: []byte("data"), decryptKey: dataKey, objectKey: "a/c.json", wantErr: true},
+		{name: "wrong data key", plaintext: []byte("data"), decryptKey: otherKey, objectKey: "a/b.json", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := enc.EncryptObject(dataKey, "a/b.json", tt.plaintext)
+			if err != nil {
+				t.Fatalf("EncryptObject: %v", err)
+			}
+			if !IsEncryptedObject(sealed) {
+				t.Fatal("sealed object is missing the envelope header")
+			}
+
+			plain, err := enc.DecryptObject(tt.decryptKey, tt.objectKey, sealed)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected DecryptObject to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecryptObject: %v", err)
+			}
+			if !bytes.Equal(plain, tt.plaintext) {
+				t.Fatalf("got %q, want %q", plain, tt.plaintext)
+			}
+		})
+	}
+}
+
+func TestDecryptObjectRejectsPlainData(t *testing.T) {
+	enc := newTestEncryption(t, testMasterKey)
+	if _, err := enc.DecryptObject(make([]byte, dataKeySize), "a", []byte(`{"id":1}`)); err == nil {
+		t.Fatal("expected an error for data without the envelope header")
+	}
+}
+
+func TestOpenSnapshotKey(t *testing.T) {
+	ctx := context.Background()
+	enc := newTestEncryption(t, testMasterKey)
+	keyID, err := enc.CreateAccountKey(ctx, "account:1")
+	if err != nil {
+		t.Fatalf("CreateAccountKey: %v", err)
+	}
+	dataKey, manifest, err := enc.NewSnapshotKey(ctx, keyID, "account:1", "snapshot:1")
+	if err != nil {
+		t.Fatalf("NewSnapshotKey: %v", err)
+	}
+
+	wrongProvider := *manifest
+	wrongProvider.KeyProvider = "kms"
+	wrongKeyID := *manifest
+	wrongKeyID.KeyID = keyID + "-other"
+
+	tests := []struct {
+		name       string
+		enc        *EncryptionService
+		accountID  string
+		snapshotID string
+		manifest   *apitypes.SnapshotEncryption
+		wantErr    bool
+	}{
+		{name: "same context", enc: enc, accountID: "account:1", snapshotID: "snapshot:1", manifest: manifest},
+		{name: "other snapshot", enc: enc, accountID: "account:1", snapshotID: "snapshot:2", manifest: manifest, wantErr: true},
+		{name: "other account", enc: enc, accountID: "account:2", snapshotID: "snapshot:1", manifest: manifest, wantErr: true},
+		{name: "wrong KEK", enc: enc, accountID: "account:1", snapshotID: "snapshot:1", manifest: &wrongKeyID, wantErr: true},
+		{name: "wrong master key", enc: newTestEncryption(t, otherMasterKey), accountID: "account:1", snapshotID: "snapshot:1", manifest: manifest, wantErr: true},
+		{name: "other provider", enc: enc, accountID: "account:1", snapshotID: "snapshot:1", manifest: &wrongProvider, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opened, err := tt.enc.OpenSnapshotKey(ctx, tt.accountID, tt.snapshotID, tt.manifest)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected OpenSnapshotKey to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("OpenSnapshotKey: %v", err)
+			}
+			if !bytes.Equal(opened, dataKey) {
+				t.Fatal("opened data key differs from the generated one")
+			}
+		})
+	}
+}
+
+func TestRewrapSnapshotKey(t *testing.T) {
+	ctx := context.Background()
+	enc := newTestEncryption(t, testMasterKey)
+	oldKeyID, _ := enc.CreateAccountKey(ctx, "account:1")
+	newKeyID, _ := enc.CreateAccountKey(ctx, "account:1")
+
+	dataKey, manifest, err := enc.NewSnapshotKey(ctx, oldKeyID, "account:1", "snapshot:1")
+	if err != nil {
+		t.Fatalf("NewSnapshotKey: %v", err)
+	}
+	sealed, err := enc.EncryptObject(dataKey, "a/b.json", []byte("data"))
+	if err != nil {
+		t.Fatalf("EncryptObject: %v", err)
+	}
+
+	rotated, err := enc.RewrapSnapshotKey(ctx, "account:1", "snapshot:1", manifest, newKeyID)
+	if err != nil {
+		t.Fatalf("RewrapSnapshotKey: %v", err)
+	}
+	if rotated.KeyID != newKeyID || rotated.RotatedAt == nil {
+		t.Fatalf("rotated manifest has key %q and rotation time %v", rotated.KeyID, rotated.RotatedAt)
+	}
+	if rotated.WrappedDataKey == manifest.WrappedDataKey {
+		t.Fatal("data key was not re-wrapped")
+	}
+
+	opened, err := enc.OpenSnapshotKey(ctx, "account:1", "snapshot:1", rotated)
+	if err != nil {
+		t.Fatalf("OpenSnapshotKey after rotation: %v", err)
+	}
+	plain, err := enc.DecryptObject(opened, "a/b.json", sealed)
+	if err != nil {
+		t.Fatalf("objects written before rotation must still decrypt: %v", err)
+	}
+	if string(plain) != "data" {
+		t.Fatalf("got %q, want %q", plain, "data")
+	}
+
+	stale := *rotated
+	stale.KeyID = oldKeyID
+	if _, err := enc.OpenSnapshotKey(ctx, "account:1", "snapshot:1", &stale); err == nil {
+		t.Fatal("the new wrapped key must not open under the old KEK")
+	}
+}
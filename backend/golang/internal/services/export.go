@@ -0,0 +1,280 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/uuid"
+	"github.com/listbackup/api/internal/database"
+	"github.com/listbackup/api/internal/export"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+const (
+	// exportRetention is how long export archives are kept before the pruner removes them
+	exportRetention = 7 * 24 * time.Hour
+	// exportLinkTTL matches the lifetime of data/download links
+	exportLinkTTL = time.Hour
+)
+
+// ExportService converts snapshots into downloadable archives in other formats
+type ExportService struct {
+	db        *database.DynamoDBClient
+	snapshots *SnapshotService
+	masking   *MaskingService
+}
+
+// NewExportService creates a new export service
+func NewExportService(ctx context.Context) (*ExportService, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	snapshots, err := NewSnapshotService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	masking, err := NewMaskingService()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExportService{db: db, snapshots: snapshots, masking: masking}, nil
+}
+
+// RunExport converts the endpoints of a snapshot to the job's export format, uploads the
+// result as a zip and records it as a File with a limited lifetime
+func (s *ExportService) RunExport(ctx context.Context, job *apitypes.Job) (*apitypes.JobOutput, error) {
+	config := job.Config.Export
+	if config == nil || !export.IsFormat(config.Format) {
+		return nil, fmt.Errorf("job %s has no valid export format", job.JobID)
+	}
+
+	snapshot, err := s.exportSnapshot(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+
+	masker, err := s.exportMasker(ctx, snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := s.loadTables(ctx, snapshot, masker, job.Config.Endpoints, config.Separator)
+	if err != nil {
+		return nil, err
+	}
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("snapshot %s has no endpoints to export", snapshot.SnapshotID)
+	}
+
+	archive, err := buildExportArchive(tables, config.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(exportRetention)
+	name := fmt.Sprintf("%s-%s.zip", displayID(snapshot.SnapshotID), config.Format)
+	s3Key := fmt.Sprintf("exports/%s/%s/%s", displayID(job.AccountID), displayID(job.JobID), name)
+
+	// The archive is not part of a snapshot and has no data key of its own, so it is
+	// encrypted at rest with SSE-KMS and presigned as stored. The pruner removes it at
+	// ExpiresAt.
+	_, err = s.snapshots.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(s.snapshots.bucket),
+		Key:                  aws.String(s3Key),
+		Body:                 bytes.NewReader(archive),
+		ContentType:          aws.String("application/zip"),
+		ServerSideEncryption: s3types.ServerSideEncryptionAwsKms,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload export: %v", err)
+	}
+
+	file := &apitypes.File{
+		FileID:      "file:" + uuid.New().String(),
+		AccountID:   job.AccountID,
+		SourceID:    snapshot.SourceID,
+		JobID:       job.JobID,
+		Endpoint:    "export",
+		Path:        "exports/" + name,
+		Size:        int64(len(archive)),
+		ContentType: "application/zip",
+		S3Key:       s3Key,
+		CreatedAt:   now,
+		ExpiresAt:   &expiresAt,
+	}
+	if err := s.db.PutItem(ctx, database.FilesTable, fixedTimeItem{file}); err != nil {
+		return nil, fmt.Errorf("failed to record export file: %v", err)
+	}
+
+	request, err := s3.NewPresignClient(s.snapshots.s3Client).PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.snapshots.bucket),
+		Key:    aws.String(s3Key),
+	}, func(opts *s3.PresignOptions) {
+		opts.Expires = exportLinkTTL
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate export link: %v", err)
+	}
+
+	return &apitypes.JobOutput{
+		FileID:       file.FileID,
+		S3Key:        s3Key,
+		Format:       config.Format,
+		Size:         file.Size,
+		DownloadURL:  request.URL,
+		URLExpiresAt: now.Add(exportLinkTTL),
+	}, nil
+}
+
+// exportSnapshot returns the configured snapshot, or the latest completed snapshot of the
+// job's source
+func (s *ExportService) exportSnapshot(ctx context.Context, job *apitypes.Job) (*apitypes.Snapshot, error) {
+	if id := job.Config.Export.SnapshotID; id != "" {
+		snapshot, err := s.snapshots.GetSnapshot(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if snapshot.AccountID != job.AccountID {
+			return nil, fmt.Errorf("snapshot %s not found", id)
+		}
+		return snapshot, nil
+	}
+
+	snapshots, err := s.snapshots.ListSourceSnapshots(ctx, job.SourceID)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if snapshots[i].Status == "completed" {
+			return &snapshots[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("source %s has no completed snapshots", job.SourceID)
+}
+
+// exportMasker masks the rules the account and source have now but the snapshot was not
+// stored with, so a field masked after a backup ran does not reappear in its exports
+func (s *ExportService) exportMasker(ctx context.Context, snapshot *apitypes.Snapshot) (*Masker, error) {
+	account, err := (&AccountService{db: s.db}).GetAccountByID(ctx, snapshot.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	// Snapshots a source deletion failed to remove still get the account's rules
+	source, err := (&SourceService{db: s.db}).GetSource(ctx, snapshot.AccountID, snapshot.SourceID)
+	if errors.Is(err, ErrSourceNotFound) {
+		source = &apitypes.Source{}
+	} else if err != nil {
+		return nil, err
+	}
+
+	pending := PendingMaskingRules(ActiveMaskingRules(account, source), snapshot.Manifest.Masking)
+	return s.masking.NewMasker(ctx, snapshot.AccountID, pending)
+}
+
+func (s *ExportService) loadTables(ctx context.Context, snapshot *apitypes.Snapshot, masker *Masker, endpoints []string, separator string) ([]*export.Table, error) {
+	wanted := map[string]bool{}
+	for _, endpoint := range endpoints {
+		wanted[endpoint] = true
+	}
+
+	var tables []*export.Table
+	for _, object := range snapshot.Manifest.Objects {
+		if len(wanted) > 0 && !wanted[object.Endpoint] {
+			continue
+		}
+
+		data, err := s.snapshots.ReadObject(ctx, snapshot, object)
+		if err != nil {
+			return nil, err
+		}
+		data, err = masker.MaskData(object.Endpoint, data)
+		if err != nil {
+			return nil, err
+		}
+
+		table, err := export.NewTable(object.Endpoint, data, separator)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+
+	return tables, nil
+}
+
+// buildExportArchive zips the tables: one file per endpoint for CSV and Parquet, a single
+// workbook for XLSX and a single dump for SQL
+func buildExportArchive(tables []*export.Table, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	add := func(name string, write func(w *bytes.Buffer) error) error {
+		var content bytes.Buffer
+		if err := write(&content); err != nil {
+			return err
+		}
+		entry, err := archive.Create(name)
+		if err != nil {
+			return fmt.Errorf("failed to add %s to export: %v", name, err)
+		}
+		_, err = entry.Write(content.Bytes())
+		return err
+	}
+
+	var err error
+	switch format {
+	case export.FormatCSV:
+		for _, table := range tables {
+			table := table
+			if err = add(exportFileName(table.Name)+".csv", func(w *bytes.Buffer) error { return export.WriteCSV(w, table) }); err != nil {
+				break
+			}
+		}
+	case export.FormatParquet:
+		for _, table := range tables {
+			table := table
+			if len(table.Columns) == 0 {
+				continue // An endpoint with no records has no schema to write
+			}
+			if err = add(exportFileName(table.Name)+".parquet", func(w *bytes.Buffer) error { return export.WriteParquet(w, table) }); err != nil {
+				break
+			}
+		}
+	case export.FormatXLSX:
+		err = add("export.xlsx", func(w *bytes.Buffer) error { return export.WriteXLSX(w, tables) })
+	case export.FormatSQLite, export.FormatPostgres:
+		err = add("export.sql", func(w *bytes.Buffer) error { return export.WriteSQL(w, tables, format) })
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to build %s export: %v", format, err)
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish export archive: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// exportFileName keeps endpoint names safe to use as archive entry names
+func exportFileName(endpoint string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, endpoint)
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/listbackup/api/internal/database"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// Files table indexes
+const (
+	FilesAccountTimeIndex  = "AccountTimeIndex"
+	FilesSourceTimeIndex   = "SourceTimeIndex"
+	FilesJobTimeIndex      = "JobTimeIndex"
+	FilesSnapshotPathIndex = "SnapshotPathIndex"
+)
+
+// fileTimeLayout is a fixed-width RFC3339 layout. File times are stored in it so createdAt,
+// the sort key of the time indexes, compares correctly as a string.
+const fileTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// FileService lists backed up files
+type FileService struct {
+	db *database.DynamoDBClient
+}
+
+// FileFilter narrows a file listing. IDs may be given with or without their type prefix.
+type FileFilter struct {
+	SourceID    string
+	JobID       string
+	SnapshotID  string
+	From        *time.Time
+	To          *time.Time
+	ContentType string
+	PathPrefix  string
+	SortBy      string // createdAt|path
+	Descending  bool
+	Limit       int32
+	NextToken   string
+}
+
+// NewFileService creates a new file service
+func NewFileService(ctx context.Context) (*FileService, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	return &FileService{db: db}, nil
+}
+
+// ListFiles returns one page of an account's files. The most selective ID in the filter
+// picks the index; every other criterion is applied as a filter expression, and results
+// are always restricted to the account.
+func (s *FileService) ListFiles(ctx context.Context, accountID string, filter FileFilter) ([]apitypes.File, string, error) {
+	if filter.SortBy == "path" && filter.SnapshotID == "" {
+		return nil, "", validationErrorf("sorting by path requires a snapshotId")
+	}
+
+	query := database.PageQuery{
+		Names:      map[string]string{},
+		Values:     map[string]interface{}{":accountId": accountID},
+		Limit:      filter.Limit,
+		Descending: filter.Descending,
+		NextToken:  filter.NextToken,
+	}
+	var filters []string
+
+	switch {
+	case filter.SnapshotID != "":
+		query.IndexName = FilesSnapshotPathIndex
+		query.KeyCondition = "snapshotId = :snapshotId"
+		query.Values[":snapshotId"] = withPrefix(filter.SnapshotID, "snapshot:")
+		if filter.PathPrefix != "" {
+			query.KeyCondition += " AND begins_with(#path, :pathPrefix)"
+		}
+		filters = append(filters, "accountId = :accountId")
+	case filter.JobID != "":
+		query.IndexName = FilesJobTimeIndex
+		query.KeyCondition = "jobId = :jobId"
+		query.Values[":jobId"] = withPrefix(filter.JobID, "job:")
+		filters = append(filters, "accountId = :accountId")
+	case filter.SourceID != "":
+		query.IndexName = FilesSourceTimeIndex
+		query.KeyCondition = "sourceId = :sourceId"
+		query.Values[":sourceId"] = withPrefix(filter.SourceID, "source:")
+		filters = append(filters, "accountId = :accountId")
+	default:
+		query.IndexName = FilesAccountTimeIndex
+		query.KeyCondition = "accountId = :accountId"
+	}
+
+	// The time indexes take the date range as a key condition; the path index filters on it
+	timeCondition := createdAtCondition(filter.From, filter.To, query.Values)
+	if timeCondition != "" {
+		if query.IndexName == FilesSnapshotPathIndex {
+			filters = append(filters, timeCondition)
+		} else {
+			query.KeyCondition += " AND " + timeCondition
+		}
+	}
+
+	// Narrow by any IDs not already used for the key
+	if filter.SourceID != "" && query.IndexName != FilesSourceTimeIndex {
+		query.Values[":sourceId"] = withPrefix(filter.SourceID, "source:")
+		filters = append(filters, "sourceId = :sourceId")
+	}
+	if filter.JobID != "" && query.IndexName != FilesJobTimeIndex {
+		query.Values[":jobId"] = withPrefix(filter.JobID, "job:")
+		filters = append(filters, "jobId = :jobId")
+	}
+
+	if filter.ContentType != "" {
+		query.Values[":contentType"] = filter.ContentType
+		filters = append(filters, "begins_with(contentType, :contentType)")
+	}
+	if filter.PathPrefix != "" {
+		query.Names["#path"] = "path"
+		query.Values[":pathPrefix"] = filter.PathPrefix
+		if query.IndexName != FilesSnapshotPathIndex {
+			filters = append(filters, "begins_with(#path, :pathPrefix)")
+		}
+	}
+
+	query.FilterExpression = strings.Join(filters, " AND ")
+
+	var files []apitypes.File
+	nextToken, err := s.db.QueryPage(ctx, database.FilesTable, query, &files)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list files: %w", err)
+	}
+
+	return files, nextToken, nil
+}
+
+func createdAtCondition(from, to *time.Time, values map[string]interface{}) string {
+	switch {
+	case from != nil && to != nil:
+		values[":from"] = from.UTC().Format(fileTimeLayout)
+		values[":to"] = to.UTC().Format(fileTimeLayout)
+		return "createdAt BETWEEN :from AND :to"
+	case from != nil:
+		values[":from"] = from.UTC().Format(fileTimeLayout)
+		return "createdAt >= :from"
+	case to != nil:
+		values[":to"] = to.UTC().Format(fileTimeLayout)
+		return "createdAt <= :to"
+	}
+	return ""
+}
+
+// fixedTimeItem marshals an item with its times in fileTimeLayout. File rows and search
+// index entries are written through it so their createdAt ranges compare correctly.
+type fixedTimeItem struct {
+	item interface{}
+}
+
+func (f fixedTimeItem) MarshalDynamoDBAttributeValue() (types.AttributeValue, error) {
+	item, err := attributevalue.MarshalMapWithOptions(f.item, func(o *attributevalue.EncoderOptions) {
+		o.EncodeTime = func(t time.Time) (types.AttributeValue, error) {
+			return &types.AttributeValueMemberS{Value: t.UTC().Format(fileTimeLayout)}, nil
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &types.AttributeValueMemberM{Value: item}, nil
+}
+
+func withPrefix(id, prefix string) string {
+	if strings.HasPrefix(id, prefix) {
+		return id
+	}
+	return prefix + id
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+func TestFixedTimeItemSortsAsStrings(t *testing.T) {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	times := []time.Time{
+		base,
+		base.Add(500 * time.Millisecond),
+		base.Add(time.Second),
+		base.Add(time.Second + 1),
+	}
+
+	var stored []string
+	for _, at := range times {
+		item, err := attributevalue.MarshalMap(fixedTimeItem{&apitypes.File{FileID: "file:1", CreatedAt: at.In(time.FixedZone("PST", -8*3600))}})
+		if err != nil {
+			t.Fatalf("MarshalMap: %v", err)
+		}
+		value := item["createdAt"].(*types.AttributeValueMemberS).Value
+		if len(value) != len("2024-03-01T12:00:00.000000000Z") {
+			t.Fatalf("createdAt %q is not fixed width", value)
+		}
+		stored = append(stored, value)
+
+		var file apitypes.File
+		if err := attributevalue.UnmarshalMap(item, &file); err != nil {
+			t.Fatalf("UnmarshalMap: %v", err)
+		}
+		if !file.CreatedAt.Equal(at) {
+			t.Fatalf("got createdAt %v back, want %v", file.CreatedAt, at)
+		}
+	}
+
+	if !sort.StringsAreSorted(stored) {
+		t.Fatalf("stored times %v do not sort in time order", stored)
+	}
+
+	values := map[string]interface{}{}
+	createdAtCondition(&times[1], nil, values)
+	if from := values[":from"].(string); from <= stored[0] || from > stored[1] {
+		t.Fatalf("bound %q does not fall between %q and %q", from, stored[0], stored[1])
+	}
+}
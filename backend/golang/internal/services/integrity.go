@@ -0,0 +1,333 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/listbackup/api/internal/compression"
+	"github.com/listbackup/api/internal/database"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// Maintenance tasks
+const (
+	MaintenanceVerify    = "verify"
+	MaintenanceRehydrate = "rehydrate"
+)
+
+// IntegrityService re-reads stored snapshots to prove they are still restorable
+type IntegrityService struct {
+	db            *database.DynamoDBClient
+	snapshots     *SnapshotService
+	notifications *NotificationService
+}
+
+// IntegrityReport summarises one verification run over a source
+type IntegrityReport struct {
+	SourceID         string   `json:"sourceId"`
+	SnapshotsChecked int      `json:"snapshotsChecked"`
+	ObjectsChecked   int      `json:"objectsChecked"`
+	Corrupted        []string `json:"corrupted"`
+	Errors           []string `json:"errors,omitempty"`
+}
+
+// NewIntegrityService creates a new integrity service
+func NewIntegrityService(ctx context.Context) (*IntegrityService, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	snapshots, err := NewSnapshotService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	notifications, err := NewNotificationService()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notification service: %v", err)
+	}
+
+	return &IntegrityService{db: db, snapshots: snapshots, notifications: notifications}, nil
+}
+
+// RunMaintenance runs the task of a maintenance job
+func (s *IntegrityService) RunMaintenance(ctx context.Context, job *apitypes.Job) (*IntegrityReport, error) {
+	config := job.Config.Maintenance
+	if config == nil || config.Task != MaintenanceVerify {
+		return nil, fmt.Errorf("job %s has no supported maintenance task", job.JobID)
+	}
+
+	return s.VerifySource(ctx, job.AccountID, job.SourceID, config.SnapshotID, config.Sample)
+}
+
+// VerifySource checks one snapshot, or every completed snapshot of the source, and flags
+// the ones that fail. sample limits the objects checked per snapshot; 0 checks all of them.
+func (s *IntegrityService) VerifySource(ctx context.Context, accountID, sourceID, snapshotID string, sample int) (*IntegrityReport, error) {
+	var snapshots []apitypes.Snapshot
+	if snapshotID != "" {
+		snapshot, err := s.snapshots.GetSnapshot(ctx, snapshotID)
+		if err != nil {
+			return nil, err
+		}
+		if snapshot.AccountID != accountID || snapshot.SourceID != sourceID {
+			return nil, fmt.Errorf("snapshot %s does not belong to source %s", snapshotID, sourceID)
+		}
+		snapshots = append(snapshots, *snapshot)
+	} else {
+		// Archived snapshots are left alone, reading them would need a restore
+		all, err := s.snapshots.ListSourceSnapshots(ctx, sourceID)
+		if err != nil {
+			return nil, err
+		}
+		for _, snapshot := range all {
+			if snapshot.AccountID == accountID && snapshot.Status == "completed" && snapshot.ArchivedAt == nil {
+				snapshots = append(snapshots, snapshot)
+			}
+		}
+	}
+
+	report := &IntegrityReport{SourceID: sourceID, Corrupted: []string{}}
+	for i := range snapshots {
+		snapshot := &snapshots[i]
+		integrity, err := s.VerifySnapshot(ctx, snapshot, sample)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", snapshot.SnapshotID, err))
+			continue
+		}
+
+		report.SnapshotsChecked++
+		report.ObjectsChecked += integrity.ObjectsChecked
+		if integrity.Status == "corrupted" {
+			report.Corrupted = append(report.Corrupted, snapshot.SnapshotID)
+		}
+	}
+
+	return report, nil
+}
+
+// VerifySnapshot re-reads the snapshot's objects, checks each against the checksum and
+// record count in the manifest, and stores the result on the snapshot. Errors are only
+// returned when the check itself could not run, never for a problem with the data.
+func (s *IntegrityService) VerifySnapshot(ctx context.Context, snapshot *apitypes.Snapshot, sample int) (*apitypes.SnapshotIntegrity, error) {
+	var dataKey []byte
+	if snapshot.Manifest.Encryption != nil {
+		key, err := s.snapshots.snapshotDataKey(ctx, snapshot)
+		if err != nil {
+			return nil, err
+		}
+		dataKey = key
+	}
+
+	objects := sampleObjects(snapshot.Manifest.Objects, sample)
+	now := time.Now()
+	integrity := &apitypes.SnapshotIntegrity{
+		Status:         "verified",
+		ObjectsChecked: len(objects),
+		ObjectsTotal:   len(snapshot.Manifest.Objects),
+		CheckedAt:      now,
+	}
+
+	for _, object := range objects {
+		problem, err := s.verifyObject(ctx, object, dataKey)
+		if err != nil {
+			return nil, err
+		}
+		if problem != nil {
+			integrity.Problems = append(integrity.Problems, *problem)
+		}
+	}
+
+	previous := snapshot.Integrity
+	if len(integrity.Problems) > 0 {
+		integrity.Status = "corrupted"
+		integrity.CorruptedAt = &now
+		if previous != nil && previous.CorruptedAt != nil {
+			integrity.CorruptedAt = previous.CorruptedAt
+		}
+	}
+
+	if err := s.saveIntegrity(ctx, snapshot.SnapshotID, integrity); err != nil {
+		return nil, err
+	}
+	snapshot.Integrity = integrity
+
+	// Only the first failing check alerts, so a corrupted snapshot does not notify nightly
+	if integrity.Status == "corrupted" && (previous == nil || previous.Status != "corrupted") {
+		s.reportCorruption(ctx, snapshot)
+	}
+
+	return integrity, nil
+}
+
+// verifyObject returns the problem found with one object, or nil when it is intact
+func (s *IntegrityService) verifyObject(ctx context.Context, object apitypes.SnapshotObject, dataKey []byte) (*apitypes.IntegrityProblem, error) {
+	problem := func(kind, detail string) *apitypes.IntegrityProblem {
+		return &apitypes.IntegrityProblem{Endpoint: object.Endpoint, FileID: object.FileID, Problem: kind, Detail: detail}
+	}
+
+	data, err := s.snapshots.downloadObject(ctx, object.S3Key)
+	if err != nil {
+		if errors.Is(err, ErrObjectMissing) {
+			return problem("missing", object.S3Key), nil
+		}
+		return nil, err
+	}
+
+	if dataKey != nil {
+		// A failed open means the ciphertext no longer authenticates
+		data, err = s.snapshots.encryption.DecryptObject(dataKey, object.S3Key, data)
+		if err != nil {
+			return problem("unreadable", err.Error()), nil
+		}
+	}
+
+	data, err = compression.Decompress(object.Codec, data)
+	if err != nil {
+		return problem("unreadable", err.Error()), nil
+	}
+
+	// Snapshots written before checksums were recorded are checked on content alone
+	if object.SHA256 != "" {
+		checksum := sha256.Sum256(data)
+		if actual := hex.EncodeToString(checksum[:]); actual != object.SHA256 {
+			return problem("checksum_mismatch", fmt.Sprintf("expected %s, got %s", object.SHA256, actual)), nil
+		}
+	}
+
+	records, err := parseRecords(data)
+	if err != nil {
+		return problem("unparseable", err.Error()), nil
+	}
+	if records != object.Records {
+		return problem("record_count_mismatch", fmt.Sprintf("expected %d records, found %d", object.Records, records)), nil
+	}
+
+	return nil, nil
+}
+
+func (s *IntegrityService) saveIntegrity(ctx context.Context, snapshotID string, integrity *apitypes.SnapshotIntegrity) error {
+	snapshotIDAttr, err := attributevalue.Marshal(snapshotID)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshotID: %v", err)
+	}
+	integrityAttr, err := attributevalue.Marshal(integrity)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot integrity: %v", err)
+	}
+
+	err = s.db.UpdateItem(ctx, database.SnapshotsTable, map[string]types.AttributeValue{
+		"snapshotId": snapshotIDAttr,
+	}, "SET integrity = :integrity", map[string]types.AttributeValue{
+		":integrity": integrityAttr,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save snapshot integrity: %v", err)
+	}
+	return nil
+}
+
+// reportCorruption records the failure in the activity feed and notifies the account owner
+func (s *IntegrityService) reportCorruption(ctx context.Context, snapshot *apitypes.Snapshot) {
+	integrity := snapshot.Integrity
+	endpoints := make([]string, 0, len(integrity.Problems))
+	for _, problem := range integrity.Problems {
+		endpoints = append(endpoints, fmt.Sprintf("%s (%s)", problem.Endpoint, problem.Problem))
+	}
+	message := fmt.Sprintf("Snapshot %s failed its integrity check: %s", snapshot.SnapshotID, strings.Join(endpoints, ", "))
+
+	if err := LogActivity(ctx, s.db, snapshot.AccountID, "system", "backup", "integrity_check", "error", message); err != nil {
+		log.Printf("Failed to log integrity failure for %s: %v", snapshot.SnapshotID, err)
+	}
+
+	accountIDAttr, err := attributevalue.Marshal(snapshot.AccountID)
+	if err != nil {
+		log.Printf("Failed to marshal accountID: %v", err)
+		return
+	}
+	var account apitypes.Account
+	err = s.db.GetItem(ctx, database.AccountsTable, map[string]types.AttributeValue{
+		"accountId": accountIDAttr,
+	}, &account)
+	if err != nil || account.OwnerUserID == "" {
+		log.Printf("No owner to notify of corrupted snapshot %s: %v", snapshot.SnapshotID, err)
+		return
+	}
+
+	_, err = s.notifications.CreateNotification(CreateNotificationOptions{
+		UserID:      account.OwnerUserID,
+		AccountID:   snapshot.AccountID,
+		Type:        "error",
+		Category:    "backup",
+		Title:       "Backup integrity check failed",
+		Message:     message,
+		Priority:    "high",
+		Channels:    []string{"app", "email"},
+		EntityID:    snapshot.SnapshotID,
+		EntityType:  "snapshot",
+		ActionURL:   fmt.Sprintf("/dashboard/sources/%s", strings.TrimPrefix(snapshot.SourceID, "source:")),
+		ActionLabel: "View Source",
+		Data: map[string]interface{}{
+			"sourceId": snapshot.SourceID,
+			"problems": len(integrity.Problems),
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to notify account %s of corrupted snapshot %s: %v", snapshot.AccountID, snapshot.SnapshotID, err)
+	}
+}
+
+// sampleObjects picks up to n objects at random, or returns all of them when n is 0
+func sampleObjects(objects []apitypes.SnapshotObject, n int) []apitypes.SnapshotObject {
+	if n <= 0 || n >= len(objects) {
+		return objects
+	}
+	sampled := make([]apitypes.SnapshotObject, 0, n)
+	for _, i := range rand.Perm(len(objects))[:n] {
+		sampled = append(sampled, objects[i])
+	}
+	return sampled
+}
+
+// parseRecords counts the records in a stored payload. A JSON array counts its elements
+// and any other JSON value counts as zero, matching what backups record; anything else
+// must be newline-delimited JSON, one record per non-empty line.
+func parseRecords(data []byte) (int64, error) {
+	if json.Valid(data) {
+		var records []json.RawMessage
+		if err := json.Unmarshal(data, &records); err != nil {
+			return 0, nil
+		}
+		return int64(len(records)), nil
+	}
+
+	var count int64
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		if !json.Valid(text) {
+			return 0, fmt.Errorf("line %d is not valid JSON", line)
+		}
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to scan records: %v", err)
+	}
+	return count, nil
+}
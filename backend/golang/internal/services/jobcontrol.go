@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/listbackup/api/internal/database"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// Job commands
+const (
+	JobCommandCancel = "cancel"
+	JobCommandPause  = "pause"
+	JobCommandResume = "resume"
+	JobCommandReplay = "replay"
+)
+
+// JobControlPollInterval is how often a running worker checks for a cancel or pause command
+const JobControlPollInterval = 5 * time.Second
+
+var (
+	// ErrJobCancelled is the cause of a running job's context being cancelled by a cancel command
+	ErrJobCancelled = errors.New("job was cancelled")
+	// ErrJobPaused is the cause of a running job's context being cancelled by a pause command
+	ErrJobPaused = errors.New("job was paused")
+	// ErrJobCommandNotAllowed is returned when a command does not apply to the job's status
+	ErrJobCommandNotAllowed = errors.New("command not allowed")
+)
+
+// JobControlService cancels, pauses, resumes and replays jobs. Jobs that are not running change
+// status right away; running jobs are sent the command and stop at their next check.
+type JobControlService struct {
+	db        *database.DynamoDBClient
+	snapshots *SnapshotService
+}
+
+// NewJobControlService creates a new job control service
+func NewJobControlService(ctx context.Context) (*JobControlService, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	snapshots, err := NewSnapshotService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JobControlService{db: db, snapshots: snapshots}, nil
+}
+
+// GetJob retrieves a job of an account
+func (s *JobControlService) GetJob(ctx context.Context, accountID, jobID string) (*apitypes.Job, error) {
+	if !strings.HasPrefix(jobID, "job:") {
+		jobID = "job:" + jobID
+	}
+
+	var job apitypes.Job
+	err := s.db.GetItem(ctx, database.JobsTable, map[string]types.AttributeValue{
+		"jobId": &types.AttributeValueMemberS{Value: jobID},
+	}, &job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job %s: %v", jobID, err)
+	}
+	if job.AccountID != accountID {
+		return nil, fmt.Errorf("job %s not found", jobID)
+	}
+
+	return &job, nil
+}
+
+// Command applies a cancel, pause, resume or replay command to a job and returns the job
+// as it is afterwards. Only backup and sync jobs checkpoint their progress, so only they
+// can be paused. Replaying a dead job gives it a fresh set of retries.
+func (s *JobControlService) Command(ctx context.Context, job *apitypes.Job, command string) (*apitypes.Job, error) {
+	notAllowed := fmt.Errorf("%w: cannot %s a %s job", ErrJobCommandNotAllowed, command, job.Status)
+
+	var err error
+	switch command {
+	case JobCommandCancel:
+		switch job.Status {
+		case "running":
+			err = s.transition(ctx, job, "control = :control", "", map[string]interface{}{":control": JobCommandCancel})
+		case "pending", "paused", "failed", "dead":
+			err = s.transition(ctx, job, "#status = :to, completedAt = :now", "control", map[string]interface{}{":to": "cancelled"})
+			if err == nil {
+				s.discardCheckpoint(ctx, job)
+			}
+		default:
+			return nil, notAllowed
+		}
+
+	case JobCommandPause:
+		if job.Type != "backup" && job.Type != "sync" {
+			return nil, fmt.Errorf("%w: only backup and sync jobs can be paused", ErrJobCommandNotAllowed)
+		}
+		switch job.Status {
+		case "running":
+			err = s.transition(ctx, job, "control = :control", "", map[string]interface{}{":control": JobCommandPause})
+		case "pending":
+			err = s.transition(ctx, job, "#status = :to", "", map[string]interface{}{":to": "paused"})
+		default:
+			return nil, notAllowed
+		}
+
+	case JobCommandResume:
+		if job.Status != "paused" {
+			return nil, notAllowed
+		}
+		// Back to pending, which queues the job again
+		err = s.transition(ctx, job, "#status = :to, resumedAt = :now", "control", map[string]interface{}{":to": "pending"})
+
+	case JobCommandReplay:
+		if job.Status != "dead" {
+			return nil, notAllowed
+		}
+		err = s.transition(ctx, job, "#status = :to, resumedAt = :now, attempts = :zero", "control, failure, nextAttemptAt, deadAt",
+			map[string]interface{}{":to": "pending", ":zero": 0})
+
+	default:
+		return nil, fmt.Errorf("%w: unknown command %s", ErrJobCommandNotAllowed, command)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetJob(ctx, job.AccountID, job.JobID)
+}
+
+// transition sets and removes job attributes on condition that its status has not changed
+// since it was read, so a command never overrides a worker that picked the job up meanwhile
+func (s *JobControlService) transition(ctx context.Context, job *apitypes.Job, set, remove string, extra map[string]interface{}) error {
+	raw := map[string]interface{}{
+		":from": job.Status,
+		":now":  time.Now(),
+	}
+	for k, v := range extra {
+		raw[k] = v
+	}
+	values, err := attributevalue.MarshalMap(raw)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job update: %v", err)
+	}
+
+	update := "SET " + set + ", updatedAt = :now"
+	if remove != "" {
+		update += " REMOVE " + remove
+	}
+
+	err = s.db.TransactWrite(ctx, []types.TransactWriteItem{{Update: &types.Update{
+		TableName:                 aws.String(database.JobsTable),
+		Key:                       map[string]types.AttributeValue{"jobId": &types.AttributeValueMemberS{Value: job.JobID}},
+		UpdateExpression:          aws.String(update),
+		ConditionExpression:       aws.String("#status = :from"),
+		ExpressionAttributeNames:  map[string]string{"#status": "status"},
+		ExpressionAttributeValues: values,
+	}}})
+	if err != nil {
+		if database.ConditionFailed(err, 0) {
+			return fmt.Errorf("%w: job %s changed status, try again", ErrJobCommandNotAllowed, job.JobID)
+		}
+		return fmt.Errorf("failed to update job %s: %v", job.JobID, err)
+	}
+	return nil
+}
+
+// discardCheckpoint closes the unfinished snapshot of a cancelled job that was not running.
+// The job is cancelled either way, so failures are only logged.
+func (s *JobControlService) discardCheckpoint(ctx context.Context, job *apitypes.Job) {
+	if job.Progress.SnapshotID == "" {
+		return
+	}
+
+	if err := s.snapshots.CancelSnapshot(ctx, job.Progress.SnapshotID, stagedParts(job.Progress)); err != nil {
+		log.Printf("Failed to cancel snapshot %s of job %s: %v", job.Progress.SnapshotID, job.JobID, err)
+	}
+
+	err := s.db.UpdateItem(ctx, database.JobsTable, map[string]types.AttributeValue{
+		"jobId": &types.AttributeValueMemberS{Value: job.JobID},
+	}, "REMOVE progress.snapshotId, progress.endpoints", nil)
+	if err != nil {
+		log.Printf("Failed to clear checkpoint of job %s: %v", job.JobID, err)
+	}
+}
+
+// WatchJobControl returns a context that is cancelled once the running job is sent a
+// cancel or pause command, with ErrJobCancelled or ErrJobPaused as its cause. Calling stop
+// ends the watch.
+func WatchJobControl(ctx context.Context, db *database.DynamoDBClient, jobID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	key := map[string]types.AttributeValue{"jobId": &types.AttributeValueMemberS{Value: jobID}}
+
+	go func() {
+		ticker := time.NewTicker(JobControlPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			var job apitypes.Job
+			if err := db.GetItem(ctx, database.JobsTable, key, &job); err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Failed to check job %s for commands: %v", jobID, err)
+				}
+				continue
+			}
+			switch job.Control {
+			case JobCommandCancel:
+				log.Printf("Job %s was sent a cancel command", jobID)
+				cancel(ErrJobCancelled)
+			case JobCommandPause:
+				log.Printf("Job %s was sent a pause command", jobID)
+				cancel(ErrJobPaused)
+			}
+		}
+	}()
+
+	return ctx, func() { cancel(nil) }
+}
+
+// JobRunError returns the command that interrupted a job when ctx was cancelled by one,
+// and err otherwise
+func JobRunError(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); errors.Is(cause, ErrJobCancelled) || errors.Is(cause, ErrJobPaused) {
+		return cause
+	}
+	return err
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/listbackup/api/internal/database"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// Job triggers
+const (
+	JobTriggerManual   = "manual"
+	JobTriggerSchedule = "schedule"
+)
+
+// ProgressPollInterval is how often a progress wait rereads the job
+const ProgressPollInterval = time.Second
+
+// ErrJobInFlight is returned when a source already has a backup queued or running
+var ErrJobInFlight = errors.New("a backup of this source is already in progress")
+
+// JobProgressUpdate is the progress of a job as shown while it runs
+type JobProgressUpdate struct {
+	JobID            string    `json:"jobId"`
+	Status           string    `json:"status"`
+	CurrentStep      string    `json:"currentStep"` // Endpoints being fetched
+	CompletedSteps   int       `json:"completedSteps"`
+	TotalSteps       int       `json:"totalSteps"`
+	FailedSteps      int       `json:"failedSteps"`
+	PercentComplete  float64   `json:"percentComplete"`
+	RecordsProcessed int64     `json:"recordsProcessed"` // Includes records staged by endpoints still running
+	DataSizeBytes    int64     `json:"dataSizeBytes"`
+	ErrorMessage     string    `json:"errorMessage,omitempty"`
+	Done             bool      `json:"done"` // The job will not change any more
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// StartBackup queues an on-demand backup of a source. When the source already has a
+// backup queued, running, paused or waiting for a retry, that job is returned with
+// ErrJobInFlight. Two requests racing past the check both queue a job; they share the
+// source's message group in the high lane, so they still run one after the other.
+func (s *JobControlService) StartBackup(ctx context.Context, source *apitypes.Source, userID string) (*apitypes.Job, error) {
+	current, err := s.InFlightBackup(ctx, source.SourceID)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		return current, ErrJobInFlight
+	}
+
+	now := time.Now()
+	job := apitypes.Job{
+		JobID:     "job:" + uuid.New().String(),
+		AccountID: source.AccountID,
+		UserID:    userID,
+		SourceID:  source.SourceID,
+		Name:      "Back up now: " + source.Name,
+		Type:      "backup",
+		Priority:  LaneHigh,
+		Trigger:   JobTriggerManual,
+		Status:    "pending",
+		Enabled:   true,
+		Config: apitypes.JobConfig{
+			IncrementalSync: source.Settings.IncrementalSync,
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.db.PutItem(ctx, database.JobsTable, job); err != nil {
+		return nil, fmt.Errorf("failed to create job: %v", err)
+	}
+
+	message := fmt.Sprintf("Started backup of source %s", source.Name)
+	if err := LogActivity(ctx, s.db, source.AccountID, userID, "sources", "backup_now", "pending", message); err != nil {
+		log.Printf("Failed to log activity: %v", err)
+	}
+	return &job, nil
+}
+
+// GroupBackupResult is the outcome of starting the backup of one source of a group
+type GroupBackupResult struct {
+	SourceID string `json:"sourceId"`
+	JobID    string `json:"jobId,omitempty"`
+	Status   string `json:"status"` // started|in_progress|skipped|failed
+	Message  string `json:"message,omitempty"`
+}
+
+// StartGroupBackup queues an on-demand backup of every source of a group that is not
+// paused. Sources that already have a backup in flight report that job instead.
+func (s *JobControlService) StartGroupBackup(ctx context.Context, sources []apitypes.Source, userID string) []GroupBackupResult {
+	results := make([]GroupBackupResult, 0, len(sources))
+	for i := range sources {
+		source := &sources[i]
+		result := GroupBackupResult{SourceID: source.SourceID}
+		if source.Status == "paused" {
+			result.Status = "skipped"
+			result.Message = "source is paused"
+			results = append(results, result)
+			continue
+		}
+
+		job, err := s.StartBackup(ctx, source, userID)
+		switch {
+		case errors.Is(err, ErrJobInFlight):
+			result.Status = "in_progress"
+			result.JobID = job.JobID
+		case err != nil:
+			log.Printf("Failed to start backup of %s: %v", source.SourceID, err)
+			result.Status = "failed"
+			result.Message = "failed to start backup"
+		default:
+			result.Status = "started"
+			result.JobID = job.JobID
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// InFlightBackup returns the backup or sync job of a source that has not finished yet, or
+// nil when there is none
+func (s *JobControlService) InFlightBackup(ctx context.Context, sourceID string) (*apitypes.Job, error) {
+	query := database.PageQuery{
+		IndexName:    "SourceIndex",
+		KeyCondition: "sourceId = :sourceId",
+		FilterExpression: "#type IN (:backup, :sync) AND (#status IN (:created, :pending, :running, :paused) OR " +
+			"(#status = :failed AND attribute_exists(nextAttemptAt)))",
+		Names: map[string]string{"#type": "type", "#status": "status"},
+		Values: map[string]interface{}{
+			":sourceId": sourceID,
+			":backup":   "backup",
+			":sync":     "sync",
+			":created":  "created",
+			":pending":  "pending",
+			":running":  "running",
+			":paused":   "paused",
+			":failed":   "failed",
+		},
+		Limit: 1,
+	}
+
+	for {
+		var jobs []apitypes.Job
+		next, err := s.db.QueryPage(ctx, database.JobsTable, query, &jobs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query jobs of source %s: %v", sourceID, err)
+		}
+		if len(jobs) > 0 {
+			return &jobs[0], nil
+		}
+		if next == "" {
+			return nil, nil
+		}
+		query.NextToken = next
+	}
+}
+
+// WaitForProgress returns the job once it has been updated after the given time, or as it
+// is when wait runs out. The boolean reports whether it changed.
+func (s *JobControlService) WaitForProgress(ctx context.Context, accountID, jobID string, after time.Time, wait time.Duration) (*apitypes.Job, bool, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		job, err := s.GetJob(ctx, accountID, jobID)
+		if err != nil {
+			return nil, false, err
+		}
+		if job.UpdatedAt.After(after) {
+			return job, true, nil
+		}
+		if jobDone(job) || time.Now().Add(ProgressPollInterval).After(deadline) {
+			return job, false, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return job, false, nil
+		case <-time.After(ProgressPollInterval):
+		}
+	}
+}
+
+// ProgressUpdate summarizes the progress of a job
+func ProgressUpdate(job *apitypes.Job) JobProgressUpdate {
+	progress := job.Progress
+	update := JobProgressUpdate{
+		JobID:            job.JobID,
+		Status:           job.Status,
+		CurrentStep:      progress.CurrentStep,
+		CompletedSteps:   progress.CompletedSteps,
+		TotalSteps:       progress.TotalSteps,
+		FailedSteps:      progress.FailedSteps,
+		PercentComplete:  progress.PercentComplete,
+		RecordsProcessed: progress.RecordsProcessed,
+		DataSizeBytes:    progress.DataSizeBytes,
+		ErrorMessage:     progress.ErrorMessage,
+		Done:             jobDone(job),
+		UpdatedAt:        job.UpdatedAt,
+	}
+
+	// Completed endpoints are already counted
+	for _, checkpoint := range progress.Endpoints {
+		if checkpoint.Status != "completed" {
+			update.RecordsProcessed += checkpoint.Records
+		}
+	}
+	return update
+}
+
+// jobDone reports whether a job has reached a status it does not leave on its own
+func jobDone(job *apitypes.Job) bool {
+	switch job.Status {
+	case "completed", "cancelled", "dead":
+		return true
+	case "failed":
+		return job.NextAttemptAt == nil
+	}
+	return false
+}
@@ -0,0 +1,415 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/listbackup/api/internal/database"
+	apitypes "github.com/listbackup/api/internal/types"
+	"gopkg.in/yaml.v3"
+)
+
+// PlatformManifest declares one platform of the catalog together with its platform
+// sources, their endpoints and the platform's OAuth configuration. Manifests are YAML or
+// JSON files using the same field names as the API.
+type PlatformManifest struct {
+	Platform apitypes.Platform         `json:"platform"`
+	Sources  []apitypes.PlatformSource `json:"sources"`
+	File     string                    `json:"-"` // Where the manifest was loaded from
+}
+
+var (
+	manifestStatuses  = map[string]bool{"active": true, "beta": true, "deprecated": true}
+	manifestAuthTypes = map[string]bool{"oauth": true, "apikey": true, "bearer": true, "basic": true}
+	manifestMethods   = map[string]bool{"GET": true, "POST": true}
+)
+
+// LoadManifests reads the manifests at paths. A directory contributes every .yaml, .yml
+// and .json file directly inside it, in name order.
+func LoadManifests(paths []string) ([]*PlatformManifest, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		for _, entry := range entries {
+			switch strings.ToLower(filepath.Ext(entry.Name())) {
+			case ".yaml", ".yml", ".json":
+				if !entry.IsDir() {
+					files = append(files, filepath.Join(path, entry.Name()))
+				}
+			}
+		}
+	}
+
+	manifests := make([]*PlatformManifest, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", file, err)
+		}
+		manifest, err := ParseManifest(file, data)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, manifest)
+	}
+	return manifests, nil
+}
+
+// ParseManifest decodes a manifest and fills in what can be derived: ID prefixes, the
+// platform of each source and endpoint names. Fields the manifest format does not know
+// are rejected so typos do not go unnoticed.
+func ParseManifest(file string, data []byte) (*PlatformManifest, error) {
+	if ext := strings.ToLower(filepath.Ext(file)); ext == ".yaml" || ext == ".yml" {
+		var document interface{}
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return nil, fmt.Errorf("%s: invalid YAML: %v", file, err)
+		}
+		converted, err := json.Marshal(document)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid YAML: %v", file, err)
+		}
+		data = converted
+	}
+
+	manifest := &PlatformManifest{File: file}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(manifest); err != nil {
+		return nil, fmt.Errorf("%s: invalid manifest: %v", file, err)
+	}
+
+	platform := &manifest.Platform
+	if platform.PlatformID != "" && !strings.HasPrefix(platform.PlatformID, "platform:") {
+		platform.PlatformID = "platform:" + platform.PlatformID
+	}
+	for i := range manifest.Sources {
+		source := &manifest.Sources[i]
+		source.PlatformSourceID = platformSourceKey(source.PlatformSourceID)
+		if source.PlatformID == "" {
+			source.PlatformID = platform.PlatformID
+		} else if !strings.HasPrefix(source.PlatformID, "platform:") {
+			source.PlatformID = "platform:" + source.PlatformID
+		}
+		for j, dep := range source.Dependencies {
+			source.Dependencies[j] = platformSourceKey(dep)
+		}
+		for name, endpoint := range source.Endpoints {
+			if endpoint.Name == "" {
+				endpoint.Name = name
+				source.Endpoints[name] = endpoint
+			}
+		}
+	}
+	return manifest, nil
+}
+
+// Validate returns every problem found in the manifest, or nothing when it can be applied
+func (m *PlatformManifest) Validate() []string {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	platform := m.Platform
+	if platform.PlatformID == "" {
+		report("platform: platformId is required")
+	}
+	if platform.Name == "" {
+		report("platform: name is required")
+	}
+	if platform.Type == "" {
+		report("platform: type is required")
+	}
+	if !manifestStatuses[platform.Status] {
+		report("platform: status must be active, beta or deprecated")
+	}
+	if platform.APIConfig.BaseURL == "" {
+		report("platform: apiConfig.baseUrl is required")
+	}
+	if !manifestAuthTypes[platform.APIConfig.AuthType] {
+		report("platform: apiConfig.authType must be oauth, apikey, bearer or basic")
+	}
+	if platform.APIConfig.AuthType == "oauth" {
+		if platform.OAuth == nil {
+			report("platform: oauth is required when apiConfig.authType is oauth")
+		} else if platform.OAuth.AuthURL == "" || platform.OAuth.TokenURL == "" {
+			report("platform: oauth.authUrl and oauth.tokenUrl are required")
+		}
+	}
+
+	if len(m.Sources) == 0 {
+		report("platform: at least one source is required")
+	}
+	graph := make(map[string][]string, len(m.Sources))
+	for i, source := range m.Sources {
+		name := source.PlatformSourceID
+		if name == "" {
+			name = fmt.Sprintf("sources[%d]", i)
+			report("%s: platformSourceId is required", name)
+		} else if _, duplicate := graph[name]; duplicate {
+			report("%s: platformSourceId is used more than once", name)
+		}
+		graph[source.PlatformSourceID] = source.Dependencies
+
+		if source.PlatformID != platform.PlatformID {
+			report("%s: platformId %s does not match the platform", name, source.PlatformID)
+		}
+		if source.Name == "" {
+			report("%s: name is required", name)
+		}
+		if source.DataType == "" {
+			report("%s: dataType is required", name)
+		}
+		if !manifestStatuses[source.Status] {
+			report("%s: status must be active, beta or deprecated", name)
+		}
+		defaults := source.DefaultSettings
+		if defaults.Priority != "" && !backupPriorities[defaults.Priority] {
+			report("%s: defaultSettings.priority must be high, medium or low", name)
+		}
+		if defaults.Frequency != "" && !backupFrequencies[defaults.Frequency] {
+			report("%s: defaultSettings.frequency must be hourly, daily, weekly or monthly", name)
+		}
+		if defaults.RetentionDays < 0 {
+			report("%s: defaultSettings.retentionDays cannot be negative", name)
+		}
+
+		if len(source.Endpoints) == 0 {
+			report("%s: at least one endpoint is required", name)
+		}
+		for _, endpointName := range sortedKeys(source.Endpoints) {
+			endpoint := source.Endpoints[endpointName]
+			if endpoint.Path == "" {
+				report("%s: endpoint %s: path is required", name, endpointName)
+			}
+			if !manifestMethods[endpoint.Method] {
+				report("%s: endpoint %s: method must be GET or POST", name, endpointName)
+			}
+			if endpoint.DefaultPriority != "" && !backupPriorities[endpoint.DefaultPriority] {
+				report("%s: endpoint %s: defaultPriority must be high, medium or low", name, endpointName)
+			}
+			if endpoint.DefaultFrequency != "" && !backupFrequencies[endpoint.DefaultFrequency] {
+				report("%s: endpoint %s: defaultFrequency must be hourly, daily, weekly or monthly", name, endpointName)
+			}
+		}
+		if err := ValidateEndpointDependencies(source.Endpoints); err != nil {
+			report("%s: %v", name, err)
+		}
+	}
+
+	for _, source := range m.Sources {
+		for _, dep := range source.Dependencies {
+			if _, ok := graph[dep]; !ok {
+				report("%s: depends on %s, which is not a source of this platform", source.PlatformSourceID, dep)
+			}
+		}
+	}
+	if cycle := FindDependencyCycle(graph); cycle != nil {
+		report("platform: %v between sources: %s", ErrDependencyCycle, strings.Join(cycle, " -> "))
+	}
+
+	for i := range problems {
+		problems[i] = m.File + ": " + problems[i]
+	}
+	return problems
+}
+
+// ValidateManifests validates each manifest and checks that no platform or platform
+// source is declared by two of them
+func ValidateManifests(manifests []*PlatformManifest) []string {
+	var problems []string
+	platforms := make(map[string]string)
+	sources := make(map[string]string)
+	for _, manifest := range manifests {
+		problems = append(problems, manifest.Validate()...)
+
+		if id := manifest.Platform.PlatformID; id != "" {
+			if other, ok := platforms[id]; ok {
+				problems = append(problems, fmt.Sprintf("%s: platform %s is also declared in %s", manifest.File, id, other))
+			}
+			platforms[id] = manifest.File
+		}
+		for _, source := range manifest.Sources {
+			if id := source.PlatformSourceID; id != "" {
+				if other, ok := sources[id]; ok && other != manifest.File {
+					problems = append(problems, fmt.Sprintf("%s: platform source %s is also declared in %s", manifest.File, id, other))
+				}
+				sources[id] = manifest.File
+			}
+		}
+	}
+	return problems
+}
+
+func platformSourceKey(id string) string {
+	if id != "" && !strings.HasPrefix(id, "platform-source:") {
+		return "platform-source:" + id
+	}
+	return id
+}
+
+// ManifestDiff is what applying a manifest would change in the catalog
+type ManifestDiff struct {
+	PlatformID     string                `json:"platformId"`
+	File           string                `json:"file"`
+	NewPlatform    bool                  `json:"newPlatform,omitempty"`
+	Platform       []FieldChange         `json:"platform,omitempty"`
+	SourcesAdded   []string              `json:"sourcesAdded,omitempty"`
+	SourcesChanged []*PlatformSourceDiff `json:"sourcesChanged,omitempty"`
+	Unmanaged      []string              `json:"unmanaged,omitempty"` // Platform sources in the catalog the manifest does not declare
+}
+
+// Empty reports whether applying the manifest would change nothing
+func (d *ManifestDiff) Empty() bool {
+	return !d.NewPlatform && len(d.Platform) == 0 && len(d.SourcesAdded) == 0 && len(d.SourcesChanged) == 0
+}
+
+// AppliedSource is the outcome of applying one platform source of a manifest
+type AppliedSource struct {
+	PlatformSourceID string `json:"platformSourceId"`
+	Status           string `json:"status"` // published|unchanged
+	Version          int    `json:"version"`
+}
+
+// ManifestResult is what applying a manifest changed
+type ManifestResult struct {
+	PlatformID string          `json:"platformId"`
+	Platform   string          `json:"platform"` // created|updated|unchanged
+	Sources    []AppliedSource `json:"sources"`
+}
+
+// DiffManifest compares a manifest with the catalog
+func (s *CatalogService) DiffManifest(ctx context.Context, manifest *PlatformManifest) (*ManifestDiff, error) {
+	current, err := s.getPlatform(ctx, manifest.Platform.PlatformID)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.listPlatformSources(ctx, manifest.Platform.PlatformID)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &ManifestDiff{PlatformID: manifest.Platform.PlatformID, File: manifest.File}
+	if current == nil {
+		diff.NewPlatform = true
+	} else {
+		diff.Platform = DiffPlatforms(current, &manifest.Platform)
+	}
+
+	declared := make(map[string]bool, len(manifest.Sources))
+	for i := range manifest.Sources {
+		template := manifest.Sources[i]
+		declared[template.PlatformSourceID] = true
+
+		before, ok := existing[template.PlatformSourceID]
+		if !ok {
+			diff.SourcesAdded = append(diff.SourcesAdded, template.PlatformSourceID)
+			continue
+		}
+		template.Version = before.Version + 1
+		// A template saved before versioning gets its first version even when unchanged
+		if sourceDiff := DiffPlatformSources(before, &template); !sourceDiff.Empty() || before.Version == 0 {
+			diff.SourcesChanged = append(diff.SourcesChanged, sourceDiff)
+		}
+	}
+	for id := range existing {
+		if !declared[id] {
+			diff.Unmanaged = append(diff.Unmanaged, id)
+		}
+	}
+	sort.Strings(diff.Unmanaged)
+	return diff, nil
+}
+
+// ApplyManifest upserts the platform and publishes its platform sources. Anything that
+// already matches the manifest is left untouched, so applying a manifest twice changes
+// nothing the second time. Platform sources the manifest does not declare are kept.
+func (s *CatalogService) ApplyManifest(ctx context.Context, manifest *PlatformManifest) (*ManifestResult, error) {
+	if problems := manifest.Validate(); len(problems) > 0 {
+		return nil, fmt.Errorf("manifest is invalid: %s", strings.Join(problems, "; "))
+	}
+
+	result := &ManifestResult{PlatformID: manifest.Platform.PlatformID, Platform: "unchanged"}
+	current, err := s.getPlatform(ctx, manifest.Platform.PlatformID)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil || len(DiffPlatforms(current, &manifest.Platform)) > 0 {
+		platform := manifest.Platform
+		platform.UpdatedAt = time.Now()
+		platform.CreatedAt = platform.UpdatedAt
+		result.Platform = "created"
+		if current != nil {
+			platform.CreatedAt = current.CreatedAt
+			result.Platform = "updated"
+		}
+		if err := s.db.PutItem(ctx, database.PlatformsTable, platform); err != nil {
+			return nil, fmt.Errorf("failed to save platform %s: %v", platform.PlatformID, err)
+		}
+	}
+
+	for _, template := range manifest.Sources {
+		published, changed, err := s.PublishPlatformSource(ctx, template)
+		if err != nil {
+			return result, err
+		}
+		applied := AppliedSource{PlatformSourceID: published.PlatformSourceID, Status: "unchanged", Version: published.Version}
+		if changed {
+			applied.Status = "published"
+		}
+		result.Sources = append(result.Sources, applied)
+	}
+	return result, nil
+}
+
+// getPlatform returns the platform, or nil when it is not in the catalog yet
+func (s *CatalogService) getPlatform(ctx context.Context, platformID string) (*apitypes.Platform, error) {
+	var platform apitypes.Platform
+	err := s.db.GetItem(ctx, database.PlatformsTable, map[string]types.AttributeValue{
+		"platformId": &types.AttributeValueMemberS{Value: platformID},
+	}, &platform)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get platform %s: %v", platformID, err)
+	}
+	return &platform, nil
+}
+
+// listPlatformSources returns the platform sources of a platform keyed by ID
+func (s *CatalogService) listPlatformSources(ctx context.Context, platformID string) (map[string]*apitypes.PlatformSource, error) {
+	var platformSources []apitypes.PlatformSource
+	err := s.db.QueryGSIAll(ctx, database.PlatformSourcesTable, "PlatformIndex", "platformId = :platformId",
+		map[string]interface{}{":platformId": platformID}, &platformSources)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list platform sources of %s: %v", platformID, err)
+	}
+
+	byID := make(map[string]*apitypes.PlatformSource, len(platformSources))
+	for i := range platformSources {
+		byID[platformSources[i].PlatformSourceID] = &platformSources[i]
+	}
+	return byID, nil
+}
@@ -0,0 +1,316 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+const (
+	// redactedValue replaces the value of a field masked with the redact action
+	redactedValue = "[redacted]"
+	// hashPrefix marks values masked with the hash action
+	hashPrefix = "hmac-sha256:"
+)
+
+var maskingActions = map[string]bool{"drop": true, "hash": true, "redact": true}
+
+// MaskingService masks fields of records before they are stored or exported. Hashed
+// values are HMACs keyed with a secret kept per account, so equal values still match
+// across snapshots without being recoverable. Search index terms are keyed the same way.
+type MaskingService struct {
+	secrets *SecretsService
+	mu      sync.Mutex
+	keys    map[string][]byte
+}
+
+// Masker applies a fixed set of masking rules
+type Masker struct {
+	rules []apitypes.MaskingRule
+	key   []byte
+}
+
+// NewMaskingService creates a new masking service
+func NewMaskingService() (*MaskingService, error) {
+	secrets, err := NewSecretsService()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create secrets service: %v", err)
+	}
+	return &MaskingService{secrets: secrets, keys: map[string][]byte{}}, nil
+}
+
+// ActiveMaskingRules returns the rules that apply to a source: the account's rules
+// followed by the source's own
+func ActiveMaskingRules(account *apitypes.Account, source *apitypes.Source) []apitypes.MaskingRule {
+	var rules []apitypes.MaskingRule
+	rules = append(rules, account.Settings.Masking...)
+	return append(rules, source.Settings.Masking...)
+}
+
+// PendingMaskingRules returns the rules that are not among those already applied
+func PendingMaskingRules(rules, applied []apitypes.MaskingRule) []apitypes.MaskingRule {
+	var pending []apitypes.MaskingRule
+	for _, rule := range rules {
+		done := false
+		for _, previous := range applied {
+			if rule == previous {
+				done = true
+				break
+			}
+		}
+		if !done {
+			pending = append(pending, rule)
+		}
+	}
+	return pending
+}
+
+// ValidateMaskingRules checks and normalizes masking rules. Endpoints are only checked
+// against a platform source's when endpoints is not nil, since account rules apply to
+// sources of every platform.
+func ValidateMaskingRules(endpoints map[string]apitypes.PlatformEndpoint, rules []apitypes.MaskingRule) error {
+	for i := range rules {
+		rule := &rules[i]
+		rule.Endpoint = strings.TrimSpace(rule.Endpoint)
+		rule.Field = strings.TrimSpace(rule.Field)
+		rule.Path = strings.TrimPrefix(strings.TrimSpace(rule.Path), "$.")
+		rule.Action = strings.ToLower(strings.TrimSpace(rule.Action))
+
+		if endpoints != nil && rule.Endpoint != "" {
+			if _, ok := endpoints[rule.Endpoint]; !ok {
+				return validationErrorf("masking rule %d: unknown endpoint %s", i+1, rule.Endpoint)
+			}
+		}
+		if (rule.Field == "") == (rule.Path == "") {
+			return validationErrorf("masking rule %d: set either field or path", i+1)
+		}
+		if strings.Contains(rule.Field, ".") {
+			return validationErrorf("masking rule %d: field is a single key name, use path for nested fields", i+1)
+		}
+		if rule.Path != "" && !isFieldPath(rule.Path) {
+			return validationErrorf("masking rule %d: path must be a dot separated path such as payment.card.fingerprint", i+1)
+		}
+		if !maskingActions[rule.Action] {
+			return validationErrorf("masking rule %d: action must be drop, hash or redact", i+1)
+		}
+	}
+	return nil
+}
+
+// NewMasker returns a masker for rules. The account's masking key is only loaded, and
+// created the first time, when a rule hashes.
+func (s *MaskingService) NewMasker(ctx context.Context, accountID string, rules []apitypes.MaskingRule) (*Masker, error) {
+	masker := &Masker{rules: rules}
+	for _, rule := range rules {
+		if rule.Action == "hash" {
+			key, err := s.accountKey(ctx, accountID)
+			if err != nil {
+				return nil, err
+			}
+			masker.key = key
+			break
+		}
+	}
+	return masker, nil
+}
+
+// accountKey returns the account's masking key, creating it when the account has none.
+// When another job creates it first, that job's key is used.
+func (s *MaskingService) accountKey(ctx context.Context, accountID string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key, ok := s.keys[accountID]; ok {
+		return key, nil
+	}
+
+	secretName := fmt.Sprintf("listbackup/accounts/%s/masking-key", displayID(accountID))
+	encoded, err := s.secrets.GetSecret(ctx, secretName)
+	var notFound *smtypes.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		encoded, err = s.createKey(ctx, secretName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load masking key: %v", err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("masking key of %s is invalid", accountID)
+	}
+	s.keys[accountID] = key
+	return key, nil
+}
+
+func (s *MaskingService) createKey(ctx context.Context, secretName string) (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate masking key: %v", err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(key)
+	if err := s.secrets.CreateSecret(ctx, secretName, encoded); err != nil {
+		return s.secrets.GetSecret(ctx, secretName)
+	}
+	return encoded, nil
+}
+
+// Rules returns the rules the masker applies
+func (m *Masker) Rules() []apitypes.MaskingRule {
+	return m.rules
+}
+
+// MaskRecords applies the rules for an endpoint to its records. Records no rule changes
+// keep their original encoding.
+func (m *Masker) MaskRecords(endpoint string, records []json.RawMessage) ([]json.RawMessage, error) {
+	var rules []apitypes.MaskingRule
+	for _, rule := range m.rules {
+		if rule.Endpoint == "" || rule.Endpoint == endpoint {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return records, nil
+	}
+
+	masked := make([]json.RawMessage, len(records))
+	for i, raw := range records {
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		var record interface{}
+		if err := decoder.Decode(&record); err != nil {
+			return nil, fmt.Errorf("failed to parse record for masking: %v", err)
+		}
+
+		changed := false
+		for _, rule := range rules {
+			if rule.Path != "" {
+				changed = m.maskPath(record, strings.Split(rule.Path, "."), rule.Action) || changed
+			} else {
+				changed = m.maskField(record, rule.Field, rule.Action) || changed
+			}
+		}
+		if !changed {
+			masked[i] = raw
+			continue
+		}
+
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal masked record: %v", err)
+		}
+		masked[i] = encoded
+	}
+	return masked, nil
+}
+
+// MaskData applies the rules for an endpoint to a JSON array of records
+func (m *Masker) MaskData(endpoint string, data []byte) ([]byte, error) {
+	if len(m.rules) == 0 {
+		return data, nil
+	}
+
+	var records []json.RawMessage
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse records for masking: %v", err)
+	}
+	masked, err := m.MaskRecords(endpoint, records)
+	if err != nil {
+		return nil, err
+	}
+	out, err := json.Marshal(masked)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal masked records: %v", err)
+	}
+	return out, nil
+}
+
+// maskPath masks the field at path. Lists along the way are masked element by element.
+func (m *Masker) maskPath(value interface{}, path []string, action string) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		child, ok := v[path[0]]
+		if !ok {
+			return false
+		}
+		if len(path) == 1 {
+			return m.mask(v, path[0], action)
+		}
+		return m.maskPath(child, path[1:], action)
+	case []interface{}:
+		changed := false
+		for _, item := range v {
+			changed = m.maskPath(item, path, action) || changed
+		}
+		return changed
+	}
+	return false
+}
+
+// maskField masks every key named field, at any depth
+func (m *Masker) maskField(value interface{}, field, action string) bool {
+	changed := false
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if key == field {
+				changed = m.mask(v, key, action) || changed
+				continue
+			}
+			changed = m.maskField(child, field, action) || changed
+		}
+	case []interface{}:
+		for _, item := range v {
+			changed = m.maskField(item, field, action) || changed
+		}
+	}
+	return changed
+}
+
+// mask applies an action to one key of an object. Null values are left as they are.
+func (m *Masker) mask(object map[string]interface{}, key, action string) bool {
+	switch action {
+	case "drop":
+		delete(object, key)
+		return true
+	case "redact":
+		if object[key] != nil {
+			object[key] = redactedValue
+			return true
+		}
+	case "hash":
+		if object[key] != nil {
+			object[key] = m.hash(object[key])
+			return true
+		}
+	}
+	return false
+}
+
+// hash returns the keyed hash of a value. Values that are not strings are hashed in their
+// JSON encoding.
+func (m *Masker) hash(value interface{}) string {
+	var text []byte
+	switch v := value.(type) {
+	case string:
+		text = []byte(v)
+	case json.Number:
+		text = []byte(v.String())
+	default:
+		text, _ = json.Marshal(v)
+	}
+
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write(text)
+	return hashPrefix + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+func TestValidateMaskingRules(t *testing.T) {
+	endpoints := map[string]apitypes.PlatformEndpoint{"contacts": {Name: "contacts"}}
+
+	tests := []struct {
+		name      string
+		endpoints map[string]apitypes.PlatformEndpoint
+		rule      apitypes.MaskingRule
+		want      apitypes.MaskingRule
+		wantErr   string
+	}{
+		{
+			name:      "normalizes",
+			endpoints: endpoints,
+			rule:      apitypes.MaskingRule{Endpoint: " contacts ", Path: " $.payment.card ", Action: " HASH "},
+			want:      apitypes.MaskingRule{Endpoint: "contacts", Path: "payment.card", Action: "hash"},
+		},
+		{
+			name: "field",
+			rule: apitypes.MaskingRule{Field: "ssn", Action: "drop"},
+			want: apitypes.MaskingRule{Field: "ssn", Action: "drop"},
+		},
+		{
+			name: "endpoints are not checked for account rules",
+			rule: apitypes.MaskingRule{Endpoint: "orders", Field: "ssn", Action: "redact"},
+			want: apitypes.MaskingRule{Endpoint: "orders", Field: "ssn", Action: "redact"},
+		},
+		{name: "unknown endpoint", endpoints: endpoints, rule: apitypes.MaskingRule{Endpoint: "orders", Field: "ssn", Action: "drop"}, wantErr: "unknown endpoint"},
+		{name: "field and path", rule: apitypes.MaskingRule{Field: "ssn", Path: "a.ssn", Action: "drop"}, wantErr: "either field or path"},
+		{name: "neither field nor path", rule: apitypes.MaskingRule{Action: "drop"}, wantErr: "either field or path"},
+		{name: "dotted field", rule: apitypes.MaskingRule{Field: "a.ssn", Action: "drop"}, wantErr: "single key name"},
+		{name: "empty path segment", rule: apitypes.MaskingRule{Path: "a..ssn", Action: "drop"}, wantErr: "dot separated path"},
+		{name: "trailing dot", rule: apitypes.MaskingRule{Path: "a.", Action: "drop"}, wantErr: "dot separated path"},
+		{name: "unknown action", rule: apitypes.MaskingRule{Field: "ssn", Action: "encrypt"}, wantErr: "drop, hash or redact"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := []apitypes.MaskingRule{tt.rule}
+			err := ValidateMaskingRules(tt.endpoints, rules)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateMaskingRules: %v", err)
+			}
+			if rules[0] != tt.want {
+				t.Fatalf("got %+v, want %+v", rules[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestActiveAndPendingMaskingRules(t *testing.T) {
+	accountRule := apitypes.MaskingRule{Field: "ssn", Action: "drop"}
+	sourceRule := apitypes.MaskingRule{Endpoint: "contacts", Field: "email", Action: "hash"}
+	account := &apitypes.Account{Settings: apitypes.AccountSettings{Masking: []apitypes.MaskingRule{accountRule}}}
+	source := &apitypes.Source{Settings: apitypes.SourceSettings{Masking: []apitypes.MaskingRule{sourceRule}}}
+
+	active := ActiveMaskingRules(account, source)
+	if !reflect.DeepEqual(active, []apitypes.MaskingRule{accountRule, sourceRule}) {
+		t.Fatalf("got active rules %v", active)
+	}
+
+	pending := PendingMaskingRules(active, []apitypes.MaskingRule{accountRule})
+	if !reflect.DeepEqual(pending, []apitypes.MaskingRule{sourceRule}) {
+		t.Fatalf("got pending rules %v", pending)
+	}
+	if pending := PendingMaskingRules(active, active); pending != nil {
+		t.Fatalf("got pending rules %v after all were applied", pending)
+	}
+}
+
+func testHash(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hashPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestMaskRecords(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	tests := []struct {
+		name   string
+		rules  []apitypes.MaskingRule
+		record string
+		want   string
+	}{
+		{
+			name:   "drop a field at any depth",
+			rules:  []apitypes.MaskingRule{{Field: "ssn", Action: "drop"}},
+			record: `{"id":1,"ssn":"123","spouse":{"ssn":"456"},"children":[{"ssn":"789"}]}`,
+			want:   `{"children":[{}],"id":1,"spouse":{}}`,
+		},
+		{
+			name:   "redact",
+			rules:  []apitypes.MaskingRule{{Field: "phone", Action: "redact"}},
+			record: `{"id":1,"phone":"555-0100"}`,
+			want:   `{"id":1,"phone":"[redacted]"}`,
+		},
+		{
+			name:   "hash strings and numbers",
+			rules:  []apitypes.MaskingRule{{Field: "email", Action: "hash"}, {Field: "card", Action: "hash"}},
+			record: `{"email":"a@example.com","card":4111111111111111}`,
+			want:   `{"card":"` + testHash(key, "4111111111111111") + `","email":"` + testHash(key, "a@example.com") + `"}`,
+		},
+		{
+			name:   "hash objects in their JSON encoding",
+			rules:  []apitypes.MaskingRule{{Field: "address", Action: "hash"}},
+			record: `{"address":{"city":"Austin"}}`,
+			want:   `{"address":"` + testHash(key, `{"city":"Austin"}`) + `"}`,
+		},
+		{
+			name:   "path through lists",
+			rules:  []apitypes.MaskingRule{{Path: "payments.card.number", Action: "redact"}},
+			record: `{"payments":[{"card":{"number":"4111","brand":"visa"}},{"card":{"number":"5500"}}],"number":"keep"}`,
+			want:   `{"number":"keep","payments":[{"card":{"brand":"visa","number":"[redacted]"}},{"card":{"number":"[redacted]"}}]}`,
+		},
+		{
+			name:   "path only matches from the root",
+			rules:  []apitypes.MaskingRule{{Path: "card.number", Action: "drop"}},
+			record: `{"payment":{"card":{"number":"4111"}}}`,
+			want:   `{"payment":{"card":{"number":"4111"}}}`,
+		},
+		{
+			name:   "null values are left alone",
+			rules:  []apitypes.MaskingRule{{Field: "ssn", Action: "hash"}, {Field: "phone", Action: "redact"}},
+			record: `{"ssn":null,"phone":null}`,
+			want:   `{"ssn":null,"phone":null}`,
+		},
+		{
+			name:   "rules for other endpoints are skipped",
+			rules:  []apitypes.MaskingRule{{Endpoint: "orders", Field: "ssn", Action: "drop"}},
+			record: `{"ssn":"123"}`,
+			want:   `{"ssn":"123"}`,
+		},
+		{
+			name:   "rules for the endpoint apply",
+			rules:  []apitypes.MaskingRule{{Endpoint: "contacts", Field: "ssn", Action: "drop"}},
+			record: `{"id":1,"ssn":"123"}`,
+			want:   `{"id":1}`,
+		},
+		{
+			name:   "unchanged records keep their encoding",
+			rules:  []apitypes.MaskingRule{{Field: "ssn", Action: "drop"}},
+			record: `{ "b": 1.50, "a": 2 }`,
+			want:   `{ "b": 1.50, "a": 2 }`,
+		},
+		{
+			name:   "numbers keep their precision",
+			rules:  []apitypes.MaskingRule{{Field: "ssn", Action: "drop"}},
+			record: `{"id":9007199254740993,"ssn":"123"}`,
+			want:   `{"id":9007199254740993}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			masker := &Masker{rules: tt.rules, key: key}
+			masked, err := masker.MaskRecords("contacts", []json.RawMessage{json.RawMessage(tt.record)})
+			if err != nil {
+				t.Fatalf("MaskRecords: %v", err)
+			}
+			if string(masked[0]) != tt.want {
+				t.Fatalf("got %s, want %s", masked[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestMaskerHashDependsOnKey(t *testing.T) {
+	rules := []apitypes.MaskingRule{{Field: "email", Action: "hash"}}
+	record := []json.RawMessage{json.RawMessage(`{"email":"a@example.com"}`)}
+
+	mask := func(key string) string {
+		masked, err := (&Masker{rules: rules, key: []byte(key)}).MaskRecords("contacts", record)
+		if err != nil {
+			t.Fatalf("MaskRecords: %v", err)
+		}
+		return string(masked[0])
+	}
+
+	if mask("account-1-key") != mask("account-1-key") {
+		t.Fatal("equal values must hash equally under one key")
+	}
+	if mask("account-1-key") == mask("account-2-key") {
+		t.Fatal("hashes must differ between account keys")
+	}
+}
+
+func TestMaskData(t *testing.T) {
+	masker := &Masker{rules: []apitypes.MaskingRule{{Field: "ssn", Action: "drop"}}}
+
+	masked, err := masker.MaskData("contacts", []byte(`[{"id":1,"ssn":"123"},{"id":2}]`))
+	if err != nil {
+		t.Fatalf("MaskData: %v", err)
+	}
+	if string(masked) != `[{"id":1},{"id":2}]` {
+		t.Fatalf("got %s", masked)
+	}
+
+	if _, err := masker.MaskData("contacts", []byte(`{"id":1}`)); err == nil {
+		t.Fatal("expected an error for data that is not an array of records")
+	}
+
+	unmasked := &Masker{}
+	data := []byte(`not json`)
+	if out, err := unmasked.MaskData("contacts", data); err != nil || string(out) != string(data) {
+		t.Fatalf("a masker without rules must return data as is, got %s, %v", out, err)
+	}
+}
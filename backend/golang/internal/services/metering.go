@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/listbackup/api/internal/database"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// MeteringInterval is how often the metering job runs. The first measurement of an
+// account is billed as one interval.
+const MeteringInterval = time.Hour
+
+// MeteringService measures stored bytes from the Files table and records them on
+// accounts, sources and snapshots and as billable usage
+type MeteringService struct {
+	db      *database.DynamoDBClient
+	billing *BillingService
+}
+
+// MeteringReport summarises one metering run over an account
+type MeteringReport struct {
+	AccountID     string  `json:"accountId"`
+	LogicalBytes  int64   `json:"logicalBytes"`
+	PhysicalBytes int64   `json:"physicalBytes"`
+	Files         int     `json:"files"`
+	GBHours       float64 `json:"gbHours"`
+	Sources       int     `json:"sources"`
+	Snapshots     int     `json:"snapshots"`
+}
+
+// NewMeteringService creates a new metering service. Usage records are only written when
+// BILLING_TABLE is configured.
+func NewMeteringService(ctx context.Context) (*MeteringService, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	service := &MeteringService{db: db}
+
+	if billingTable := os.Getenv("BILLING_TABLE"); billingTable != "" {
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS config: %v", err)
+		}
+		service.billing = NewBillingService(dynamodb.NewFromConfig(cfg), billingTable)
+	}
+
+	return service, nil
+}
+
+// MeterAccount sums the logical and physical size of every file of an account. Account
+// usage is overwritten with the result, as metering is the only writer of it, and the
+// GB-hours since the previous run are recorded for billing.
+func (s *MeteringService) MeterAccount(ctx context.Context, account *apitypes.Account) (*MeteringReport, error) {
+	var files []apitypes.File
+	err := s.db.QueryGSIAll(ctx, database.FilesTable, FilesAccountTimeIndex, "accountId = :accountId", map[string]interface{}{
+		":accountId": account.AccountID,
+	}, &files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %v", err)
+	}
+
+	now := time.Now()
+	total := apitypes.StorageUsage{MeteredAt: now}
+	bySource := map[string]*apitypes.StorageUsage{}
+	bySnapshot := map[string]*apitypes.StorageUsage{}
+	for _, file := range files {
+		addFile(&total, file)
+		if file.SourceID != "" {
+			addFile(usageFor(bySource, file.SourceID, now), file)
+		}
+		if file.SnapshotID != "" {
+			addFile(usageFor(bySnapshot, file.SnapshotID, now), file)
+		}
+	}
+
+	elapsed := MeteringInterval
+	if account.Usage.StorageMeteredAt != nil {
+		elapsed = now.Sub(*account.Usage.StorageMeteredAt)
+	}
+	report := &MeteringReport{
+		AccountID:     account.AccountID,
+		LogicalBytes:  total.LogicalBytes,
+		PhysicalBytes: total.PhysicalBytes,
+		Files:         total.Files,
+		GBHours:       float64(total.PhysicalBytes) / (1 << 30) * elapsed.Hours(),
+	}
+
+	if err := s.saveAccountUsage(ctx, account.AccountID, &total); err != nil {
+		return nil, err
+	}
+
+	sources, err := s.meterSources(ctx, account.AccountID, bySource, now)
+	if err != nil {
+		return nil, err
+	}
+	report.Sources = sources
+
+	snapshots, err := s.meterSnapshots(ctx, account.AccountID, bySnapshot, now)
+	if err != nil {
+		return nil, err
+	}
+	report.Snapshots = snapshots
+
+	s.recordUsage(ctx, report)
+	return report, nil
+}
+
+// storageGB rounds stored bytes up to whole gigabytes, so any data counts against a limit
+func storageGB(bytes int64) int {
+	const gb = 1 << 30
+	if bytes <= 0 {
+		return 0
+	}
+	return int((bytes + gb - 1) / gb)
+}
+
+func (s *MeteringService) saveAccountUsage(ctx context.Context, accountID string, total *apitypes.StorageUsage) error {
+	accountIDAttr, err := attributevalue.Marshal(accountID)
+	if err != nil {
+		return fmt.Errorf("failed to marshal accountID: %v", err)
+	}
+	values, err := attributevalue.MarshalMap(map[string]interface{}{
+		":physical": total.PhysicalBytes,
+		":logical":  total.LogicalBytes,
+		":gb":       storageGB(total.PhysicalBytes),
+		":now":      total.MeteredAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal storage usage: %v", err)
+	}
+
+	err = s.db.UpdateItem(ctx, database.AccountsTable, map[string]types.AttributeValue{
+		"accountId": accountIDAttr,
+	}, "SET usage.storageUsedBytes = :physical, usage.storageLogicalBytes = :logical, usage.storageUsedGB = :gb, usage.storageMeteredAt = :now", values)
+	if err != nil {
+		return fmt.Errorf("failed to update account usage: %v", err)
+	}
+	return nil
+}
+
+// meterSources records the usage of every source of the account, including sources that
+// no longer have any files
+func (s *MeteringService) meterSources(ctx context.Context, accountID string, bySource map[string]*apitypes.StorageUsage, now time.Time) (int, error) {
+	var sources []apitypes.Source
+	err := s.db.QueryGSIAll(ctx, database.SourcesTable, "AccountIndex", "accountId = :accountId", map[string]interface{}{
+		":accountId": accountID,
+	}, &sources)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list sources: %v", err)
+	}
+
+	for _, source := range sources {
+		usage := usageFor(bySource, source.SourceID, now)
+		if err := s.saveStorage(ctx, database.SourcesTable, "sourceId", source.SourceID, usage); err != nil {
+			return 0, err
+		}
+	}
+	return len(sources), nil
+}
+
+// meterSnapshots records the usage of snapshots whose size changed since they were last
+// measured, which after the first run is only new snapshots and ones that lost files
+func (s *MeteringService) meterSnapshots(ctx context.Context, accountID string, bySnapshot map[string]*apitypes.StorageUsage, now time.Time) (int, error) {
+	var snapshots []apitypes.Snapshot
+	err := s.db.QueryGSIAll(ctx, database.SnapshotsTable, "AccountIndex", "accountId = :accountId", map[string]interface{}{
+		":accountId": accountID,
+	}, &snapshots)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list snapshots: %v", err)
+	}
+
+	for _, snapshot := range snapshots {
+		usage := usageFor(bySnapshot, snapshot.SnapshotID, now)
+		if previous := snapshot.Storage; previous != nil && previous.LogicalBytes == usage.LogicalBytes &&
+			previous.PhysicalBytes == usage.PhysicalBytes && previous.Files == usage.Files {
+			continue
+		}
+		if err := s.saveStorage(ctx, database.SnapshotsTable, "snapshotId", snapshot.SnapshotID, usage); err != nil {
+			return 0, err
+		}
+	}
+	return len(snapshots), nil
+}
+
+func (s *MeteringService) saveStorage(ctx context.Context, tableName, keyName, id string, usage *apitypes.StorageUsage) error {
+	idAttr, err := attributevalue.Marshal(id)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %v", keyName, err)
+	}
+	usageAttr, err := attributevalue.Marshal(usage)
+	if err != nil {
+		return fmt.Errorf("failed to marshal storage usage: %v", err)
+	}
+
+	err = s.db.UpdateItem(ctx, tableName, map[string]types.AttributeValue{
+		keyName: idAttr,
+	}, "SET storage = :storage", map[string]types.AttributeValue{
+		":storage": usageAttr,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save storage usage of %s: %v", id, err)
+	}
+	return nil
+}
+
+// recordUsage writes a storage_gb usage record. Accounts without a subscription are
+// still metered, they just have nothing to bill.
+func (s *MeteringService) recordUsage(ctx context.Context, report *MeteringReport) {
+	if s.billing == nil {
+		return
+	}
+
+	subscription, err := s.billing.GetSubscriptionByAccount(ctx, report.AccountID)
+	if err != nil {
+		log.Printf("No subscription to bill storage of %s to: %v", report.AccountID, err)
+		return
+	}
+
+	err = s.billing.RecordMeteredUsage(ctx, report.AccountID, subscription.SubscriptionID, "storage_gb",
+		int64(storageGB(report.PhysicalBytes)), report.GBHours)
+	if err != nil {
+		log.Printf("Failed to record storage usage of %s: %v", report.AccountID, err)
+	}
+}
+
+func usageFor(usages map[string]*apitypes.StorageUsage, id string, now time.Time) *apitypes.StorageUsage {
+	usage, ok := usages[id]
+	if !ok {
+		usage = &apitypes.StorageUsage{MeteredAt: now}
+		usages[id] = usage
+	}
+	return usage
+}
+
+func addFile(usage *apitypes.StorageUsage, file apitypes.File) {
+	usage.LogicalBytes += file.Size
+	usage.PhysicalBytes += storedOrLogical(file.StoredSize, file.Size)
+	usage.Files++
+}
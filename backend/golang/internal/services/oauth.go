@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -26,6 +27,14 @@ type OAuthService struct {
 	dynamodb *database.DynamoDBClient
 }
 
+var (
+	// ErrNoRefreshToken is returned when a connection's provider issued no refresh token
+	ErrNoRefreshToken = errors.New("connection has no refresh token")
+	// ErrRefreshRejected is returned when a provider refuses a connection's refresh token,
+	// so only re-authorizing the connection can restore it
+	ErrRefreshRejected = errors.New("refresh token rejected")
+)
+
 // OAuthState represents the OAuth state stored during the flow
 type OAuthState struct {
 	UserID      string    `json:"userId"`
@@ -294,10 +303,130 @@ func (s *OAuthService) getUserInfo(ctx context.Context, provider string, accessT
 	return userInfo, nil
 }
 
-// RefreshToken refreshes an OAuth token
-func (s *OAuthService) RefreshToken(ctx context.Context, source *apitypes.Source) error {
-	// TODO: Fix this to work with current Source structure
-	return fmt.Errorf("RefreshToken not implemented for current Source structure")
+// RefreshToken exchanges a connection's refresh token for a new access token and stores
+// the new credentials and expiry on the connection. Providers that rotate refresh tokens
+// return a new one, which replaces the old.
+func (s *OAuthService) RefreshToken(ctx context.Context, connection *apitypes.PlatformConnection, platform *apitypes.Platform) error {
+	refreshToken, _ := connection.Credentials["refresh_token"].(string)
+	if refreshToken == "" {
+		return ErrNoRefreshToken
+	}
+
+	provider := strings.TrimPrefix(connection.PlatformID, "platform:")
+	providerConfig, ok := config.OAuthProviders[provider]
+	if !ok {
+		return fmt.Errorf("unsupported provider: %s", provider)
+	}
+	tokenURL := providerConfig.TokenURL
+	if platform.OAuth != nil && platform.OAuth.TokenURL != "" {
+		tokenURL = platform.OAuth.TokenURL
+	}
+
+	clientID, err := s.secrets.GetSecret(ctx, providerConfig.ClientIDPath)
+	if err != nil {
+		return fmt.Errorf("failed to get client ID: %w", err)
+	}
+	clientSecret, err := s.secrets.GetSecret(ctx, providerConfig.ClientSecretPath)
+	if err != nil {
+		return fmt.Errorf("failed to get client secret: %w", err)
+	}
+
+	tokenData := url.Values{}
+	tokenData.Set("grant_type", "refresh_token")
+	tokenData.Set("refresh_token", refreshToken)
+	tokenData.Set("client_id", clientID)
+	tokenData.Set("client_secret", clientSecret)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(tokenData.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to refresh token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	// Providers answer an invalid or revoked refresh token with 400 (invalid_grant) or 401
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%w: %s", ErrRefreshRejected, string(body))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token refresh failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var tokenResponse OAuthTokenResponse
+	if err := json.Unmarshal(body, &tokenResponse); err != nil {
+		return fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if tokenResponse.AccessToken == "" {
+		return fmt.Errorf("token response has no access token")
+	}
+
+	credentials := make(map[string]interface{}, len(connection.Credentials))
+	for key, value := range connection.Credentials {
+		credentials[key] = value
+	}
+	credentials["access_token"] = tokenResponse.AccessToken
+	credentials["expires_in"] = tokenResponse.ExpiresIn
+	if tokenResponse.RefreshToken != "" {
+		credentials["refresh_token"] = tokenResponse.RefreshToken
+	}
+	if tokenResponse.TokenType != "" {
+		credentials["token_type"] = tokenResponse.TokenType
+	}
+	if tokenResponse.Scope != "" {
+		credentials["scope"] = tokenResponse.Scope
+	}
+
+	now := time.Now()
+	var expiresAt *time.Time
+	if tokenResponse.ExpiresIn > 0 {
+		expiry := now.Add(time.Duration(tokenResponse.ExpiresIn) * time.Second)
+		expiresAt = &expiry
+	}
+
+	credentialsAttr, err := attributevalue.Marshal(credentials)
+	if err != nil {
+		return fmt.Errorf("failed to marshal credentials: %v", err)
+	}
+	nowAttr, err := attributevalue.Marshal(now)
+	if err != nil {
+		return fmt.Errorf("failed to marshal timestamp: %v", err)
+	}
+	updateExpression := "SET credentials = :credentials, updatedAt = :now REMOVE expiresAt"
+	values := map[string]types.AttributeValue{
+		":credentials": credentialsAttr,
+		":now":         nowAttr,
+	}
+	if expiresAt != nil {
+		expiresAtAttr, err := attributevalue.Marshal(*expiresAt)
+		if err != nil {
+			return fmt.Errorf("failed to marshal expiry: %v", err)
+		}
+		updateExpression = "SET credentials = :credentials, expiresAt = :expiresAt, updatedAt = :now"
+		values[":expiresAt"] = expiresAtAttr
+	}
+
+	err = s.dynamodb.UpdateItem(ctx, database.PlatformConnectionsTable, map[string]types.AttributeValue{
+		"connectionId": &types.AttributeValueMemberS{Value: connection.ConnectionID},
+	}, updateExpression, values)
+	if err != nil {
+		return fmt.Errorf("failed to store refreshed token: %v", err)
+	}
+
+	connection.Credentials = credentials
+	connection.ExpiresAt = expiresAt
+	connection.UpdatedAt = now
+	return nil
 }
 
 // Helper functions
@@ -0,0 +1,377 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/listbackup/api/internal/database"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// RetentionService enforces retention settings by pruning expired snapshots and files
+type RetentionService struct {
+	db        *database.DynamoDBClient
+	snapshots *SnapshotService
+	billing   *BillingService
+}
+
+// PruneReport summarises one pruning run over an account
+type PruneReport struct {
+	AccountID        string              `json:"accountId"`
+	DryRun           bool                `json:"dryRun"`
+	PlanMaxDays      int                 `json:"planMaxDays"`
+	SourcesChecked   int                 `json:"sourcesChecked"`
+	SnapshotsChecked int                 `json:"snapshotsChecked"`
+	SnapshotsPruned  int                 `json:"snapshotsPruned"`
+	SnapshotsHeld    int                 `json:"snapshotsHeld"`
+	ObjectsDeleted   int                 `json:"objectsDeleted"`
+	FilesExpired     int                 `json:"filesExpired"`
+	BytesFreed       int64               `json:"bytesFreed"`
+	Sources          []SourcePruneResult `json:"sources"`
+	Errors           []string            `json:"errors,omitempty"`
+}
+
+// SourcePruneResult records what was kept and pruned for one source
+type SourcePruneResult struct {
+	SourceID        string                    `json:"sourceId"`
+	RetentionDays   int                       `json:"retentionDays"`
+	RetentionPolicy *apitypes.RetentionPolicy `json:"retentionPolicy,omitempty"`
+	Kept            int                       `json:"kept"`
+	Held            bool                      `json:"held,omitempty"`
+	Pruned          []string                  `json:"pruned"`
+}
+
+// NewRetentionService creates a new retention service. Plan limits are only enforced
+// when BILLING_TABLE is configured.
+func NewRetentionService(ctx context.Context) (*RetentionService, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	snapshots, err := NewSnapshotService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	service := &RetentionService{db: db, snapshots: snapshots}
+
+	if billingTable := os.Getenv("BILLING_TABLE"); billingTable != "" {
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS config: %v", err)
+		}
+		service.billing = NewBillingService(dynamodb.NewFromConfig(cfg), billingTable)
+	}
+
+	return service, nil
+}
+
+// EffectiveRetentionDays resolves the retention window for a source: the source override,
+// else the account default, never exceeding the plan maximum. Zero means keep forever.
+func EffectiveRetentionDays(sourceDays, accountDays, planMaxDays int) int {
+	days := sourceDays
+	if days <= 0 {
+		days = accountDays
+	}
+	if planMaxDays > 0 && (days <= 0 || days > planMaxDays) {
+		days = planMaxDays
+	}
+	return days
+}
+
+// PruneAccount applies retention to every source of an account and records the report in
+// the activity feed. With dryRun set nothing is deleted.
+func (s *RetentionService) PruneAccount(ctx context.Context, account *apitypes.Account, dryRun bool) (*PruneReport, error) {
+	report := &PruneReport{
+		AccountID: account.AccountID,
+		DryRun:    dryRun,
+		Sources:   []SourcePruneResult{},
+	}
+
+	if s.billing != nil {
+		limits, err := s.billing.CheckPlanLimits(ctx, account.AccountID)
+		if err != nil {
+			// Without a plan we fall back to the account's own settings
+			log.Printf("No plan limits for %s, using account retention: %v", account.AccountID, err)
+		} else {
+			report.PlanMaxDays = limits.MaxRetentionDays
+		}
+	}
+
+	var sources []apitypes.Source
+	err := s.db.QueryGSIAll(ctx, database.SourcesTable, "AccountIndex", "accountId = :accountId", map[string]interface{}{
+		":accountId": account.AccountID,
+	}, &sources)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sources: %v", err)
+	}
+
+	now := time.Now()
+	heldSources := map[string]bool{}
+	for i := range sources {
+		if isHeld(account.LegalHold) || isHeld(sources[i].LegalHold) {
+			heldSources[sources[i].SourceID] = true
+		}
+	}
+
+	for i := range sources {
+		result, err := s.pruneSource(ctx, account, &sources[i], heldSources[sources[i].SourceID], report, now)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", sources[i].SourceID, err))
+		}
+		report.SourcesChecked++
+		report.Sources = append(report.Sources, result)
+	}
+
+	if err := s.expireFiles(ctx, account, heldSources, report, now); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("expired files: %v", err))
+	}
+
+	s.recordReport(ctx, report)
+	return report, nil
+}
+
+func (s *RetentionService) pruneSource(ctx context.Context, account *apitypes.Account, source *apitypes.Source, held bool, report *PruneReport, now time.Time) (SourcePruneResult, error) {
+	result := SourcePruneResult{
+		SourceID:        source.SourceID,
+		RetentionDays:   EffectiveRetentionDays(source.Settings.RetentionDays, account.Settings.RetentionDays, report.PlanMaxDays),
+		RetentionPolicy: source.Settings.RetentionPolicy,
+		Held:            held,
+		Pruned:          []string{},
+	}
+	if result.RetentionPolicy == nil {
+		result.RetentionPolicy = account.Settings.RetentionPolicy
+	}
+
+	snapshots, err := s.snapshots.ListSourceSnapshots(ctx, source.SourceID)
+	if err != nil {
+		return result, err
+	}
+	report.SnapshotsChecked += len(snapshots)
+
+	// A hold on the account or source protects every snapshot beneath it
+	if held {
+		result.Kept = len(snapshots)
+		report.SnapshotsHeld += len(snapshots)
+		return result, nil
+	}
+
+	expired := SelectExpiredSnapshots(snapshots, result.RetentionDays, result.RetentionPolicy, report.PlanMaxDays, now)
+	result.Kept = len(snapshots) - len(expired)
+
+	for i := range expired {
+		snapshot := &expired[i]
+		if isHeld(snapshot.LegalHold) {
+			result.Kept++
+			report.SnapshotsHeld++
+			continue
+		}
+
+		if !report.DryRun {
+			deleted, partBytes, err := s.snapshots.DeleteSnapshot(ctx, snapshot)
+			report.ObjectsDeleted += deleted
+			report.BytesFreed += partBytes
+			if err != nil {
+				result.Kept++
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", snapshot.SnapshotID, err))
+				continue
+			}
+		}
+
+		result.Pruned = append(result.Pruned, strings.TrimPrefix(snapshot.SnapshotID, "snapshot:"))
+		report.SnapshotsPruned++
+		report.BytesFreed += storedOrLogical(snapshot.Manifest.StoredBytes, snapshot.Manifest.TotalBytes)
+	}
+
+	return result, nil
+}
+
+// expireFiles deletes individual files whose own expiry has passed, unless a legal hold
+// covers them
+func (s *RetentionService) expireFiles(ctx context.Context, account *apitypes.Account, heldSources map[string]bool, report *PruneReport, now time.Time) error {
+	if isHeld(account.LegalHold) {
+		return nil
+	}
+
+	var files []apitypes.File
+	err := s.db.QueryGSIAll(ctx, database.FilesTable, FilesAccountTimeIndex, "accountId = :accountId", map[string]interface{}{
+		":accountId": account.AccountID,
+	}, &files)
+	if err != nil {
+		return fmt.Errorf("failed to list files: %v", err)
+	}
+
+	heldSnapshots := map[string]bool{}
+	for i := range files {
+		file := &files[i]
+		if file.ExpiresAt == nil || file.ExpiresAt.After(now) || heldSources[file.SourceID] {
+			continue
+		}
+
+		if file.SnapshotID != "" {
+			held, checked := heldSnapshots[file.SnapshotID]
+			if !checked {
+				// A snapshot that is gone cannot hold its files, but one that could not be
+				// read might, so its files are kept until the next run
+				snapshot, err := s.snapshots.GetSnapshot(ctx, file.SnapshotID)
+				switch {
+				case errors.Is(err, database.ErrItemNotFound):
+					held = false
+				case err != nil:
+					report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", file.SnapshotID, err))
+					held = true
+				default:
+					held = isHeld(snapshot.LegalHold)
+				}
+				heldSnapshots[file.SnapshotID] = held
+			}
+			if held {
+				continue
+			}
+		}
+
+		if !report.DryRun {
+			if err := s.snapshots.DeleteFile(ctx, file); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", file.FileID, err))
+				continue
+			}
+		}
+
+		report.FilesExpired++
+		report.BytesFreed += storedOrLogical(file.StoredSize, file.Size)
+	}
+
+	return nil
+}
+
+// storedOrLogical returns the stored size, or the logical size for data written before
+// stored sizes were recorded
+func storedOrLogical(stored, logical int64) int64 {
+	if stored > 0 {
+		return stored
+	}
+	return logical
+}
+
+func (s *RetentionService) recordReport(ctx context.Context, report *PruneReport) {
+	status := "success"
+	if len(report.Errors) > 0 {
+		status = "error"
+	}
+
+	prefix := "Pruned"
+	if report.DryRun {
+		prefix = "Dry run: would prune"
+	}
+	message := fmt.Sprintf("%s %d of %d snapshots across %d sources and %d expired files, freeing %d bytes; %d snapshots under legal hold",
+		prefix, report.SnapshotsPruned, report.SnapshotsChecked, report.SourcesChecked, report.FilesExpired, report.BytesFreed, report.SnapshotsHeld)
+	if len(report.Errors) > 0 {
+		message += fmt.Sprintf(" (%d errors: %s)", len(report.Errors), strings.Join(report.Errors, "; "))
+	}
+
+	if err := LogActivity(ctx, s.db, report.AccountID, "system", "retention", "prune_snapshots", status, message); err != nil {
+		log.Printf("Failed to record prune report for %s: %v", report.AccountID, err)
+	}
+}
+
+// inProgressSnapshotStatuses are the statuses of snapshots a backup may still write to or
+// resume from
+var inProgressSnapshotStatuses = map[string]bool{"running": true, "paused": true, "cancelling": true}
+
+// SelectExpiredSnapshots returns the snapshots that fall outside both the retention window
+// and the GFS policy. Anything older than the plan maximum is expired, except the newest
+// completed snapshot, which is always kept so a source never loses its last good backup.
+// Snapshots still in progress are never touched.
+func SelectExpiredSnapshots(snapshots []apitypes.Snapshot, retentionDays int, policy *apitypes.RetentionPolicy, planMaxDays int, now time.Time) []apitypes.Snapshot {
+	sorted := make([]apitypes.Snapshot, len(snapshots))
+	copy(sorted, snapshots)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.After(sorted[j].CreatedAt)
+	})
+
+	keep := map[string]bool{}
+	if policy != nil {
+		keepNewestPerPeriod(sorted, policy.KeepDaily, keep, func(t time.Time) string {
+			return t.Format("2006-01-02")
+		})
+		keepNewestPerPeriod(sorted, policy.KeepWeekly, keep, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		})
+		keepNewestPerPeriod(sorted, policy.KeepMonthly, keep, func(t time.Time) string {
+			return t.Format("2006-01")
+		})
+	}
+	hasPolicy := policy != nil && (policy.KeepDaily > 0 || policy.KeepWeekly > 0 || policy.KeepMonthly > 0)
+
+	newestCompleted := ""
+	for _, snapshot := range sorted {
+		if snapshot.Status == "completed" {
+			newestCompleted = snapshot.SnapshotID
+			break
+		}
+	}
+
+	var expired []apitypes.Snapshot
+	for _, snapshot := range sorted {
+		if inProgressSnapshotStatuses[snapshot.Status] || snapshot.SnapshotID == newestCompleted {
+			continue
+		}
+
+		age := now.Sub(snapshot.CreatedAt)
+		if planMaxDays > 0 && age > time.Duration(planMaxDays)*24*time.Hour {
+			expired = append(expired, snapshot)
+			continue
+		}
+
+		if keep[snapshot.SnapshotID] {
+			continue
+		}
+		if retentionDays > 0 && age <= time.Duration(retentionDays)*24*time.Hour {
+			continue
+		}
+		if retentionDays <= 0 && !hasPolicy {
+			// Nothing configured, keep forever
+			continue
+		}
+
+		expired = append(expired, snapshot)
+	}
+
+	return expired
+}
+
+// keepNewestPerPeriod marks the newest completed snapshot of each of the latest count periods.
+// Snapshots must be sorted newest first.
+func keepNewestPerPeriod(snapshots []apitypes.Snapshot, count int, keep map[string]bool, period func(time.Time) string) {
+	if count <= 0 {
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, snapshot := range snapshots {
+		if snapshot.Status != "completed" {
+			continue
+		}
+
+		key := period(snapshot.CreatedAt.UTC())
+		if seen[key] {
+			continue
+		}
+		if len(seen) == count {
+			return
+		}
+
+		seen[key] = true
+		keep[snapshot.SnapshotID] = true
+	}
+}
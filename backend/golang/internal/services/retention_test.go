@@ -0,0 +1,199 @@
+package services
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+var retentionNow = time.Date(2026, 6, 15, 12, 0, 0, 0, time.UTC)
+
+func testSnapshot(id, status string, createdAt time.Time) apitypes.Snapshot {
+	return apitypes.Snapshot{SnapshotID: id, Status: status, CreatedAt: createdAt}
+}
+
+func daysAgo(days int) time.Time {
+	return retentionNow.Add(-time.Duration(days) * 24 * time.Hour)
+}
+
+func on(month time.Month, day, hour int) time.Time {
+	return time.Date(2026, month, day, hour, 0, 0, 0, time.UTC)
+}
+
+func TestEffectiveRetentionDays(t *testing.T) {
+	tests := []struct {
+		name                              string
+		sourceDays, accountDays, planDays int
+		want                              int
+	}{
+		{name: "source override", sourceDays: 7, accountDays: 30, want: 7},
+		{name: "account default", accountDays: 30, want: 30},
+		{name: "keep forever", want: 0},
+		{name: "capped by plan", sourceDays: 90, planDays: 30, want: 30},
+		{name: "forever capped by plan", planDays: 30, want: 30},
+		{name: "within plan", accountDays: 14, planDays: 30, want: 14},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EffectiveRetentionDays(tt.sourceDays, tt.accountDays, tt.planDays); got != tt.want {
+				t.Fatalf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectExpiredSnapshots(t *testing.T) {
+	tests := []struct {
+		name          string
+		snapshots     []apitypes.Snapshot
+		retentionDays int
+		policy        *apitypes.RetentionPolicy
+		planMaxDays   int
+		want          []string
+	}{
+		{
+			name: "nothing configured keeps everything",
+			snapshots: []apitypes.Snapshot{
+				testSnapshot("a", "completed", daysAgo(1)),
+				testSnapshot("b", "completed", daysAgo(400)),
+			},
+		},
+		{
+			name: "retention window",
+			snapshots: []apitypes.Snapshot{
+				testSnapshot("a", "completed", daysAgo(1)),
+				testSnapshot("b", "completed", daysAgo(3)),
+				testSnapshot("c", "completed", daysAgo(10)),
+				testSnapshot("d", "failed", daysAgo(20)),
+			},
+			retentionDays: 7,
+			want:          []string{"c", "d"},
+		},
+		{
+			name: "newest completed is kept outside the window",
+			snapshots: []apitypes.Snapshot{
+				testSnapshot("a", "completed", daysAgo(10)),
+				testSnapshot("b", "completed", daysAgo(20)),
+				testSnapshot("c", "completed", daysAgo(30)),
+			},
+			retentionDays: 7,
+			want:          []string{"b", "c"},
+		},
+		{
+			name: "failed snapshots do not count as the last good backup",
+			snapshots: []apitypes.Snapshot{
+				testSnapshot("a", "failed", daysAgo(10)),
+				testSnapshot("b", "completed", daysAgo(20)),
+				testSnapshot("c", "completed", daysAgo(30)),
+			},
+			retentionDays: 7,
+			want:          []string{"a", "c"},
+		},
+		{
+			name: "in-progress snapshots are never expired",
+			snapshots: []apitypes.Snapshot{
+				testSnapshot("a", "completed", daysAgo(1)),
+				testSnapshot("b", "running", daysAgo(30)),
+				testSnapshot("c", "paused", daysAgo(40)),
+				testSnapshot("d", "cancelling", daysAgo(50)),
+				testSnapshot("e", "cancelled", daysAgo(60)),
+			},
+			retentionDays: 7,
+			want:          []string{"e"},
+		},
+		{
+			name: "plan maximum spares in-progress and newest completed",
+			snapshots: []apitypes.Snapshot{
+				testSnapshot("a", "paused", daysAgo(100)),
+				testSnapshot("b", "completed", daysAgo(110)),
+				testSnapshot("c", "completed", daysAgo(120)),
+			},
+			planMaxDays: 30,
+			want:        []string{"c"},
+		},
+		{
+			name: "daily policy keeps the newest of each day",
+			snapshots: []apitypes.Snapshot{
+				testSnapshot("a", "completed", on(6, 13, 10)),
+				testSnapshot("b", "completed", on(6, 13, 8)),
+				testSnapshot("c", "completed", on(6, 12, 10)),
+				testSnapshot("d", "completed", on(6, 11, 10)),
+			},
+			retentionDays: 1,
+			policy:        &apitypes.RetentionPolicy{KeepDaily: 2},
+			want:          []string{"b", "d"},
+		},
+		{
+			name: "daily policy skips failed snapshots",
+			snapshots: []apitypes.Snapshot{
+				testSnapshot("a", "completed", on(6, 13, 10)),
+				testSnapshot("b", "failed", on(6, 12, 10)),
+				testSnapshot("c", "completed", on(6, 12, 8)),
+			},
+			retentionDays: 1,
+			policy:        &apitypes.RetentionPolicy{KeepDaily: 2},
+			want:          []string{"b"},
+		},
+		{
+			name: "weekly policy uses ISO weeks",
+			snapshots: []apitypes.Snapshot{
+				testSnapshot("a", "completed", on(6, 10, 10)),
+				testSnapshot("b", "completed", on(6, 8, 10)),
+				testSnapshot("c", "completed", on(6, 3, 10)),
+				testSnapshot("d", "completed", on(5, 27, 10)),
+			},
+			retentionDays: 1,
+			policy:        &apitypes.RetentionPolicy{KeepWeekly: 2},
+			want:          []string{"b", "d"},
+		},
+		{
+			name: "monthly policy",
+			snapshots: []apitypes.Snapshot{
+				testSnapshot("a", "completed", on(6, 1, 10)),
+				testSnapshot("b", "completed", on(5, 20, 10)),
+				testSnapshot("c", "completed", on(5, 10, 10)),
+				testSnapshot("d", "completed", on(4, 15, 10)),
+			},
+			retentionDays: 1,
+			policy:        &apitypes.RetentionPolicy{KeepMonthly: 2},
+			want:          []string{"c", "d"},
+		},
+		{
+			name: "policy alone expires snapshots it does not keep",
+			snapshots: []apitypes.Snapshot{
+				testSnapshot("a", "completed", on(6, 1, 10)),
+				testSnapshot("b", "completed", on(5, 20, 10)),
+			},
+			policy: &apitypes.RetentionPolicy{KeepMonthly: 1},
+			want:   []string{"b"},
+		},
+		{
+			name: "plan maximum overrides the policy",
+			snapshots: []apitypes.Snapshot{
+				testSnapshot("a", "completed", on(6, 1, 10)),
+				testSnapshot("b", "completed", on(5, 1, 10)),
+				testSnapshot("c", "completed", on(3, 1, 10)),
+			},
+			policy:      &apitypes.RetentionPolicy{KeepMonthly: 3},
+			planMaxDays: 60,
+			want:        []string{"c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expired := SelectExpiredSnapshots(tt.snapshots, tt.retentionDays, tt.policy, tt.planMaxDays, retentionNow)
+
+			var got []string
+			for _, snapshot := range expired {
+				got = append(got, snapshot.SnapshotID)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expired %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/listbackup/api/internal/connectors"
+	"github.com/listbackup/api/internal/database"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// Job failure classes
+const (
+	FailureAuth        = "auth"
+	FailureRateLimited = "rate_limited"
+	FailureServer      = "server_error"
+	FailureTimeout     = "timeout"
+	FailureNetwork     = "network"
+	FailurePermanent   = "permanent"
+)
+
+// DefaultJobMaxRetries applies to jobs that do not set JobConfig.MaxRetries
+const DefaultJobMaxRetries = 3
+
+const (
+	retryBackoffBase = 30 * time.Second
+	// retryBackoffMax is the longest delay SQS can put on a message
+	retryBackoffMax = 15 * time.Minute
+)
+
+// RetryService records failed job runs, scheduling a retry or declaring the job dead
+type RetryService struct {
+	db            *database.DynamoDBClient
+	notifications *NotificationService
+}
+
+// NewRetryService creates a new retry service
+func NewRetryService(ctx context.Context) (*RetryService, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	notifications, err := NewNotificationService()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notification service: %v", err)
+	}
+
+	return &RetryService{db: db, notifications: notifications}, nil
+}
+
+// ClassifyJobError decides whether the error that failed a job run is worth retrying.
+// Rate limiting, platform server errors, timeouts and network errors usually pass; bad
+// credentials and anything else would fail the same way again.
+func ClassifyJobError(err error) apitypes.JobFailure {
+	failure := apitypes.JobFailure{Class: FailurePermanent, Message: err.Error(), FailedAt: time.Now()}
+
+	var apiErr *connectors.APIError
+	var netErr net.Error
+	var urlErr *url.Error
+	switch {
+	case errors.As(err, &apiErr):
+		switch {
+		case apiErr.StatusCode == 401 || apiErr.StatusCode == 403:
+			failure.Class = FailureAuth
+		case apiErr.StatusCode == 429:
+			failure.Class, failure.Retryable = FailureRateLimited, true
+		case apiErr.StatusCode >= 500:
+			failure.Class, failure.Retryable = FailureServer, true
+		}
+	case errors.Is(err, connectors.ErrNoCredentials):
+		failure.Class = FailureAuth
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		failure.Class, failure.Retryable = FailureTimeout, true
+	case errors.As(err, &urlErr):
+		failure.Class, failure.Retryable = FailureNetwork, true
+	}
+
+	return failure
+}
+
+// RetryBackoff returns how long to wait before the given retry, doubling from 30 seconds
+// up to the 15 minutes SQS can delay a message
+func RetryBackoff(retry int) time.Duration {
+	backoff := retryBackoffBase
+	for i := 1; i < retry && backoff < retryBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > retryBackoffMax {
+		backoff = retryBackoffMax
+	}
+	return backoff
+}
+
+// jobMaxRetries returns how many times a job may be retried
+func jobMaxRetries(job *apitypes.Job) int {
+	if job.Config.MaxRetries > 0 {
+		return job.Config.MaxRetries
+	}
+	return DefaultJobMaxRetries
+}
+
+// RecordFailure stores why a job run failed. Retryable failures with retries left set the
+// job to failed with the time of its next attempt, which the queue handler schedules; any
+// other failure makes the job dead and notifies its owner. job.Attempts must count the
+// failed run. It returns the status the job was given.
+func (s *RetryService) RecordFailure(ctx context.Context, job *apitypes.Job, runErr error) (string, error) {
+	failure := ClassifyJobError(runErr)
+	now := failure.FailedAt
+
+	status := "dead"
+	update := "SET #status = :status, failure = :failure, completedAt = :now, lastRunAt = :now, updatedAt = :now, deadAt = :now, progress.errorMessage = :error REMOVE nextAttemptAt"
+	values := map[string]interface{}{
+		":failure": failure,
+		":now":     now,
+		":error":   failure.Message,
+	}
+	if failure.Retryable && job.Attempts <= jobMaxRetries(job) {
+		status = "failed"
+		update = "SET #status = :status, failure = :failure, completedAt = :now, lastRunAt = :now, updatedAt = :now, nextAttemptAt = :next, progress.errorMessage = :error"
+		values[":next"] = now.Add(RetryBackoff(job.Attempts))
+	}
+	values[":status"] = status
+
+	av, err := attributevalue.MarshalMap(values)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal job failure: %v", err)
+	}
+	err = s.db.UpdateItemWithNames(ctx, database.JobsTable, map[string]types.AttributeValue{
+		"jobId": &types.AttributeValueMemberS{Value: job.JobID},
+	}, update, av, map[string]string{"#status": "status"})
+	if err != nil {
+		return "", fmt.Errorf("failed to set job %s to %s: %v", job.JobID, status, err)
+	}
+
+	if status == "dead" {
+		s.reportDead(ctx, job, &failure)
+	}
+	return status, nil
+}
+
+// reportDead records the dead job in the activity feed and notifies the user who created it
+func (s *RetryService) reportDead(ctx context.Context, job *apitypes.Job, failure *apitypes.JobFailure) {
+	message := fmt.Sprintf("Job %s stopped after %d attempts: %s", job.Name, job.Attempts, failure.Message)
+	if !failure.Retryable {
+		message = fmt.Sprintf("Job %s failed and will not be retried: %s", job.Name, failure.Message)
+	}
+
+	if err := LogActivity(ctx, s.db, job.AccountID, "system", "jobs", "job_dead", "error", message); err != nil {
+		log.Printf("Failed to log dead job %s: %v", job.JobID, err)
+	}
+
+	if job.UserID == "" {
+		return
+	}
+	_, err := s.notifications.CreateNotification(CreateNotificationOptions{
+		UserID:      job.UserID,
+		AccountID:   job.AccountID,
+		Type:        "error",
+		Category:    "backup",
+		Title:       "Job failed",
+		Message:     message,
+		Priority:    "high",
+		Channels:    []string{"app", "email"},
+		EntityID:    job.JobID,
+		EntityType:  "job",
+		ActionURL:   fmt.Sprintf("/dashboard/jobs/%s", strings.TrimPrefix(job.JobID, "job:")),
+		ActionLabel: "View Job",
+		Data: map[string]interface{}{
+			"class":    failure.Class,
+			"attempts": job.Attempts,
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to notify %s of dead job %s: %v", job.UserID, job.JobID, err)
+	}
+}
+
+// ListDeadJobs returns a page of an account's dead jobs
+func (s *RetryService) ListDeadJobs(ctx context.Context, accountID string, limit int32, nextToken string) ([]apitypes.Job, string, error) {
+	var jobs []apitypes.Job
+	next, err := s.db.QueryPage(ctx, database.JobsTable, database.PageQuery{
+		IndexName:        "AccountIndex",
+		KeyCondition:     "accountId = :accountId",
+		FilterExpression: "#status = :dead",
+		Names:            map[string]string{"#status": "status"},
+		Values: map[string]interface{}{
+			":accountId": accountID,
+			":dead":      "dead",
+		},
+		Limit:     limit,
+		NextToken: nextToken,
+	}, &jobs)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list dead jobs: %w", err)
+	}
+	return jobs, next, nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/listbackup/api/internal/connectors"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// timeoutError is a net.Error that reports a timeout
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyJobError(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantClass     string
+		wantRetryable bool
+	}{
+		{name: "unauthorized", err: &connectors.APIError{StatusCode: 401}, wantClass: FailureAuth},
+		{name: "forbidden", err: &connectors.APIError{StatusCode: 403}, wantClass: FailureAuth},
+		{name: "rate limited", err: &connectors.APIError{StatusCode: 429}, wantClass: FailureRateLimited, wantRetryable: true},
+		{name: "server error", err: &connectors.APIError{StatusCode: 503}, wantClass: FailureServer, wantRetryable: true},
+		{name: "bad request", err: &connectors.APIError{StatusCode: 400}, wantClass: FailurePermanent},
+		{name: "not found", err: &connectors.APIError{StatusCode: 404}, wantClass: FailurePermanent},
+		{name: "wrapped API error", err: fmt.Errorf("failed to fetch contacts: %w", &connectors.APIError{StatusCode: 502}), wantClass: FailureServer, wantRetryable: true},
+		{name: "no credentials", err: fmt.Errorf("failed to create connector: %w", connectors.ErrNoCredentials), wantClass: FailureAuth},
+		{name: "deadline", err: fmt.Errorf("fetch: %w", context.DeadlineExceeded), wantClass: FailureTimeout, wantRetryable: true},
+		{name: "network timeout", err: &url.Error{Op: "Get", URL: "https://api.example.com", Err: timeoutError{}}, wantClass: FailureTimeout, wantRetryable: true},
+		{name: "connection refused", err: &url.Error{Op: "Get", URL: "https://api.example.com", Err: errors.New("connection refused")}, wantClass: FailureNetwork, wantRetryable: true},
+		{name: "anything else", err: errors.New("invalid response mapping"), wantClass: FailurePermanent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failure := ClassifyJobError(tt.err)
+			if failure.Class != tt.wantClass || failure.Retryable != tt.wantRetryable {
+				t.Fatalf("got %s (retryable %v), want %s (retryable %v)", failure.Class, failure.Retryable, tt.wantClass, tt.wantRetryable)
+			}
+			if failure.Message != tt.err.Error() {
+				t.Fatalf("got message %q, want %q", failure.Message, tt.err.Error())
+			}
+			if failure.FailedAt.IsZero() {
+				t.Fatal("failure time is not set")
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		retry int
+		want  time.Duration
+	}{
+		{retry: 0, want: 30 * time.Second},
+		{retry: 1, want: 30 * time.Second},
+		{retry: 2, want: time.Minute},
+		{retry: 3, want: 2 * time.Minute},
+		{retry: 5, want: 8 * time.Minute},
+		{retry: 6, want: 15 * time.Minute},
+		{retry: 50, want: 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("retry %d", tt.retry), func(t *testing.T) {
+			if got := RetryBackoff(tt.retry); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobMaxRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxRetries int
+		want       int
+	}{
+		{name: "default", want: DefaultJobMaxRetries},
+		{name: "configured", maxRetries: 5, want: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &apitypes.Job{Config: apitypes.JobConfig{MaxRetries: tt.maxRetries}}
+			if got := jobMaxRetries(job); got != tt.want {
+				t.Fatalf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,466 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/listbackup/api/internal/database"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// Searchable record fields
+const (
+	SearchFieldID    = "id"
+	SearchFieldEmail = "email"
+	SearchFieldName  = "name"
+)
+
+const searchSnapshotIndex = "SnapshotIndex"
+
+// maxSearchTermPages bounds how many pages of index entries one search term reads
+const maxSearchTermPages = 5
+
+// searchNameFields are the record fields, lowercased, treated as part of a person's name
+var searchNameFields = map[string]bool{
+	"name": true, "full_name": true, "fullname": true, "display_name": true, "displayname": true,
+	"first_name": true, "firstname": true, "given_name": true, "givenname": true,
+	"last_name": true, "lastname": true, "family_name": true, "familyname": true,
+}
+
+// SearchService indexes backed up records as snapshots are written and finds them again.
+// Terms are stored as HMACs keyed with the account's masking key, so the index does not
+// reveal the values it was built from.
+type SearchService struct {
+	db        *database.DynamoDBClient
+	snapshots *SnapshotService
+	masking   *MaskingService
+}
+
+// SearchQuery describes a record search. An empty Field searches email for values that
+// look like an address and id and name otherwise.
+type SearchQuery struct {
+	Query      string
+	Field      string // id|email|name
+	SourceID   string
+	SnapshotID string
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+}
+
+// SearchResult is one matching record and where it was backed up
+type SearchResult struct {
+	Record       json.RawMessage `json:"record"`
+	RecordID     string          `json:"recordId,omitempty"`
+	MatchedField string          `json:"matchedField"`
+	Endpoint     string          `json:"endpoint"`
+	SourceID     string          `json:"sourceId"`
+	SnapshotID   string          `json:"snapshotId"`
+	FileID       string          `json:"fileId"`
+	Path         string          `json:"path"`
+	BackedUpAt   time.Time       `json:"backedUpAt"`
+}
+
+// NewSearchService creates a new search service
+func NewSearchService(ctx context.Context) (*SearchService, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	snapshots, err := NewSnapshotService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	masking, err := NewMaskingService()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SearchService{db: db, snapshots: snapshots, masking: masking}, nil
+}
+
+// IndexRecords adds the id, email and name values of every record in an endpoint payload to
+// the search index. Fields are recognised by the endpoint's ResponseMapping. Indexing is
+// skipped when no search index table is configured.
+func (s *SearchService) IndexRecords(ctx context.Context, file *apitypes.File, mapping apitypes.ResponseMapping, data []byte) (int, error) {
+	if database.SearchIndexTable == "" {
+		return 0, nil
+	}
+
+	var records []map[string]interface{}
+	if err := json.Unmarshal(data, &records); err != nil {
+		// Only arrays of objects carry searchable records
+		return 0, nil
+	}
+
+	termKey, err := s.masking.accountKey(ctx, file.AccountID)
+	if err != nil {
+		return 0, err
+	}
+
+	idField := mapping.IDField
+	if idField == "" {
+		idField = "id"
+	}
+
+	var entries []interface{}
+	for i, record := range records {
+		recordID := ""
+		if ids := searchValues(record[idField]); len(ids) > 0 {
+			recordID = ids[0]
+		}
+
+		seen := map[string]bool{}
+		for key, value := range record {
+			field := searchFieldFor(key, idField, mapping.FieldMappings)
+			if field == "" {
+				continue
+			}
+
+			for _, term := range searchTerms(field, value) {
+				hashed := searchTerm(termKey, field, term)
+				if seen[hashed] {
+					continue
+				}
+				seen[hashed] = true
+
+				entries = append(entries, fixedTimeItem{apitypes.SearchIndexEntry{
+					Term:        hashed,
+					Ref:         fmt.Sprintf("%s#%s#%d", file.SnapshotID, file.FileID, i),
+					AccountID:   file.AccountID,
+					SourceID:    file.SourceID,
+					SnapshotID:  file.SnapshotID,
+					FileID:      file.FileID,
+					Endpoint:    file.Endpoint,
+					Field:       field,
+					RecordID:    recordID,
+					RecordIndex: i,
+					CreatedAt:   file.CreatedAt.UTC(),
+				}})
+			}
+		}
+	}
+
+	if err := s.db.BatchPutItems(ctx, database.SearchIndexTable, entries); err != nil {
+		return 0, fmt.Errorf("failed to index %s: %v", file.FileID, err)
+	}
+
+	return len(entries), nil
+}
+
+// Search returns the newest records of an account matching the query, up to query.Limit.
+// truncated is true when a term matched more index entries than a search reads, so older
+// matches may be missing.
+func (s *SearchService) Search(ctx context.Context, accountID string, query SearchQuery) ([]SearchResult, bool, error) {
+	if database.SearchIndexTable == "" {
+		return nil, false, fmt.Errorf("search is not enabled")
+	}
+
+	fields := []string{query.Field}
+	if query.Field == "" {
+		fields = []string{SearchFieldID, SearchFieldName}
+		if strings.Contains(query.Query, "@") {
+			fields = []string{SearchFieldEmail}
+		}
+	}
+
+	matches := map[string]apitypes.SearchIndexEntry{}
+	truncated := false
+	for _, field := range fields {
+		entries, fieldTruncated, err := s.lookup(ctx, accountID, field, query)
+		if err != nil {
+			return nil, false, err
+		}
+		truncated = truncated || fieldTruncated
+		for _, entry := range entries {
+			matches[entry.Ref] = entry
+		}
+	}
+
+	entries := make([]apitypes.SearchIndexEntry, 0, len(matches))
+	for _, entry := range matches {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.After(entries[j].CreatedAt)
+		}
+		return entries[i].Ref < entries[j].Ref
+	})
+	if query.Limit > 0 && len(entries) > query.Limit {
+		entries = entries[:query.Limit]
+	}
+
+	return s.loadResults(ctx, accountID, entries), truncated, nil
+}
+
+// lookup finds the entries matching every term of the query in one field
+func (s *SearchService) lookup(ctx context.Context, accountID, field string, query SearchQuery) ([]apitypes.SearchIndexEntry, bool, error) {
+	terms := searchTerms(field, query.Query)
+	if len(terms) == 0 {
+		return nil, false, nil
+	}
+
+	termKey, err := s.masking.accountKey(ctx, accountID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	truncated := false
+	var matched map[string]apitypes.SearchIndexEntry
+	for i, term := range terms {
+		entries, termTruncated, err := s.queryTerm(ctx, accountID, searchTerm(termKey, field, term), query)
+		if err != nil {
+			return nil, false, err
+		}
+		truncated = truncated || termTruncated
+
+		found := map[string]apitypes.SearchIndexEntry{}
+		for _, entry := range entries {
+			if _, ok := matched[entry.Ref]; i == 0 || ok {
+				found[entry.Ref] = entry
+			}
+		}
+		matched = found
+		if len(matched) == 0 {
+			break
+		}
+	}
+
+	entries := make([]apitypes.SearchIndexEntry, 0, len(matched))
+	for _, entry := range matched {
+		entries = append(entries, entry)
+	}
+	return entries, truncated, nil
+}
+
+// queryTerm reads the index entries of one term, up to maxSearchTermPages pages. It reports
+// whether entries were left unread.
+func (s *SearchService) queryTerm(ctx context.Context, accountID, term string, query SearchQuery) ([]apitypes.SearchIndexEntry, bool, error) {
+	pageQuery := database.PageQuery{
+		KeyCondition: "term = :term",
+		Values: map[string]interface{}{
+			":term":      term,
+			":accountId": accountID,
+		},
+	}
+	filters := []string{"accountId = :accountId"}
+
+	if query.SourceID != "" {
+		pageQuery.Values[":sourceId"] = withPrefix(query.SourceID, "source:")
+		filters = append(filters, "sourceId = :sourceId")
+	}
+	if query.SnapshotID != "" {
+		pageQuery.Values[":snapshotId"] = withPrefix(query.SnapshotID, "snapshot:")
+		filters = append(filters, "snapshotId = :snapshotId")
+	}
+	if condition := createdAtCondition(query.From, query.To, pageQuery.Values); condition != "" {
+		filters = append(filters, condition)
+	}
+	pageQuery.FilterExpression = strings.Join(filters, " AND ")
+
+	var entries []apitypes.SearchIndexEntry
+	for pages := 0; pages < maxSearchTermPages; pages++ {
+		var page []apitypes.SearchIndexEntry
+		nextToken, err := s.db.QueryPage(ctx, database.SearchIndexTable, pageQuery, &page)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to search index: %v", err)
+		}
+		entries = append(entries, page...)
+
+		if nextToken == "" {
+			return entries, false, nil
+		}
+		pageQuery.NextToken = nextToken
+	}
+
+	return entries, true, nil
+}
+
+// loadResults reads each matching record back out of its backed up file. Files that have
+// since been pruned are skipped.
+func (s *SearchService) loadResults(ctx context.Context, accountID string, entries []apitypes.SearchIndexEntry) []SearchResult {
+	files := map[string]*apitypes.File{}
+	payloads := map[string][]json.RawMessage{}
+
+	results := []SearchResult{}
+	for _, entry := range entries {
+		file, ok := files[entry.FileID]
+		if !ok {
+			var err error
+			file, err = s.getFile(ctx, entry.FileID)
+			if err != nil {
+				log.Printf("Skipping search match in %s: %v", entry.FileID, err)
+			}
+			files[entry.FileID] = file
+		}
+		if file == nil || file.AccountID != accountID {
+			continue
+		}
+
+		records, ok := payloads[file.FileID]
+		if !ok {
+			data, err := s.snapshots.ReadFile(ctx, file)
+			if err == nil {
+				err = json.Unmarshal(data, &records)
+			}
+			if err != nil {
+				log.Printf("Failed to read records from %s: %v", file.FileID, err)
+			}
+			payloads[file.FileID] = records
+		}
+		if entry.RecordIndex >= len(records) {
+			continue
+		}
+
+		results = append(results, SearchResult{
+			Record:       records[entry.RecordIndex],
+			RecordID:     entry.RecordID,
+			MatchedField: entry.Field,
+			Endpoint:     entry.Endpoint,
+			SourceID:     entry.SourceID,
+			SnapshotID:   entry.SnapshotID,
+			FileID:       entry.FileID,
+			Path:         file.Path,
+			BackedUpAt:   entry.CreatedAt,
+		})
+	}
+
+	return results
+}
+
+func (s *SearchService) getFile(ctx context.Context, fileID string) (*apitypes.File, error) {
+	fileIDAttr, err := attributevalue.Marshal(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal fileID: %v", err)
+	}
+
+	var file apitypes.File
+	err = s.db.GetItem(ctx, database.FilesTable, map[string]types.AttributeValue{
+		"fileId": fileIDAttr,
+	}, &file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file: %v", err)
+	}
+
+	return &file, nil
+}
+
+// deleteSearchEntries removes a snapshot's records from the search index
+func deleteSearchEntries(ctx context.Context, db *database.DynamoDBClient, snapshotID string) error {
+	if database.SearchIndexTable == "" {
+		return nil
+	}
+
+	var entries []apitypes.SearchIndexEntry
+	err := db.QueryGSIAll(ctx, database.SearchIndexTable, searchSnapshotIndex, "snapshotId = :snapshotId", map[string]interface{}{
+		":snapshotId": snapshotID,
+	}, &entries)
+	if err != nil {
+		return fmt.Errorf("failed to list search entries: %v", err)
+	}
+
+	keys := make([]map[string]types.AttributeValue, 0, len(entries))
+	for _, entry := range entries {
+		keys = append(keys, map[string]types.AttributeValue{
+			"term": &types.AttributeValueMemberS{Value: entry.Term},
+			"ref":  &types.AttributeValueMemberS{Value: entry.Ref},
+		})
+	}
+
+	if err := db.BatchDeleteItems(ctx, database.SearchIndexTable, keys); err != nil {
+		return fmt.Errorf("failed to delete search entries: %v", err)
+	}
+
+	return nil
+}
+
+// searchFieldFor classifies a record field by its own name and its mapped name
+func searchFieldFor(key, idField string, mappings map[string]string) string {
+	if key == idField {
+		return SearchFieldID
+	}
+
+	for _, name := range []string{key, mappings[key]} {
+		name = strings.ToLower(name)
+		switch {
+		case name == "":
+		case strings.Contains(name, "email"):
+			return SearchFieldEmail
+		case searchNameFields[name]:
+			return SearchFieldName
+		}
+	}
+	return ""
+}
+
+// searchTerms normalizes a value into the terms stored for a field. Names are split into
+// words so any part of a name matches.
+func searchTerms(field string, value interface{}) []string {
+	var terms []string
+	for _, v := range searchValues(value) {
+		v = strings.ToLower(strings.TrimSpace(v))
+		switch field {
+		case SearchFieldEmail:
+			if strings.Contains(v, "@") {
+				terms = append(terms, v)
+			}
+		case SearchFieldName:
+			for _, word := range strings.Fields(v) {
+				if word = strings.Trim(word, ".,;:'\"()"); word != "" {
+					terms = append(terms, word)
+				}
+			}
+		default:
+			if v != "" {
+				terms = append(terms, v)
+			}
+		}
+	}
+	return terms
+}
+
+// searchValues flattens strings and numbers out of a JSON value, including lists and
+// nested objects such as [{"email": "..."}]
+func searchValues(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			values = append(values, searchValues(item)...)
+		}
+		return values
+	case map[string]interface{}:
+		var values []string
+		for _, item := range v {
+			values = append(values, searchValues(item)...)
+		}
+		return values
+	}
+	return nil
+}
+
+// searchTerm returns the stored form of a term. Keying the hash per account keeps values
+// from being found by hashing guesses.
+func searchTerm(key []byte, field, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(field + "|" + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
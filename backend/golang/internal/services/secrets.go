@@ -89,6 +89,21 @@ func (s *SecretsService) StoreSecret(ctx context.Context, secretName string, sec
 	return nil
 }
 
+// CreateSecret creates a secret, failing if one with the name already exists
+func (s *SecretsService) CreateSecret(ctx context.Context, secretName string, secretValue string) error {
+	log.Printf("Creating secret: %s", secretName)
+
+	_, err := s.client.CreateSecret(ctx, &secretsmanager.CreateSecretInput{
+		Name:         aws.String(secretName),
+		SecretString: aws.String(secretValue),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create secret %s: %w", secretName, err)
+	}
+
+	return nil
+}
+
 // StoreJSONSecret marshals and stores a JSON secret
 func (s *SecretsService) StoreJSONSecret(ctx context.Context, secretName string, secretValue interface{}) error {
 	jsonBytes, err := json.Marshal(secretValue)
@@ -97,4 +112,19 @@ func (s *SecretsService) StoreJSONSecret(ctx context.Context, secretName string,
 	}
 
 	return s.StoreSecret(ctx, secretName, string(jsonBytes))
-}
\ No newline at end of file
+}
+
+// DeleteSecret schedules a secret for deletion after the minimum recovery window
+func (s *SecretsService) DeleteSecret(ctx context.Context, secretName string) error {
+	log.Printf("Deleting secret: %s", secretName)
+
+	_, err := s.client.DeleteSecret(ctx, &secretsmanager.DeleteSecretInput{
+		SecretId:             aws.String(secretName),
+		RecoveryWindowInDays: aws.Int64(7),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete secret %s: %w", secretName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/listbackup/api/internal/database"
+)
+
+const (
+	// connectionLeaseDuration outlives the longest Lambda invocation, so a slot held by an
+	// invocation that died without releasing it frees itself
+	connectionLeaseDuration = 15 * time.Minute
+	semaphoreWaitMin        = 250 * time.Millisecond
+	semaphoreWaitMax        = 5 * time.Second
+)
+
+// ConnectionSemaphore bounds the fetches running against one platform connection across
+// every Lambda invocation. Each slot is a lease recorded on the connection's item in the
+// connection leases table.
+type ConnectionSemaphore struct {
+	db           *database.DynamoDBClient
+	connectionID string
+	limit        int
+}
+
+type connectionLeases struct {
+	ConnectionID string           `dynamodbav:"connectionId"`
+	Leases       map[string]int64 `dynamodbav:"leases"`
+	TTL          int64            `dynamodbav:"ttl"`
+}
+
+// NewConnectionSemaphore creates a semaphore allowing limit concurrent holders per connection
+func NewConnectionSemaphore(db *database.DynamoDBClient, connectionID string, limit int) *ConnectionSemaphore {
+	if limit < 1 {
+		limit = 1
+	}
+	return &ConnectionSemaphore{db: db, connectionID: connectionID, limit: limit}
+}
+
+// Acquire waits until a slot is free and takes it. The returned function releases the
+// slot. Waiting ends with an error when ctx is done.
+func (s *ConnectionSemaphore) Acquire(ctx context.Context) (func(), error) {
+	leaseID := uuid.New().String()
+	wait := semaphoreWaitMin
+	for {
+		acquired, err := s.tryAcquire(ctx, leaseID)
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			return func() { s.release(leaseID) }, nil
+		}
+
+		freed, err := s.reapExpired(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if freed {
+			continue
+		}
+
+		// Jitter keeps waiting invocations from retrying in lockstep
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timed out waiting for a free slot on connection %s: %w", s.connectionID, ctx.Err())
+		case <-time.After(wait/2 + time.Duration(rand.Int63n(int64(wait)))):
+		}
+		if wait *= 2; wait > semaphoreWaitMax {
+			wait = semaphoreWaitMax
+		}
+	}
+}
+
+// tryAcquire adds the lease if fewer than limit are held. It reports false when the
+// connection is full or has no leases item yet.
+func (s *ConnectionSemaphore) tryAcquire(ctx context.Context, leaseID string) (bool, error) {
+	now := time.Now()
+	expires := now.Add(connectionLeaseDuration)
+	values, err := attributevalue.MarshalMap(map[string]interface{}{
+		":expires": expires.Unix(),
+		":ttl":     expires.Add(time.Hour).Unix(),
+		":limit":   s.limit,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal connection lease: %v", err)
+	}
+
+	err = s.db.TransactWrite(ctx, []types.TransactWriteItem{{Update: &types.Update{
+		TableName:                 aws.String(database.ConnectionLeasesTable),
+		Key:                       map[string]types.AttributeValue{"connectionId": &types.AttributeValueMemberS{Value: s.connectionID}},
+		UpdateExpression:          aws.String("SET leases.#lease = :expires, #ttl = :ttl"),
+		ConditionExpression:       aws.String("attribute_exists(leases) AND size(leases) < :limit"),
+		ExpressionAttributeNames:  map[string]string{"#lease": leaseID, "#ttl": "ttl"},
+		ExpressionAttributeValues: values,
+	}}})
+	if err != nil {
+		if database.ConditionFailed(err, 0) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to acquire connection lease: %v", err)
+	}
+	return true, nil
+}
+
+// reapExpired removes leases whose holders stopped without releasing them, creating the
+// connection's leases item if it does not exist yet. It reports whether a slot may have
+// been freed.
+func (s *ConnectionSemaphore) reapExpired(ctx context.Context) (bool, error) {
+	key := map[string]types.AttributeValue{"connectionId": &types.AttributeValueMemberS{Value: s.connectionID}}
+
+	var item connectionLeases
+	if err := s.db.GetItem(ctx, database.ConnectionLeasesTable, key, &item); err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return s.createLeases(ctx)
+		}
+		return false, fmt.Errorf("failed to get connection leases: %v", err)
+	}
+
+	now := time.Now().Unix()
+	var expired []string
+	names := map[string]string{}
+	for leaseID, expires := range item.Leases {
+		if expires > now {
+			continue
+		}
+		name := fmt.Sprintf("#l%d", len(expired))
+		names[name] = leaseID
+		expired = append(expired, "leases."+name)
+	}
+	if len(expired) == 0 {
+		return false, nil
+	}
+
+	err := s.db.UpdateItemWithNames(ctx, database.ConnectionLeasesTable, key, "REMOVE "+strings.Join(expired, ", "), nil, names)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove expired connection leases: %v", err)
+	}
+	log.Printf("Removed %d expired leases on connection %s", len(expired), s.connectionID)
+	return true, nil
+}
+
+// createLeases creates the connection's leases item. Losing the race to another
+// invocation is fine, the item exists either way.
+func (s *ConnectionSemaphore) createLeases(ctx context.Context) (bool, error) {
+	item, err := attributevalue.MarshalMap(connectionLeases{
+		ConnectionID: s.connectionID,
+		Leases:       map[string]int64{},
+		TTL:          time.Now().Add(connectionLeaseDuration + time.Hour).Unix(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal connection leases: %v", err)
+	}
+
+	err = s.db.TransactWrite(ctx, []types.TransactWriteItem{{Put: &types.Put{
+		TableName:           aws.String(database.ConnectionLeasesTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(connectionId)"),
+	}}})
+	if err != nil && !database.ConditionFailed(err, 0) {
+		return false, fmt.Errorf("failed to create connection leases: %v", err)
+	}
+	return true, nil
+}
+
+// release gives the slot back. It runs on its own context so a cancelled job still frees
+// its slots; a failure only delays the slot until the lease expires.
+func (s *ConnectionSemaphore) release(leaseID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := s.db.UpdateItemWithNames(ctx, database.ConnectionLeasesTable, map[string]types.AttributeValue{
+		"connectionId": &types.AttributeValueMemberS{Value: s.connectionID},
+	}, "REMOVE leases.#lease", nil, map[string]string{"#lease": leaseID})
+	if err != nil {
+		log.Printf("Failed to release lease %s on connection %s: %v", leaseID, s.connectionID, err)
+	}
+}
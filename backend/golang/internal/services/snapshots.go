@@ -0,0 +1,913 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/uuid"
+	"github.com/listbackup/api/internal/compression"
+	"github.com/listbackup/api/internal/database"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// ErrObjectMissing is returned when a snapshot object is no longer in the bucket
+var ErrObjectMissing = errors.New("snapshot object is missing")
+
+// ErrSnapshotNotResumable is returned when a snapshot has already finished and can no
+// longer be written to
+var ErrSnapshotNotResumable = errors.New("snapshot cannot be resumed")
+
+// ErrObjectArchived is returned when a snapshot object is in the archive tier and has no
+// restored copy to read
+var ErrObjectArchived = errors.New("snapshot object is archived")
+
+// SnapshotService stores backup snapshots in S3 and tracks them in DynamoDB
+type SnapshotService struct {
+	db         *database.DynamoDBClient
+	s3Client   *s3.Client
+	bucket     string
+	objectLock bool // Bucket was created with S3 Object Lock enabled
+	encryption *EncryptionService
+}
+
+// SnapshotWriter writes the objects of a single in-progress snapshot
+type SnapshotWriter struct {
+	service   *SnapshotService
+	snapshot  *apitypes.Snapshot
+	dataKey   []byte
+	codec     string
+	legalHold bool
+	mu        sync.Mutex // Guards the manifest while objects are written concurrently
+}
+
+// NewSnapshotService creates a new snapshot service
+func NewSnapshotService(ctx context.Context) (*SnapshotService, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %v", err)
+	}
+
+	encryption, err := NewEncryptionServiceFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create encryption service: %v", err)
+	}
+
+	bucket := os.Getenv("S3_BUCKET")
+	if bucket == "" {
+		bucket = "listbackup-data-main" // fallback
+	}
+
+	return &SnapshotService{
+		db:         db,
+		s3Client:   s3.NewFromConfig(cfg),
+		bucket:     bucket,
+		objectLock: os.Getenv("S3_OBJECT_LOCK_ENABLED") == "true",
+		encryption: encryption,
+	}, nil
+}
+
+// BeginSnapshot starts a new snapshot for a job, recording the masking rules its records
+// are stored with. When the account has encryption enabled a fresh data key is generated
+// and wrapped with the account's key-encryption key.
+func (s *SnapshotService) BeginSnapshot(ctx context.Context, account *apitypes.Account, job *apitypes.Job, masking []apitypes.MaskingRule) (*SnapshotWriter, error) {
+	now := time.Now()
+	snapshot := &apitypes.Snapshot{
+		SnapshotID: "snapshot:" + uuid.New().String(),
+		AccountID:  job.AccountID,
+		SourceID:   job.SourceID,
+		JobID:      job.JobID,
+		Status:     "running",
+		Manifest:   apitypes.SnapshotManifest{Objects: []apitypes.SnapshotObject{}, Masking: masking},
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	writer := &SnapshotWriter{
+		service:  s,
+		snapshot: snapshot,
+		codec:    compression.Resolve(account.Settings.Compression),
+	}
+
+	if account.Settings.EncryptionEnabled {
+		keyID, err := s.ensureAccountKey(ctx, account)
+		if err != nil {
+			return nil, err
+		}
+
+		dataKey, enc, err := s.encryption.NewSnapshotKey(ctx, keyID, snapshot.AccountID, snapshot.SnapshotID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create snapshot data key: %v", err)
+		}
+		writer.dataKey = dataKey
+		snapshot.Manifest.Encryption = enc
+	}
+
+	if err := s.db.PutItem(ctx, database.SnapshotsTable, snapshot); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot: %v", err)
+	}
+
+	return writer, nil
+}
+
+// Snapshot returns the snapshot being written
+func (w *SnapshotWriter) Snapshot() *apitypes.Snapshot {
+	return w.snapshot
+}
+
+// HoldObjects writes every subsequent object with an S3 Object Lock legal hold, for
+// snapshots of sources or accounts that are already under legal hold
+func (w *SnapshotWriter) HoldObjects() {
+	w.legalHold = true
+}
+
+// WriteObject stores the data fetched from one endpoint and records it in the Files table.
+// It may be called concurrently for different endpoints.
+func (w *SnapshotWriter) WriteObject(ctx context.Context, endpoint string, data []byte, records int64) (*apitypes.File, error) {
+	s := w.service
+	snapshot := w.snapshot
+
+	s3Key := fmt.Sprintf("%s/%s/%s/%s.json",
+		strings.TrimPrefix(snapshot.AccountID, "account:"),
+		strings.TrimPrefix(snapshot.SourceID, "source:"),
+		strings.TrimPrefix(snapshot.SnapshotID, "snapshot:"),
+		endpoint)
+
+	// Compress before encrypting, since ciphertext does not compress
+	body, err := compression.Compress(w.codec, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress %s: %v", endpoint, err)
+	}
+	if w.dataKey != nil {
+		sealed, err := s.encryption.EncryptObject(w.dataKey, s3Key, body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt %s: %v", endpoint, err)
+		}
+		body = sealed
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s3Key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	}
+	// Plain compressed objects can then be served from a presigned URL as they are
+	if encoding := compression.ContentEncoding(w.codec); encoding != "" && w.dataKey == nil {
+		input.ContentEncoding = aws.String(encoding)
+	}
+	if w.legalHold && s.objectLock {
+		input.ObjectLockLegalHoldStatus = s3types.ObjectLockLegalHoldStatusOn
+	}
+
+	_, err = s.s3Client.PutObject(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload %s: %v", s3Key, err)
+	}
+
+	file := &apitypes.File{
+		FileID:      "file:" + uuid.New().String(),
+		AccountID:   snapshot.AccountID,
+		SourceID:    snapshot.SourceID,
+		JobID:       snapshot.JobID,
+		SnapshotID:  snapshot.SnapshotID,
+		Endpoint:    endpoint,
+		Path:        endpoint + ".json",
+		Size:        int64(len(data)),
+		ContentType: "application/json",
+		S3Key:       s3Key,
+		Encrypted:   w.dataKey != nil,
+		Codec:       w.codec,
+		StoredSize:  int64(len(body)),
+		StorageTier: StorageTierStandard,
+		CreatedAt:   time.Now(),
+	}
+
+	if err := s.db.PutItem(ctx, database.FilesTable, fixedTimeItem{file}); err != nil {
+		return nil, fmt.Errorf("failed to record file: %v", err)
+	}
+
+	checksum := sha256.Sum256(data)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	snapshot.Manifest.Objects = append(snapshot.Manifest.Objects, apitypes.SnapshotObject{
+		Endpoint:   endpoint,
+		FileID:     file.FileID,
+		S3Key:      s3Key,
+		Records:    records,
+		Size:       file.Size,
+		SHA256:     hex.EncodeToString(checksum[:]),
+		Codec:      w.codec,
+		StoredSize: file.StoredSize,
+	})
+	snapshot.Manifest.TotalRecords += records
+	snapshot.Manifest.TotalBytes += file.Size
+	snapshot.Manifest.StoredBytes += file.StoredSize
+
+	return file, nil
+}
+
+// Complete marks the snapshot as completed and persists its manifest
+func (w *SnapshotWriter) Complete(ctx context.Context) (*apitypes.Snapshot, error) {
+	return w.finish(ctx, "completed")
+}
+
+// Fail marks the snapshot as failed, keeping whatever objects were written
+func (w *SnapshotWriter) Fail(ctx context.Context) (*apitypes.Snapshot, error) {
+	return w.finish(ctx, "failed")
+}
+
+func (w *SnapshotWriter) finish(ctx context.Context, status string) (*apitypes.Snapshot, error) {
+	now := time.Now()
+	w.snapshot.Status = status
+	w.snapshot.UpdatedAt = now
+	w.snapshot.CompletedAt = &now
+
+	if err := w.service.saveSnapshot(ctx, w.snapshot); err != nil {
+		return nil, fmt.Errorf("failed to save snapshot: %v", err)
+	}
+
+	return w.snapshot, nil
+}
+
+// Pause marks the snapshot as paused and persists its manifest so a later run can resume it
+func (w *SnapshotWriter) Pause(ctx context.Context) error {
+	w.snapshot.Status = "paused"
+	return w.Save(ctx)
+}
+
+// Cancel marks the snapshot as cancelled, keeping whatever objects were written
+func (w *SnapshotWriter) Cancel(ctx context.Context) (*apitypes.Snapshot, error) {
+	return w.finish(ctx, "cancelled")
+}
+
+// Save persists the manifest of the in-progress snapshot, so objects written so far are
+// known to a run that resumes it
+func (w *SnapshotWriter) Save(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.snapshot.UpdatedAt = time.Now()
+	if err := w.service.saveSnapshot(ctx, w.snapshot); err != nil {
+		return fmt.Errorf("failed to save snapshot: %v", err)
+	}
+	return nil
+}
+
+// ResumeSnapshot reopens an unfinished snapshot of a job for writing. Failed snapshots can
+// be resumed too; their objects stop counting towards storage until the snapshot finishes again.
+func (s *SnapshotService) ResumeSnapshot(ctx context.Context, account *apitypes.Account, job *apitypes.Job, snapshotID string) (*SnapshotWriter, error) {
+	snapshot, err := s.GetSnapshot(ctx, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.AccountID != job.AccountID || snapshot.SourceID != job.SourceID {
+		return nil, fmt.Errorf("snapshot %s does not belong to source %s", snapshotID, job.SourceID)
+	}
+	if snapshot.Status != "running" && snapshot.Status != "paused" && snapshot.Status != "failed" {
+		return nil, fmt.Errorf("%w: snapshot %s is %s", ErrSnapshotNotResumable, snapshotID, snapshot.Status)
+	}
+
+	writer := &SnapshotWriter{
+		service:  s,
+		snapshot: snapshot,
+		codec:    compression.Resolve(account.Settings.Compression),
+	}
+	if snapshot.Manifest.Encryption != nil {
+		dataKey, err := s.snapshotDataKey(ctx, snapshot)
+		if err != nil {
+			return nil, err
+		}
+		writer.dataKey = dataKey
+	}
+
+	snapshot.Status = "running"
+	snapshot.CompletedAt = nil
+	if err := writer.Save(ctx); err != nil {
+		return nil, err
+	}
+
+	return writer, nil
+}
+
+// StagePart stores pages fetched from an endpoint that has not finished yet and returns
+// the part's key. Parts are encrypted like the snapshot's objects but not compressed,
+// since they only live until the endpoint completes.
+func (w *SnapshotWriter) StagePart(ctx context.Context, endpoint string, part int, records []json.RawMessage) (string, error) {
+	s := w.service
+	s3Key := fmt.Sprintf("%s%s/%05d.json", partsPrefix(w.snapshot), endpoint, part)
+
+	body, err := json.Marshal(records)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal %s part %d: %v", endpoint, part, err)
+	}
+	if w.dataKey != nil {
+		body, err = s.encryption.EncryptObject(w.dataKey, s3Key, body)
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt %s part %d: %v", endpoint, part, err)
+		}
+	}
+
+	_, err = s.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s3Key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload %s: %v", s3Key, err)
+	}
+	return s3Key, nil
+}
+
+// partsPrefix is the key prefix a snapshot's staged parts are stored under
+func partsPrefix(snapshot *apitypes.Snapshot) string {
+	return fmt.Sprintf("%s/%s/%s/parts/",
+		strings.TrimPrefix(snapshot.AccountID, "account:"),
+		strings.TrimPrefix(snapshot.SourceID, "source:"),
+		strings.TrimPrefix(snapshot.SnapshotID, "snapshot:"))
+}
+
+// downloadsPrefix is the key prefix the decrypted copies of a file staged for download are
+// stored under
+func downloadsPrefix(fileID string) string {
+	return fmt.Sprintf("downloads/%s/", displayID(fileID))
+}
+
+// ReadParts returns the records of staged parts in order
+func (w *SnapshotWriter) ReadParts(ctx context.Context, keys []string) ([]json.RawMessage, error) {
+	var records []json.RawMessage
+	for _, key := range keys {
+		body, err := w.service.downloadObject(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if w.dataKey != nil {
+			body, err = w.service.encryption.DecryptObject(w.dataKey, key, body)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt %s: %v", key, err)
+			}
+		}
+
+		var part []json.RawMessage
+		if err := json.Unmarshal(body, &part); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", key, err)
+		}
+		records = append(records, part...)
+	}
+	return records, nil
+}
+
+// DeleteParts removes staged parts once they are no longer needed. Failures are only
+// logged; a leftover part is never read again.
+func (s *SnapshotService) DeleteParts(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		_, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			log.Printf("Failed to delete staged part %s: %v", key, err)
+		}
+	}
+}
+
+// CancelSnapshot marks an unfinished snapshot that no job is writing to as cancelled and
+// removes its staged parts
+func (s *SnapshotService) CancelSnapshot(ctx context.Context, snapshotID string, parts []string) error {
+	snapshot, err := s.GetSnapshot(ctx, snapshotID)
+	if err != nil {
+		return err
+	}
+	s.DeleteParts(ctx, parts)
+
+	switch snapshot.Status {
+	case "running", "paused":
+		writer := &SnapshotWriter{service: s, snapshot: snapshot}
+		_, err = writer.Cancel(ctx)
+		return err
+	case "failed":
+		// Already finished and counted towards storage
+		now := time.Now()
+		snapshot.Status = "cancelled"
+		snapshot.UpdatedAt = now
+		if err := s.saveSnapshot(ctx, snapshot); err != nil {
+			return fmt.Errorf("failed to save snapshot: %v", err)
+		}
+	}
+	return nil
+}
+
+// saveSnapshot writes back a snapshot that was read or begun earlier. RotateAccountKey may
+// rewrap the data key of an encrypted snapshot in the meantime, so the write only
+// replaces a snapshot still wrapped with the key it was read with; otherwise it takes
+// the rewrapped key and tries again. The data key itself does not change.
+func (s *SnapshotService) saveSnapshot(ctx context.Context, snapshot *apitypes.Snapshot) error {
+	for {
+		enc := snapshot.Manifest.Encryption
+		if enc == nil {
+			return s.db.PutItem(ctx, database.SnapshotsTable, snapshot)
+		}
+
+		keyIDAttr, err := attributevalue.Marshal(enc.KeyID)
+		if err != nil {
+			return fmt.Errorf("failed to marshal key ID: %v", err)
+		}
+		err = s.db.PutItemWithCondition(ctx, database.SnapshotsTable, snapshot, "manifest.encryption.keyId = :keyId",
+			map[string]types.AttributeValue{":keyId": keyIDAttr})
+		if !database.ConditionFailed(err, -1) {
+			return err
+		}
+
+		current, err := s.GetSnapshot(ctx, snapshot.SnapshotID)
+		if err != nil {
+			return err
+		}
+		if current.Manifest.Encryption == nil {
+			return fmt.Errorf("snapshot %s lost its encryption metadata", snapshot.SnapshotID)
+		}
+		snapshot.Manifest.Encryption = current.Manifest.Encryption
+	}
+}
+
+// GetSnapshot retrieves a snapshot by ID
+func (s *SnapshotService) GetSnapshot(ctx context.Context, snapshotID string) (*apitypes.Snapshot, error) {
+	if !strings.HasPrefix(snapshotID, "snapshot:") {
+		snapshotID = "snapshot:" + snapshotID
+	}
+
+	snapshotIDAttr, err := attributevalue.Marshal(snapshotID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal snapshotID: %v", err)
+	}
+
+	var snapshot apitypes.Snapshot
+	err = s.db.GetItem(ctx, database.SnapshotsTable, map[string]types.AttributeValue{
+		"snapshotId": snapshotIDAttr,
+	}, &snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot: %w", err)
+	}
+
+	return &snapshot, nil
+}
+
+// ListAccountSnapshots returns every snapshot belonging to an account
+func (s *SnapshotService) ListAccountSnapshots(ctx context.Context, accountID string) ([]apitypes.Snapshot, error) {
+	var snapshots []apitypes.Snapshot
+	err := s.db.QueryGSIAll(ctx, database.SnapshotsTable, "AccountIndex", "accountId = :accountId", map[string]interface{}{
+		":accountId": accountID,
+	}, &snapshots)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %v", err)
+	}
+
+	return snapshots, nil
+}
+
+// ListSourceSnapshots returns every snapshot of a source, oldest first
+func (s *SnapshotService) ListSourceSnapshots(ctx context.Context, sourceID string) ([]apitypes.Snapshot, error) {
+	var snapshots []apitypes.Snapshot
+	err := s.db.QueryGSIAll(ctx, database.SnapshotsTable, "SourceTimeIndex", "sourceId = :sourceId", map[string]interface{}{
+		":sourceId": sourceID,
+	}, &snapshots)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %v", err)
+	}
+
+	return snapshots, nil
+}
+
+// DeleteSnapshot removes a snapshot's S3 objects, staged parts, download copies, File rows
+// and search entries and finally the snapshot itself. The snapshot row goes last so a partial failure can be
+// retried from the manifest. It returns the objects deleted and the bytes of staged parts
+// freed, which the manifest does not count.
+func (s *SnapshotService) DeleteSnapshot(ctx context.Context, snapshot *apitypes.Snapshot) (int, int64, error) {
+	if isHeld(snapshot.LegalHold) {
+		return 0, 0, fmt.Errorf("snapshot %s is under legal hold", snapshot.SnapshotID)
+	}
+
+	deleted := 0
+
+	for _, object := range snapshot.Manifest.Objects {
+		if err := s.deleteObjectVersions(ctx, object.S3Key); err != nil {
+			return deleted, 0, err
+		}
+
+		if object.FileID != "" {
+			if _, _, err := s.deleteVersions(ctx, downloadsPrefix(object.FileID), false); err != nil {
+				return deleted, 0, err
+			}
+			if err := s.deleteFileRecord(ctx, object.FileID); err != nil {
+				return deleted, 0, err
+			}
+		}
+		deleted++
+	}
+
+	// Parts left behind by a paused or failed backup are not in the manifest
+	parts, partBytes, err := s.deleteVersions(ctx, partsPrefix(snapshot), false)
+	deleted += parts
+	if err != nil {
+		return deleted, partBytes, err
+	}
+
+	if err := deleteSearchEntries(ctx, s.db, snapshot.SnapshotID); err != nil {
+		return deleted, partBytes, err
+	}
+
+	snapshotIDAttr, err := attributevalue.Marshal(snapshot.SnapshotID)
+	if err != nil {
+		return deleted, partBytes, fmt.Errorf("failed to marshal snapshotID: %v", err)
+	}
+
+	err = s.db.DeleteItem(ctx, database.SnapshotsTable, map[string]types.AttributeValue{
+		"snapshotId": snapshotIDAttr,
+	})
+	if err != nil {
+		return deleted, partBytes, fmt.Errorf("failed to delete snapshot: %v", err)
+	}
+
+	return deleted, partBytes, nil
+}
+
+// SetObjectLegalHold turns the S3 Object Lock legal hold of every object in a snapshot on or
+// off. It does nothing when the bucket does not have Object Lock enabled.
+func (s *SnapshotService) SetObjectLegalHold(ctx context.Context, snapshot *apitypes.Snapshot, on bool) error {
+	if !s.objectLock {
+		return nil
+	}
+
+	status := s3types.ObjectLockLegalHoldStatusOff
+	if on {
+		status = s3types.ObjectLockLegalHoldStatusOn
+	}
+
+	for _, object := range snapshot.Manifest.Objects {
+		_, err := s.s3Client.PutObjectLegalHold(ctx, &s3.PutObjectLegalHoldInput{
+			Bucket:    aws.String(s.bucket),
+			Key:       aws.String(object.S3Key),
+			LegalHold: &s3types.ObjectLockLegalHold{Status: status},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to set legal hold on %s: %v", object.S3Key, err)
+		}
+	}
+
+	return nil
+}
+
+// DeleteFile removes a single backed up file, its S3 object and any copies staged for
+// download
+func (s *SnapshotService) DeleteFile(ctx context.Context, file *apitypes.File) error {
+	if err := s.deleteObjectVersions(ctx, file.S3Key); err != nil {
+		return err
+	}
+	if _, _, err := s.deleteVersions(ctx, downloadsPrefix(file.FileID), false); err != nil {
+		return err
+	}
+
+	return s.deleteFileRecord(ctx, file.FileID)
+}
+
+// deleteObjectVersions deletes every version and delete marker of an object. The bucket is
+// versioned, so a plain delete would leave the data restorable until lifecycle expires the
+// noncurrent version.
+func (s *SnapshotService) deleteObjectVersions(ctx context.Context, s3Key string) error {
+	_, _, err := s.deleteVersions(ctx, s3Key, true)
+	return err
+}
+
+// deleteVersions deletes every version and delete marker of the objects under a prefix, or
+// of the object at it when exact is set. It returns how many objects had a current version
+// and the bytes of all versions deleted.
+func (s *SnapshotService) deleteVersions(ctx context.Context, prefix string, exact bool) (int, int64, error) {
+	input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}
+	objects := 0
+	var bytes int64
+	for {
+		page, err := s.s3Client.ListObjectVersions(ctx, input)
+		if err != nil {
+			return objects, bytes, fmt.Errorf("failed to list versions of %s: %v", prefix, err)
+		}
+
+		var versions []s3types.ObjectIdentifier
+		var pageObjects int
+		var pageBytes int64
+		for _, version := range page.Versions {
+			if !exact || aws.ToString(version.Key) == prefix {
+				versions = append(versions, s3types.ObjectIdentifier{Key: version.Key, VersionId: version.VersionId})
+				if aws.ToBool(version.IsLatest) {
+					pageObjects++
+				}
+				pageBytes += aws.ToInt64(version.Size)
+			}
+		}
+		for _, marker := range page.DeleteMarkers {
+			if !exact || aws.ToString(marker.Key) == prefix {
+				versions = append(versions, s3types.ObjectIdentifier{Key: marker.Key, VersionId: marker.VersionId})
+			}
+		}
+
+		if len(versions) > 0 {
+			result, err := s.s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+				Bucket: aws.String(s.bucket),
+				Delete: &s3types.Delete{Objects: versions, Quiet: aws.Bool(true)},
+			})
+			if err != nil {
+				return objects, bytes, fmt.Errorf("failed to delete %s: %v", prefix, err)
+			}
+			if len(result.Errors) > 0 {
+				return objects, bytes, fmt.Errorf("failed to delete version %s of %s: %s", aws.ToString(result.Errors[0].VersionId), aws.ToString(result.Errors[0].Key), aws.ToString(result.Errors[0].Message))
+			}
+		}
+		objects += pageObjects
+		bytes += pageBytes
+
+		if !aws.ToBool(page.IsTruncated) {
+			return objects, bytes, nil
+		}
+		input.KeyMarker = page.NextKeyMarker
+		input.VersionIdMarker = page.NextVersionIdMarker
+	}
+}
+
+func (s *SnapshotService) deleteFileRecord(ctx context.Context, fileID string) error {
+	fileIDAttr, err := attributevalue.Marshal(fileID)
+	if err != nil {
+		return fmt.Errorf("failed to marshal fileID: %v", err)
+	}
+
+	err = s.db.DeleteItem(ctx, database.FilesTable, map[string]types.AttributeValue{
+		"fileId": fileIDAttr,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete file %s: %v", fileID, err)
+	}
+
+	return nil
+}
+
+// ReadFile returns the plaintext contents of a backed up file, decrypting and
+// decompressing it when needed
+func (s *SnapshotService) ReadFile(ctx context.Context, file *apitypes.File) ([]byte, error) {
+	data, err := s.readStoredFile(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	return compression.Decompress(file.Codec, data)
+}
+
+// readStoredFile returns a file as it was written before encryption, which is still
+// compressed with the file's codec
+func (s *SnapshotService) readStoredFile(ctx context.Context, file *apitypes.File) ([]byte, error) {
+	data, err := s.downloadObject(ctx, file.S3Key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !file.Encrypted {
+		return data, nil
+	}
+
+	snapshot, err := s.GetSnapshot(ctx, file.SnapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := s.snapshotDataKey(ctx, snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.encryption.DecryptObject(dataKey, file.S3Key, data)
+}
+
+// ReadObject returns the plaintext of one object of a snapshot's manifest
+func (s *SnapshotService) ReadObject(ctx context.Context, snapshot *apitypes.Snapshot, object apitypes.SnapshotObject) ([]byte, error) {
+	return s.ReadFile(ctx, &apitypes.File{
+		FileID:     object.FileID,
+		SnapshotID: snapshot.SnapshotID,
+		S3Key:      object.S3Key,
+		Encrypted:  snapshot.Manifest.Encryption != nil,
+		Codec:      object.Codec,
+	})
+}
+
+// openStoredFile returns a reader for a file's bytes as stored, still compressed. Plain
+// objects are streamed from S3; encrypted objects are sealed as a whole, so they are read
+// and decrypted first.
+func (s *SnapshotService) openStoredFile(ctx context.Context, file *apitypes.File) (io.ReadCloser, error) {
+	if !file.Encrypted {
+		return s.openObject(ctx, file.S3Key)
+	}
+
+	data, err := s.readStoredFile(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *SnapshotService) downloadObject(ctx context.Context, s3Key string) ([]byte, error) {
+	body, err := s.openObject(ctx, s3Key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", s3Key, err)
+	}
+	return data, nil
+}
+
+func (s *SnapshotService) openObject(ctx context.Context, s3Key string) (io.ReadCloser, error) {
+	result, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s3Key),
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrObjectMissing
+		}
+		var archived *s3types.InvalidObjectState
+		if errors.As(err, &archived) {
+			return nil, ErrObjectArchived
+		}
+		return nil, fmt.Errorf("failed to download %s: %v", s3Key, err)
+	}
+	return result.Body, nil
+}
+
+// objectReadable reports whether an object can be read now. Objects that lifecycle has
+// moved to an archive storage class can only be read while a restored copy exists.
+func (s *SnapshotService) objectReadable(ctx context.Context, s3Key string) (bool, error) {
+	head, err := s.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s3Key),
+	})
+	if err != nil {
+		var notFound *s3types.NotFound
+		if errors.As(err, &notFound) {
+			return false, ErrObjectMissing
+		}
+		return false, fmt.Errorf("failed to inspect %s: %v", s3Key, err)
+	}
+
+	switch head.StorageClass {
+	case s3types.StorageClassGlacier, s3types.StorageClassDeepArchive:
+		return head.Restore != nil && strings.Contains(*head.Restore, `ongoing-request="false"`), nil
+	}
+	return true, nil
+}
+
+// snapshotDataKey unwraps the data key of an encrypted snapshot
+func (s *SnapshotService) snapshotDataKey(ctx context.Context, snapshot *apitypes.Snapshot) ([]byte, error) {
+	if snapshot.Manifest.Encryption == nil {
+		return nil, fmt.Errorf("snapshot %s has no encryption metadata", snapshot.SnapshotID)
+	}
+	return s.encryption.OpenSnapshotKey(ctx, snapshot.AccountID, snapshot.SnapshotID, snapshot.Manifest.Encryption)
+}
+
+// RotateAccountKey provisions a new key-encryption key for an account and re-wraps every
+// snapshot data key under it. Stored objects are not rewritten. The previous key must stay
+// usable until rotation has finished. Snapshots being written are rewrapped too; their
+// writers save through saveSnapshot, which keeps the rewrapped key.
+func (s *SnapshotService) RotateAccountKey(ctx context.Context, account *apitypes.Account) (string, int, error) {
+	newKeyID, err := s.encryption.CreateAccountKey(ctx, account.AccountID)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// Switch the account first so new snapshots are wrapped with the new key
+	if err := s.setAccountKey(ctx, account.AccountID, newKeyID); err != nil {
+		return "", 0, err
+	}
+	account.Settings.EncryptionKeyID = newKeyID
+
+	snapshots, err := s.ListAccountSnapshots(ctx, account.AccountID)
+	if err != nil {
+		return newKeyID, 0, err
+	}
+
+	rewrapped := 0
+	for _, snapshot := range snapshots {
+		enc := snapshot.Manifest.Encryption
+		if enc == nil || enc.KeyID == newKeyID {
+			continue
+		}
+
+		newEnc, err := s.encryption.RewrapSnapshotKey(ctx, snapshot.AccountID, snapshot.SnapshotID, enc, newKeyID)
+		if err != nil {
+			return newKeyID, rewrapped, fmt.Errorf("failed to rewrap key for %s: %v", snapshot.SnapshotID, err)
+		}
+
+		if err := s.updateSnapshotEncryption(ctx, snapshot.SnapshotID, newEnc); err != nil {
+			return newKeyID, rewrapped, err
+		}
+		rewrapped++
+	}
+
+	log.Printf("Rotated encryption key for %s: rewrapped %d snapshot keys", account.AccountID, rewrapped)
+	return newKeyID, rewrapped, nil
+}
+
+// ensureAccountKey returns the account's KEK, provisioning one on first use
+func (s *SnapshotService) ensureAccountKey(ctx context.Context, account *apitypes.Account) (string, error) {
+	if account.Settings.EncryptionKeyID != "" {
+		return account.Settings.EncryptionKeyID, nil
+	}
+
+	keyID, err := s.encryption.CreateAccountKey(ctx, account.AccountID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.setAccountKey(ctx, account.AccountID, keyID); err != nil {
+		return "", err
+	}
+	account.Settings.EncryptionKeyID = keyID
+
+	return keyID, nil
+}
+
+func (s *SnapshotService) setAccountKey(ctx context.Context, accountID, keyID string) error {
+	accountIDAttr, err := attributevalue.Marshal(accountID)
+	if err != nil {
+		return fmt.Errorf("failed to marshal accountID: %v", err)
+	}
+	keyIDAttr, err := attributevalue.Marshal(keyID)
+	if err != nil {
+		return fmt.Errorf("failed to marshal key ID: %v", err)
+	}
+	updatedAtAttr, err := attributevalue.Marshal(time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to marshal timestamp: %v", err)
+	}
+
+	err = s.db.UpdateItem(ctx, database.AccountsTable, map[string]types.AttributeValue{
+		"accountId": accountIDAttr,
+	}, "SET settings.encryptionKeyId = :keyId, updatedAt = :updatedAt", map[string]types.AttributeValue{
+		":keyId":     keyIDAttr,
+		":updatedAt": updatedAtAttr,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save account encryption key: %v", err)
+	}
+
+	return nil
+}
+
+func (s *SnapshotService) updateSnapshotEncryption(ctx context.Context, snapshotID string, enc *apitypes.SnapshotEncryption) error {
+	snapshotIDAttr, err := attributevalue.Marshal(snapshotID)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshotID: %v", err)
+	}
+	encAttr, err := attributevalue.Marshal(enc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal encryption metadata: %v", err)
+	}
+	updatedAtAttr, err := attributevalue.Marshal(time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to marshal timestamp: %v", err)
+	}
+
+	err = s.db.UpdateItem(ctx, database.SnapshotsTable, map[string]types.AttributeValue{
+		"snapshotId": snapshotIDAttr,
+	}, "SET manifest.encryption = :enc, updatedAt = :updatedAt", map[string]types.AttributeValue{
+		":enc":       encAttr,
+		":updatedAt": updatedAtAttr,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update snapshot %s: %v", snapshotID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,392 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/listbackup/api/internal/database"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// Source group commands
+const (
+	SourceGroupCommandPause  = "pause"
+	SourceGroupCommandResume = "resume"
+	SourceGroupCommandSync   = "sync"
+)
+
+var (
+	// ErrSourceGroupNotFound is returned when a group does not exist or belongs to another account
+	ErrSourceGroupNotFound = errors.New("source group not found")
+	// ErrSourceGroupPaused is returned when syncing a paused group
+	ErrSourceGroupPaused = errors.New("source group is paused")
+)
+
+// backupFrequencies are the backup frequencies sources, groups and templates can use
+var backupFrequencies = map[string]bool{"hourly": true, "daily": true, "weekly": true, "monthly": true}
+
+// SourceHealth is the backup health of one source of a group
+type SourceHealth struct {
+	SourceID      string               `json:"sourceId"`
+	Name          string               `json:"name"`
+	Status        string               `json:"status"`
+	LastSuccessAt *time.Time           `json:"lastSuccessAt,omitempty"`
+	LastJobID     string               `json:"lastJobId,omitempty"`
+	LastJobStatus string               `json:"lastJobStatus,omitempty"` // Status of the latest finished backup
+	LastFailure   *apitypes.JobFailure `json:"lastFailure,omitempty"`
+	Failing       bool                 `json:"failing"`
+}
+
+// SourceGroupHealth rolls up the backup health of the sources of a group
+type SourceGroupHealth struct {
+	GroupID       string         `json:"groupId"`
+	Status        string         `json:"status"` // healthy|degraded|failing
+	SourceCount   int            `json:"sourceCount"`
+	Healthy       int            `json:"healthy"`
+	Failing       int            `json:"failing"`
+	Paused        int            `json:"paused"`
+	NeverBackedUp int            `json:"neverBackedUp"`
+	LastSuccessAt *time.Time     `json:"lastSuccessAt,omitempty"` // Latest success of any source
+	Sources       []SourceHealth `json:"sources"`
+}
+
+// GetGroup retrieves a source group of an account
+func (s *SourceService) GetGroup(ctx context.Context, accountID, groupID string) (*apitypes.SourceGroup, error) {
+	if !strings.HasPrefix(groupID, "group:") {
+		groupID = "group:" + groupID
+	}
+
+	var group apitypes.SourceGroup
+	err := s.db.GetItem(ctx, database.SourceGroupsTable, map[string]types.AttributeValue{
+		"groupId": &types.AttributeValueMemberS{Value: groupID},
+	}, &group)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return nil, ErrSourceGroupNotFound
+		}
+		return nil, fmt.Errorf("failed to get source group %s: %v", groupID, err)
+	}
+	if group.AccountID != accountID {
+		return nil, ErrSourceGroupNotFound
+	}
+	return &group, nil
+}
+
+// ListGroupSources returns the sources of a group
+func (s *SourceService) ListGroupSources(ctx context.Context, groupID string) ([]apitypes.Source, error) {
+	var sources []apitypes.Source
+	err := s.db.QueryGSIAll(ctx, database.SourcesTable, "GroupIndex", "groupId = :groupId", map[string]interface{}{
+		":groupId": groupID,
+	}, &sources)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sources of group %s: %v", groupID, err)
+	}
+	return sources, nil
+}
+
+// SetGroupPaused pauses or resumes a group along with its sources and returns how many
+// sources changed. Pausing marks the sources it pauses, so resuming the group leaves
+// sources that were paused on their own paused. Jobs already queued or running are not
+// affected.
+func (s *SourceService) SetGroupPaused(ctx context.Context, group *apitypes.SourceGroup, userID string, paused bool) (int, error) {
+	status, action, verb := "active", SourceGroupCommandResume, "Resumed"
+	if paused {
+		status, action, verb = "paused", SourceGroupCommandPause, "Paused"
+	}
+
+	now := time.Now()
+	values, err := attributevalue.MarshalMap(map[string]interface{}{
+		":status":    status,
+		":updatedAt": now,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal group status: %v", err)
+	}
+	err = s.db.UpdateItemWithNames(ctx, database.SourceGroupsTable, map[string]types.AttributeValue{
+		"groupId": &types.AttributeValueMemberS{Value: group.GroupID},
+	}, "SET #status = :status, updatedAt = :updatedAt", values, map[string]string{"#status": "status"})
+	if err != nil {
+		return 0, fmt.Errorf("failed to %s source group %s: %v", action, group.GroupID, err)
+	}
+	group.Status = status
+	group.UpdatedAt = now
+
+	sources, err := s.ListGroupSources(ctx, group.GroupID)
+	if err != nil {
+		return 0, err
+	}
+
+	// The group is updated first, so repeating a command that failed part way finishes it
+	changed, failed := 0, 0
+	for i := range sources {
+		source := &sources[i]
+		var update *types.Update
+		if paused && source.Status != "paused" {
+			update, err = sourceStatusUpdate(source.SourceID, "SET #status = :status, pausedByGroup = :true, updatedAt = :updatedAt",
+				"#status <> :status", map[string]interface{}{":status": "paused", ":true": true, ":updatedAt": now})
+		} else if !paused && source.PausedByGroup {
+			update, err = sourceStatusUpdate(source.SourceID, "SET #status = :status, updatedAt = :updatedAt REMOVE pausedByGroup",
+				"pausedByGroup = :true", map[string]interface{}{":status": "active", ":true": true, ":updatedAt": now})
+		} else {
+			continue
+		}
+		if err == nil {
+			err = s.db.TransactWrite(ctx, []types.TransactWriteItem{{Update: update}})
+		}
+		if err != nil {
+			// The source changed since it was listed
+			if database.ConditionFailed(err, 0) {
+				continue
+			}
+			log.Printf("Failed to %s source %s of group %s: %v", action, source.SourceID, group.GroupID, err)
+			failed++
+			continue
+		}
+		changed++
+	}
+
+	message := fmt.Sprintf("%s source group %s and %d of its sources", verb, group.Name, changed)
+	if err := LogActivity(ctx, s.db, group.AccountID, userID, "sources", "group_"+action, "success", message); err != nil {
+		log.Printf("Failed to log activity: %v", err)
+	}
+
+	if failed > 0 {
+		return changed, fmt.Errorf("failed to %s %d of the group's sources", action, failed)
+	}
+	return changed, nil
+}
+
+// SetGroupSettings replaces the settings a group shares and applies them to its sources,
+// returning how many sources were updated. A source inherits a shared setting unless it
+// overrides it: its value differs from the one the group shared before. With
+// resetOverrides every source takes the group's settings.
+func (s *SourceService) SetGroupSettings(ctx context.Context, group *apitypes.SourceGroup, userID string, settings apitypes.SourceGroupSettings, resetOverrides bool) (int, error) {
+	if err := validateGroupSettings(&settings); err != nil {
+		return 0, err
+	}
+
+	previous := group.Settings
+	if previous == nil {
+		previous = &apitypes.SourceGroupSettings{}
+	}
+
+	now := time.Now()
+	values, err := attributevalue.MarshalMap(map[string]interface{}{
+		":settings":  settings,
+		":updatedAt": now,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal group settings: %v", err)
+	}
+	err = s.db.UpdateItem(ctx, database.SourceGroupsTable, map[string]types.AttributeValue{
+		"groupId": &types.AttributeValueMemberS{Value: group.GroupID},
+	}, "SET settings = :settings, updatedAt = :updatedAt", values)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update settings of source group %s: %v", group.GroupID, err)
+	}
+	group.Settings = &settings
+	group.UpdatedAt = now
+
+	sources, err := s.ListGroupSources(ctx, group.GroupID)
+	if err != nil {
+		return 0, err
+	}
+
+	updated, failed := 0, 0
+	for i := range sources {
+		source := &sources[i]
+		// A source overrides a setting the group shared before when it no longer matches
+		inherit := func(overridden bool) bool {
+			return resetOverrides || !overridden
+		}
+
+		var sets []string
+		fields := map[string]interface{}{":updatedAt": now}
+		if settings.Frequency != "" && inherit(previous.Frequency != "" && source.Settings.Frequency != previous.Frequency) {
+			sets = append(sets, "settings.frequency = :frequency")
+			fields[":frequency"] = settings.Frequency
+		}
+		if settings.Schedule != "" && inherit(previous.Schedule != "" && source.Settings.Schedule != previous.Schedule) {
+			sets = append(sets, "settings.schedule = :schedule")
+			fields[":schedule"] = settings.Schedule
+		}
+		if settings.RetentionDays > 0 && inherit(previous.RetentionDays > 0 && source.Settings.RetentionDays != previous.RetentionDays) {
+			sets = append(sets, "settings.retentionDays = :retentionDays")
+			fields[":retentionDays"] = settings.RetentionDays
+		}
+		if settings.RetentionPolicy != nil && inherit(previous.RetentionPolicy != nil && !sameRetentionPolicy(source.Settings.RetentionPolicy, previous.RetentionPolicy)) {
+			sets = append(sets, "settings.retentionPolicy = :retentionPolicy")
+			fields[":retentionPolicy"] = settings.RetentionPolicy
+		}
+		if len(sets) == 0 {
+			continue
+		}
+
+		sourceValues, err := attributevalue.MarshalMap(fields)
+		if err == nil {
+			err = s.db.UpdateItem(ctx, database.SourcesTable, map[string]types.AttributeValue{
+				"sourceId": &types.AttributeValueMemberS{Value: source.SourceID},
+			}, "SET "+strings.Join(sets, ", ")+", updatedAt = :updatedAt", sourceValues)
+		}
+		if err != nil {
+			log.Printf("Failed to apply group settings to source %s: %v", source.SourceID, err)
+			failed++
+			continue
+		}
+		updated++
+	}
+
+	message := fmt.Sprintf("Updated shared settings of source group %s for %d of its sources", group.Name, updated)
+	if err := LogActivity(ctx, s.db, group.AccountID, userID, "sources", "group_settings", "success", message); err != nil {
+		log.Printf("Failed to log activity: %v", err)
+	}
+
+	if failed > 0 {
+		return updated, fmt.Errorf("failed to apply settings to %d of the group's sources", failed)
+	}
+	return updated, nil
+}
+
+// GroupHealth reports the last successful backup of each source of a group and which
+// sources are failing. A source is failing when its latest finished backup failed or it
+// is in error.
+func (s *SourceService) GroupHealth(ctx context.Context, group *apitypes.SourceGroup) (*SourceGroupHealth, error) {
+	sources, err := s.ListGroupSources(ctx, group.GroupID)
+	if err != nil {
+		return nil, err
+	}
+
+	health := &SourceGroupHealth{
+		GroupID:     group.GroupID,
+		SourceCount: len(sources),
+		Sources:     make([]SourceHealth, 0, len(sources)),
+	}
+	for i := range sources {
+		sourceHealth, err := s.sourceHealth(ctx, &sources[i])
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case sourceHealth.Status == "paused":
+			health.Paused++
+		case sourceHealth.Failing:
+			health.Failing++
+		default:
+			health.Healthy++
+		}
+		if sourceHealth.LastSuccessAt == nil {
+			health.NeverBackedUp++
+		} else if health.LastSuccessAt == nil || sourceHealth.LastSuccessAt.After(*health.LastSuccessAt) {
+			health.LastSuccessAt = sourceHealth.LastSuccessAt
+		}
+		health.Sources = append(health.Sources, sourceHealth)
+	}
+
+	switch {
+	case health.Failing == 0:
+		health.Status = "healthy"
+	case health.Healthy == 0:
+		health.Status = "failing"
+	default:
+		health.Status = "degraded"
+	}
+	return health, nil
+}
+
+// sourceHealth looks up the latest finished and latest successful backup of a source
+func (s *SourceService) sourceHealth(ctx context.Context, source *apitypes.Source) (SourceHealth, error) {
+	health := SourceHealth{
+		SourceID: source.SourceID,
+		Name:     source.Name,
+		Status:   source.Status,
+		Failing:  source.Status == "error",
+	}
+
+	var jobs []apitypes.Job
+	err := s.db.QueryGSIAll(ctx, database.JobsTable, "SourceIndex", "sourceId = :sourceId", map[string]interface{}{
+		":sourceId": source.SourceID,
+	}, &jobs)
+	if err != nil {
+		return health, fmt.Errorf("failed to list jobs of source %s: %v", source.SourceID, err)
+	}
+
+	var latest *apitypes.Job
+	for i := range jobs {
+		job := &jobs[i]
+		if job.Type != "backup" && job.Type != "sync" {
+			continue
+		}
+		switch job.Status {
+		case "completed":
+			if job.CompletedAt != nil && (health.LastSuccessAt == nil || job.CompletedAt.After(*health.LastSuccessAt)) {
+				health.LastSuccessAt = job.CompletedAt
+			}
+		case "failed", "dead":
+		default:
+			continue
+		}
+		if latest == nil || job.CreatedAt.After(latest.CreatedAt) {
+			latest = job
+		}
+	}
+
+	if latest != nil {
+		health.LastJobID = latest.JobID
+		health.LastJobStatus = latest.Status
+		if latest.Status != "completed" {
+			health.LastFailure = latest.Failure
+			health.Failing = true
+		}
+	}
+	return health, nil
+}
+
+// validateGroupSettings checks the settings a group shares
+func validateGroupSettings(settings *apitypes.SourceGroupSettings) error {
+	settings.Frequency = strings.ToLower(strings.TrimSpace(settings.Frequency))
+	if settings.Frequency != "" && !backupFrequencies[settings.Frequency] {
+		return validationErrorf("frequency must be hourly, daily, weekly or monthly")
+	}
+	settings.Schedule = strings.TrimSpace(settings.Schedule)
+	if fields := len(strings.Fields(settings.Schedule)); settings.Schedule != "" && (fields < 5 || fields > 6) {
+		return validationErrorf("schedule must be a cron expression")
+	}
+	if settings.RetentionDays < 0 {
+		return validationErrorf("retentionDays cannot be negative")
+	}
+	if policy := settings.RetentionPolicy; policy != nil && (policy.KeepDaily < 0 || policy.KeepWeekly < 0 || policy.KeepMonthly < 0) {
+		return validationErrorf("retentionPolicy cannot keep a negative number of snapshots")
+	}
+	return nil
+}
+
+// sourceStatusUpdate builds a conditional status change of a source
+func sourceStatusUpdate(sourceID, expression, condition string, fields map[string]interface{}) (*types.Update, error) {
+	values, err := attributevalue.MarshalMap(fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal source status: %v", err)
+	}
+	return &types.Update{
+		TableName:                 aws.String(database.SourcesTable),
+		Key:                       map[string]types.AttributeValue{"sourceId": &types.AttributeValueMemberS{Value: sourceID}},
+		UpdateExpression:          aws.String(expression),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  map[string]string{"#status": "status"},
+		ExpressionAttributeValues: values,
+	}, nil
+}
+
+func sameRetentionPolicy(a, b *apitypes.RetentionPolicy) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,426 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/listbackup/api/internal/database"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// MaxBulkSources is how many sources one bulk request may create. A DynamoDB
+// transaction holds 100 writes: the group, the connection check and the sources.
+const MaxBulkSources = 98
+
+var (
+	// ErrSourceLimitReached is returned when creating sources would exceed the account's plan
+	ErrSourceLimitReached = errors.New("source limit reached")
+	// ErrSourceNotFound is returned when a source does not exist or belongs to another account
+	ErrSourceNotFound = errors.New("source not found")
+	// ErrSourceExists is returned when a source or source group with the same ID already exists
+	ErrSourceExists = errors.New("source already exists")
+	// ErrConnectionNotFound is returned when a connection does not exist or belongs to another
+	// account
+	ErrConnectionNotFound = errors.New("connection not found")
+	// ErrConnectionInactive is returned when creating sources from a connection that is not active
+	ErrConnectionInactive = errors.New("connection is not active")
+)
+
+// SourceService creates and manages the sources of an account
+type SourceService struct {
+	db *database.DynamoDBClient
+}
+
+// BulkSourceInput selects the platform sources to create from a connection. With
+// AllDefaults every active platform source of the platform that is enabled by default is
+// used instead of PlatformSourceIDs.
+type BulkSourceInput struct {
+	ConnectionID      string
+	PlatformSourceIDs []string
+	AllDefaults       bool
+	GroupName         string // Defaults to the connection name
+	Description       string
+}
+
+// BulkSourceResult is the group and the sources created by a bulk request
+type BulkSourceResult struct {
+	Group   apitypes.SourceGroup `json:"group"`
+	Sources []apitypes.Source    `json:"sources"`
+}
+
+// SourceUpdate changes a source. Empty fields are left as they are, and settings replace
+// the source's settings as a whole.
+type SourceUpdate struct {
+	Name     string                   `json:"name,omitempty"`
+	Status   string                   `json:"status,omitempty"` // active|paused
+	Settings *apitypes.SourceSettings `json:"settings,omitempty"`
+}
+
+// NewSourceService creates a new source service
+func NewSourceService(ctx context.Context) (*SourceService, error) {
+	db, err := database.NewDynamoDBClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %v", err)
+	}
+
+	return &SourceService{db: db}, nil
+}
+
+// BulkCreateSources creates a source group for a connection along with one source per
+// selected platform source, each inheriting the platform source's default settings. The
+// connection, the platform sources and the account's source limit are all checked before
+// anything is written, and the group and sources are written in a single transaction, so
+// a failure leaves no partial group behind.
+func (s *SourceService) BulkCreateSources(ctx context.Context, accountID, userID string, input BulkSourceInput) (*BulkSourceResult, error) {
+	connectionID := input.ConnectionID
+	if connectionID == "" {
+		return nil, validationErrorf("connectionId is required")
+	}
+	if !strings.HasPrefix(connectionID, "connection:") {
+		connectionID = "connection:" + connectionID
+	}
+	if !input.AllDefaults && len(input.PlatformSourceIDs) == 0 {
+		return nil, validationErrorf("platformSourceIds is required unless allDefaults is set")
+	}
+
+	var connection apitypes.PlatformConnection
+	err := s.db.GetItem(ctx, database.PlatformConnectionsTable, map[string]types.AttributeValue{
+		"connectionId": &types.AttributeValueMemberS{Value: connectionID},
+	}, &connection)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return nil, ErrConnectionNotFound
+		}
+		return nil, fmt.Errorf("failed to get connection %s: %v", connectionID, err)
+	}
+	if connection.AccountID != accountID {
+		return nil, ErrConnectionNotFound
+	}
+	if connection.Status != "active" {
+		return nil, ErrConnectionInactive
+	}
+
+	platformSources, err := s.selectPlatformSources(ctx, connection.PlatformID, input)
+	if err != nil {
+		return nil, err
+	}
+	if len(platformSources) == 0 {
+		return nil, validationErrorf("no platform sources are enabled by default for this platform")
+	}
+	if len(platformSources) > MaxBulkSources {
+		return nil, validationErrorf("at most %d sources can be created at once", MaxBulkSources)
+	}
+
+	if err := s.checkSourceLimit(ctx, accountID, len(platformSources)); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	groupName := strings.TrimSpace(input.GroupName)
+	if groupName == "" {
+		groupName = connection.Name
+	}
+	result := &BulkSourceResult{
+		Group: apitypes.SourceGroup{
+			GroupID:      "group:" + uuid.New().String(),
+			AccountID:    accountID,
+			UserID:       userID,
+			ConnectionID: connectionID,
+			Name:         groupName,
+			Description:  input.Description,
+			Status:       "active",
+			SourceCount:  len(platformSources),
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+	}
+	for _, platformSource := range platformSources {
+		result.Sources = append(result.Sources, apitypes.Source{
+			SourceID:         "source:" + uuid.New().String(),
+			AccountID:        accountID,
+			UserID:           userID,
+			GroupID:          result.Group.GroupID,
+			ConnectionID:     connectionID,
+			PlatformSourceID: platformSource.PlatformSourceID,
+			Name:             platformSource.Name,
+			Status:           "active",
+			Settings:         DefaultSourceSettings(platformSource),
+			TemplateVersion:  platformSource.Version,
+			CreatedAt:        now,
+			UpdatedAt:        now,
+		})
+	}
+
+	if err := s.writeGroup(ctx, connection, result); err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("Created %d sources in group %s", len(result.Sources), groupName)
+	if err := LogActivity(ctx, s.db, accountID, userID, "sources", "bulk_create", "success", message); err != nil {
+		log.Printf("Failed to log activity: %v", err)
+	}
+	return result, nil
+}
+
+// GetSource retrieves a source of an account
+func (s *SourceService) GetSource(ctx context.Context, accountID, sourceID string) (*apitypes.Source, error) {
+	if !strings.HasPrefix(sourceID, "source:") {
+		sourceID = "source:" + sourceID
+	}
+
+	var source apitypes.Source
+	err := s.db.GetItem(ctx, database.SourcesTable, map[string]types.AttributeValue{
+		"sourceId": &types.AttributeValueMemberS{Value: sourceID},
+	}, &source)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return nil, ErrSourceNotFound
+		}
+		return nil, fmt.Errorf("failed to get source %s: %v", sourceID, err)
+	}
+	if source.AccountID != accountID {
+		return nil, ErrSourceNotFound
+	}
+	return &source, nil
+}
+
+// UpdateSource renames, pauses or resumes a source or replaces its settings. New settings
+// are checked against the source's platform source, including the custom parameters its
+// endpoints declare, the record filters and the masking rules.
+func (s *SourceService) UpdateSource(ctx context.Context, accountID, userID, sourceID string, update SourceUpdate) (*apitypes.Source, error) {
+	source, err := s.GetSource(ctx, accountID, sourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	set := []string{"updatedAt = :updatedAt"}
+	remove := ""
+	fields := map[string]interface{}{":updatedAt": now}
+	var names map[string]string
+
+	if name := strings.TrimSpace(update.Name); name != "" {
+		set = append(set, "#name = :name")
+		fields[":name"] = name
+		names = map[string]string{"#name": "name"}
+		source.Name = name
+	}
+
+	switch update.Status {
+	case "":
+	case "active", "paused":
+		if update.Status == "active" && source.PausedByGroup {
+			return nil, validationErrorf("source was paused with its group, resume the group instead")
+		}
+		// A source paused on its own stays paused when its group is resumed
+		set = append(set, "#status = :status")
+		remove = " REMOVE pausedByGroup"
+		fields[":status"] = update.Status
+		if names == nil {
+			names = map[string]string{}
+		}
+		names["#status"] = "status"
+		source.Status = update.Status
+		source.PausedByGroup = false
+	default:
+		return nil, validationErrorf("status must be active or paused")
+	}
+
+	if update.Settings != nil {
+		platformSource, err := (&CatalogService{db: s.db}).GetPlatformSource(ctx, source.PlatformSourceID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the source's platform source: %v", err)
+		}
+		if err := ValidateSourceSettings(platformSource, update.Settings); err != nil {
+			return nil, err
+		}
+		set = append(set, "settings = :settings")
+		fields[":settings"] = update.Settings
+		source.Settings = *update.Settings
+	}
+
+	values, err := attributevalue.MarshalMap(fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal source update: %v", err)
+	}
+	err = s.db.UpdateItemWithNames(ctx, database.SourcesTable, map[string]types.AttributeValue{
+		"sourceId": &types.AttributeValueMemberS{Value: source.SourceID},
+	}, "SET "+strings.Join(set, ", ")+remove, values, names)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update source %s: %v", source.SourceID, err)
+	}
+	source.UpdatedAt = now
+
+	message := fmt.Sprintf("Updated source %s", source.Name)
+	if err := LogActivity(ctx, s.db, accountID, userID, "sources", "update", "success", message); err != nil {
+		log.Printf("Failed to log activity: %v", err)
+	}
+	return source, nil
+}
+
+// DefaultSourceSettings returns the settings a new source inherits from its platform source
+func DefaultSourceSettings(platformSource *apitypes.PlatformSource) apitypes.SourceSettings {
+	defaults := platformSource.DefaultSettings
+	customParams := make(map[string]string, len(defaults.CustomParams))
+	for key, value := range defaults.CustomParams {
+		customParams[key] = value
+	}
+
+	return apitypes.SourceSettings{
+		Enabled:         defaults.Enabled,
+		Priority:        defaults.Priority,
+		Frequency:       defaults.Frequency,
+		RetentionDays:   defaults.RetentionDays,
+		IncrementalSync: defaults.IncrementalSync,
+		Notifications:   defaults.Notifications,
+		CustomParams:    customParams,
+	}
+}
+
+// selectPlatformSources returns the platform sources a bulk request asks for, in the order
+// given, after checking that each is active, belongs to the platform and has endpoint
+// dependencies that can be ordered
+func (s *SourceService) selectPlatformSources(ctx context.Context, platformID string, input BulkSourceInput) ([]*apitypes.PlatformSource, error) {
+	var available []apitypes.PlatformSource
+	err := s.db.QueryGSIAll(ctx, database.PlatformSourcesTable, "PlatformIndex", "platformId = :platformId",
+		map[string]interface{}{":platformId": platformID}, &available)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list platform sources of %s: %v", platformID, err)
+	}
+
+	byID := make(map[string]*apitypes.PlatformSource, len(available))
+	for i := range available {
+		byID[available[i].PlatformSourceID] = &available[i]
+	}
+
+	var selected []*apitypes.PlatformSource
+	if input.AllDefaults {
+		for i := range available {
+			if available[i].Status == "active" && available[i].DefaultSettings.Enabled {
+				selected = append(selected, &available[i])
+			}
+		}
+	} else {
+		seen := make(map[string]bool, len(input.PlatformSourceIDs))
+		for _, id := range input.PlatformSourceIDs {
+			if !strings.HasPrefix(id, "platform-source:") {
+				id = "platform-source:" + id
+			}
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			platformSource, ok := byID[id]
+			if !ok {
+				return nil, validationErrorf("platform source %s does not belong to this connection's platform", strings.TrimPrefix(id, "platform-source:"))
+			}
+			if platformSource.Status != "active" {
+				return nil, validationErrorf("platform source %s is not active", strings.TrimPrefix(id, "platform-source:"))
+			}
+			selected = append(selected, platformSource)
+		}
+	}
+
+	// Only endpoint dependencies order a backup; backups of different sources are not ordered
+	for _, platformSource := range selected {
+		if err := ValidateEndpointDependencies(platformSource.Endpoints); err != nil {
+			return nil, fmt.Errorf("platform source %s is misconfigured: %v",
+				strings.TrimPrefix(platformSource.PlatformSourceID, "platform-source:"), err)
+		}
+	}
+
+	return selected, nil
+}
+
+// checkSourceLimit fails with ErrSourceLimitReached when adding sources would take the
+// account past its plan's source limit. A limit of zero or less means unlimited.
+func (s *SourceService) checkSourceLimit(ctx context.Context, accountID string, adding int) error {
+	var account apitypes.Account
+	err := s.db.GetItem(ctx, database.AccountsTable, map[string]types.AttributeValue{
+		"accountId": &types.AttributeValueMemberS{Value: accountID},
+	}, &account)
+	if err != nil {
+		return fmt.Errorf("failed to get account %s: %v", accountID, err)
+	}
+
+	limit := account.Settings.MaxSources
+	if limit <= 0 {
+		return nil
+	}
+
+	var existing []apitypes.Source
+	err = s.db.QueryGSIAll(ctx, database.SourcesTable, "AccountIndex", "accountId = :accountId",
+		map[string]interface{}{":accountId": accountID}, &existing)
+	if err != nil {
+		return fmt.Errorf("failed to count sources of account %s: %v", accountID, err)
+	}
+
+	if len(existing)+adding > limit {
+		return fmt.Errorf("%w: your plan allows %d sources, the account has %d and this would add %d",
+			ErrSourceLimitReached, limit, len(existing), adding)
+	}
+	return nil
+}
+
+// writeGroup writes the group and its sources in one transaction, which also checks that
+// the connection is still active. The connection check is the first item of the
+// transaction, the group the second and the sources follow.
+func (s *SourceService) writeGroup(ctx context.Context, connection apitypes.PlatformConnection, result *BulkSourceResult) error {
+	groupItem, err := attributevalue.MarshalMap(result.Group)
+	if err != nil {
+		return fmt.Errorf("failed to marshal source group: %v", err)
+	}
+	values, err := attributevalue.MarshalMap(map[string]interface{}{
+		":accountId": connection.AccountID,
+		":active":    "active",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal connection check: %v", err)
+	}
+
+	items := []types.TransactWriteItem{
+		{ConditionCheck: &types.ConditionCheck{
+			TableName:                 aws.String(database.PlatformConnectionsTable),
+			Key:                       map[string]types.AttributeValue{"connectionId": &types.AttributeValueMemberS{Value: connection.ConnectionID}},
+			ConditionExpression:       aws.String("accountId = :accountId AND #status = :active"),
+			ExpressionAttributeNames:  map[string]string{"#status": "status"},
+			ExpressionAttributeValues: values,
+		}},
+		{Put: &types.Put{
+			TableName:           aws.String(database.SourceGroupsTable),
+			Item:                groupItem,
+			ConditionExpression: aws.String("attribute_not_exists(groupId)"),
+		}},
+	}
+	for _, source := range result.Sources {
+		sourceItem, err := attributevalue.MarshalMap(source)
+		if err != nil {
+			return fmt.Errorf("failed to marshal source: %v", err)
+		}
+		items = append(items, types.TransactWriteItem{Put: &types.Put{
+			TableName:           aws.String(database.SourcesTable),
+			Item:                sourceItem,
+			ConditionExpression: aws.String("attribute_not_exists(sourceId)"),
+		}})
+	}
+
+	if err := s.db.TransactWrite(ctx, items); err != nil {
+		switch {
+		case database.ConditionFailed(err, 0):
+			return ErrConnectionInactive
+		case database.ConditionFailed(err, -1):
+			return ErrSourceExists
+		}
+		return fmt.Errorf("failed to create sources: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+var (
+	backupPriorities = map[string]bool{"high": true, "medium": true, "low": true}
+	filterOperators  = map[string]bool{"equals": true, "contains": true, "exists": true}
+	filterActions    = map[string]bool{"include": true, "exclude": true}
+)
+
+// ValidateSourceSettings checks settings for a source of platformSource, normalizing them
+// where it can
+func ValidateSourceSettings(platformSource *apitypes.PlatformSource, settings *apitypes.SourceSettings) error {
+	settings.Priority = strings.ToLower(strings.TrimSpace(settings.Priority))
+	if settings.Priority != "" && !backupPriorities[settings.Priority] {
+		return validationErrorf("priority must be high, medium or low")
+	}
+
+	// Schedule and retention follow the same rules as the settings a group shares
+	shared := apitypes.SourceGroupSettings{
+		Frequency:       settings.Frequency,
+		Schedule:        settings.Schedule,
+		RetentionDays:   settings.RetentionDays,
+		RetentionPolicy: settings.RetentionPolicy,
+	}
+	if err := validateGroupSettings(&shared); err != nil {
+		return err
+	}
+	settings.Frequency, settings.Schedule = shared.Frequency, shared.Schedule
+
+	if err := ValidateSourceParams(platformSource.Endpoints, platformSource.DefaultSettings.CustomParams, settings.CustomParams); err != nil {
+		return err
+	}
+	if err := ValidateRecordFilters(platformSource.Endpoints, settings.Filters); err != nil {
+		return err
+	}
+	return ValidateMaskingRules(platformSource.Endpoints, settings.Masking)
+}
+
+// ValidateSourceParams checks a source's custom API parameters against the parameters its
+// platform source's endpoints declare. A parameter must be declared by an endpoint or be
+// one of the template's default parameters, which apply to every endpoint. Declared
+// parameters must match their type, and required parameters need a value or a default.
+func ValidateSourceParams(endpoints map[string]apitypes.PlatformEndpoint, templateParams, params map[string]string) error {
+	declared := declaredParams(endpoints)
+	for _, key := range unionKeys(params, nil) {
+		if strings.TrimSpace(key) == "" {
+			return validationErrorf("custom parameter names cannot be empty")
+		}
+		for _, name := range sortedKeys(endpoints) {
+			if endpoints[name].ResponseMapping.PaginationKey == key {
+				return validationErrorf("custom parameter %s is set by pagination and cannot be changed", key)
+			}
+		}
+
+		definitions, ok := declared[key]
+		if !ok {
+			if _, ok := templateParams[key]; ok {
+				continue
+			}
+			names := make([]string, 0, len(declared))
+			for name := range declared {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return validationErrorf("unknown custom parameter %s, the endpoints accept: %s", key, strings.Join(names, ", "))
+		}
+		for _, param := range definitions {
+			if err := checkParamType(param, params[key]); err != nil {
+				return validationErrorf("custom parameter %s %v", key, err)
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(endpoints) {
+		endpoint := endpoints[name]
+		for _, param := range endpoint.Parameters {
+			if !param.Required || param.Name == endpoint.ResponseMapping.PaginationKey {
+				continue
+			}
+			if strings.TrimSpace(params[param.Name]) == "" && param.Default == "" {
+				return validationErrorf("endpoint %s requires the custom parameter %s", name, param.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// EndpointParams returns the custom parameters that apply to one endpoint: those it
+// declares and those no endpoint declares, which came from the template's defaults
+func EndpointParams(endpoints map[string]apitypes.PlatformEndpoint, name string, params map[string]string) map[string]string {
+	declared := declaredParams(endpoints)
+	own := make(map[string]bool, len(endpoints[name].Parameters))
+	for _, param := range endpoints[name].Parameters {
+		own[param.Name] = true
+	}
+
+	applied := make(map[string]string, len(params))
+	for key, value := range params {
+		if _, elsewhere := declared[key]; own[key] || !elsewhere {
+			applied[key] = value
+		}
+	}
+	return applied
+}
+
+// ValidateRecordFilters checks and normalizes a source's record filters
+func ValidateRecordFilters(endpoints map[string]apitypes.PlatformEndpoint, filters []apitypes.RecordFilter) error {
+	for i := range filters {
+		filter := &filters[i]
+		filter.Endpoint = strings.TrimSpace(filter.Endpoint)
+		filter.Field = strings.TrimSpace(filter.Field)
+		filter.Operator = strings.ToLower(strings.TrimSpace(filter.Operator))
+		filter.Action = strings.ToLower(strings.TrimSpace(filter.Action))
+
+		if filter.Endpoint != "" {
+			if _, ok := endpoints[filter.Endpoint]; !ok {
+				return validationErrorf("filter %d: unknown endpoint %s", i+1, filter.Endpoint)
+			}
+		}
+		if !isFieldPath(filter.Field) {
+			return validationErrorf("filter %d: field must be a dot separated path such as tags.name", i+1)
+		}
+		if !filterOperators[filter.Operator] {
+			return validationErrorf("filter %d: operator must be equals, contains or exists", i+1)
+		}
+		if !filterActions[filter.Action] {
+			return validationErrorf("filter %d: action must be include or exclude", i+1)
+		}
+		if filter.Operator == "exists" && len(filter.Values) > 0 {
+			return validationErrorf("filter %d: exists takes no values", i+1)
+		}
+		if filter.Operator != "exists" && len(filter.Values) == 0 {
+			return validationErrorf("filter %d: %s needs at least one value", i+1, filter.Operator)
+		}
+	}
+	return nil
+}
+
+// EndpointFilters returns the filters that apply to an endpoint
+func EndpointFilters(filters []apitypes.RecordFilter, endpoint string) []apitypes.RecordFilter {
+	var applied []apitypes.RecordFilter
+	for _, filter := range filters {
+		if filter.Endpoint == "" || filter.Endpoint == endpoint {
+			applied = append(applied, filter)
+		}
+	}
+	return applied
+}
+
+// FilterRecords applies filters to records and returns the records that are kept. Records
+// keep their original encoding.
+func FilterRecords(records []json.RawMessage, filters []apitypes.RecordFilter) ([]json.RawMessage, error) {
+	if len(filters) == 0 {
+		return records, nil
+	}
+
+	hasInclude := false
+	for _, filter := range filters {
+		if filter.Action == "include" {
+			hasInclude = true
+		}
+	}
+
+	kept := make([]json.RawMessage, 0, len(records))
+	for _, raw := range records {
+		var record interface{}
+		if err := json.Unmarshal(raw, &record); err != nil {
+			return nil, fmt.Errorf("failed to parse record for filtering: %v", err)
+		}
+
+		included, excluded := !hasInclude, false
+		for _, filter := range filters {
+			if !matchesFilter(record, filter) {
+				continue
+			}
+			if filter.Action == "include" {
+				included = true
+			} else {
+				excluded = true
+			}
+		}
+		if included && !excluded {
+			kept = append(kept, raw)
+		}
+	}
+
+	return kept, nil
+}
+
+// isFieldPath reports whether path is a dot separated path with no empty segments
+func isFieldPath(path string) bool {
+	return path != "" && !strings.Contains(path, "..") && !strings.HasPrefix(path, ".") && !strings.HasSuffix(path, ".")
+}
+
+func matchesFilter(record interface{}, filter apitypes.RecordFilter) bool {
+	found := fieldValues(record, strings.Split(filter.Field, "."))
+	if filter.Operator == "exists" {
+		for _, value := range found {
+			if value != nil {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, value := range found {
+		for _, text := range filterValues(value) {
+			for _, want := range filter.Values {
+				switch filter.Operator {
+				case "equals":
+					if strings.EqualFold(text, want) {
+						return true
+					}
+				case "contains":
+					if strings.Contains(strings.ToLower(text), strings.ToLower(want)) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// fieldValues follows a path into a record. Lists along the way are searched element by
+// element, so tags.name finds the name of every tag.
+func fieldValues(value interface{}, path []string) []interface{} {
+	if len(path) == 0 {
+		return []interface{}{value}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if child, ok := v[path[0]]; ok {
+			return fieldValues(child, path[1:])
+		}
+	case []interface{}:
+		var found []interface{}
+		for _, item := range v {
+			found = append(found, fieldValues(item, path)...)
+		}
+		return found
+	}
+	return nil
+}
+
+// filterValues flattens a field value into the text filters compare against
+func filterValues(value interface{}) []string {
+	if b, ok := value.(bool); ok {
+		return []string{strconv.FormatBool(b)}
+	}
+	return searchValues(value)
+}
+
+// declaredParams maps each parameter name to its definitions across the endpoints
+func declaredParams(endpoints map[string]apitypes.PlatformEndpoint) map[string][]apitypes.APIParameter {
+	declared := make(map[string][]apitypes.APIParameter)
+	for _, name := range sortedKeys(endpoints) {
+		for _, param := range endpoints[name].Parameters {
+			declared[param.Name] = append(declared[param.Name], param)
+		}
+	}
+	return declared
+}
+
+func checkParamType(param apitypes.APIParameter, value string) error {
+	value = strings.TrimSpace(value)
+	switch param.Type {
+	case "integer":
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("must be true or false")
+		}
+	case "datetime":
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			if _, err := time.Parse("2006-01-02", value); err != nil {
+				return fmt.Errorf("must be a date (2006-01-02) or an RFC 3339 timestamp")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package services
+
+import "fmt"
+
+// ValidationError is returned when the input of a request is invalid. Handlers report it
+// to the caller as a bad request; every other error is internal.
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// validationErrorf returns a ValidationError with a formatted message
+func validationErrorf(format string, args ...interface{}) error {
+	return &ValidationError{Message: fmt.Sprintf(format, args...)}
+}
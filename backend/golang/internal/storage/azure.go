@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+const azureAPIVersion = "2021-08-06"
+
+// azureWriter writes block blobs to an Azure Blob Storage container through the REST API,
+// authenticated with either the storage account's shared key or a SAS token
+type azureWriter struct {
+	httpClient *http.Client
+	account    string
+	container  string
+	prefix     string
+	accountKey []byte
+	sasToken   string
+}
+
+func newAzureWriter(config apitypes.StorageDestinationConfig, creds apitypes.StorageCredentials) *azureWriter {
+	w := &azureWriter{
+		httpClient: &http.Client{Timeout: 5 * time.Minute},
+		account:    config.StorageAccount,
+		container:  config.Bucket,
+		prefix:     config.Prefix,
+		sasToken:   strings.TrimPrefix(creds.SASToken, "?"),
+	}
+	if creds.AccountKey != "" {
+		// An invalid key surfaces as an authentication failure on first use
+		w.accountKey, _ = base64.StdEncoding.DecodeString(creds.AccountKey)
+	}
+	return w
+}
+
+func (w *azureWriter) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	resp, err := w.do(ctx, http.MethodPut, key, data, map[string]string{
+		"Content-Type":   contentType,
+		"x-ms-blob-type": "BlockBlob",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %v", key, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (w *azureWriter) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := w.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		if err == ErrNotFound {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to download %s: %v", key, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", key, err)
+	}
+	return data, nil
+}
+
+func (w *azureWriter) Delete(ctx context.Context, key string) error {
+	resp, err := w.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil && err != ErrNotFound {
+		return fmt.Errorf("failed to delete %s: %v", key, err)
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return nil
+}
+
+func (w *azureWriter) Close() error {
+	return nil
+}
+
+// do sends a blob request and returns the response when it succeeded
+func (w *azureWriter) do(ctx context.Context, method, key string, body []byte, headers map[string]string) (*http.Response, error) {
+	blobPath := "/" + w.container + "/" + objectKey(w.prefix, key)
+	endpoint := url.URL{
+		Scheme:   "https",
+		Host:     w.account + ".blob.core.windows.net",
+		Path:     blobPath,
+		RawQuery: w.sasToken,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureAPIVersion)
+
+	if w.sasToken == "" {
+		req.Header.Set("Authorization", "SharedKey "+w.account+":"+w.sign(req))
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("azure returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// sign computes the Shared Key signature of a request
+func (w *azureWriter) sign(req *http.Request) string {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+
+	var msHeaders []string
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			msHeaders = append(msHeaders, lower+":"+strings.TrimSpace(req.Header.Get(name)))
+		}
+	}
+	sort.Strings(msHeaders)
+
+	resource := "/" + w.account + req.URL.EscapedPath()
+	query := req.URL.Query()
+	var params []string
+	for name := range query {
+		params = append(params, name)
+	}
+	sort.Strings(params)
+	for _, name := range params {
+		values := query[name]
+		sort.Strings(values)
+		resource += "\n" + strings.ToLower(name) + ":" + strings.Join(values, ",")
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, superseded by x-ms-date
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		strings.Join(msHeaders, "\n"),
+		resource,
+	}, "\n")
+
+	mac := hmac.New(sha256.New, w.accountKey)
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
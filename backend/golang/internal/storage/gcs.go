@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+const (
+	gcsScope         = "https://www.googleapis.com/auth/devstorage.read_write"
+	gcsDefaultTokens = "https://oauth2.googleapis.com/token"
+)
+
+// gcsWriter writes objects to a Google Cloud Storage bucket through the JSON API, using a
+// service account key to obtain access tokens
+type gcsWriter struct {
+	httpClient *http.Client
+	bucket     string
+	prefix     string
+
+	clientEmail string
+	privateKey  *rsa.PrivateKey
+	tokenURI    string
+
+	mu          sync.Mutex
+	accessToken string
+	tokenExpiry time.Time
+}
+
+type gcsServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+func newGCSWriter(config apitypes.StorageDestinationConfig, creds apitypes.StorageCredentials) (*gcsWriter, error) {
+	var account gcsServiceAccount
+	if err := json.Unmarshal([]byte(creds.ServiceAccountJSON), &account); err != nil {
+		return nil, fmt.Errorf("failed to parse service account key: %v", err)
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, fmt.Errorf("service account key is missing client_email or private_key")
+	}
+
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("service account private key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse service account private key: %v", err)
+		}
+	}
+	privateKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("service account private key is not an RSA key")
+	}
+
+	tokenURI := account.TokenURI
+	if tokenURI == "" {
+		tokenURI = gcsDefaultTokens
+	}
+
+	return &gcsWriter{
+		httpClient:  &http.Client{Timeout: 5 * time.Minute},
+		bucket:      config.Bucket,
+		prefix:      config.Prefix,
+		clientEmail: account.ClientEmail,
+		privateKey:  privateKey,
+		tokenURI:    tokenURI,
+	}, nil
+}
+
+func (w *gcsWriter) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	endpoint := fmt.Sprintf("https://storage.googleapis.com/upload/storage/v1/b/%s/o?uploadType=media&name=%s",
+		url.PathEscape(w.bucket), url.QueryEscape(objectKey(w.prefix, key)))
+
+	resp, err := w.do(ctx, http.MethodPost, endpoint, data, contentType)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %v", key, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (w *gcsWriter) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := w.do(ctx, http.MethodGet, w.objectURL(key)+"?alt=media", nil, "")
+	if err != nil {
+		if err == ErrNotFound {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to download %s: %v", key, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", key, err)
+	}
+	return data, nil
+}
+
+func (w *gcsWriter) Delete(ctx context.Context, key string) error {
+	resp, err := w.do(ctx, http.MethodDelete, w.objectURL(key), nil, "")
+	if err != nil && err != ErrNotFound {
+		return fmt.Errorf("failed to delete %s: %v", key, err)
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return nil
+}
+
+func (w *gcsWriter) Close() error {
+	return nil
+}
+
+func (w *gcsWriter) objectURL(key string) string {
+	return fmt.Sprintf("https://storage.googleapis.com/storage/v1/b/%s/o/%s",
+		url.PathEscape(w.bucket), url.PathEscape(objectKey(w.prefix, key)))
+}
+
+// do sends an authenticated request and returns the response when it succeeded
+func (w *gcsWriter) do(ctx context.Context, method, endpoint string, body []byte, contentType string) (*http.Response, error) {
+	token, err := w.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("gcs returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// token returns a cached access token, exchanging a signed JWT for a new one when needed
+func (w *gcsWriter) token(ctx context.Context) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.accessToken != "" && time.Now().Before(w.tokenExpiry) {
+		return w.accessToken, nil
+	}
+
+	assertion, err := w.signedJWT(time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request access token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode access token response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || result.AccessToken == "" {
+		return "", fmt.Errorf("failed to request access token: %s %s", resp.Status, result.ErrorDescription)
+	}
+
+	w.accessToken = result.AccessToken
+	// Refresh a minute early so a token never expires mid-request
+	w.tokenExpiry = time.Now().Add(time.Duration(result.ExpiresIn)*time.Second - time.Minute)
+	return w.accessToken, nil
+}
+
+func (w *gcsWriter) signedJWT(now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   w.clientEmail,
+		"scope": gcsScope,
+		"aud":   w.tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, w.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign access token request: %v", err)
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// s3Writer writes to AWS S3 or any S3-compatible service such as MinIO, Wasabi or
+// Cloudflare R2
+type s3Writer struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func newS3Writer(config apitypes.StorageDestinationConfig, creds apitypes.StorageCredentials) *s3Writer {
+	region := config.Region
+	if region == "" {
+		region = "us-east-1" // MinIO and R2 ("auto") accept any region
+	}
+
+	client := s3.New(s3.Options{
+		Region:       region,
+		Credentials:  credentials.NewStaticCredentialsProvider(creds.AccessKeyID, creds.SecretAccessKey, ""),
+		UsePathStyle: config.PathStyle,
+		// Not every S3-compatible service understands the flexible checksum headers
+		RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+		ResponseChecksumValidation: aws.ResponseChecksumValidationWhenRequired,
+	}, func(o *s3.Options) {
+		if config.Endpoint != "" {
+			o.BaseEndpoint = aws.String(config.Endpoint)
+		}
+	})
+
+	return &s3Writer{client: client, bucket: config.Bucket, prefix: config.Prefix}
+}
+
+func (w *s3Writer) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := w.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(w.bucket),
+		Key:           aws.String(objectKey(w.prefix, key)),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+		ContentType:   aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %v", key, err)
+	}
+	return nil
+}
+
+func (w *s3Writer) Get(ctx context.Context, key string) ([]byte, error) {
+	result, err := w.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(w.bucket),
+		Key:    aws.String(objectKey(w.prefix, key)),
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to download %s: %v", key, err)
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", key, err)
+	}
+	return data, nil
+}
+
+func (w *s3Writer) Delete(ctx context.Context, key string) error {
+	_, err := w.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(w.bucket),
+		Key:    aws.String(objectKey(w.prefix, key)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %v", key, err)
+	}
+	return nil
+}
+
+func (w *s3Writer) Close() error {
+	return nil
+}
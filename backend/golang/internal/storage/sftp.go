@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	apitypes "github.com/listbackup/api/internal/types"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const sftpDialTimeout = 15 * time.Second
+
+// sftpWriter writes files below a base directory on an SFTP server
+type sftpWriter struct {
+	conn    *ssh.Client
+	client  *sftp.Client
+	baseDir string
+	hostKey ssh.PublicKey
+}
+
+func newSFTPWriter(ctx context.Context, config apitypes.StorageDestinationConfig, creds apitypes.StorageCredentials) (*sftpWriter, error) {
+	var auth []ssh.AuthMethod
+	if creds.PrivateKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(creds.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %v", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if creds.Password != "" {
+		auth = append(auth, ssh.Password(creds.Password))
+	}
+
+	w := &sftpWriter{baseDir: config.Prefix}
+
+	// A pinned key must match exactly. Without one the presented key is accepted and
+	// kept, so the first verification can pin it.
+	hostKeyCallback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		w.hostKey = key
+		return nil
+	}
+	if config.HostKey != "" {
+		pinned, _, _, _, err := ssh.ParseAuthorizedKey([]byte(config.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse host key: %v", err)
+		}
+		hostKeyCallback = ssh.FixedHostKey(pinned)
+	}
+
+	port := config.Port
+	if port == 0 {
+		port = 22
+	}
+	address := net.JoinHostPort(config.Host, strconv.Itoa(port))
+
+	dialer := net.Dialer{Timeout: sftpDialTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", address, err)
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, address, &ssh.ClientConfig{
+		User:            config.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sftpDialTimeout,
+	})
+	if err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("failed to open SSH session with %s: %v", address, err)
+	}
+	w.conn = ssh.NewClient(sshConn, chans, reqs)
+
+	w.client, err = sftp.NewClient(w.conn)
+	if err != nil {
+		w.conn.Close()
+		return nil, fmt.Errorf("failed to start SFTP on %s: %v", address, err)
+	}
+
+	return w, nil
+}
+
+// HostKey returns the server key presented on connect, in authorized_keys format
+func (w *sftpWriter) HostKey() string {
+	if w.hostKey == nil {
+		return ""
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(w.hostKey)))
+}
+
+func (w *sftpWriter) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	remotePath := w.remotePath(key)
+	if err := w.client.MkdirAll(path.Dir(remotePath)); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %v", key, err)
+	}
+
+	// Write to a temporary name first so a half-written file never has the final name
+	tmpPath := remotePath + ".partial"
+	file, err := w.client.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", key, err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %v", key, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", key, err)
+	}
+
+	if err := w.client.PosixRename(tmpPath, remotePath); err != nil {
+		// Not every server supports the posix-rename extension, and plain rename will
+		// not replace an existing file
+		w.client.Remove(remotePath)
+		if err := w.client.Rename(tmpPath, remotePath); err != nil {
+			return fmt.Errorf("failed to rename %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+func (w *sftpWriter) Get(ctx context.Context, key string) ([]byte, error) {
+	file, err := w.client.Open(w.remotePath(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to open %s: %v", key, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", key, err)
+	}
+	return data, nil
+}
+
+func (w *sftpWriter) Delete(ctx context.Context, key string) error {
+	if err := w.client.Remove(w.remotePath(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %v", key, err)
+	}
+	return nil
+}
+
+// remotePath resolves a key below the base directory. Unlike bucket prefixes a leading
+// slash is kept, since it makes the directory absolute rather than relative to the login.
+func (w *sftpWriter) remotePath(key string) string {
+	return path.Join(w.baseDir, key)
+}
+
+func (w *sftpWriter) Close() error {
+	w.client.Close()
+	return w.conn.Close()
+}
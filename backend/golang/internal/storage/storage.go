@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	apitypes "github.com/listbackup/api/internal/types"
+)
+
+// Destination types
+const (
+	TypeS3    = "s3"
+	TypeSFTP  = "sftp"
+	TypeAzure = "azure"
+	TypeGCS   = "gcs"
+)
+
+// ErrNotFound is returned by Get when the object does not exist
+var ErrNotFound = errors.New("object not found")
+
+// Writer stores objects in a storage destination. Keys are slash separated and relative to
+// the destination's prefix. Get and Delete exist so writes can be verified.
+type Writer interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+	Close() error
+}
+
+// HostKeyReporter is implemented by writers whose server identity is pinned on first
+// verification (SFTP)
+type HostKeyReporter interface {
+	HostKey() string
+}
+
+// IsType reports whether t is a supported destination type
+func IsType(t string) bool {
+	switch t {
+	case TypeS3, TypeSFTP, TypeAzure, TypeGCS:
+		return true
+	}
+	return false
+}
+
+// Validate checks that a destination has the settings and credentials its type needs
+func Validate(destType string, config apitypes.StorageDestinationConfig, creds apitypes.StorageCredentials) error {
+	switch destType {
+	case TypeS3:
+		if config.Bucket == "" {
+			return fmt.Errorf("bucket is required")
+		}
+		if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+			return fmt.Errorf("accessKeyId and secretAccessKey are required")
+		}
+		if config.Endpoint != "" && !strings.HasPrefix(config.Endpoint, "https://") {
+			return fmt.Errorf("endpoint must be an https URL")
+		}
+	case TypeSFTP:
+		if config.Host == "" || config.Username == "" {
+			return fmt.Errorf("host and username are required")
+		}
+		if creds.Password == "" && creds.PrivateKey == "" {
+			return fmt.Errorf("password or privateKey is required")
+		}
+	case TypeAzure:
+		if config.StorageAccount == "" || config.Bucket == "" {
+			return fmt.Errorf("storageAccount and bucket (container) are required")
+		}
+		if creds.AccountKey == "" && creds.SASToken == "" {
+			return fmt.Errorf("accountKey or sasToken is required")
+		}
+	case TypeGCS:
+		if config.Bucket == "" {
+			return fmt.Errorf("bucket is required")
+		}
+		if creds.ServiceAccountJSON == "" {
+			return fmt.Errorf("serviceAccountJson is required")
+		}
+	default:
+		return fmt.Errorf("unsupported destination type: %s", destType)
+	}
+	return nil
+}
+
+// NewWriter connects to a destination. SFTP connects immediately; the other types are
+// plain HTTP clients and only fail on first use.
+func NewWriter(ctx context.Context, destination *apitypes.StorageDestination, creds apitypes.StorageCredentials) (Writer, error) {
+	config := destination.Config
+	switch destination.Type {
+	case TypeS3:
+		return newS3Writer(config, creds), nil
+	case TypeSFTP:
+		return newSFTPWriter(ctx, config, creds)
+	case TypeAzure:
+		return newAzureWriter(config, creds), nil
+	case TypeGCS:
+		return newGCSWriter(config, creds)
+	}
+	return nil, fmt.Errorf("unsupported destination type: %s", destination.Type)
+}
+
+// objectKey joins the destination prefix and a key
+func objectKey(prefix, key string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return key
+	}
+	return path.Join(prefix, key)
+}
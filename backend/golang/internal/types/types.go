@@ -51,6 +51,7 @@ type Account struct {
 	UpdatedAt       time.Time       `json:"updatedAt" dynamodbav:"updatedAt"`
 	Settings        AccountSettings `json:"settings" dynamodbav:"settings"`
 	Usage           AccountUsage    `json:"usage" dynamodbav:"usage"`
+	LegalHold       *LegalHold      `json:"legalHold,omitempty" dynamodbav:"legalHold,omitempty"` // Blocks account deletion and pruning of all snapshots
 }
 
 // AccountSettings represents account settings (updated for hierarchical accounts)
@@ -59,11 +60,15 @@ type AccountSettings struct {
 	MaxStorageGB       int                    `json:"maxStorageGB" dynamodbav:"maxStorageGB"`
 	MaxBackupJobs      int                    `json:"maxBackupJobs" dynamodbav:"maxBackupJobs"`
 	RetentionDays      int                    `json:"retentionDays" dynamodbav:"retentionDays"`
+	RetentionPolicy    *RetentionPolicy       `json:"retentionPolicy,omitempty" dynamodbav:"retentionPolicy,omitempty"` // Default GFS rotation for sources
 	EncryptionEnabled  bool                   `json:"encryptionEnabled" dynamodbav:"encryptionEnabled"`
+	EncryptionKeyID    string                 `json:"encryptionKeyId,omitempty" dynamodbav:"encryptionKeyId,omitempty"` // Current key-encryption key (KMS key ARN or local key ID)
+	Compression        string                 `json:"compression,omitempty" dynamodbav:"compression,omitempty"`         // gzip|zstd|none, empty uses gzip
 	TwoFactorRequired  bool                   `json:"twoFactorRequired" dynamodbav:"twoFactorRequired"`
 	AllowSubAccounts   bool                   `json:"allowSubAccounts" dynamodbav:"allowSubAccounts"`
 	MaxSubAccounts     int                    `json:"maxSubAccounts" dynamodbav:"maxSubAccounts"`
 	WhiteLabel         WhiteLabelSettings     `json:"whiteLabel" dynamodbav:"whiteLabel"`
+	Masking            []MaskingRule          `json:"masking,omitempty" dynamodbav:"masking,omitempty"` // Applied to every source of the account
 }
 
 // WhiteLabelSettings represents white label configuration
@@ -77,6 +82,9 @@ type WhiteLabelSettings struct {
 type AccountUsage struct {
 	Sources              int `json:"sources" dynamodbav:"sources"`
 	StorageUsedGB        int `json:"storageUsedGB" dynamodbav:"storageUsedGB"`
+	StorageUsedBytes     int64 `json:"storageUsedBytes" dynamodbav:"storageUsedBytes"` // Stored (compressed) bytes, StorageUsedGB is derived from it
+	StorageLogicalBytes  int64 `json:"storageLogicalBytes" dynamodbav:"storageLogicalBytes"` // Uncompressed size of the same data
+	StorageMeteredAt     *time.Time `json:"storageMeteredAt,omitempty" dynamodbav:"storageMeteredAt,omitempty"` // Last run of the storage metering job
 	BackupJobs           int `json:"backupJobs" dynamodbav:"backupJobs"`
 	MonthlyBackups       int `json:"monthlyBackups" dynamodbav:"monthlyBackups"`
 	MonthlyAPIRequests   int `json:"monthlyAPIRequests" dynamodbav:"monthlyAPIRequests"`
@@ -114,10 +122,20 @@ type SourceGroup struct {
 	Description  string    `json:"description" dynamodbav:"description"`
 	Status       string    `json:"status" dynamodbav:"status"`                 // active|paused|error
 	SourceCount  int       `json:"sourceCount" dynamodbav:"sourceCount"`       // Number of sources in this group
+	Settings     *SourceGroupSettings `json:"settings,omitempty" dynamodbav:"settings,omitempty"` // Shared by members that do not override them
 	CreatedAt    time.Time `json:"createdAt" dynamodbav:"createdAt"`
 	UpdatedAt    time.Time `json:"updatedAt" dynamodbav:"updatedAt"`
 }
 
+// SourceGroupSettings represents the schedule and retention shared by the sources of a group.
+// Empty fields are not shared.
+type SourceGroupSettings struct {
+	Frequency       string           `json:"frequency,omitempty" dynamodbav:"frequency,omitempty"` // daily|weekly|monthly
+	Schedule        string           `json:"schedule,omitempty" dynamodbav:"schedule,omitempty"`   // Cron expression
+	RetentionDays   int              `json:"retentionDays,omitempty" dynamodbav:"retentionDays,omitempty"`
+	RetentionPolicy *RetentionPolicy `json:"retentionPolicy,omitempty" dynamodbav:"retentionPolicy,omitempty"`
+}
+
 // Source represents a user's backup job created from a platform source template
 type Source struct {
 	SourceID         string                `json:"sourceId" dynamodbav:"sourceId"`                 // source:uuid
@@ -135,6 +153,19 @@ type Source struct {
 	NextSyncAt       *time.Time            `json:"nextSyncAt,omitempty" dynamodbav:"nextSyncAt,omitempty"`
 	LastBackupAt     *time.Time            `json:"lastBackupAt,omitempty" dynamodbav:"lastBackupAt,omitempty"`
 	NextBackupAt     *time.Time            `json:"nextBackupAt,omitempty" dynamodbav:"nextBackupAt,omitempty"`
+	LegalHold        *LegalHold            `json:"legalHold,omitempty" dynamodbav:"legalHold,omitempty"` // Blocks source deletion and pruning of its snapshots
+	DestinationID    string                `json:"destinationId,omitempty" dynamodbav:"destinationId,omitempty"` // StorageDestination every snapshot is mirrored to
+	Storage          *StorageUsage         `json:"storage,omitempty" dynamodbav:"storage,omitempty"`             // Measured by the storage metering job
+	PausedByGroup    bool                  `json:"pausedByGroup,omitempty" dynamodbav:"pausedByGroup,omitempty"` // Resumed along with its group
+	TemplateVersion  int                   `json:"templateVersion,omitempty" dynamodbav:"templateVersion,omitempty"` // Platform source version the settings were derived from
+}
+
+// StorageUsage is the measured size of the files of an account, source or snapshot
+type StorageUsage struct {
+	LogicalBytes  int64     `json:"logicalBytes" dynamodbav:"logicalBytes"`   // Uncompressed size
+	PhysicalBytes int64     `json:"physicalBytes" dynamodbav:"physicalBytes"` // Bytes stored in S3
+	Files         int       `json:"files" dynamodbav:"files"`
+	MeteredAt     time.Time `json:"meteredAt" dynamodbav:"meteredAt"`
 }
 
 // SourceSettings represents user's customized settings for a source (overrides platform source defaults)
@@ -144,11 +175,40 @@ type SourceSettings struct {
 	Frequency       string                         `json:"frequency" dynamodbav:"frequency"`       // daily|weekly|monthly
 	Schedule        string                         `json:"schedule" dynamodbav:"schedule"`         // Cron expression
 	RetentionDays   int                           `json:"retentionDays" dynamodbav:"retentionDays"`
+	RetentionPolicy *RetentionPolicy              `json:"retentionPolicy,omitempty" dynamodbav:"retentionPolicy,omitempty"` // Overrides the account GFS rotation
 	IncrementalSync bool                          `json:"incrementalSync" dynamodbav:"incrementalSync"`
 	Notifications   BackupNotificationSettings    `json:"notifications" dynamodbav:"notifications"`
 	CustomParams    map[string]string             `json:"customParams" dynamodbav:"customParams"` // User's custom API parameters
+	Filters         []RecordFilter                `json:"filters,omitempty" dynamodbav:"filters,omitempty"` // Which fetched records are kept
+	Masking         []MaskingRule                 `json:"masking,omitempty" dynamodbav:"masking,omitempty"` // Applied after the account's rules
 }
 
+// RecordFilter keeps or drops fetched records by the value of a field. A record is kept
+// when it matches an include filter, or there are none, and matches no exclude filter.
+type RecordFilter struct {
+	Endpoint string   `json:"endpoint,omitempty" dynamodbav:"endpoint,omitempty"` // Empty applies to every endpoint
+	Field    string   `json:"field" dynamodbav:"field"`                           // Dot path into the record, e.g. tags.name
+	Operator string   `json:"operator" dynamodbav:"operator"`                     // equals|contains|exists
+	Values   []string `json:"values,omitempty" dynamodbav:"values,omitempty"`     // Matching any one is enough
+	Action   string   `json:"action" dynamodbav:"action"`                         // include|exclude
+}
+
+// MaskingRule drops, hashes or redacts a field of every record before it is stored. Field
+// matches a key at any depth of the record, Path one location from its root.
+type MaskingRule struct {
+	Endpoint string `json:"endpoint,omitempty" dynamodbav:"endpoint,omitempty"` // Empty applies to every endpoint
+	Field    string `json:"field,omitempty" dynamodbav:"field,omitempty"`       // Key name, e.g. ssn
+	Path     string `json:"path,omitempty" dynamodbav:"path,omitempty"`         // Dot path into the record, e.g. payment.card.fingerprint
+	Action   string `json:"action" dynamodbav:"action"`                         // drop|hash|redact
+}
+
+// RetentionPolicy represents a grandfather-father-son snapshot rotation. The newest
+// completed snapshot of each of the last N days, weeks and months is kept.
+type RetentionPolicy struct {
+	KeepDaily   int `json:"keepDaily" dynamodbav:"keepDaily"`
+	KeepWeekly  int `json:"keepWeekly" dynamodbav:"keepWeekly"`
+	KeepMonthly int `json:"keepMonthly" dynamodbav:"keepMonthly"`
+}
 
 // BackupNotificationSettings represents notification preferences for backups
 type BackupNotificationSettings struct {
@@ -181,7 +241,9 @@ type Job struct {
 	SubType     string     `json:"subType" dynamodbav:"subType"`       // endpoint name for granular tracking
 	Priority    string     `json:"priority" dynamodbav:"priority"`     // high|medium|low
 	Schedule    string     `json:"schedule" dynamodbav:"schedule"`     // Cron expression
-	Status      string     `json:"status" dynamodbav:"status"`         // pending|running|completed|failed
+	Trigger     string     `json:"trigger,omitempty" dynamodbav:"trigger,omitempty"` // manual|schedule
+	Status      string     `json:"status" dynamodbav:"status"`         // pending|running|paused|completed|failed|dead|cancelled
+	Control     string     `json:"control,omitempty" dynamodbav:"control,omitempty"` // cancel|pause, requested of a running worker
 	Enabled     bool       `json:"enabled" dynamodbav:"enabled"`
 	Config      JobConfig  `json:"config" dynamodbav:"config"`         // Job-specific configuration
 	Progress    JobProgress `json:"progress" dynamodbav:"progress"`     // Execution progress
@@ -191,6 +253,20 @@ type Job struct {
 	CompletedAt *time.Time `json:"completedAt,omitempty" dynamodbav:"completedAt,omitempty"`
 	LastRunAt   *time.Time `json:"lastRunAt,omitempty" dynamodbav:"lastRunAt,omitempty"`
 	NextRunAt   *time.Time `json:"nextRunAt,omitempty" dynamodbav:"nextRunAt,omitempty"`
+	ResumedAt   *time.Time `json:"resumedAt,omitempty" dynamodbav:"resumedAt,omitempty"` // Last resumed or replayed
+	Attempts      int         `json:"attempts" dynamodbav:"attempts"` // Runs started, counting retries
+	Failure       *JobFailure `json:"failure,omitempty" dynamodbav:"failure,omitempty"`
+	NextAttemptAt *time.Time  `json:"nextAttemptAt,omitempty" dynamodbav:"nextAttemptAt,omitempty"` // When a failed job is retried
+	DeadAt        *time.Time  `json:"deadAt,omitempty" dynamodbav:"deadAt,omitempty"`               // When the job ran out of retries
+	Output      *JobOutput `json:"output,omitempty" dynamodbav:"output,omitempty"` // Artifact produced by export jobs
+}
+
+// JobFailure describes why the last run of a job failed
+type JobFailure struct {
+	Class     string    `json:"class" dynamodbav:"class"` // auth|rate_limited|server_error|timeout|network|permanent
+	Message   string    `json:"message" dynamodbav:"message"`
+	Retryable bool      `json:"retryable" dynamodbav:"retryable"`
+	FailedAt  time.Time `json:"failedAt" dynamodbav:"failedAt"`
 }
 
 // JobConfig represents job-specific configuration
@@ -198,9 +274,37 @@ type JobConfig struct {
 	Endpoints       []string               `json:"endpoints" dynamodbav:"endpoints"`             // Endpoints to process
 	RetentionDays   int                    `json:"retentionDays" dynamodbav:"retentionDays"`     // Data retention
 	IncrementalSync bool                   `json:"incrementalSync" dynamodbav:"incrementalSync"` // Incremental vs full backup
-	MaxRetries      int                    `json:"maxRetries" dynamodbav:"maxRetries"`           // Retry attempts
+	MaxRetries      int                    `json:"maxRetries" dynamodbav:"maxRetries"`           // Retries before the job is dead, 3 when unset
 	Timeout         int                    `json:"timeout" dynamodbav:"timeout"`                 // Timeout in seconds
 	Metadata        map[string]interface{} `json:"metadata" dynamodbav:"metadata"`               // Additional job metadata
+	Export          *ExportConfig          `json:"export,omitempty" dynamodbav:"export,omitempty"` // Export jobs only
+	Maintenance     *MaintenanceConfig     `json:"maintenance,omitempty" dynamodbav:"maintenance,omitempty"` // Maintenance jobs only
+}
+
+// ExportConfig configures an export job
+type ExportConfig struct {
+	SnapshotID string `json:"snapshotId,omitempty" dynamodbav:"snapshotId,omitempty"` // Defaults to the source's latest completed snapshot
+	Format     string `json:"format" dynamodbav:"format"`                             // csv|xlsx|parquet|sqlite|postgres
+	Separator  string `json:"separator,omitempty" dynamodbav:"separator,omitempty"`   // Joins nested keys when flattening, default "."
+}
+
+// MaintenanceConfig configures a maintenance job
+type MaintenanceConfig struct {
+	Task       string `json:"task" dynamodbav:"task"`                                 // verify|rehydrate
+	SnapshotID string `json:"snapshotId,omitempty" dynamodbav:"snapshotId,omitempty"` // Defaults to every completed snapshot of the source
+	Sample     int    `json:"sample,omitempty" dynamodbav:"sample,omitempty"`         // Objects checked per snapshot, 0 checks all
+	FileID     string `json:"fileId,omitempty" dynamodbav:"fileId,omitempty"`         // File to restore from the archive tier
+}
+
+// JobOutput records the artifact a job produced. The archive is also a File, so a fresh
+// link can be requested through data/download once DownloadURL expires.
+type JobOutput struct {
+	FileID       string    `json:"fileId" dynamodbav:"fileId"`
+	S3Key        string    `json:"s3Key" dynamodbav:"s3Key"`
+	Format       string    `json:"format" dynamodbav:"format"`
+	Size         int64     `json:"size" dynamodbav:"size"`
+	DownloadURL  string    `json:"downloadUrl" dynamodbav:"downloadUrl"`
+	URLExpiresAt time.Time `json:"urlExpiresAt" dynamodbav:"urlExpiresAt"`
 }
 
 // JobProgress represents job execution progress
@@ -212,7 +316,21 @@ type JobProgress struct {
 	CurrentStep     string  `json:"currentStep" dynamodbav:"currentStep"`
 	RecordsProcessed int64  `json:"recordsProcessed" dynamodbav:"recordsProcessed"`
 	DataSizeBytes   int64   `json:"dataSizeBytes" dynamodbav:"dataSizeBytes"`
+	RecordsFiltered int64   `json:"recordsFiltered,omitempty" dynamodbav:"recordsFiltered,omitempty"` // Fetched but dropped by the source's filters
 	ErrorMessage    string  `json:"errorMessage,omitempty" dynamodbav:"errorMessage,omitempty"`
+	// Checkpoint of an unfinished backup, so a resumed or retried job continues its snapshot
+	SnapshotID      string                        `json:"snapshotId,omitempty" dynamodbav:"snapshotId,omitempty"`
+	Endpoints       map[string]EndpointCheckpoint `json:"endpoints,omitempty" dynamodbav:"endpoints,omitempty"`
+}
+
+// EndpointCheckpoint records how far a backup got through one endpoint
+type EndpointCheckpoint struct {
+	Status    string    `json:"status" dynamodbav:"status"`                   // running|completed
+	Offset    int       `json:"offset" dynamodbav:"offset"`                   // Pagination offset of the next page to fetch
+	Records   int64     `json:"records" dynamodbav:"records"`                 // Records fetched so far
+	Parts     []string  `json:"parts,omitempty" dynamodbav:"parts,omitempty"` // S3 keys of staged pages
+	FileID    string    `json:"fileId,omitempty" dynamodbav:"fileId,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt" dynamodbav:"updatedAt"`
 }
 
 // File represents a backed up file
@@ -221,14 +339,200 @@ type File struct {
 	AccountID   string    `json:"accountId" dynamodbav:"accountId"`
 	SourceID    string    `json:"sourceId" dynamodbav:"sourceId"`
 	JobID       string    `json:"jobId" dynamodbav:"jobId"`
+	SnapshotID  string    `json:"snapshotId,omitempty" dynamodbav:"snapshotId,omitempty"` // References Snapshot
+	Endpoint    string    `json:"endpoint,omitempty" dynamodbav:"endpoint,omitempty"`     // Platform endpoint this file was fetched from
 	Path        string    `json:"path" dynamodbav:"path"`
 	Size        int64     `json:"size" dynamodbav:"size"`
 	ContentType string    `json:"contentType" dynamodbav:"contentType"`
 	S3Key       string    `json:"s3Key" dynamodbav:"s3Key"`
+	Encrypted   bool      `json:"encrypted" dynamodbav:"encrypted"` // Object is sealed with the snapshot data key
+	Codec       string    `json:"codec,omitempty" dynamodbav:"codec,omitempty"`           // gzip|zstd|none, empty for files written before compression
+	StoredSize  int64     `json:"storedSize,omitempty" dynamodbav:"storedSize,omitempty"` // Bytes in S3 after compression and encryption
+	StorageTier string    `json:"storageTier,omitempty" dynamodbav:"storageTier,omitempty"` // standard|archive, empty is standard
+	ArchivedAt  *time.Time `json:"archivedAt,omitempty" dynamodbav:"archivedAt,omitempty"`
+	Rehydration *FileRehydration `json:"rehydration,omitempty" dynamodbav:"rehydration,omitempty"` // Latest restore from the archive tier
 	CreatedAt   time.Time `json:"createdAt" dynamodbav:"createdAt"`
 	ExpiresAt   *time.Time `json:"expiresAt,omitempty" dynamodbav:"expiresAt,omitempty"`
 }
 
+// FileRehydration tracks a temporary restore of an archived file so it can be downloaded
+type FileRehydration struct {
+	JobID       string     `json:"jobId" dynamodbav:"jobId"`
+	RequestedBy string     `json:"requestedBy" dynamodbav:"requestedBy"` // User notified when the file is ready
+	Status      string     `json:"status" dynamodbav:"status"`           // requested|restoring|ready
+	RequestedAt time.Time  `json:"requestedAt" dynamodbav:"requestedAt"`
+	ReadyAt     *time.Time `json:"readyAt,omitempty" dynamodbav:"readyAt,omitempty"`
+	ReadyUntil  *time.Time `json:"readyUntil,omitempty" dynamodbav:"readyUntil,omitempty"` // When the restored copy expires
+}
+
+// Snapshot represents a single backup run of a source and the objects it produced
+type Snapshot struct {
+	SnapshotID  string           `json:"snapshotId" dynamodbav:"snapshotId"` // snapshot:uuid
+	AccountID   string           `json:"accountId" dynamodbav:"accountId"`
+	SourceID    string           `json:"sourceId" dynamodbav:"sourceId"`
+	JobID       string           `json:"jobId" dynamodbav:"jobId"`
+	Status      string           `json:"status" dynamodbav:"status"` // running|paused|completed|failed|cancelled
+	Manifest    SnapshotManifest `json:"manifest" dynamodbav:"manifest"`
+	CreatedAt   time.Time        `json:"createdAt" dynamodbav:"createdAt"`
+	UpdatedAt   time.Time        `json:"updatedAt" dynamodbav:"updatedAt"`
+	CompletedAt *time.Time       `json:"completedAt,omitempty" dynamodbav:"completedAt,omitempty"`
+	LegalHold   *LegalHold       `json:"legalHold,omitempty" dynamodbav:"legalHold,omitempty"` // Blocks pruning of this snapshot
+	Mirror      *SnapshotMirror  `json:"mirror,omitempty" dynamodbav:"mirror,omitempty"`       // Copy in the source's storage destination
+	Integrity   *SnapshotIntegrity `json:"integrity,omitempty" dynamodbav:"integrity,omitempty"` // Result of the latest integrity check
+	Storage     *StorageUsage      `json:"storage,omitempty" dynamodbav:"storage,omitempty"`     // Measured by the storage metering job
+	ArchivedAt  *time.Time         `json:"archivedAt,omitempty" dynamodbav:"archivedAt,omitempty"` // Objects were moved to the archive tier
+}
+
+// SnapshotManifest describes the contents of a snapshot
+type SnapshotManifest struct {
+	Objects      []SnapshotObject    `json:"objects" dynamodbav:"objects"`
+	TotalRecords int64               `json:"totalRecords" dynamodbav:"totalRecords"`
+	TotalBytes   int64               `json:"totalBytes" dynamodbav:"totalBytes"`
+	StoredBytes  int64               `json:"storedBytes,omitempty" dynamodbav:"storedBytes,omitempty"` // TotalBytes after compression and encryption
+	Encryption   *SnapshotEncryption `json:"encryption,omitempty" dynamodbav:"encryption,omitempty"`
+	Masking      []MaskingRule       `json:"masking,omitempty" dynamodbav:"masking,omitempty"` // Rules the records were masked with before they were stored
+}
+
+// SnapshotObject represents one stored object within a snapshot
+type SnapshotObject struct {
+	Endpoint string `json:"endpoint" dynamodbav:"endpoint"`
+	FileID   string `json:"fileId" dynamodbav:"fileId"`
+	S3Key    string `json:"s3Key" dynamodbav:"s3Key"`
+	Records  int64  `json:"records" dynamodbav:"records"`
+	Size     int64  `json:"size" dynamodbav:"size"`
+	SHA256   string `json:"sha256,omitempty" dynamodbav:"sha256,omitempty"` // Hex digest of the plaintext data
+	Codec      string `json:"codec,omitempty" dynamodbav:"codec,omitempty"`
+	StoredSize int64  `json:"storedSize,omitempty" dynamodbav:"storedSize,omitempty"`
+}
+
+// SnapshotEncryption records how a snapshot's data key is wrapped
+type SnapshotEncryption struct {
+	Algorithm      string     `json:"algorithm" dynamodbav:"algorithm"`           // AES-256-GCM
+	KeyProvider    string     `json:"keyProvider" dynamodbav:"keyProvider"`       // local|kms
+	KeyID          string     `json:"keyId" dynamodbav:"keyId"`                   // Key-encryption key that wraps the data key
+	WrappedDataKey string     `json:"wrappedDataKey" dynamodbav:"wrappedDataKey"` // Base64 encoded
+	RotatedAt      *time.Time `json:"rotatedAt,omitempty" dynamodbav:"rotatedAt,omitempty"`
+}
+
+// SnapshotMirror records the copy of a snapshot written to a storage destination
+type SnapshotMirror struct {
+	DestinationID string     `json:"destinationId" dynamodbav:"destinationId"`
+	Status        string     `json:"status" dynamodbav:"status"` // verified|failed
+	Prefix        string     `json:"prefix" dynamodbav:"prefix"` // Key prefix of the snapshot in the destination
+	Objects       int        `json:"objects" dynamodbav:"objects"`
+	Bytes         int64      `json:"bytes" dynamodbav:"bytes"`
+	Error         string     `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	MirroredAt    time.Time  `json:"mirroredAt" dynamodbav:"mirroredAt"`
+	VerifiedAt    *time.Time `json:"verifiedAt,omitempty" dynamodbav:"verifiedAt,omitempty"`
+}
+
+// SnapshotIntegrity records the outcome of re-reading a snapshot's stored objects
+type SnapshotIntegrity struct {
+	Status         string             `json:"status" dynamodbav:"status"` // verified|corrupted
+	ObjectsChecked int                `json:"objectsChecked" dynamodbav:"objectsChecked"`
+	ObjectsTotal   int                `json:"objectsTotal" dynamodbav:"objectsTotal"`
+	Problems       []IntegrityProblem `json:"problems,omitempty" dynamodbav:"problems,omitempty"`
+	CheckedAt      time.Time          `json:"checkedAt" dynamodbav:"checkedAt"`
+	CorruptedAt    *time.Time         `json:"corruptedAt,omitempty" dynamodbav:"corruptedAt,omitempty"` // First check that found a problem
+}
+
+// IntegrityProblem describes one object that failed an integrity check
+type IntegrityProblem struct {
+	Endpoint string `json:"endpoint" dynamodbav:"endpoint"`
+	FileID   string `json:"fileId" dynamodbav:"fileId"`
+	Problem  string `json:"problem" dynamodbav:"problem"` // missing|unreadable|checksum_mismatch|unparseable|record_count_mismatch
+	Detail   string `json:"detail,omitempty" dynamodbav:"detail,omitempty"`
+}
+
+// LegalHold represents a legal hold on an account, source or snapshot. Released holds are
+// kept with Active false so the last placement and release stay on the record.
+type LegalHold struct {
+	Active        bool       `json:"active" dynamodbav:"active"`
+	Reason        string     `json:"reason" dynamodbav:"reason"`
+	PlacedBy      string     `json:"placedBy" dynamodbav:"placedBy"`
+	PlacedAt      time.Time  `json:"placedAt" dynamodbav:"placedAt"`
+	ReleaseReason string     `json:"releaseReason,omitempty" dynamodbav:"releaseReason,omitempty"`
+	ReleasedBy    string     `json:"releasedBy,omitempty" dynamodbav:"releasedBy,omitempty"`
+	ReleasedAt    *time.Time `json:"releasedAt,omitempty" dynamodbav:"releasedAt,omitempty"`
+}
+
+// SearchIndexEntry points from one searchable value to the record it was found in. The
+// term is a hash of the account, field and normalized value, so values are not stored.
+type SearchIndexEntry struct {
+	Term        string    `json:"term" dynamodbav:"term"` // sha256(accountId|field|value)
+	Ref         string    `json:"ref" dynamodbav:"ref"`   // snapshotId#fileId#recordIndex
+	AccountID   string    `json:"accountId" dynamodbav:"accountId"`
+	SourceID    string    `json:"sourceId" dynamodbav:"sourceId"`
+	SnapshotID  string    `json:"snapshotId" dynamodbav:"snapshotId"`
+	FileID      string    `json:"fileId" dynamodbav:"fileId"`
+	Endpoint    string    `json:"endpoint" dynamodbav:"endpoint"`
+	Field       string    `json:"field" dynamodbav:"field"` // id|email|name
+	RecordID    string    `json:"recordId,omitempty" dynamodbav:"recordId,omitempty"`
+	RecordIndex int       `json:"recordIndex" dynamodbav:"recordIndex"`
+	CreatedAt   time.Time `json:"createdAt" dynamodbav:"createdAt"`
+}
+
+// StorageDestination is customer-owned storage that snapshots are mirrored to. Credentials
+// are kept in Secrets Manager under SecretName, never in the table.
+type StorageDestination struct {
+	DestinationID  string                   `json:"destinationId" dynamodbav:"destinationId"` // destination:uuid
+	AccountID      string                   `json:"accountId" dynamodbav:"accountId"`
+	CreatedBy      string                   `json:"createdBy" dynamodbav:"createdBy"`
+	Name           string                   `json:"name" dynamodbav:"name"`
+	Type           string                   `json:"type" dynamodbav:"type"` // s3|sftp|azure|gcs
+	Config         StorageDestinationConfig `json:"config" dynamodbav:"config"`
+	SecretName     string                   `json:"-" dynamodbav:"secretName"`
+	Status         string                   `json:"status" dynamodbav:"status"` // pending|verified|failed
+	LastError      string                   `json:"lastError,omitempty" dynamodbav:"lastError,omitempty"`
+	LastVerifiedAt *time.Time               `json:"lastVerifiedAt,omitempty" dynamodbav:"lastVerifiedAt,omitempty"`
+	CreatedAt      time.Time                `json:"createdAt" dynamodbav:"createdAt"`
+	UpdatedAt      time.Time                `json:"updatedAt" dynamodbav:"updatedAt"`
+}
+
+// StorageDestinationConfig holds the non-secret settings of a storage destination. Which
+// fields apply depends on the destination type.
+type StorageDestinationConfig struct {
+	Bucket         string `json:"bucket,omitempty" dynamodbav:"bucket,omitempty"`                 // S3/GCS bucket or Azure container
+	Prefix         string `json:"prefix,omitempty" dynamodbav:"prefix,omitempty"`                 // Key prefix, or base directory for SFTP
+	Endpoint       string `json:"endpoint,omitempty" dynamodbav:"endpoint,omitempty"`             // S3-compatible endpoint URL (MinIO, Wasabi, R2)
+	Region         string `json:"region,omitempty" dynamodbav:"region,omitempty"`                 // S3 signing region
+	PathStyle      bool   `json:"pathStyle,omitempty" dynamodbav:"pathStyle,omitempty"`           // S3 path-style addressing, needed by most MinIO setups
+	StorageAccount string `json:"storageAccount,omitempty" dynamodbav:"storageAccount,omitempty"` // Azure
+	Host           string `json:"host,omitempty" dynamodbav:"host,omitempty"`                     // SFTP
+	Port           int    `json:"port,omitempty" dynamodbav:"port,omitempty"`                     // SFTP, defaults to 22
+	Username       string `json:"username,omitempty" dynamodbav:"username,omitempty"`             // SFTP
+	HostKey        string `json:"hostKey,omitempty" dynamodbav:"hostKey,omitempty"`               // SFTP server key, authorized_keys format; pinned on first verification
+}
+
+// StorageCredentials are the secrets needed to write to a storage destination. They are
+// only accepted on create and stored in Secrets Manager.
+type StorageCredentials struct {
+	AccessKeyID        string `json:"accessKeyId,omitempty"`        // S3
+	SecretAccessKey    string `json:"secretAccessKey,omitempty"`    // S3
+	Password           string `json:"password,omitempty"`           // SFTP
+	PrivateKey         string `json:"privateKey,omitempty"`         // SFTP, PEM encoded
+	AccountKey         string `json:"accountKey,omitempty"`         // Azure shared key
+	SASToken           string `json:"sasToken,omitempty"`           // Azure, instead of the account key
+	ServiceAccountJSON string `json:"serviceAccountJson,omitempty"` // GCS
+}
+
+// DownloadLink is a shareable link to a backed up file. Only a hash of the link token is
+// stored, so a link cannot be rebuilt from the table.
+type DownloadLink struct {
+	LinkID     string     `json:"linkId" dynamodbav:"linkId"` // sha256 of the link token
+	AccountID  string     `json:"accountId" dynamodbav:"accountId"`
+	FileID     string     `json:"fileId" dynamodbav:"fileId"`
+	CreatedBy  string     `json:"createdBy" dynamodbav:"createdBy"`
+	CreatedAt  time.Time  `json:"createdAt" dynamodbav:"createdAt"`
+	ExpiresAt  time.Time  `json:"expiresAt" dynamodbav:"expiresAt"`
+	SingleUse  bool       `json:"singleUse" dynamodbav:"singleUse"`
+	AllowedIPs []string   `json:"allowedIps,omitempty" dynamodbav:"allowedIps,omitempty"` // IP addresses or CIDR ranges
+	UseCount   int        `json:"useCount" dynamodbav:"useCount"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" dynamodbav:"lastUsedAt,omitempty"`
+	LastUsedIP string     `json:"lastUsedIp,omitempty" dynamodbav:"lastUsedIp,omitempty"`
+	TTL        int64      `json:"ttl" dynamodbav:"ttl"`
+}
+
 // APIResponse represents a standard API response
 type APIResponse struct {
 	Success bool        `json:"success"`
@@ -313,11 +617,20 @@ type PlatformSource struct {
 	Status           string                          `json:"status" dynamodbav:"status"`                     // active|deprecated|beta
 	DefaultSettings  PlatformSourceDefaults          `json:"defaultSettings" dynamodbav:"defaultSettings"`   // Default backup configuration
 	Endpoints        map[string]PlatformEndpoint     `json:"endpoints" dynamodbav:"endpoints"`               // API endpoints this source uses
-	Dependencies     []string                        `json:"dependencies" dynamodbav:"dependencies"`         // Other platform sources needed
+	Dependencies     []string                        `json:"dependencies" dynamodbav:"dependencies"`         // Other platform sources needed; not used to order backups
+	Version          int                             `json:"version,omitempty" dynamodbav:"version,omitempty"` // Raised each time the template changes
 	CreatedAt        time.Time                       `json:"createdAt" dynamodbav:"createdAt"`
 	UpdatedAt        time.Time                       `json:"updatedAt" dynamodbav:"updatedAt"`
 }
 
+// PlatformSourceVersion is a published revision of a platform source template
+type PlatformSourceVersion struct {
+	PlatformSourceID string         `json:"platformSourceId" dynamodbav:"platformSourceId"`
+	Version          int            `json:"version" dynamodbav:"version"` // 0 is the template as it was before versioning
+	Template         PlatformSource `json:"template" dynamodbav:"template"`
+	PublishedAt      time.Time      `json:"publishedAt" dynamodbav:"publishedAt"`
+}
+
 // PlatformSourceDefaults represents default settings for a platform source template
 type PlatformSourceDefaults struct {
 	Enabled         bool                           `json:"enabled" dynamodbav:"enabled"`
@@ -337,9 +650,11 @@ type PlatformConnection struct {
 	PlatformID      string                 `json:"platformId" dynamodbav:"platformId"`           // References Platform
 	Name            string                 `json:"name" dynamodbav:"name"`                       // User-defined name
 	Status          string                 `json:"status" dynamodbav:"status"`                   // active|expired|error
+	StatusReason    string                 `json:"statusReason,omitempty" dynamodbav:"statusReason,omitempty"` // Why the connection is expired or in error
 	AuthType        string                 `json:"authType" dynamodbav:"authType"`               // oauth|apikey|basic
 	Credentials     map[string]interface{} `json:"credentials" dynamodbav:"credentials"`         // Encrypted auth data
 	LastConnected   *time.Time             `json:"lastConnected,omitempty" dynamodbav:"lastConnected,omitempty"`
+	LastCheckedAt   *time.Time             `json:"lastCheckedAt,omitempty" dynamodbav:"lastCheckedAt,omitempty"` // Latest health check
 	CreatedAt       time.Time              `json:"createdAt" dynamodbav:"createdAt"`
 	UpdatedAt       time.Time              `json:"updatedAt" dynamodbav:"updatedAt"`
 	ExpiresAt       *time.Time             `json:"expiresAt,omitempty" dynamodbav:"expiresAt,omitempty"` // For OAuth tokens
@@ -629,6 +944,7 @@ type PlanLimits struct {
 	MaxBackupsPerMonth   int `json:"maxBackupsPerMonth" dynamodbav:"maxBackupsPerMonth"`
 	MaxRetentionDays     int `json:"maxRetentionDays" dynamodbav:"maxRetentionDays"`
 	MaxSyncFrequency     int `json:"maxSyncFrequency" dynamodbav:"maxSyncFrequency"` // minutes
+	ArchiveAfterDays     int `json:"archiveAfterDays" dynamodbav:"archiveAfterDays"` // Snapshots older than this move to the archive tier, 0 never
 }
 
 // Invoice represents a billing invoice
@@ -693,6 +1009,7 @@ type UsageRecord struct {
 	SubscriptionID string    `json:"subscriptionId" dynamodbav:"subscriptionId"`
 	MetricType     string    `json:"metricType" dynamodbav:"metricType"`     // api_calls|storage_gb|backups|sources
 	Quantity       int64     `json:"quantity" dynamodbav:"quantity"`
+	Amount         float64   `json:"amount,omitempty" dynamodbav:"amount,omitempty"` // Fractional usage; GB-hours for storage_gb, where Quantity is the whole GB stored
 	Timestamp      time.Time `json:"timestamp" dynamodbav:"timestamp"`
 	BillingPeriod  string    `json:"billingPeriod" dynamodbav:"billingPeriod"` // 2024-01 format
 	CreatedAt      time.Time `json:"createdAt" dynamodbav:"createdAt"`
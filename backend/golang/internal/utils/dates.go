@@ -0,0 +1,20 @@
+package utils
+
+import "time"
+
+// ParseDate parses a query parameter given as RFC 3339 or as a plain date. A plain date
+// means the start of that day, or its last instant when endOfDay is set.
+func ParseDate(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
@@ -10,10 +10,14 @@ import (
 const (
 	StatusOK                  = 200
 	StatusCreated             = 201
+	StatusAccepted            = 202
+	StatusFound               = 302
 	StatusBadRequest          = 400
 	StatusUnauthorized        = 401
 	StatusForbidden           = 403
 	StatusNotFound            = 404
+	StatusConflict            = 409
+	StatusGone                = 410
 	StatusInternalServerError = 500
 )
 
@@ -41,6 +45,21 @@ func Success(data interface{}) events.APIGatewayProxyResponse {
 	}
 }
 
+// Accepted reports work that was started but has not finished yet
+func Accepted(data interface{}) events.APIGatewayProxyResponse {
+	response := types.APIResponse{
+		Success: true,
+		Data:    data,
+	}
+
+	body, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: StatusAccepted,
+		Headers:    GetCORSHeaders(),
+		Body:       string(body),
+	}
+}
+
 func Created(data interface{}) events.APIGatewayProxyResponse {
 	response := types.APIResponse{
 		Success: true,
@@ -85,6 +104,14 @@ func NotFound(message string) events.APIGatewayProxyResponse {
 	return Error(StatusNotFound, message)
 }
 
+func Conflict(message string) events.APIGatewayProxyResponse {
+	return Error(StatusConflict, message)
+}
+
+func Gone(message string) events.APIGatewayProxyResponse {
+	return Error(StatusGone, message)
+}
+
 func InternalServerError(message string) events.APIGatewayProxyResponse {
 	return Error(StatusInternalServerError, message)
 }
@@ -115,6 +142,18 @@ func Options() events.APIGatewayProxyResponse {
 	}
 }
 
+// Redirect sends the client on to another URL
+func Redirect(location string) events.APIGatewayProxyResponse {
+	return events.APIGatewayProxyResponse{
+		StatusCode: StatusFound,
+		Headers: map[string]string{
+			"Location":                    location,
+			"Access-Control-Allow-Origin": "*",
+			"Cache-Control":               "no-store",
+		},
+	}
+}
+
 // CORS handles CORS preflight requests
 func CORS() events.APIGatewayProxyResponse {
 	return Options()
@@ -220,6 +220,7 @@ func getDefaultBillingPlans() []types.BillingPlan {
 				MaxAPICallsPerMonth:  -1, // Unlimited
 				MaxBackupsPerMonth:   -1, // Unlimited
 				MaxRetentionDays:     365,
+				ArchiveAfterDays:     90, // Shorter retention prunes before Glacier pays off
 				MaxSyncFrequency:     5, // 5 minutes
 			},
 			TrialDays: 30,
@@ -21,6 +21,8 @@ HANDLERS=(
     "create-sub-account"
     "list-hierarchy"
     "switch-context"
+    "rotate-encryption-key"
+    "legal-hold"
 )
 
 for handler in "${HANDLERS[@]}"; do